@@ -0,0 +1,171 @@
+// Package audit records full request and response bodies for auditing.
+// Entries are redacted and written by a background goroutine so recording
+// never blocks request handling.
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"ai-gateway/logger"
+	"ai-gateway/metrics"
+)
+
+// DefaultBufferSize is the number of entries queued before new ones are dropped
+const DefaultBufferSize = 1024
+
+// redacted replaces the values of sensitive headers and body fields
+const redacted = "[REDACTED]"
+
+// alwaysRedactedHeaders carry credentials and are never written to the audit log
+var alwaysRedactedHeaders = []string{"Authorization", "X-Api-Key", "Proxy-Authorization", "Cookie"}
+
+// Entry is one audited request
+type Entry struct {
+	Time       time.Time         `json:"time"`
+	RequestID  string            `json:"request_id,omitempty"`
+	Path       string            `json:"path"`
+	Model      string            `json:"model,omitempty"`
+	Status     int               `json:"status"`
+	DurationMs int64             `json:"duration_ms"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Request    json.RawMessage   `json:"request,omitempty"`
+	Response   json.RawMessage   `json:"response,omitempty"`
+	Error      string            `json:"error,omitempty"`
+
+	// header holds the raw request headers until the entry is redacted
+	header http.Header
+}
+
+// Sink stores audit entries durably
+type Sink interface {
+	Write(entry Entry) error
+	Close() error
+}
+
+// Logger queues entries for a sink and writes them in the background
+type Logger struct {
+	sink         Sink
+	logger       *logger.Logger
+	redactFields map[string]bool // lowercased header and body field names
+	entries      chan Entry
+	done         chan struct{}
+	closeOnce    sync.Once
+}
+
+// NewLogger starts a background writer for the sink. Values of the named
+// headers and JSON body fields (matched case-insensitively at any depth) are
+// redacted in addition to the credential headers, which always are.
+func NewLogger(sink Sink, redactFields []string, bufferSize int, logger *logger.Logger) *Logger {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	fields := make(map[string]bool, len(redactFields)+len(alwaysRedactedHeaders))
+	for _, name := range alwaysRedactedHeaders {
+		fields[strings.ToLower(name)] = true
+	}
+	for _, name := range redactFields {
+		fields[strings.ToLower(name)] = true
+	}
+	l := &Logger{
+		sink:         sink,
+		logger:       logger,
+		redactFields: fields,
+		entries:      make(chan Entry, bufferSize),
+		done:         make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// Record queues the entry with the request headers it was made with. When the
+// queue is full the entry is dropped and counted rather than delaying the caller.
+func (l *Logger) Record(entry Entry, header http.Header) {
+	entry.header = header
+	select {
+	case l.entries <- entry:
+	default:
+		metrics.AuditEntriesDroppedTotal.Inc("buffer_full")
+	}
+}
+
+// Close stops accepting entries, writes the queued ones and closes the sink.
+// Record must not be called after Close.
+func (l *Logger) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.entries)
+		<-l.done
+		err = l.sink.Close()
+	})
+	return err
+}
+
+func (l *Logger) run() {
+	defer close(l.done)
+	for entry := range l.entries {
+		if err := l.sink.Write(l.redact(entry)); err != nil {
+			metrics.AuditEntriesDroppedTotal.Inc("write_failed")
+			l.logger.Error("Failed to write audit entry", err, map[string]interface{}{
+				"request_id": entry.RequestID,
+			})
+		}
+	}
+}
+
+// redact fills in the entry's headers and masks sensitive values in its bodies
+func (l *Logger) redact(entry Entry) Entry {
+	if len(entry.header) > 0 {
+		entry.Headers = make(map[string]string, len(entry.header))
+		for name, values := range entry.header {
+			if l.redactFields[strings.ToLower(name)] {
+				entry.Headers[name] = redacted
+				continue
+			}
+			entry.Headers[name] = strings.Join(values, ", ")
+		}
+	}
+	entry.header = nil
+	entry.Request = l.redactBody(entry.Request)
+	entry.Response = l.redactBody(entry.Response)
+	return entry
+}
+
+// redactBody masks configured fields in a JSON body. Bodies that aren't JSON
+// are stored as a JSON string so the entry stays valid.
+func (l *Logger) redactBody(body json.RawMessage) json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		quoted, _ := json.Marshal(string(body))
+		return quoted
+	}
+	out, err := json.Marshal(l.redactValue(v))
+	if err != nil {
+		return body
+	}
+	return out
+}
+
+func (l *Logger) redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if l.redactFields[strings.ToLower(k)] {
+				v[k] = redacted
+				continue
+			}
+			v[k] = l.redactValue(child)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = l.redactValue(child)
+		}
+	}
+	return v
+}
@@ -0,0 +1,115 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+
+	"ai-gateway/logger"
+	"ai-gateway/metrics"
+)
+
+// memorySink keeps written entries for inspection
+type memorySink struct {
+	mu      sync.Mutex
+	entries []Entry
+	block   chan struct{} // when set, Write waits for it to be closed
+	err     error
+}
+
+func (s *memorySink) Write(entry Entry) error {
+	if s.block != nil {
+		<-s.block
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, entry)
+	return s.err
+}
+
+func (s *memorySink) Close() error { return nil }
+
+func TestLogger_Redacts(t *testing.T) {
+	sink := &memorySink{}
+	l := NewLogger(sink, []string{"user", "X-Customer-Secret"}, 0, logger.NewLogger())
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer secret-token")
+	header.Set("X-Api-Key", "gateway-key")
+	header.Set("X-Customer-Secret", "abc")
+	header.Set("Content-Type", "application/json")
+	l.Record(Entry{
+		RequestID: "req-1",
+		Status:    200,
+		Request:   json.RawMessage(`{"model":"gpt-4","user":"alice","messages":[{"role":"user","content":"Hello"}],"metadata":{"User":"bob"}}`),
+		Response:  json.RawMessage(`not json`),
+	}, header)
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if len(sink.entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(sink.entries))
+	}
+	entry := sink.entries[0]
+	for _, name := range []string{"Authorization", "X-Api-Key", "X-Customer-Secret"} {
+		if entry.Headers[name] != redacted {
+			t.Errorf("Expected header %s to be redacted, got %q", name, entry.Headers[name])
+		}
+	}
+	if entry.Headers["Content-Type"] != "application/json" {
+		t.Errorf("Expected Content-Type to be kept, got %q", entry.Headers["Content-Type"])
+	}
+
+	var request struct {
+		User     string            `json:"user"`
+		Messages []json.RawMessage `json:"messages"`
+		Metadata map[string]string `json:"metadata"`
+	}
+	if err := json.Unmarshal(entry.Request, &request); err != nil {
+		t.Fatalf("Failed to unmarshal audited request: %v", err)
+	}
+	if request.User != redacted || request.Metadata["User"] != redacted {
+		t.Errorf("Expected user fields to be redacted, got %s", entry.Request)
+	}
+	// The role "user" is a value, not a field name, so messages are untouched
+	if string(request.Messages[0]) != `{"content":"Hello","role":"user"}` {
+		t.Errorf("Expected message to be kept in full, got %s", request.Messages[0])
+	}
+	if string(entry.Response) != `"not json"` {
+		t.Errorf("Expected a non-JSON body to be stored as a string, got %s", entry.Response)
+	}
+}
+
+func TestLogger_DropsWhenBufferFull(t *testing.T) {
+	sink := &memorySink{block: make(chan struct{})}
+	l := NewLogger(sink, nil, 1, logger.NewLogger())
+
+	before := metrics.AuditEntriesDroppedTotal.Value("buffer_full")
+	// The writer holds one entry and the buffer one more; the rest are dropped
+	for i := 0; i < 5; i++ {
+		l.Record(Entry{Status: 200}, nil)
+	}
+	close(sink.block)
+	l.Close()
+
+	dropped := metrics.AuditEntriesDroppedTotal.Value("buffer_full") - before
+	if written := len(sink.entries); written+int(dropped) != 5 || dropped < 3 {
+		t.Errorf("Expected at least 3 of 5 entries dropped, got %d written and %v dropped", written, dropped)
+	}
+}
+
+func TestLogger_CountsWriteFailures(t *testing.T) {
+	sink := &memorySink{err: errors.New("disk full")}
+	l := NewLogger(sink, nil, 0, logger.NewLogger())
+
+	before := metrics.AuditEntriesDroppedTotal.Value("write_failed")
+	l.Record(Entry{Status: 200}, nil)
+	l.Close()
+
+	if got := metrics.AuditEntriesDroppedTotal.Value("write_failed") - before; got != 1 {
+		t.Errorf("Expected 1 failed write, got %v", got)
+	}
+}
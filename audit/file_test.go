@@ -0,0 +1,75 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+	n := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Errorf("Line %d of %s is not a JSON entry: %v", n+1, path, err)
+		}
+		n++
+	}
+	return n
+}
+
+func TestFileSink_Rotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	entry := Entry{RequestID: "req", Status: 200, Request: json.RawMessage(`{"model":"gpt-4"}`)}
+	line, _ := json.Marshal(entry)
+
+	// Room for two entries per file, keeping one backup
+	sink, err := NewFileSink(path, int64(2*(len(line)+1)), 1)
+	if err != nil {
+		t.Fatalf("NewFileSink() error = %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := sink.Write(entry); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if got := countLines(t, path); got != 1 {
+		t.Errorf("Expected 1 entry in the current file, got %d", got)
+	}
+	if got := countLines(t, path+".1"); got != 2 {
+		t.Errorf("Expected 2 entries in the backup, got %d", got)
+	}
+	if _, err := os.Stat(path + ".2"); !os.IsNotExist(err) {
+		t.Errorf("Expected only one backup to be kept, stat error = %v", err)
+	}
+}
+
+func TestFileSink_AppendsToExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	for i := 0; i < 2; i++ {
+		sink, err := NewFileSink(path, 0, 0)
+		if err != nil {
+			t.Fatalf("NewFileSink() error = %v", err)
+		}
+		if err := sink.Write(Entry{Status: 200}); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+		sink.Close()
+	}
+	if got := countLines(t, path); got != 2 {
+		t.Errorf("Expected 2 entries, got %d", got)
+	}
+}
@@ -1,7 +1,11 @@
 package config
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -13,42 +17,43 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
-// LoadConfig loads configuration from YAML file with environment variable substitution
+// LoadConfig loads configuration from a YAML file, or a JSON file when the
+// name ends in .json, with environment variable substitution. AIGW_CONFIG_B64
+// takes precedence over the file when set.
 func LoadConfig(filename string) (*Config, error) {
-	// Try to load from current directory first, then from /etc/ai-gateway/
-	paths := []string{
-		filename,
-		filepath.Join("/etc/ai-gateway", filename),
-	}
-
-	var data []byte
-	var err error
-
-	for _, path := range paths {
-		data, err = os.ReadFile(path)
-		if err == nil {
-			break
-		}
-	}
-
+	data, isJSON, err := readConfig(filename)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file from any location: %w", err)
+		return nil, err
 	}
 
 	rawConfig := string(data)
 	envVars := findEnvVars(rawConfig)
 
-	// Expand environment variables
-	expanded, err := expandEnvVars(rawConfig)
+	// Expand environment variables; in JSON they are escaped so a value
+	// containing quotes or backslashes cannot break out of its string
+	var escape func(string) string
+	if isJSON {
+		escape = jsonEscape
+	}
+	expanded, err := expandEnvVars(rawConfig, escape)
 	if err != nil {
 		return nil, err
 	}
 
 	var config Config
-	if err := yaml.Unmarshal([]byte(expanded), &config); err != nil {
+	if isJSON {
+		err = json.Unmarshal([]byte(expanded), &config)
+	} else {
+		err = yaml.Unmarshal([]byte(expanded), &config)
+	}
+	if err != nil {
 		return nil, fmt.Errorf("failed to parse config: %w", err)
 	}
 
+	if err := readKeyFiles(&config); err != nil {
+		return nil, err
+	}
+
 	// Set defaults
 	if config.Port == 0 {
 		if port := os.Getenv("PORT"); port != "" {
@@ -66,6 +71,11 @@ func LoadConfig(filename string) (*Config, error) {
 		config.DefaultTimeout = "30s"
 	}
 
+	// Set default request body limit if not specified
+	if config.MaxRequestBytes == 0 {
+		config.MaxRequestBytes = DefaultMaxRequestBytes
+	}
+
 	// Validate configuration
 	if err := validateConfig(&config); err != nil {
 		return nil, fmt.Errorf("invalid configuration: %w", err)
@@ -76,15 +86,165 @@ func LoadConfig(filename string) (*Config, error) {
 	return &config, nil
 }
 
-// expandEnvVars replaces ${VAR_NAME} with environment variable values
-func expandEnvVars(s string) (string, error) {
+// Warnings describes configuration that is valid but likely a mistake
+func (c *Config) Warnings() []string {
+	warnings := append(c.WriteTimeoutWarnings(), c.DisabledProviderWarnings()...)
+	warnings = append(warnings, c.InsecureProviderWarnings()...)
+	return append(warnings, c.BudgetWarnings()...)
+}
+
+// BudgetWarnings reports budgets that can never be reached because no model
+// has a price, so no request has a cost to charge against them
+func (c *Config) BudgetWarnings() []string {
+	if len(c.Budgets) == 0 || len(c.Prices) > 0 {
+		return nil
+	}
+	return []string{"budgets are set but the prices table is empty, so no spend is counted against them"}
+}
+
+// InsecureProviderWarnings names the providers whose certificates are not
+// verified, since anyone on the path to them can read and alter the traffic
+func (c *Config) InsecureProviderWarnings() []string {
+	var warnings []string
+	for _, provider := range c.Providers {
+		if provider.InsecureSkipVerify {
+			warnings = append(warnings, fmt.Sprintf("provider '%s' has insecure_skip_verify set: its TLS certificate is not verified and its traffic, including the API key, can be intercepted", provider.Name))
+		}
+	}
+	return warnings
+}
+
+// DisabledProviderWarnings describes the enabled routes whose steps all use
+// disabled providers, so every request on them fails
+func (c *Config) DisabledProviderWarnings() []string {
+	disabled := make(map[string]bool)
+	for _, provider := range c.Providers {
+		if provider.Disabled {
+			disabled[provider.Name] = true
+		}
+	}
+	if len(disabled) == 0 {
+		return nil
+	}
+
+	var warnings []string
+	for _, route := range c.Routes {
+		if route.Disabled || len(route.Steps) == 0 {
+			continue
+		}
+		allDisabled := true
+		for _, step := range route.Steps {
+			if !disabled[step.Provider] {
+				allDisabled = false
+				break
+			}
+		}
+		if allDisabled {
+			warnings = append(warnings, fmt.Sprintf("route '%s' has only disabled providers; its requests will fail", route.Name))
+		}
+	}
+	return warnings
+}
+
+// WriteTimeoutWarnings describes the routes whose worst-case duration exceeds
+// write_timeout: the server would cut off a slow but valid response before
+// the route gives up. Such routes need a request_timeout or a longer write_timeout.
+func (c *Config) WriteTimeoutWarnings() []string {
+	writeTimeout := c.GetWriteTimeout()
+	var warnings []string
+	for _, route := range c.Routes {
+		if worst := route.WorstCaseDuration(c.GetRequestTimeout()); worst > writeTimeout {
+			warnings = append(warnings, fmt.Sprintf("route '%s' may run for up to %s, longer than write_timeout %s; set a request_timeout or raise write_timeout",
+				route.Name, worst, writeTimeout))
+		}
+	}
+	return warnings
+}
+
+// ConfigEnvVar holds the whole configuration base64-encoded, for deployments
+// that can't write files. When set it is used instead of the configuration file.
+const ConfigEnvVar = "AIGW_CONFIG_B64"
+
+// readConfig returns the raw configuration from ConfigEnvVar or the file, and
+// whether it is JSON: by the file's extension, or for the env var by its
+// content starting with '{'
+func readConfig(filename string) ([]byte, bool, error) {
+	if encoded := strings.TrimSpace(os.Getenv(ConfigEnvVar)); encoded != "" {
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to decode %s: %w", ConfigEnvVar, err)
+		}
+		return data, bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")), nil
+	}
+
+	var data []byte
+	var err error
+	for _, path := range configLocations(filename) {
+		data, err = os.ReadFile(path)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read config file from any location: %w", err)
+	}
+	return data, strings.EqualFold(filepath.Ext(filename), ".json"), nil
+}
+
+// configLocations lists where a configuration file is looked for: the
+// current directory first, then /etc/ai-gateway/
+func configLocations(filename string) []string {
+	return []string{
+		filename,
+		filepath.Join("/etc/ai-gateway", filename),
+	}
+}
+
+// FindConfigFile returns the first of names present in a configuration
+// location, or the first name when none is, so the read error mentions it
+func FindConfigFile(names ...string) string {
+	for _, name := range names {
+		for _, path := range configLocations(name) {
+			if _, err := os.Stat(path); err == nil {
+				return name
+			}
+		}
+	}
+	return names[0]
+}
+
+// expandEnvVars replaces ${VAR_NAME} with environment variable values and
+// ${prefix:reference} with secrets from the matching SecretResolver, passed
+// through escape when it is not nil
+func expandEnvVars(s string, escape func(string) string) (string, error) {
 	missing := findMissingEnvVars(s)
 	if len(missing) > 0 {
 		return "", fmt.Errorf("missing required environment variables: %s", strings.Join(missing, ", "))
 	}
-	return os.Expand(s, func(key string) string {
-		return os.Getenv(key)
-	}), nil
+	var resolveErr error
+	expanded := os.Expand(s, func(key string) string {
+		value, err := resolvePlaceholder(key)
+		if err != nil {
+			if resolveErr == nil {
+				resolveErr = err
+			}
+			return ""
+		}
+		if escape != nil {
+			return escape(value)
+		}
+		return value
+	})
+	if resolveErr != nil {
+		return "", resolveErr
+	}
+	return expanded, nil
+}
+
+// jsonEscape escapes a value for use inside a JSON string
+func jsonEscape(value string) string {
+	quoted, _ := json.Marshal(value)
+	return string(quoted[1 : len(quoted)-1])
 }
 
 func findMissingEnvVars(s string) []string {
@@ -146,8 +306,208 @@ func findEnvVars(s string) []string {
 
 // validateConfig checks that required fields are present
 func validateConfig(cfg *Config) error {
-	if cfg.APIKey == "" {
-		return fmt.Errorf("api_key is required")
+	if cfg.APIKey == "" && len(cfg.APIKeys) == 0 {
+		return fmt.Errorf("api_key or api_keys is required")
+	}
+	keyLabels := make(map[string]bool)
+	keyOwners := make(map[string]string) // key -> label, so one key can't carry two labels
+	if cfg.APIKey != "" {
+		keyLabels[DefaultKeyLabel] = true
+		keyOwners[cfg.APIKey] = DefaultKeyLabel
+	}
+	for i, key := range cfg.APIKeys {
+		if strings.TrimSpace(key.Label) == "" {
+			return fmt.Errorf("api_keys[%d]: label is required", i)
+		}
+		if key.Key == "" {
+			return fmt.Errorf("api_keys[%d] (%s): key is required", i, key.Label)
+		}
+		if keyLabels[key.Label] {
+			return fmt.Errorf("api_keys[%d] (%s): duplicate label", i, key.Label)
+		}
+		if owner, ok := keyOwners[key.Key]; ok {
+			return fmt.Errorf("api_keys[%d] (%s): key is already used by '%s'", i, key.Label, owner)
+		}
+		keyLabels[key.Label] = true
+		keyOwners[key.Key] = key.Label
+	}
+	for label, budget := range cfg.Budgets {
+		if !keyLabels[label] {
+			return fmt.Errorf("budgets[%s]: unknown key label", label)
+		}
+		if budget <= 0 {
+			return fmt.Errorf("budgets[%s]: budget must be positive", label)
+		}
+	}
+	switch cfg.BudgetPeriod {
+	case "", BudgetPeriodDaily, BudgetPeriodMonthly:
+	default:
+		return fmt.Errorf("budget_period must be '%s' or '%s', got '%s'", BudgetPeriodDaily, BudgetPeriodMonthly, cfg.BudgetPeriod)
+	}
+
+	if cfg.AdminAPIKey != "" {
+		for _, key := range cfg.ClientKeys() {
+			if cfg.AdminAPIKey == key.Key {
+				return fmt.Errorf("admin_api_key must differ from api_key and api_keys")
+			}
+		}
+	}
+
+	if cfg.MaxRequestBytes < 0 {
+		return fmt.Errorf("max_request_bytes cannot be negative")
+	}
+	if cfg.MaxMessages < 0 {
+		return fmt.Errorf("max_messages cannot be negative")
+	}
+
+	switch cfg.ModelsSource {
+	case "", ModelsSourceRoutes, ModelsSourceUpstream, ModelsSourceBoth:
+	default:
+		return fmt.Errorf("models_source must be 'routes', 'upstream' or 'both', got '%s'", cfg.ModelsSource)
+	}
+	switch cfg.ValidateModels {
+	case "", ModelValidationOff, ModelValidationWarn, ModelValidationError:
+	default:
+		return fmt.Errorf("validate_models must be 'off', 'warn' or 'error', got '%s'", cfg.ValidateModels)
+	}
+	if cfg.ModelsRefreshInterval != "" {
+		if d, err := time.ParseDuration(cfg.ModelsRefreshInterval); err != nil || d <= 0 {
+			return fmt.Errorf("models_refresh_interval must be a positive duration, got '%s'", cfg.ModelsRefreshInterval)
+		}
+	}
+	if cfg.HealthCheckInterval != "" {
+		if d, err := time.ParseDuration(cfg.HealthCheckInterval); err != nil || d <= 0 {
+			return fmt.Errorf("health_check_interval must be a positive duration, got '%s'", cfg.HealthCheckInterval)
+		}
+	}
+	if cfg.HealthCheckThreshold < 0 {
+		return fmt.Errorf("health_check_threshold cannot be negative")
+	}
+
+	if cfg.CircuitBreakerThreshold < 0 {
+		return fmt.Errorf("circuit_breaker_threshold cannot be negative")
+	}
+	if cfg.CircuitBreakerWindow != "" {
+		if _, err := time.ParseDuration(cfg.CircuitBreakerWindow); err != nil {
+			return fmt.Errorf("invalid circuit_breaker_window format: %w", err)
+		}
+	}
+	if cfg.CircuitBreakerCooldown != "" {
+		if _, err := time.ParseDuration(cfg.CircuitBreakerCooldown); err != nil {
+			return fmt.Errorf("invalid circuit_breaker_cooldown format: %w", err)
+		}
+	}
+
+	if cfg.CacheTTL != "" {
+		if d, err := time.ParseDuration(cfg.CacheTTL); err != nil || d <= 0 {
+			return fmt.Errorf("cache_ttl must be a positive duration, got '%s'", cfg.CacheTTL)
+		}
+	}
+	if cfg.CacheMaxEntries < 0 {
+		return fmt.Errorf("cache_max_entries cannot be negative")
+	}
+	if cfg.IdempotencyTTL != "" {
+		if d, err := time.ParseDuration(cfg.IdempotencyTTL); err != nil || d <= 0 {
+			return fmt.Errorf("idempotency_ttl must be a positive duration, got '%s'", cfg.IdempotencyTTL)
+		}
+	}
+	if cfg.BasePath != "" && (!strings.HasPrefix(cfg.BasePath, "/") || strings.HasSuffix(cfg.BasePath, "/") || strings.ContainsAny(cfg.BasePath, " {}")) {
+		return fmt.Errorf("base_path must start with '/' and not end with '/', got '%s'", cfg.BasePath)
+	}
+	if cfg.RateLimitRPS < 0 {
+		return fmt.Errorf("rate_limit_rps cannot be negative")
+	}
+	if cfg.RateLimitBurst < 0 {
+		return fmt.Errorf("rate_limit_burst cannot be negative")
+	}
+	if cfg.MaxConcurrentRequests < 0 {
+		return fmt.Errorf("max_concurrent_requests cannot be negative")
+	}
+	if cfg.RequestQueueTimeout != "" {
+		if d, err := time.ParseDuration(cfg.RequestQueueTimeout); err != nil || d < 0 {
+			return fmt.Errorf("request_queue_timeout must be a non-negative duration, got '%s'", cfg.RequestQueueTimeout)
+		}
+	}
+	for model, price := range cfg.Prices {
+		if price.PricePer1KPrompt < 0 || price.PricePer1KCompletion < 0 {
+			return fmt.Errorf("prices[%s]: prices cannot be negative", model)
+		}
+	}
+	switch strings.ToLower(cfg.LogLevel) {
+	case "", "debug", "info", "warn", "warning", "error":
+	default:
+		return fmt.Errorf("log_level must be 'debug', 'info', 'warn' or 'error', got '%s'", cfg.LogLevel)
+	}
+	if cfg.LogFormat != "" && cfg.LogFormat != "json" && cfg.LogFormat != "text" {
+		return fmt.Errorf("log_format must be 'json' or 'text', got '%s'", cfg.LogFormat)
+	}
+	if cfg.LogOutput != "" && cfg.LogOutput != "stdout" && cfg.LogOutput != "stderr" {
+		return fmt.Errorf("log_output must be 'stdout' or 'stderr', got '%s'", cfg.LogOutput)
+	}
+	for param, limit := range cfg.ParamLimits {
+		if limit.Min != nil && limit.Max != nil && *limit.Min > *limit.Max {
+			return fmt.Errorf("param_limits[%s]: min cannot be greater than max", param)
+		}
+	}
+	for i, rk := range cfg.RedactKeys {
+		if strings.TrimSpace(rk.Key) == "" {
+			return fmt.Errorf("redact_keys[%d]: key is required", i)
+		}
+		if rk.Match != "" && rk.Match != "substring" && rk.Match != "exact" {
+			return fmt.Errorf("redact_keys[%d] (%s): match must be 'substring' or 'exact', got '%s'", i, rk.Key, rk.Match)
+		}
+	}
+	if cfg.RequestTimeout != "" {
+		if d, err := time.ParseDuration(cfg.RequestTimeout); err != nil || d <= 0 {
+			return fmt.Errorf("request_timeout must be a positive duration, got '%s'", cfg.RequestTimeout)
+		}
+	}
+	if cfg.DialTimeout != "" {
+		if d, err := time.ParseDuration(cfg.DialTimeout); err != nil || d <= 0 {
+			return fmt.Errorf("dial_timeout must be a positive duration, got '%s'", cfg.DialTimeout)
+		}
+	}
+	if cfg.ResponseHeaderTimeout != "" {
+		if d, err := time.ParseDuration(cfg.ResponseHeaderTimeout); err != nil || d <= 0 {
+			return fmt.Errorf("response_header_timeout must be a positive duration, got '%s'", cfg.ResponseHeaderTimeout)
+		}
+	}
+	if cfg.ShutdownTimeout != "" {
+		if d, err := time.ParseDuration(cfg.ShutdownTimeout); err != nil || d <= 0 {
+			return fmt.Errorf("shutdown_timeout must be a positive duration, got '%s'", cfg.ShutdownTimeout)
+		}
+	}
+	if cfg.ReadTimeout != "" {
+		if d, err := time.ParseDuration(cfg.ReadTimeout); err != nil || d <= 0 {
+			return fmt.Errorf("read_timeout must be a positive duration, got '%s'", cfg.ReadTimeout)
+		}
+	}
+	if cfg.WriteTimeout != "" {
+		if d, err := time.ParseDuration(cfg.WriteTimeout); err != nil || d <= 0 {
+			return fmt.Errorf("write_timeout must be a positive duration, got '%s'", cfg.WriteTimeout)
+		}
+	}
+
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return fmt.Errorf("tls_cert_file and tls_key_file must be set together")
+	}
+	for field, path := range map[string]string{"tls_cert_file": cfg.TLSCertFile, "tls_key_file": cfg.TLSKeyFile} {
+		if path == "" {
+			continue
+		}
+		if err := checkReadable(path); err != nil {
+			return fmt.Errorf("%s: %w", field, err)
+		}
+	}
+
+	if cfg.MaxInlineImageBytes < 0 {
+		return fmt.Errorf("max_inline_image_bytes cannot be negative")
+	}
+	if cfg.AuditMaxSizeMB < 0 {
+		return fmt.Errorf("audit_max_size_mb cannot be negative")
+	}
+	if cfg.AuditMaxBackups < 0 {
+		return fmt.Errorf("audit_max_backups cannot be negative")
 	}
 
 	if len(cfg.Providers) == 0 {
@@ -165,17 +525,79 @@ func validateConfig(cfg *Config) error {
 		if strings.TrimSpace(provider.Name) == "" {
 			return fmt.Errorf("provider[%d]: name is required", i)
 		}
-		if strings.TrimSpace(provider.APIKey) == "" {
-			return fmt.Errorf("provider[%d] (%s): api_key is required", i, provider.Name)
+		if len(provider.Keys()) == 0 {
+			return fmt.Errorf("provider[%d] (%s): api_key or api_keys is required", i, provider.Name)
 		}
 		if strings.TrimSpace(provider.BaseURL) == "" {
 			return fmt.Errorf("provider[%d] (%s): base_url is required", i, provider.Name)
 		}
+		switch provider.Type {
+		case "", ProviderTypeOpenAI:
+		case ProviderTypeAzure:
+			if strings.TrimSpace(provider.APIVersion) == "" {
+				return fmt.Errorf("provider[%d] (%s): api_version is required for azure providers", i, provider.Name)
+			}
+		case ProviderTypeGemini:
+			if provider.ForceStream {
+				return fmt.Errorf("provider[%d] (%s): force_stream is not supported for gemini providers", i, provider.Name)
+			}
+		default:
+			return fmt.Errorf("provider[%d] (%s): type must be 'openai', 'azure' or 'gemini', got '%s'", i, provider.Name, provider.Type)
+		}
+		if err := validateForwardHeaders(provider.ForwardHeaders); err != nil {
+			return fmt.Errorf("provider[%d] (%s): %w", i, provider.Name, err)
+		}
+		if err := validateResponseHeaders(provider.ResponseHeaders); err != nil {
+			return fmt.Errorf("provider[%d] (%s): %w", i, provider.Name, err)
+		}
+		for name, value := range provider.Headers {
+			if !ValidHeaderName(name) {
+				return fmt.Errorf("provider[%d] (%s): headers: invalid header name '%s'", i, provider.Name, name)
+			}
+			if strings.ContainsAny(value, "\r\n") {
+				return fmt.Errorf("provider[%d] (%s): headers: value of '%s' cannot contain line breaks", i, provider.Name, name)
+			}
+		}
+		if provider.ProxyURL == "" {
+			provider.ProxyURL = cfg.ProxyURL
+		}
+		if provider.UserAgent == "" {
+			provider.UserAgent = cfg.UserAgent
+		}
+		if strings.ContainsAny(provider.UserAgent, "\r\n") {
+			return fmt.Errorf("provider[%d] (%s): user_agent cannot contain line breaks", i, provider.Name)
+		}
+		if err := validateProxyURL(provider.ProxyURL); err != nil {
+			return fmt.Errorf("provider[%d] (%s): %w", i, provider.Name, err)
+		}
+		if _, err := provider.TLSConfig(); err != nil {
+			return fmt.Errorf("provider[%d] (%s): %w", i, provider.Name, err)
+		}
+		if strings.Contains(provider.ChatCompletionsPath, "://") || strings.ContainsAny(provider.ChatCompletionsPath, "?#") {
+			return fmt.Errorf("provider[%d] (%s): chat_completions_path must be a path relative to base_url, got '%s'", i, provider.Name, provider.ChatCompletionsPath)
+		}
+		if provider.RateLimitRPM < 0 || provider.RateLimitTPM < 0 {
+			return fmt.Errorf("provider[%d] (%s): rate_limit_rpm and rate_limit_tpm cannot be negative", i, provider.Name)
+		}
+		if provider.MaxConcurrency < 0 {
+			return fmt.Errorf("provider[%d] (%s): max_concurrency cannot be negative", i, provider.Name)
+		}
+		switch provider.OnSaturation {
+		case "", SaturationWait, SaturationFallback:
+		default:
+			return fmt.Errorf("provider[%d] (%s): on_saturation must be 'wait' or 'fallback', got '%s'", i, provider.Name, provider.OnSaturation)
+		}
+		if provider.QueueTimeout != "" {
+			if d, err := time.ParseDuration(provider.QueueTimeout); err != nil || d <= 0 {
+				return fmt.Errorf("provider[%d] (%s): queue_timeout must be a positive duration, got '%s'", i, provider.Name, provider.QueueTimeout)
+			}
+		}
 		// Providers no longer have Model and Timeout fields
 		cfg.Providers[i] = provider
 	}
 
 	// Validate routes
+	defaultRoute := ""
 	for i, route := range cfg.Routes {
 		if strings.TrimSpace(route.Name) == "" {
 			return fmt.Errorf("route[%d]: name is required", i)
@@ -183,13 +605,54 @@ func validateConfig(cfg *Config) error {
 		if len(route.Steps) == 0 {
 			return fmt.Errorf("route[%d] (%s): at least one step must be configured", i, route.Name)
 		}
+		for _, label := range route.AllowedKeys {
+			if !keyLabels[label] {
+				return fmt.Errorf("route[%d] (%s): allowed_keys references unknown key label '%s'", i, route.Name, label)
+			}
+		}
+		if route.IsDefault() {
+			if defaultRoute != "" {
+				return fmt.Errorf("route[%d] (%s): only one default route is allowed, '%s' is already the default", i, route.Name, defaultRoute)
+			}
+			defaultRoute = route.Name
+		}
+		if route.RequestTimeout != "" {
+			if d, err := time.ParseDuration(route.RequestTimeout); err != nil || d <= 0 {
+				return fmt.Errorf("route[%d] (%s): request_timeout must be a positive duration, got '%s'", i, route.Name, route.RequestTimeout)
+			}
+		}
+		switch route.Strategy {
+		case "", "sequential", "weighted", "hedge", "latency":
+		default:
+			return fmt.Errorf("route[%d] (%s): strategy must be 'sequential', 'weighted', 'hedge' or 'latency', got '%s'", i, route.Name, route.Strategy)
+		}
+		if route.MaxAttempts < 0 {
+			return fmt.Errorf("route[%d] (%s): max_attempts cannot be negative", i, route.Name)
+		}
+		if route.MaxPromptChars < 0 {
+			return fmt.Errorf("route[%d] (%s): max_prompt_chars cannot be negative", i, route.Name)
+		}
+		if route.HedgeDelay != "" {
+			if d, err := time.ParseDuration(route.HedgeDelay); err != nil || d < 0 {
+				return fmt.Errorf("route[%d] (%s): hedge_delay must be a non-negative duration, got '%s'", i, route.Name, route.HedgeDelay)
+			}
+		}
+		for _, condition := range route.FallbackOn {
+			if !validFallbackCondition(condition) {
+				return fmt.Errorf("route[%d] (%s): fallback_on entries must be '4xx', '5xx', 'timeout', 'network' or a status code from 400 to 599, got '%s'", i, route.Name, condition)
+			}
+		}
 
 		// Validate route steps
+		canaryStep := -1
 		for j, step := range route.Steps {
 			if strings.TrimSpace(step.Provider) == "" {
 				return fmt.Errorf("route[%d] (%s) step[%d]: provider is required", i, route.Name, j)
 			}
-			if strings.TrimSpace(step.Model) == "" {
+			if step.PreserveModel && step.Model != "" {
+				return fmt.Errorf("route[%d] (%s) step[%d]: model must be empty when preserve_model is set", i, route.Name, j)
+			}
+			if !step.PreserveModel && strings.TrimSpace(step.Model) == "" {
 				return fmt.Errorf("route[%d] (%s) step[%d]: model is required", i, route.Name, j)
 			}
 			// Validate provider reference
@@ -202,16 +665,222 @@ func validateConfig(cfg *Config) error {
 					return fmt.Errorf("route[%d] (%s) step[%d]: invalid timeout format: %w", i, route.Name, j, err)
 				}
 			}
+			// Validate retry settings
+			if step.Retries < 0 {
+				return fmt.Errorf("route[%d] (%s) step[%d]: retries cannot be negative", i, route.Name, j)
+			}
+			if step.Backoff != "" {
+				if _, err := time.ParseDuration(step.Backoff); err != nil {
+					return fmt.Errorf("route[%d] (%s) step[%d]: invalid backoff format: %w", i, route.Name, j, err)
+				}
+			}
+			if step.Weight < 0 {
+				return fmt.Errorf("route[%d] (%s) step[%d]: weight cannot be negative", i, route.Name, j)
+			}
+			if step.Canary < 0 || step.Canary > 100 {
+				return fmt.Errorf("route[%d] (%s) step[%d]: canary must be a percentage from 0 to 100, got %d", i, route.Name, j, step.Canary)
+			}
+			if step.Canary > 0 {
+				if canaryStep >= 0 {
+					return fmt.Errorf("route[%d] (%s) step[%d]: only one step can be a canary, step[%d] already is", i, route.Name, j, canaryStep)
+				}
+				if len(route.Steps) < 2 {
+					return fmt.Errorf("route[%d] (%s) step[%d]: canary needs another step to split traffic with", i, route.Name, j)
+				}
+				canaryStep = j
+			}
+			if step.MaxMessages < 0 || step.MaxContextTokens < 0 {
+				return fmt.Errorf("route[%d] (%s) step[%d]: max_messages and max_context_tokens cannot be negative", i, route.Name, j)
+			}
 			// Validate conflict_resolution
 			if step.ConflictResolution != "" {
 				if step.ConflictResolution != "tools" && step.ConflictResolution != "format" {
 					return fmt.Errorf("route[%d] (%s) step[%d]: conflict_resolution must be 'tools' or 'format', got '%s'", i, route.Name, j, step.ConflictResolution)
 				}
 			}
+			if err := validateForwardHeaders(step.ForwardHeaders); err != nil {
+				return fmt.Errorf("route[%d] (%s) step[%d]: %w", i, route.Name, j, err)
+			}
+			if err := validateStepParams("defaults", step.Defaults); err != nil {
+				return fmt.Errorf("route[%d] (%s) step[%d]: %w", i, route.Name, j, err)
+			}
+			if err := validateStepParams("overrides", step.Overrides); err != nil {
+				return fmt.Errorf("route[%d] (%s) step[%d]: %w", i, route.Name, j, err)
+			}
+			if err := validateRenames("rename_params", step.RenameParams); err != nil {
+				return fmt.Errorf("route[%d] (%s) step[%d]: %w", i, route.Name, j, err)
+			}
+			if err := validateRenames("rename_response", step.RenameResponse); err != nil {
+				return fmt.Errorf("route[%d] (%s) step[%d]: %w", i, route.Name, j, err)
+			}
 			cfg.Routes[i].Steps[j] = step
 		}
 		cfg.Routes[i] = route
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// readKeyFiles replaces api_key with the contents of api_key_file, for the
+// gateway and each provider that sets one
+func readKeyFiles(cfg *Config) error {
+	if cfg.APIKeyFile != "" {
+		key, err := readKeyFile(cfg.APIKeyFile)
+		if err != nil {
+			return fmt.Errorf("api_key_file: %w", err)
+		}
+		cfg.APIKey = key
+	}
+	for i := range cfg.Providers {
+		provider := &cfg.Providers[i]
+		if provider.APIKeyFile == "" {
+			continue
+		}
+		key, err := readKeyFile(provider.APIKeyFile)
+		if err != nil {
+			return fmt.Errorf("provider[%d] (%s): api_key_file: %w", i, provider.Name, err)
+		}
+		provider.APIKey = key
+	}
+	return nil
+}
+
+// readKeyFile returns the key stored in path without the trailing newline
+// mounted secrets usually end with
+func readKeyFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	key := strings.TrimRight(string(data), " \t\r\n")
+	if key == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return key, nil
+}
+
+// checkReadable verifies that path is a regular file the gateway can open
+func checkReadable(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	return nil
+}
+
+// validateProxyURL checks that a proxy URL, if set, is an absolute http, https or socks5 URL
+func validateProxyURL(proxyURL string) error {
+	if proxyURL == "" {
+		return nil
+	}
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return fmt.Errorf("invalid proxy_url: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("proxy_url scheme must be http, https, socks5 or socks5h, got '%s'", u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("proxy_url must include a host, got '%s'", proxyURL)
+	}
+	return nil
+}
+
+// validateStepParams rejects request parameters a route step may not set:
+// the model comes from the step itself and the messages from the client
+func validateStepParams(field string, params map[string]interface{}) error {
+	for key := range params {
+		if key == "model" || key == "messages" {
+			return fmt.Errorf("%s cannot set '%s'", field, key)
+		}
+	}
+	return nil
+}
+
+// validateRenames checks a from -> to field map: names must be non-empty,
+// the model and messages fields stay put, and no two fields may share a target
+func validateRenames(field string, renames map[string]string) error {
+	targets := make(map[string]string, len(renames))
+	for from, to := range renames {
+		if from == "" || to == "" {
+			return fmt.Errorf("%s cannot rename to or from an empty name", field)
+		}
+		for _, name := range []string{from, to} {
+			if name == "model" || name == "messages" {
+				return fmt.Errorf("%s cannot rename '%s'", field, name)
+			}
+		}
+		if other, ok := targets[to]; ok {
+			return fmt.Errorf("%s renames both '%s' and '%s' to '%s'", field, min(from, other), max(from, other), to)
+		}
+		targets[to] = from
+	}
+	return nil
+}
+
+// validFallbackCondition reports whether s is an error class or an HTTP error status
+func validFallbackCondition(s string) bool {
+	switch s {
+	case FallbackOn4xx, FallbackOn5xx, FallbackOnTimeout, FallbackOnNetwork:
+		return true
+	}
+	code, err := strconv.Atoi(s)
+	return err == nil && code >= 400 && code <= 599
+}
+
+// validateForwardHeaders checks that forwarded header names are well-formed and
+// that the gateway's own credentials can never be passed through to a provider
+func validateForwardHeaders(names []string) error {
+	for _, name := range names {
+		if !ValidHeaderName(name) {
+			return fmt.Errorf("forward_headers: invalid header name '%s'", name)
+		}
+		switch strings.ToLower(name) {
+		case "authorization", "x-api-key", "api-key", "host", "content-length", "content-type":
+			return fmt.Errorf("forward_headers: header '%s' cannot be forwarded", name)
+		}
+	}
+	return nil
+}
+
+// validateResponseHeaders checks the upstream response headers a provider may
+// pass to clients. Headers describing the body or the connection are the
+// gateway's own and can't be copied.
+func validateResponseHeaders(names []string) error {
+	for _, name := range names {
+		if !ValidHeaderName(name) {
+			return fmt.Errorf("response_headers: invalid header name '%s'", name)
+		}
+		switch strings.ToLower(name) {
+		case "content-length", "content-type", "content-encoding", "transfer-encoding", "connection", "set-cookie":
+			return fmt.Errorf("response_headers: header '%s' cannot be copied", name)
+		}
+	}
+	return nil
+}
+
+// ValidHeaderName reports whether name is a valid HTTP header field name (an RFC 7230 token)
+func ValidHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
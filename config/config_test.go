@@ -1,6 +1,9 @@
 package config
 
 import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
@@ -83,6 +86,190 @@ routes:
 	}
 }
 
+func TestLoadConfigJSON(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.json")
+	configData := `{
+  "api_key": "${GATEWAY_API_KEY}",
+  "providers": [
+    {"name": "test", "api_key": "${JSON_PROVIDER_KEY}", "base_url": "https://example.com", "max_concurrency": 4}
+  ],
+  "routes": [
+    {"name": "test-route", "request_timeout": "90s", "steps": [{"provider": "test", "model": "test-model", "retries": 2}]}
+  ]
+}`
+	if err := os.WriteFile(configPath, []byte(configData), 0o600); err != nil {
+		t.Fatalf("failed to write temp config: %v", err)
+	}
+
+	os.Setenv("GATEWAY_API_KEY", "test-gateway-key")
+	defer os.Unsetenv("GATEWAY_API_KEY")
+	// Quotes in a value must not break the JSON document
+	os.Setenv("JSON_PROVIDER_KEY", `key"with\quotes`)
+	defer os.Unsetenv("JSON_PROVIDER_KEY")
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.APIKey != "test-gateway-key" || cfg.Port != 8080 || cfg.DefaultTimeout != "30s" {
+		t.Errorf("Expected the key and defaults to be set, got %+v", cfg)
+	}
+	provider := cfg.Providers[0]
+	if provider.APIKey != `key"with\quotes` || provider.MaxConcurrency != 4 {
+		t.Errorf("Unexpected provider: %+v", provider)
+	}
+	route := cfg.Routes[0]
+	if route.RequestTimeout != "90s" || route.Steps[0].Retries != 2 {
+		t.Errorf("Unexpected route: %+v", route)
+	}
+}
+
+func TestLoadConfigBase64Env(t *testing.T) {
+	configData := `
+api_key: ${GATEWAY_API_KEY}
+providers:
+  - name: test
+    api_key: provider-key
+    base_url: https://example.com
+routes:
+  - name: test-route
+    steps:
+      - provider: test
+        model: test-model
+`
+	t.Setenv(ConfigEnvVar, base64.StdEncoding.EncodeToString([]byte(configData)))
+	t.Setenv("GATEWAY_API_KEY", "test-gateway-key")
+
+	// The env var wins over a file that doesn't exist
+	cfg, err := LoadConfig(filepath.Join(t.TempDir(), "config.yaml"))
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.APIKey != "test-gateway-key" || cfg.Port != 8080 || cfg.Routes[0].Name != "test-route" {
+		t.Errorf("Expected the config from %s with env expansion and defaults, got %+v", ConfigEnvVar, cfg)
+	}
+
+	// JSON is recognised by its content
+	t.Setenv(ConfigEnvVar, base64.StdEncoding.EncodeToString([]byte(`{"api_key": "${GATEWAY_API_KEY}", "providers": [{"name": "test", "api_key": "k", "base_url": "https://example.com"}]}`)))
+	if cfg, err := LoadConfig("config.yaml"); err != nil || cfg.APIKey != "test-gateway-key" {
+		t.Errorf("Expected a JSON config to load, got %v", err)
+	}
+
+	t.Setenv(ConfigEnvVar, "not base64!")
+	if _, err := LoadConfig("config.yaml"); err == nil || !strings.Contains(err.Error(), ConfigEnvVar) {
+		t.Errorf("Expected a decode error naming %s, got %v", ConfigEnvVar, err)
+	}
+}
+
+func TestLoadConfigSecretResolvers(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "vault-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/openai":
+			w.Write([]byte(`{"data": {"data": {"api_key": "vault-provider-key"}, "metadata": {"version": 3}}}`))
+		case "/v1/kv/gateway":
+			w.Write([]byte(`{"data": {"key": "vault-gateway-key"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer vault.Close()
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("VAULT_TOKEN", "vault-token")
+
+	configData := `
+api_key: ${vault:kv/gateway#key}
+providers:
+  - name: test
+    api_key: ${vault:secret/data/openai#api_key}
+    base_url: https://example.com
+routes:
+  - name: test-route
+    steps:
+      - provider: test
+        model: test-model
+`
+	t.Setenv(ConfigEnvVar, base64.StdEncoding.EncodeToString([]byte(configData)))
+	cfg, err := LoadConfig("config.yaml")
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.APIKey != "vault-gateway-key" || cfg.Providers[0].APIKey != "vault-provider-key" {
+		t.Errorf("Expected the keys from vault (KV v1 and v2), got %q and %q", cfg.APIKey, cfg.Providers[0].APIKey)
+	}
+
+	for _, placeholder := range []string{"${vault:secret/data/missing#api_key}", "${vault:kv/gateway#other}", "${vault:kv/gateway}", "${env:UNSET_GATEWAY_SECRET}", "${nope:x}"} {
+		t.Setenv(ConfigEnvVar, base64.StdEncoding.EncodeToString([]byte(strings.Replace(configData, "${vault:kv/gateway#key}", placeholder, 1))))
+		if _, err := LoadConfig("config.yaml"); err == nil || !strings.Contains(err.Error(), placeholder) {
+			t.Errorf("Expected an error naming %s, got %v", placeholder, err)
+		}
+	}
+}
+
+func TestLoadConfigEnvDefaults(t *testing.T) {
+	t.Setenv("SET_GATEWAY_KEY", "env-key")
+	configData := `
+api_key: ${SET_GATEWAY_KEY:-fallback-key}
+providers:
+  - name: test
+    api_key: ${UNSET_PROVIDER_KEY:-default-provider-key}
+    base_url: https://example.com
+routes:
+  - name: test-route
+    steps:
+      - provider: test
+        model: test-model
+`
+	t.Setenv(ConfigEnvVar, base64.StdEncoding.EncodeToString([]byte(configData)))
+	cfg, err := LoadConfig("config.yaml")
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.APIKey != "env-key" || cfg.Providers[0].APIKey != "default-provider-key" {
+		t.Errorf("Expected the env value and the default, got %q and %q", cfg.APIKey, cfg.Providers[0].APIKey)
+	}
+}
+
+func TestLoadConfigAPIKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	gatewayKey := filepath.Join(dir, "gateway-key")
+	providerKey := filepath.Join(dir, "provider-key")
+	os.WriteFile(gatewayKey, []byte("file-gateway-key\n"), 0600)
+	os.WriteFile(providerKey, []byte("file-provider-key\r\n"), 0600)
+
+	configData := `
+api_key: inline-key
+api_key_file: ` + gatewayKey + `
+providers:
+  - name: test
+    api_key_file: ` + providerKey + `
+    base_url: https://example.com
+routes:
+  - name: test-route
+    steps:
+      - provider: test
+        model: test-model
+`
+	t.Setenv(ConfigEnvVar, base64.StdEncoding.EncodeToString([]byte(configData)))
+	cfg, err := LoadConfig("config.yaml")
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.APIKey != "file-gateway-key" || cfg.Providers[0].APIKey != "file-provider-key" {
+		t.Errorf("Expected the keys from the files without newlines, got %q and %q", cfg.APIKey, cfg.Providers[0].APIKey)
+	}
+
+	missing := filepath.Join(dir, "missing")
+	t.Setenv(ConfigEnvVar, base64.StdEncoding.EncodeToString([]byte(strings.Replace(configData, providerKey, missing, 1))))
+	if _, err := LoadConfig("config.yaml"); err == nil || !strings.Contains(err.Error(), "provider[0] (test): api_key_file") {
+		t.Errorf("Expected an error for the unreadable provider key file, got %v", err)
+	}
+}
+
 func TestFindEnvVars(t *testing.T) {
 	configData := `
 api_key: ${GATEWAY_API_KEY}
@@ -215,6 +402,95 @@ func TestValidateConfig(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "admin key same as gateway key",
+			config: &Config{
+				APIKey:      "test-key",
+				AdminAPIKey: "test-key",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid hedge_delay",
+			config: &Config{
+				APIKey: "test-key",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+				Routes: []Route{
+					{
+						Name:       "test-model",
+						Strategy:   "hedge",
+						HedgeDelay: "soon",
+						Steps: []RouteStep{
+							{Provider: "test", Model: "gpt-4"},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid fallback_on",
+			config: &Config{
+				APIKey: "test-key",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+				Routes: []Route{
+					{
+						Name:       "test-model",
+						FallbackOn: []string{"5xx", "200"},
+						Steps: []RouteStep{
+							{Provider: "test", Model: "gpt-4"},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative max_attempts",
+			config: &Config{
+				APIKey: "test-key",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+				Routes: []Route{
+					{
+						Name:        "test-model",
+						MaxAttempts: -1,
+						Steps: []RouteStep{
+							{Provider: "test", Model: "gpt-4"},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative audit_max_size_mb",
+			config: &Config{
+				APIKey:         "test-key",
+				AuditEnabled:   true,
+				AuditMaxSizeMB: -1,
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+				Routes: []Route{
+					{
+						Name: "test-model",
+						Steps: []RouteStep{
+							{Provider: "test", Model: "gpt-4"},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
 		{
 			name: "invalid conflict_resolution",
 			config: &Config{
@@ -234,7 +510,7 @@ func TestValidateConfig(t *testing.T) {
 			wantErr: true,
 		},
 		{
-			name: "route missing name",
+			name: "step defaults setting model",
 			config: &Config{
 				APIKey: "test-key",
 				Providers: []Provider{
@@ -242,9 +518,9 @@ func TestValidateConfig(t *testing.T) {
 				},
 				Routes: []Route{
 					{
-						Name: "",
+						Name: "test-model",
 						Steps: []RouteStep{
-							{Provider: "test", Model: "gpt-4"},
+							{Provider: "test", Model: "gpt-4", Defaults: map[string]interface{}{"model": "gpt-3.5-turbo"}},
 						},
 					},
 				},
@@ -252,7 +528,7 @@ func TestValidateConfig(t *testing.T) {
 			wantErr: true,
 		},
 		{
-			name: "route step missing provider",
+			name: "step renaming model",
 			config: &Config{
 				APIKey: "test-key",
 				Providers: []Provider{
@@ -262,7 +538,7 @@ func TestValidateConfig(t *testing.T) {
 					{
 						Name: "test-model",
 						Steps: []RouteStep{
-							{Provider: "", Model: "gpt-4"},
+							{Provider: "test", Model: "gpt-4", RenameParams: map[string]string{"model": "deployment"}},
 						},
 					},
 				},
@@ -270,7 +546,7 @@ func TestValidateConfig(t *testing.T) {
 			wantErr: true,
 		},
 		{
-			name: "route step missing model",
+			name: "step renames sharing a target",
 			config: &Config{
 				APIKey: "test-key",
 				Providers: []Provider{
@@ -280,7 +556,7 @@ func TestValidateConfig(t *testing.T) {
 					{
 						Name: "test-model",
 						Steps: []RouteStep{
-							{Provider: "test", Model: ""},
+							{Provider: "test", Model: "gpt-4", RenameParams: map[string]string{"max_tokens": "max_completion_tokens", "max_output_tokens": "max_completion_tokens"}},
 						},
 					},
 				},
@@ -288,7 +564,7 @@ func TestValidateConfig(t *testing.T) {
 			wantErr: true,
 		},
 		{
-			name: "multiple routes same name",
+			name: "negative max_prompt_chars",
 			config: &Config{
 				APIKey: "test-key",
 				Providers: []Provider{
@@ -296,58 +572,818 @@ func TestValidateConfig(t *testing.T) {
 				},
 				Routes: []Route{
 					{
-						Name: "duplicate",
+						Name:           "test-model",
+						MaxPromptChars: -1,
 						Steps: []RouteStep{
 							{Provider: "test", Model: "gpt-4"},
 						},
 					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "preserve_model step without model",
+			config: &Config{
+				APIKey: "test-key",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+				Routes: []Route{
 					{
-						Name: "duplicate",
+						Name: "gpt-*",
 						Steps: []RouteStep{
-							{Provider: "test", Model: "claude-3"},
+							{Provider: "test", PreserveModel: true},
 						},
 					},
 				},
 			},
-			wantErr: false, // This should actually be allowed - routes can have same name but different steps
+			wantErr: false,
 		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			err := validateConfig(tt.config)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("validateConfig() error = %v, wantErr %v", err, tt.wantErr)
-			}
-		})
-	}
-}
-
-func TestGetDefaultTimeout(t *testing.T) {
-	tests := []struct {
-		name           string
-		defaultTimeout string
-		expected       time.Duration
-	}{
 		{
-			name:           "explicit timeout",
-			defaultTimeout: "60s",
-			expected:       60 * time.Second,
+			name: "preserve_model step with model",
+			config: &Config{
+				APIKey: "test-key",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+				Routes: []Route{
+					{
+						Name: "gpt-*",
+						Steps: []RouteStep{
+							{Provider: "test", Model: "gpt-4", PreserveModel: true},
+						},
+					},
+				},
+			},
+			wantErr: true,
 		},
 		{
-			name:           "empty timeout",
-			defaultTimeout: "",
-			expected:       30 * time.Second,
+			name: "negative max_messages",
+			config: &Config{
+				APIKey: "test-key",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+				Routes: []Route{
+					{
+						Name: "test-model",
+						Steps: []RouteStep{
+							{Provider: "test", Model: "gpt-4", MaxMessages: -1},
+						},
+					},
+				},
+			},
+			wantErr: true,
 		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			config := &Config{DefaultTimeout: tt.defaultTimeout}
-			result := config.GetDefaultTimeout()
-			if result != tt.expected {
-				t.Errorf("GetDefaultTimeout() = %v, want %v", result, tt.expected)
-			}
-		})
-	}
-}
\ No newline at end of file
+		{
+			name: "negative retries",
+			config: &Config{
+				APIKey: "test-key",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+				Routes: []Route{
+					{
+						Name: "test-model",
+						Steps: []RouteStep{
+							{Provider: "test", Model: "gpt-4", Retries: -1},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid backoff",
+			config: &Config{
+				APIKey: "test-key",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+				Routes: []Route{
+					{
+						Name: "test-model",
+						Steps: []RouteStep{
+							{Provider: "test", Model: "gpt-4", Retries: 2, Backoff: "soon"},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative max_request_bytes",
+			config: &Config{
+				APIKey:          "test-key",
+				MaxRequestBytes: -1,
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "provider with api_keys only",
+			config: &Config{
+				APIKey: "test-key",
+				Providers: []Provider{
+					{Name: "test", APIKeys: []string{"key1", "key2"}, BaseURL: "http://test.com"},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "provider without any key",
+			config: &Config{
+				APIKey: "test-key",
+				Providers: []Provider{
+					{Name: "test", APIKeys: []string{" "}, BaseURL: "http://test.com"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "azure provider without api_version",
+			config: &Config{
+				APIKey: "test-key",
+				Providers: []Provider{
+					{Name: "azure", Type: "azure", APIKey: "key", BaseURL: "https://example.openai.azure.com"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown provider type",
+			config: &Config{
+				APIKey: "test-key",
+				Providers: []Provider{
+					{Name: "test", Type: "bedrock", APIKey: "key", BaseURL: "http://test.com"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "forwarding authorization header",
+			config: &Config{
+				APIKey: "test-key",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com", ForwardHeaders: []string{"Authorization"}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "malformed forward header name",
+			config: &Config{
+				APIKey: "test-key",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com", ForwardHeaders: []string{"OpenAI Beta"}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid proxy_url scheme",
+			config: &Config{
+				APIKey: "test-key",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com", ProxyURL: "ftp://proxy.internal:21"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "chat_completions_path with a full URL",
+			config: &Config{
+				APIKey: "test-key",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com", ChatCompletionsPath: "http://other.com/chat"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid on_saturation",
+			config: &Config{
+				APIKey: "test-key",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com", MaxConcurrency: 4, OnSaturation: "drop"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid global proxy_url",
+			config: &Config{
+				APIKey:   "test-key",
+				ProxyURL: "proxy.internal:3128",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "malformed static header name",
+			config: &Config{
+				APIKey: "test-key",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com", Headers: map[string]string{"X Title": "gateway"}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "labeled api_keys without api_key",
+			config: &Config{
+				APIKeys: []ClientKey{{Label: "team-a", Key: "team-a-key"}},
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+				Routes: []Route{
+					{Name: "gpt-4", AllowedKeys: []string{"team-a"}, Steps: []RouteStep{{Provider: "test", Model: "gpt-4"}}},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "duplicate api_keys label",
+			config: &Config{
+				APIKey:  "test-key",
+				APIKeys: []ClientKey{{Label: "default", Key: "other-key"}},
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "allowed_keys references unknown label",
+			config: &Config{
+				APIKey: "test-key",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+				Routes: []Route{
+					{Name: "gpt-4", AllowedKeys: []string{"team-a"}, Steps: []RouteStep{{Provider: "test", Model: "gpt-4"}}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "response_headers copying content-length",
+			config: &Config{
+				APIKey: "test-key",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com", ResponseHeaders: []string{"x-request-id", "Content-Length"}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative rate_limit_tpm",
+			config: &Config{
+				APIKey: "test-key",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com", RateLimitTPM: -1},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid idempotency_ttl",
+			config: &Config{
+				APIKey:         "test-key",
+				IdempotencyTTL: "-1h",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid read_timeout",
+			config: &Config{
+				APIKey:      "test-key",
+				ReadTimeout: "fast",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid write_timeout",
+			config: &Config{
+				APIKey:       "test-key",
+				WriteTimeout: "0s",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid response_header_timeout",
+			config: &Config{
+				APIKey:                "test-key",
+				ResponseHeaderTimeout: "0s",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid log_output",
+			config: &Config{
+				APIKey:    "test-key",
+				LogOutput: "syslog",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative max_concurrent_requests",
+			config: &Config{
+				APIKey:                "test-key",
+				MaxConcurrentRequests: -1,
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid validate_models",
+			config: &Config{
+				APIKey:         "test-key",
+				ValidateModels: "strict",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "base_path with trailing slash",
+			config: &Config{
+				APIKey:   "test-key",
+				BasePath: "/ai/",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "budget for unknown key label",
+			config: &Config{
+				APIKey:  "test-key",
+				Budgets: BudgetTable{"research": 100},
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid budget_period",
+			config: &Config{
+				APIKey:       "test-key",
+				Budgets:      BudgetTable{"default": 100},
+				BudgetPeriod: "weekly",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative global max_messages",
+			config: &Config{
+				APIKey:      "test-key",
+				MaxMessages: -1,
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "route with a canary step",
+			config: &Config{
+				APIKey: "test-key",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+				Routes: []Route{
+					{Name: "chat", Steps: []RouteStep{
+						{Provider: "test", Model: "current"},
+						{Provider: "test", Model: "new", Canary: 10},
+					}},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "canary percentage over 100",
+			config: &Config{
+				APIKey: "test-key",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+				Routes: []Route{
+					{Name: "chat", Steps: []RouteStep{
+						{Provider: "test", Model: "new", Canary: 150},
+						{Provider: "test", Model: "current"},
+					}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "two canary steps",
+			config: &Config{
+				APIKey: "test-key",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+				Routes: []Route{
+					{Name: "chat", Steps: []RouteStep{
+						{Provider: "test", Model: "new", Canary: 10},
+						{Provider: "test", Model: "newer", Canary: 5},
+						{Provider: "test", Model: "current"},
+					}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "canary without another step",
+			config: &Config{
+				APIKey: "test-key",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+				Routes: []Route{
+					{Name: "chat", Steps: []RouteStep{{Provider: "test", Model: "new", Canary: 10}}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid shutdown_timeout",
+			config: &Config{
+				APIKey:          "test-key",
+				ShutdownTimeout: "soon",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid log_level",
+			config: &Config{
+				APIKey:   "test-key",
+				LogLevel: "verbose",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid redact_keys match",
+			config: &Config{
+				APIKey:     "test-key",
+				RedactKeys: []RedactKey{{Key: "user_email", Match: "prefix"}},
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "param_limits min above max",
+			config: &Config{
+				APIKey:      "test-key",
+				ParamLimits: ParamLimits{"temperature": {Min: floatPtr(2), Max: floatPtr(1)}},
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid route strategy",
+			config: &Config{
+				APIKey: "test-key",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+				Routes: []Route{
+					{
+						Name:     "test-model",
+						Strategy: "random",
+						Steps: []RouteStep{
+							{Provider: "test", Model: "gpt-4"},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "multiple default routes",
+			config: &Config{
+				APIKey: "test-key",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+				Routes: []Route{
+					{Name: "*", Steps: []RouteStep{{Provider: "test", Model: "gpt-4"}}},
+					{Name: "fallback", Default: true, Steps: []RouteStep{{Provider: "test", Model: "gpt-4"}}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "route missing name",
+			config: &Config{
+				APIKey: "test-key",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+				Routes: []Route{
+					{
+						Name: "",
+						Steps: []RouteStep{
+							{Provider: "test", Model: "gpt-4"},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "route step missing provider",
+			config: &Config{
+				APIKey: "test-key",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+				Routes: []Route{
+					{
+						Name: "test-model",
+						Steps: []RouteStep{
+							{Provider: "", Model: "gpt-4"},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "route step missing model",
+			config: &Config{
+				APIKey: "test-key",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+				Routes: []Route{
+					{
+						Name: "test-model",
+						Steps: []RouteStep{
+							{Provider: "test", Model: ""},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "multiple routes same name",
+			config: &Config{
+				APIKey: "test-key",
+				Providers: []Provider{
+					{Name: "test", APIKey: "key", BaseURL: "http://test.com"},
+				},
+				Routes: []Route{
+					{
+						Name: "duplicate",
+						Steps: []RouteStep{
+							{Provider: "test", Model: "gpt-4"},
+						},
+					},
+					{
+						Name: "duplicate",
+						Steps: []RouteStep{
+							{Provider: "test", Model: "claude-3"},
+						},
+					},
+				},
+			},
+			wantErr: false, // This should actually be allowed - routes can have same name but different steps
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateConfig(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetDefaultTimeout(t *testing.T) {
+	tests := []struct {
+		name           string
+		defaultTimeout string
+		expected       time.Duration
+	}{
+		{
+			name:           "explicit timeout",
+			defaultTimeout: "60s",
+			expected:       60 * time.Second,
+		},
+		{
+			name:           "empty timeout",
+			defaultTimeout: "",
+			expected:       30 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{DefaultTimeout: tt.defaultTimeout}
+			result := config.GetDefaultTimeout()
+			if result != tt.expected {
+				t.Errorf("GetDefaultTimeout() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWriteTimeoutWarnings(t *testing.T) {
+	cfg := &Config{
+		Routes: []Route{
+			// 30s step timeout, a 10s one retried twice with 500ms and 1s backoff
+			{Name: "slow", Steps: []RouteStep{{Provider: "a", Model: "m"}, {Provider: "b", Model: "m", Timeout: "10s", Retries: 2}}},
+			{Name: "fast", Steps: []RouteStep{{Provider: "a", Model: "m", Timeout: "20s"}}},
+			{Name: "bounded", RequestTimeout: "25s", Steps: []RouteStep{{Provider: "a", Model: "m"}, {Provider: "b", Model: "m"}}},
+		},
+	}
+
+	if got := cfg.Routes[0].WorstCaseDuration(0); got != 61500*time.Millisecond {
+		t.Errorf("Expected worst case 1m1.5s, got %s", got)
+	}
+	warnings := cfg.WriteTimeoutWarnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "'slow'") {
+		t.Errorf("Expected a warning for the slow route only, got %v", warnings)
+	}
+
+	cfg.WriteTimeout = "2m"
+	if warnings := cfg.WriteTimeoutWarnings(); len(warnings) != 0 {
+		t.Errorf("Expected no warnings with a longer write_timeout, got %v", warnings)
+	}
+}
+
+func TestDisabledProviderWarnings(t *testing.T) {
+	cfg := &Config{
+		Providers: []Provider{
+			{Name: "off", Disabled: true},
+			{Name: "on"},
+		},
+		Routes: []Route{
+			{Name: "stranded", Steps: []RouteStep{{Provider: "off", Model: "m"}}},
+			{Name: "covered", Steps: []RouteStep{{Provider: "off", Model: "m"}, {Provider: "on", Model: "m"}}},
+			{Name: "parked", Disabled: true, Steps: []RouteStep{{Provider: "off", Model: "m"}}},
+		},
+	}
+	if err := validateConfig(&Config{APIKey: "test-key", Providers: []Provider{{Name: "off", APIKey: "key", BaseURL: "http://test.com", Disabled: true}}, Routes: cfg.Routes[:1]}); err != nil {
+		t.Fatalf("Expected a route with only disabled providers to be valid, got %v", err)
+	}
+
+	warnings := cfg.DisabledProviderWarnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "'stranded'") {
+		t.Errorf("Expected a warning for the stranded route only, got %v", warnings)
+	}
+}
+
+func TestInsecureProviderWarnings(t *testing.T) {
+	cfg := &Config{Providers: []Provider{{Name: "vllm", InsecureSkipVerify: true}, {Name: "openai"}}}
+	warnings := cfg.Warnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "'vllm'") || !strings.Contains(warnings[0], "insecure_skip_verify") {
+		t.Errorf("Expected one warning for the insecure provider, got %v", warnings)
+	}
+}
+
+func TestProviderKeys(t *testing.T) {
+	p := Provider{APIKey: "primary", APIKeys: []string{"primary", "secondary", ""}}
+	keys := p.Keys()
+	if len(keys) != 2 || keys[0] != "primary" || keys[1] != "secondary" {
+		t.Errorf("Expected [primary secondary], got %v", keys)
+	}
+
+	if keys := (Provider{}).Keys(); len(keys) != 0 {
+		t.Errorf("Expected no keys, got %v", keys)
+	}
+}
+
+func TestValidateConfigInheritsProxyURL(t *testing.T) {
+	cfg := &Config{
+		APIKey:   "test-key",
+		ProxyURL: "http://proxy.internal:3128",
+		Providers: []Provider{
+			{Name: "inherits", APIKey: "key", BaseURL: "http://test.com"},
+			{Name: "own", APIKey: "key", BaseURL: "http://test.com", ProxyURL: "socks5://socks.internal:1080"},
+		},
+	}
+	if err := validateConfig(cfg); err != nil {
+		t.Fatalf("validateConfig() error = %v", err)
+	}
+	if got := cfg.Providers[0].ProxyURL; got != "http://proxy.internal:3128" {
+		t.Errorf("Expected provider to inherit the global proxy_url, got '%s'", got)
+	}
+	if got := cfg.Providers[1].ProxyURL; got != "socks5://socks.internal:1080" {
+		t.Errorf("Expected provider to keep its own proxy_url, got '%s'", got)
+	}
+}
+
+func TestValidateConfigTLSFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	for _, path := range []string{certFile, keyFile} {
+		if err := os.WriteFile(path, []byte("pem"), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		certFile string
+		keyFile  string
+		wantErr  bool
+	}{
+		{"both files", certFile, keyFile, false},
+		{"neither file", "", "", false},
+		{"cert without key", certFile, "", true},
+		{"missing key file", certFile, filepath.Join(dir, "missing.pem"), true},
+		{"directory as cert", dir, keyFile, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				APIKey:      "test-key",
+				TLSCertFile: tt.certFile,
+				TLSKeyFile:  tt.keyFile,
+				Providers:   []Provider{{Name: "test", APIKey: "key", BaseURL: "http://test.com"}},
+			}
+			err := validateConfig(cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateConfigProviderTLS(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "not.pem")
+	if err := os.WriteFile(notPEM, []byte("pem"), 0600); err != nil {
+		t.Fatalf("Failed to write %s: %v", notPEM, err)
+	}
+
+	tests := []struct {
+		name     string
+		provider Provider
+	}{
+		{"cert without key", Provider{TLSClientCert: notPEM}},
+		{"unparseable cert", Provider{TLSClientCert: notPEM, TLSClientKey: notPEM}},
+		{"missing ca", Provider{TLSCA: filepath.Join(dir, "missing.pem")}},
+		{"ca without certificates", Provider{TLSCA: notPEM}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := tt.provider
+			provider.Name, provider.APIKey, provider.BaseURL = "test", "key", "https://test.com"
+			cfg := &Config{APIKey: "test-key", Providers: []Provider{provider}}
+			if err := validateConfig(cfg); err == nil || !strings.Contains(err.Error(), "provider[0] (test)") {
+				t.Errorf("validateConfig() error = %v, want a provider TLS error", err)
+			}
+		})
+	}
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// SecretResolver fetches the value of a ${prefix:reference} placeholder in
+// the configuration. Errors must not include the secret itself.
+type SecretResolver interface {
+	Resolve(ref string) (string, error)
+}
+
+// secretResolvers maps placeholder prefixes to their resolvers. A placeholder
+// without a prefix, like ${VAR}, reads the environment.
+var secretResolvers = map[string]SecretResolver{
+	"env":   envResolver{},
+	"vault": vaultResolver{client: &http.Client{Timeout: 10 * time.Second}},
+}
+
+// RegisterSecretResolver makes ${prefix:reference} placeholders resolve with r
+func RegisterSecretResolver(prefix string, r SecretResolver) {
+	secretResolvers[prefix] = r
+}
+
+// resolvePlaceholder returns the value of a ${...} placeholder: an environment
+// variable by default, or the secret named by a registered prefix
+func resolvePlaceholder(key string) (string, error) {
+	prefix, ref, ok := strings.Cut(key, ":")
+	if !ok {
+		return os.Getenv(key), nil
+	}
+	// ${VAR:-default} is an environment variable with a default, not a resolver
+	if fallback, isDefault := strings.CutPrefix(ref, "-"); isDefault {
+		if value := os.Getenv(prefix); value != "" {
+			return value, nil
+		}
+		return fallback, nil
+	}
+	resolver, ok := secretResolvers[prefix]
+	if !ok {
+		return "", fmt.Errorf("unknown secret resolver '%s' in ${%s}", prefix, key)
+	}
+	value, err := resolver.Resolve(ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve ${%s}: %w", key, err)
+	}
+	return value, nil
+}
+
+// envResolver reads ${env:VAR}, which unlike ${VAR} is an error when unset
+type envResolver struct{}
+
+func (envResolver) Resolve(name string) (string, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+// vaultResolver reads ${vault:path#field} from HashiCorp Vault at VAULT_ADDR
+// with VAULT_TOKEN. Both KV v1 and KV v2 (secret/data/...) paths work.
+type vaultResolver struct {
+	client *http.Client
+}
+
+func (v vaultResolver) Resolve(ref string) (string, error) {
+	path, field, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || field == "" {
+		return "", fmt.Errorf("vault reference must be 'path#field'")
+	}
+	addr := strings.TrimSuffix(os.Getenv("VAULT_ADDR"), "/")
+	token := os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return "", fmt.Errorf("VAULT_ADDR and VAULT_TOKEN are required")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, addr+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned status %d", resp.StatusCode)
+	}
+
+	var secret struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return "", fmt.Errorf("failed to parse vault response: %w", err)
+	}
+	data := secret.Data
+	// KV v2 nests the fields under data.data, next to data.metadata
+	if nested, ok := data["data"]; ok && data["metadata"] != nil {
+		data = nil
+		if err := json.Unmarshal(nested, &data); err != nil {
+			return "", fmt.Errorf("failed to parse vault response: %w", err)
+		}
+	}
+	var value string
+	if raw, ok := data[field]; !ok || json.Unmarshal(raw, &value) != nil {
+		return "", fmt.Errorf("vault secret has no string field '%s'", field)
+	}
+	return value, nil
+}
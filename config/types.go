@@ -1,38 +1,381 @@
 package config
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
 	"time"
 )
 
 // Config represents the gateway configuration
 type Config struct {
-	APIKey         string     `yaml:"api_key"`
-	Port           int        `yaml:"port"`
-	DefaultTimeout string     `yaml:"default_timeout"`
-	Providers      []Provider `yaml:"providers"`
-	Routes         []Route    `yaml:"routes"`
-	EnvVars        []string   `yaml:"-"`
+	APIKey                  string      `yaml:"api_key" json:"api_key"`
+	APIKeyFile              string      `yaml:"api_key_file" json:"api_key_file"` // read into api_key at load time
+	APIKeys                 []ClientKey `yaml:"api_keys" json:"api_keys"`
+	AdminAPIKey             string      `yaml:"admin_api_key" json:"admin_api_key"` // enables /admin endpoints
+	Port                    int         `yaml:"port" json:"port"`
+	BasePath                string      `yaml:"base_path" json:"base_path"` // prefix for every route, e.g. /ai
+	DefaultTimeout          string      `yaml:"default_timeout" json:"default_timeout"`
+	MaxRequestBytes         int64       `yaml:"max_request_bytes" json:"max_request_bytes"`
+	MaxMessages             int         `yaml:"max_messages" json:"max_messages"` // chat messages per request, 0 for no limit
+	MetricsEnabled          bool        `yaml:"metrics_enabled" json:"metrics_enabled"`
+	HealthCheckInterval     string      `yaml:"health_check_interval" json:"health_check_interval"`
+	HealthCheckThreshold    int         `yaml:"health_check_threshold" json:"health_check_threshold"`
+	ModelsSource            string      `yaml:"models_source" json:"models_source"`
+	ModelsRefreshInterval   string      `yaml:"models_refresh_interval" json:"models_refresh_interval"`
+	ValidateModels          string      `yaml:"validate_models" json:"validate_models"`
+	CircuitBreakerThreshold int         `yaml:"circuit_breaker_threshold" json:"circuit_breaker_threshold"`
+	CircuitBreakerWindow    string      `yaml:"circuit_breaker_window" json:"circuit_breaker_window"`
+	CircuitBreakerCooldown  string      `yaml:"circuit_breaker_cooldown" json:"circuit_breaker_cooldown"`
+	CacheEnabled            bool        `yaml:"cache_enabled" json:"cache_enabled"`
+	CacheTTL                string      `yaml:"cache_ttl" json:"cache_ttl"`
+	CacheMaxEntries         int         `yaml:"cache_max_entries" json:"cache_max_entries"`
+	IdempotencyEnabled      bool        `yaml:"idempotency_enabled" json:"idempotency_enabled"`
+	IdempotencyTTL          string      `yaml:"idempotency_ttl" json:"idempotency_ttl"`
+	ShutdownTimeout         string      `yaml:"shutdown_timeout" json:"shutdown_timeout"`
+	ReadTimeout             string      `yaml:"read_timeout" json:"read_timeout"`
+	WriteTimeout            string      `yaml:"write_timeout" json:"write_timeout"`
+	RateLimitRPS            float64     `yaml:"rate_limit_rps" json:"rate_limit_rps"`
+	RateLimitBurst          int         `yaml:"rate_limit_burst" json:"rate_limit_burst"`
+	Budgets                 BudgetTable `yaml:"budgets" json:"budgets"`
+	BudgetPeriod            string      `yaml:"budget_period" json:"budget_period"`
+	MaxConcurrentRequests   int         `yaml:"max_concurrent_requests" json:"max_concurrent_requests"`
+	RequestQueueTimeout     string      `yaml:"request_queue_timeout" json:"request_queue_timeout"`
+	CORSAllowedOrigins      []string    `yaml:"cors_allowed_origins" json:"cors_allowed_origins"`
+	CORSAllowedMethods      []string    `yaml:"cors_allowed_methods" json:"cors_allowed_methods"`
+	CORSAllowedHeaders      []string    `yaml:"cors_allowed_headers" json:"cors_allowed_headers"`
+	Prices                  PriceTable  `yaml:"prices" json:"prices"`
+	RequestTimeout          string      `yaml:"request_timeout" json:"request_timeout"`
+	RequireChoices          *bool       `yaml:"require_choices" json:"require_choices"`
+	DialTimeout             string      `yaml:"dial_timeout" json:"dial_timeout"`
+	ResponseHeaderTimeout   string      `yaml:"response_header_timeout" json:"response_header_timeout"`
+	LogLevel                string      `yaml:"log_level" json:"log_level"`
+	LogFormat               string      `yaml:"log_format" json:"log_format"`
+	LogOutput               string      `yaml:"log_output" json:"log_output"`
+	DebugHeaders            bool        `yaml:"debug_headers" json:"debug_headers"` // X-Gateway-Route and X-Gateway-Provider on responses
+	RedactKeys              []RedactKey `yaml:"redact_keys" json:"redact_keys"`
+	ParamLimits             ParamLimits `yaml:"param_limits" json:"param_limits"`
+	ValidateTools           bool        `yaml:"validate_tools" json:"validate_tools"`
+	ValidateStop            bool        `yaml:"validate_stop" json:"validate_stop"`
+	ValidateContentBlocks   bool        `yaml:"validate_content_blocks" json:"validate_content_blocks"`
+	MaxInlineImageBytes     int64       `yaml:"max_inline_image_bytes" json:"max_inline_image_bytes"`
+	ProxyURL                string      `yaml:"proxy_url" json:"proxy_url"` // default proxy for providers without their own
+	UserAgent               string      `yaml:"user_agent" json:"user_agent"`
+	TLSCertFile             string      `yaml:"tls_cert_file" json:"tls_cert_file"`
+	TLSKeyFile              string      `yaml:"tls_key_file" json:"tls_key_file"`
+	AuditEnabled            bool        `yaml:"audit_enabled" json:"audit_enabled"`
+	AuditFile               string      `yaml:"audit_file" json:"audit_file"`
+	AuditMaxSizeMB          int         `yaml:"audit_max_size_mb" json:"audit_max_size_mb"`
+	AuditMaxBackups         int         `yaml:"audit_max_backups" json:"audit_max_backups"`
+	AuditRedactFields       []string    `yaml:"audit_redact_fields" json:"audit_redact_fields"`
+	Providers               []Provider  `yaml:"providers" json:"providers"`
+	Routes                  []Route     `yaml:"routes" json:"routes"`
+	EnvVars                 []string    `yaml:"-" json:"-"`
 }
 
+// ClientKey is a labeled gateway key, e.g. one per team. The label names the
+// key in logs and in a route's allowed_keys without exposing the key itself.
+type ClientKey struct {
+	Label string `yaml:"label" json:"label"`
+	Key   string `yaml:"key" json:"key"`
+}
+
+// DefaultKeyLabel is the label of the key set with api_key
+const DefaultKeyLabel = "default"
+
+// ClientKeys returns every key clients can authenticate with: api_key under
+// DefaultKeyLabel, followed by api_keys
+func (c *Config) ClientKeys() []ClientKey {
+	var keys []ClientKey
+	if c.APIKey != "" {
+		keys = append(keys, ClientKey{Label: DefaultKeyLabel, Key: c.APIKey})
+	}
+	return append(keys, c.APIKeys...)
+}
+
+// ParamLimits maps numeric request parameters (temperature, top_p, max_tokens,
+// n, ...) to their allowed range. Parameters without limits pass through unchecked.
+type ParamLimits map[string]ParamRange
+
+// ParamRange is an inclusive range; a nil bound is unbounded
+type ParamRange struct {
+	Min *float64 `yaml:"min,omitempty" json:"min,omitempty"`
+	Max *float64 `yaml:"max,omitempty" json:"max,omitempty"`
+}
+
+// RedactKey names a log field to mask. Match is "substring" (default) or "exact".
+type RedactKey struct {
+	Key   string `yaml:"key" json:"key"`
+	Match string `yaml:"match,omitempty" json:"match,omitempty"`
+}
+
+// BudgetTable maps client key labels to the most they may spend per
+// budget_period, in the currency of the prices table
+type BudgetTable map[string]float64
+
+// PriceTable maps provider model names to their prices
+type PriceTable map[string]ModelPrice
+
+// ModelPrice is the cost of a provider model per thousand tokens
+type ModelPrice struct {
+	PricePer1KPrompt     float64 `yaml:"price_per_1k_prompt" json:"price_per_1k_prompt"`
+	PricePer1KCompletion float64 `yaml:"price_per_1k_completion" json:"price_per_1k_completion"`
+}
+
+// DefaultMaxRequestBytes is the request body limit used when max_request_bytes is not set
+const DefaultMaxRequestBytes = 10 << 20 // 10MB
+
 // Provider represents a single AI provider configuration
 type Provider struct {
-	Name    string `yaml:"name"`
-	APIKey  string `yaml:"api_key"`
-	BaseURL string `yaml:"base_url"`
+	Name       string   `yaml:"name" json:"name"`
+	Type       string   `yaml:"type,omitempty" json:"type,omitempty"` // "openai" (default) or "azure"
+	APIKey     string   `yaml:"api_key" json:"api_key"`
+	APIKeyFile string   `yaml:"api_key_file,omitempty" json:"api_key_file,omitempty"` // read into api_key at load time
+	APIKeys    []string `yaml:"api_keys,omitempty" json:"api_keys,omitempty"`
+	BaseURL    string   `yaml:"base_url" json:"base_url"`
+	APIVersion string   `yaml:"api_version,omitempty" json:"api_version,omitempty"` // Azure OpenAI api-version query parameter
+	// ForwardHeaders lists client request headers copied onto upstream requests
+	ForwardHeaders []string `yaml:"forward_headers,omitempty" json:"forward_headers,omitempty"`
+	// ResponseHeaders lists upstream response headers copied onto the
+	// gateway's chat completion responses, e.g. x-ratelimit-remaining-requests
+	ResponseHeaders []string `yaml:"response_headers,omitempty" json:"response_headers,omitempty"`
+	// Headers are static headers added to every upstream request
+	Headers map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	// ProxyURL routes upstream requests through an http, https or socks5 proxy.
+	// Without it the HTTP_PROXY, HTTPS_PROXY and NO_PROXY env vars apply.
+	ProxyURL string `yaml:"proxy_url,omitempty" json:"proxy_url,omitempty"`
+	// TLSClientCert and TLSClientKey are PEM files of the client certificate
+	// presented to providers that require mutual TLS. TLSCA is a PEM bundle
+	// trusted for the provider's certificate instead of the system roots.
+	TLSClientCert string `yaml:"tls_client_cert,omitempty" json:"tls_client_cert,omitempty"`
+	TLSClientKey  string `yaml:"tls_client_key,omitempty" json:"tls_client_key,omitempty"`
+	TLSCA         string `yaml:"tls_ca,omitempty" json:"tls_ca,omitempty"`
+	// InsecureSkipVerify accepts any certificate from the provider, e.g. an
+	// internal server with a self-signed one. Logged as a warning when set.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify,omitempty" json:"insecure_skip_verify,omitempty"`
+	// UserAgent is sent on every upstream request, defaulting to the global
+	// user_agent and then to "ai-gateway/<version>"
+	UserAgent string `yaml:"user_agent,omitempty" json:"user_agent,omitempty"`
+	// ChatCompletionsPath replaces "/chat/completions" for providers serving it
+	// elsewhere, e.g. "/v1/chat" or "/openai/chat/completions"; joined to base_url
+	ChatCompletionsPath string `yaml:"chat_completions_path,omitempty" json:"chat_completions_path,omitempty"`
+	// MaxConcurrency caps in-flight requests to the provider, 0 for no limit.
+	// OnSaturation decides what a step does at the cap: "wait" (default) up to
+	// QueueTimeout for a free slot, or "fallback" to the next step right away.
+	MaxConcurrency int    `yaml:"max_concurrency,omitempty" json:"max_concurrency,omitempty"`
+	OnSaturation   string `yaml:"on_saturation,omitempty" json:"on_saturation,omitempty"`
+	QueueTimeout   string `yaml:"queue_timeout,omitempty" json:"queue_timeout,omitempty"`
+	// RateLimitRPM and RateLimitTPM cap the requests and estimated tokens per
+	// minute sent to the provider across all routes, 0 for no limit. At the
+	// limit a step waits for capacity within its timeout, or falls back right
+	// away with on_saturation "fallback".
+	RateLimitRPM int `yaml:"rate_limit_rpm,omitempty" json:"rate_limit_rpm,omitempty"`
+	RateLimitTPM int `yaml:"rate_limit_tpm,omitempty" json:"rate_limit_tpm,omitempty"`
+	// Disabled providers keep their configuration but their steps are skipped
+	Disabled bool `yaml:"disabled,omitempty" json:"disabled,omitempty"`
+	// ForceStream sends every chat request with stream set, for providers that
+	// only stream; non-streaming requests get the events aggregated into one completion
+	ForceStream bool `yaml:"force_stream,omitempty" json:"force_stream,omitempty"`
+}
+
+// Provider types
+const (
+	ProviderTypeOpenAI = "openai"
+	ProviderTypeAzure  = "azure"
+	ProviderTypeGemini = "gemini"
+)
+
+// Provider on_saturation values
+const (
+	SaturationWait     = "wait"
+	SaturationFallback = "fallback"
+)
+
+// GetQueueTimeout returns how long a step waits for a free slot when the provider is saturated
+func (p Provider) GetQueueTimeout() time.Duration {
+	if p.QueueTimeout == "" {
+		return time.Second
+	}
+	duration, err := time.ParseDuration(p.QueueTimeout)
+	if err != nil {
+		return time.Second
+	}
+	return duration
+}
+
+// TLSConfig loads the provider's client certificate and CA bundle into a TLS
+// configuration for its transport. It returns nil when no TLS option is set.
+func (p Provider) TLSConfig() (*tls.Config, error) {
+	if p.TLSClientCert == "" && p.TLSClientKey == "" && p.TLSCA == "" && !p.InsecureSkipVerify {
+		return nil, nil
+	}
+	config := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: p.InsecureSkipVerify}
+	if p.TLSClientCert != "" || p.TLSClientKey != "" {
+		if p.TLSClientCert == "" || p.TLSClientKey == "" {
+			return nil, fmt.Errorf("tls_client_cert and tls_client_key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(p.TLSClientCert, p.TLSClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if p.TLSCA != "" {
+		pem, err := os.ReadFile(p.TLSCA)
+		if err != nil {
+			return nil, fmt.Errorf("tls_ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls_ca: no PEM certificates in %s", p.TLSCA)
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+// Keys returns the provider's non-empty API keys, with api_key first when both forms are set
+func (p Provider) Keys() []string {
+	var keys []string
+	if strings.TrimSpace(p.APIKey) != "" {
+		keys = append(keys, p.APIKey)
+	}
+	for _, key := range p.APIKeys {
+		if strings.TrimSpace(key) != "" && key != p.APIKey {
+			keys = append(keys, key)
+		}
+	}
+	return keys
 }
 
 // Route represents a route configuration that matches incoming request models
 type Route struct {
-	Name  string      `yaml:"name"`
-	Steps []RouteStep `yaml:"steps"`
+	Name           string      `yaml:"name" json:"name"`
+	Strategy       string      `yaml:"strategy,omitempty" json:"strategy,omitempty"`         // "sequential" (default), "weighted", "hedge" or "latency"
+	HedgeDelay     string      `yaml:"hedge_delay,omitempty" json:"hedge_delay,omitempty"`   // hedge only: wait before racing the second step
+	MaxAttempts    int         `yaml:"max_attempts,omitempty" json:"max_attempts,omitempty"` // upstream calls per request across steps and retries, 0 for no limit
+	Default        bool        `yaml:"default,omitempty" json:"default,omitempty"`
+	RequestTimeout string      `yaml:"request_timeout,omitempty" json:"request_timeout,omitempty"` // overrides the global request_timeout
+	Steps          []RouteStep `yaml:"steps" json:"steps"`
+	// FallbackOn lists the step errors that move on to the next step: "4xx",
+	// "5xx", "timeout", "network" or a status code such as 429. Other errors
+	// are returned to the client right away. Empty falls back on every error.
+	FallbackOn []string `yaml:"fallback_on,omitempty" json:"fallback_on,omitempty"`
+	// Metadata describes the model's capabilities in /v1/models, e.g.
+	// context_window, supports_tools, supports_vision, supports_streaming
+	Metadata map[string]interface{} `yaml:"metadata,omitempty" json:"metadata,omitempty"`
+	// Disabled routes keep their configuration but match no model
+	Disabled bool `yaml:"disabled,omitempty" json:"disabled,omitempty"`
+	// AllowedKeys restricts the route to these client key labels. Empty
+	// allows every valid key.
+	AllowedKeys []string `yaml:"allowed_keys,omitempty" json:"allowed_keys,omitempty"`
+	// MaxPromptChars rejects chat requests whose message text is longer, before
+	// any provider is called. 0 for no limit.
+	MaxPromptChars int `yaml:"max_prompt_chars,omitempty" json:"max_prompt_chars,omitempty"`
+	// FallbackResponse is returned as the assistant message of a normal chat
+	// completion when every step fails, instead of an error. Streaming
+	// requests, request_timeout expiries and errors fallback_on stops at
+	// still get the error.
+	FallbackResponse string `yaml:"fallback_response,omitempty" json:"fallback_response,omitempty"`
+}
+
+// Error classes accepted in a route's fallback_on besides specific status codes
+const (
+	FallbackOn4xx     = "4xx"
+	FallbackOn5xx     = "5xx"
+	FallbackOnTimeout = "timeout"
+	FallbackOnNetwork = "network" // connection failures and other errors without an upstream status
+)
+
+// IsDefault reports whether the route is the catch-all used when no other route matches
+func (r Route) IsDefault() bool {
+	return r.Default || r.Name == "*"
+}
+
+// AllowsKey reports whether clients authenticated with the labeled key may use the route
+func (r Route) AllowsKey(label string) bool {
+	return len(r.AllowedKeys) == 0 || slices.Contains(r.AllowedKeys, label)
+}
+
+// GetRequestTimeout returns the route's overall time limit, or def when the route doesn't set one
+func (r Route) GetRequestTimeout(def time.Duration) time.Duration {
+	if r.RequestTimeout == "" {
+		return def
+	}
+	duration, err := time.ParseDuration(r.RequestTimeout)
+	if err != nil {
+		return def
+	}
+	return duration
+}
+
+// WorstCaseDuration returns the longest a non-streaming request on the route
+// may run: its request_timeout, or the global one, when set, otherwise every
+// step timing out after all of its retries and backoff waits
+func (r Route) WorstCaseDuration(requestTimeout time.Duration) time.Duration {
+	if timeout := r.GetRequestTimeout(requestTimeout); timeout > 0 {
+		return timeout
+	}
+	var total time.Duration
+	for _, step := range r.Steps {
+		total += time.Duration(step.Retries+1) * GetTimeout(step.Timeout, "30s")
+		for retry := 1; retry <= step.Retries; retry++ {
+			total += step.GetBackoff() << (retry - 1)
+		}
+	}
+	return total
+}
+
+// GetHedgeDelay returns how long a hedge route waits for its first step before starting the second
+func (r Route) GetHedgeDelay() time.Duration {
+	if r.HedgeDelay == "" {
+		return 200 * time.Millisecond
+	}
+	duration, err := time.ParseDuration(r.HedgeDelay)
+	if err != nil {
+		return 200 * time.Millisecond
+	}
+	return duration
 }
 
 // RouteStep represents a single step in a route
 type RouteStep struct {
-	Provider           string `yaml:"provider"`
-	Model              string `yaml:"model"`
-	Timeout            string `yaml:"timeout,omitempty"`
-	ConflictResolution string `yaml:"conflict_resolution,omitempty"`
+	Provider           string `yaml:"provider" json:"provider"`
+	Model              string `yaml:"model" json:"model"`
+	Timeout            string `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	ConflictResolution string `yaml:"conflict_resolution,omitempty" json:"conflict_resolution,omitempty"`
+	Retries            int    `yaml:"retries,omitempty" json:"retries,omitempty"`
+	Backoff            string `yaml:"backoff,omitempty" json:"backoff,omitempty"`
+	Weight             int    `yaml:"weight,omitempty" json:"weight,omitempty"`
+	Deployment         string `yaml:"deployment,omitempty" json:"deployment,omitempty"` // Azure deployment, defaults to model
+	// ForwardHeaders adds to the provider's forward_headers for this step
+	ForwardHeaders []string `yaml:"forward_headers,omitempty" json:"forward_headers,omitempty"`
+	// Defaults are request parameters (temperature, max_tokens, ...) added when the client omits them
+	Defaults map[string]interface{} `yaml:"defaults,omitempty" json:"defaults,omitempty"`
+	// Overrides are request parameters forced on this step, replacing whatever the client sent
+	Overrides map[string]interface{} `yaml:"overrides,omitempty" json:"overrides,omitempty"`
+	// RenameParams renames top-level request parameters for this step's
+	// provider, e.g. max_tokens: max_completion_tokens
+	RenameParams map[string]string `yaml:"rename_params,omitempty" json:"rename_params,omitempty"`
+	// RenameResponse renames fields of the provider's response, at the top
+	// level and in each choice's message, e.g. reasoning: reasoning_content
+	RenameResponse map[string]string `yaml:"rename_response,omitempty" json:"rename_response,omitempty"`
+	// PreserveModel sends the model the client asked for instead of Model,
+	// for passthrough routes whose model names the provider already knows
+	PreserveModel bool `yaml:"preserve_model,omitempty" json:"preserve_model,omitempty"`
+	// MaxMessages and MaxContextTokens opt in to dropping the oldest messages
+	// of long conversations to fit the step model's context window, 0 for no
+	// limit. Tokens are estimated from the messages' JSON size.
+	MaxMessages      int `yaml:"max_messages,omitempty" json:"max_messages,omitempty"`
+	MaxContextTokens int `yaml:"max_context_tokens,omitempty" json:"max_context_tokens,omitempty"`
+	// Canary is the percentage of requests that start with this step, to roll
+	// out a new provider or model under an existing route name. The other
+	// requests try it after every other step. 0 for a regular step.
+	Canary int `yaml:"canary,omitempty" json:"canary,omitempty"`
 }
 
 // GetTimeout returns the timeout as a time.Duration for a route step
@@ -56,4 +399,278 @@ func GetTimeout(stepTimeout, defaultTimeout string) time.Duration {
 // GetDefaultTimeout returns the default timeout as a time.Duration
 func (c *Config) GetDefaultTimeout() time.Duration {
 	return GetTimeout("", c.DefaultTimeout)
-}
\ No newline at end of file
+}
+
+// UpstreamModel returns the model the step sends to its provider for a
+// request that asked for the given model
+func (s RouteStep) UpstreamModel(requested string) string {
+	if s.PreserveModel {
+		return requested
+	}
+	return s.Model
+}
+
+// GetBackoff returns the initial delay between retries of a route step
+func (s RouteStep) GetBackoff() time.Duration {
+	if s.Backoff == "" {
+		return 500 * time.Millisecond
+	}
+	duration, err := time.ParseDuration(s.Backoff)
+	if err != nil {
+		return 500 * time.Millisecond
+	}
+	return duration
+}
+
+// GetMaxRequestBytes returns the maximum accepted request body size in bytes
+func (c *Config) GetMaxRequestBytes() int64 {
+	if c.MaxRequestBytes <= 0 {
+		return DefaultMaxRequestBytes
+	}
+	return c.MaxRequestBytes
+}
+
+// Sources for the /v1/models list, set with models_source
+const (
+	ModelsSourceRoutes   = "routes"   // configured route names (default)
+	ModelsSourceUpstream = "upstream" // models reported by the providers' /models endpoints
+	ModelsSourceBoth     = "both"     // route names followed by upstream models not already listed
+)
+
+// Startup checks of route step models against the providers' model lists,
+// set with validate_models
+const (
+	ModelValidationOff   = "off"   // no check (default)
+	ModelValidationWarn  = "warn"  // log a warning per unknown model
+	ModelValidationError = "error" // refuse to start
+)
+
+// Periods after which budgets start over, set with budget_period
+const (
+	BudgetPeriodDaily   = "daily"   // resets at midnight UTC
+	BudgetPeriodMonthly = "monthly" // resets on the first of the month, UTC (default)
+)
+
+// GetBudgetPeriod returns the budget period, defaulting to monthly
+func (c *Config) GetBudgetPeriod() string {
+	if c.BudgetPeriod == "" {
+		return BudgetPeriodMonthly
+	}
+	return c.BudgetPeriod
+}
+
+// GetModelsSource returns where /v1/models gets its list, defaulting to the routes
+func (c *Config) GetModelsSource() string {
+	if c.ModelsSource == "" {
+		return ModelsSourceRoutes
+	}
+	return c.ModelsSource
+}
+
+// GetModelsRefreshInterval returns how long upstream model lists are cached before they are fetched again
+func (c *Config) GetModelsRefreshInterval() time.Duration {
+	if c.ModelsRefreshInterval == "" {
+		return 10 * time.Minute
+	}
+	duration, err := time.ParseDuration(c.ModelsRefreshInterval)
+	if err != nil {
+		return 10 * time.Minute
+	}
+	return duration
+}
+
+// GetHealthCheckInterval returns the provider probe interval, or zero when health checks are disabled
+func (c *Config) GetHealthCheckInterval() time.Duration {
+	if c.HealthCheckInterval == "" {
+		return 0
+	}
+	duration, err := time.ParseDuration(c.HealthCheckInterval)
+	if err != nil {
+		return 0
+	}
+	return duration
+}
+
+// GetCircuitBreakerWindow returns the window in which failures are counted, zero meaning unlimited
+func (c *Config) GetCircuitBreakerWindow() time.Duration {
+	duration, err := time.ParseDuration(c.CircuitBreakerWindow)
+	if err != nil {
+		return 0
+	}
+	return duration
+}
+
+// GetCircuitBreakerCooldown returns how long an open circuit skips its provider
+func (c *Config) GetCircuitBreakerCooldown() time.Duration {
+	if c.CircuitBreakerCooldown == "" {
+		return 30 * time.Second
+	}
+	duration, err := time.ParseDuration(c.CircuitBreakerCooldown)
+	if err != nil {
+		return 30 * time.Second
+	}
+	return duration
+}
+
+// GetCacheTTL returns how long cached responses stay valid
+func (c *Config) GetCacheTTL() time.Duration {
+	if c.CacheTTL == "" {
+		return 5 * time.Minute
+	}
+	duration, err := time.ParseDuration(c.CacheTTL)
+	if err != nil {
+		return 5 * time.Minute
+	}
+	return duration
+}
+
+// GetRequestTimeout returns the overall time limit for a request across all route steps, 0 if unlimited
+func (c *Config) GetRequestTimeout() time.Duration {
+	if c.RequestTimeout == "" {
+		return 0
+	}
+	duration, err := time.ParseDuration(c.RequestTimeout)
+	if err != nil {
+		return 0
+	}
+	return duration
+}
+
+// GetRequestQueueTimeout returns how long a chat completion over
+// max_concurrent_requests waits for a slot, 0 to reject it right away
+func (c *Config) GetRequestQueueTimeout() time.Duration {
+	if c.RequestQueueTimeout == "" {
+		return 0
+	}
+	duration, err := time.ParseDuration(c.RequestQueueTimeout)
+	if err != nil {
+		return 0
+	}
+	return duration
+}
+
+// GetDialTimeout returns the limit for connecting to a provider, 0 for
+// net/http's default of 30s
+func (c *Config) GetDialTimeout() time.Duration {
+	if c.DialTimeout == "" {
+		return 0
+	}
+	duration, err := time.ParseDuration(c.DialTimeout)
+	if err != nil {
+		return 0
+	}
+	return duration
+}
+
+// GetResponseHeaderTimeout returns how long to wait for a provider's response
+// headers once the request is sent, 0 for no limit beyond the step timeout
+func (c *Config) GetResponseHeaderTimeout() time.Duration {
+	if c.ResponseHeaderTimeout == "" {
+		return 0
+	}
+	duration, err := time.ParseDuration(c.ResponseHeaderTimeout)
+	if err != nil {
+		return 0
+	}
+	return duration
+}
+
+// GetRequireChoices reports whether a 200 chat response without choices fails
+// the step, which is the default
+func (c *Config) GetRequireChoices() bool {
+	return c.RequireChoices == nil || *c.RequireChoices
+}
+
+// GetShutdownTimeout returns how long shutdown waits for in-flight requests to finish
+func (c *Config) GetShutdownTimeout() time.Duration {
+	if c.ShutdownTimeout == "" {
+		return 30 * time.Second
+	}
+	duration, err := time.ParseDuration(c.ShutdownTimeout)
+	if err != nil {
+		return 30 * time.Second
+	}
+	return duration
+}
+
+// GetReadTimeout returns how long the server may take to read a request, body included
+func (c *Config) GetReadTimeout() time.Duration {
+	if c.ReadTimeout == "" {
+		return 30 * time.Second
+	}
+	duration, err := time.ParseDuration(c.ReadTimeout)
+	if err != nil {
+		return 30 * time.Second
+	}
+	return duration
+}
+
+// GetWriteTimeout returns how long the server may take to write a response,
+// which bounds the whole non-streaming request
+func (c *Config) GetWriteTimeout() time.Duration {
+	if c.WriteTimeout == "" {
+		return 30 * time.Second
+	}
+	duration, err := time.ParseDuration(c.WriteTimeout)
+	if err != nil {
+		return 30 * time.Second
+	}
+	return duration
+}
+
+// GetRateLimitBurst returns the token bucket size, defaulting to one second's worth of requests
+func (c *Config) GetRateLimitBurst() int {
+	if c.RateLimitBurst > 0 {
+		return c.RateLimitBurst
+	}
+	return max(1, int(math.Ceil(c.RateLimitRPS)))
+}
+
+// TLSEnabled reports whether the gateway serves HTTPS with the configured certificate
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+// GetIdempotencyTTL returns how long a response is replayed for its Idempotency-Key
+func (c *Config) GetIdempotencyTTL() time.Duration {
+	if c.IdempotencyTTL == "" {
+		return 24 * time.Hour
+	}
+	duration, err := time.ParseDuration(c.IdempotencyTTL)
+	if err != nil {
+		return 24 * time.Hour
+	}
+	return duration
+}
+
+// GetCacheMaxEntries returns the maximum number of cached responses
+func (c *Config) GetCacheMaxEntries() int {
+	if c.CacheMaxEntries <= 0 {
+		return 1000
+	}
+	return c.CacheMaxEntries
+}
+
+// GetAuditFile returns the audit log path
+func (c *Config) GetAuditFile() string {
+	if c.AuditFile == "" {
+		return "audit.log"
+	}
+	return c.AuditFile
+}
+
+// GetAuditMaxBytes returns the audit log size at which it is rotated
+func (c *Config) GetAuditMaxBytes() int64 {
+	if c.AuditMaxSizeMB <= 0 {
+		return 100 << 20 // 100MB
+	}
+	return int64(c.AuditMaxSizeMB) << 20
+}
+
+// GetAuditMaxBackups returns how many rotated audit logs are kept
+func (c *Config) GetAuditMaxBackups() int {
+	if c.AuditMaxBackups <= 0 {
+		return 5
+	}
+	return c.AuditMaxBackups
+}
@@ -3,39 +3,161 @@ package logger
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"log"
+	"sort"
+	"strconv"
 	"strings"
 
 	"ai-gateway/telemetry"
 )
 
+// Level is a log severity; messages below the logger's level are dropped
+type Level int
+
+// Log levels in increasing severity
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// ParseLevel converts a config value ("debug", "info", "warn" or "error") to a Level.
+// An empty string means info.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return LevelDebug, nil
+	case "", "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level '%s'", s)
+}
+
+// Log formats selected with SetFormat
+const (
+	FormatJSON = "json" // one JSON object per line, the default
+	FormatText = "text" // "LEVEL message key=value ..." for reading in a terminal
+)
+
+// RedactRule masks log fields by name. Names are compared case-insensitively,
+// either in full (Exact) or as a substring of the field name.
+type RedactRule struct {
+	Key   string
+	Exact bool
+}
+
+// matches reports whether the lowercased field name is covered by the rule
+func (r RedactRule) matches(keyLower string) bool {
+	key := strings.ToLower(r.Key)
+	if r.Exact {
+		return keyLower == key
+	}
+	return strings.Contains(keyLower, key)
+}
+
+// DefaultRedactRules are used when no rules are passed to NewLogger
+var DefaultRedactRules = []RedactRule{
+	{Key: "api_key"},
+	{Key: "apikey"},
+	{Key: "api-key"},
+	{Key: "token"},
+	{Key: "secret"},
+	{Key: "authorization"},
+	{Key: "cookie"},
+}
+
 // Logger provides structured logging with API key redaction
 type Logger struct {
-	redactKeys []string
+	redactRules []RedactRule
+	level       Level
+	out         *log.Logger // nil writes through the standard log package
+	text        bool
 }
 
-// NewLogger creates a new logger instance
-func NewLogger() *Logger {
+// NewLogger creates a new logger instance at info level. The given redaction
+// rules replace DefaultRedactRules; with none, the defaults apply.
+func NewLogger(redactRules ...RedactRule) *Logger {
 	// Disable timestamp and other prefixes from standard logger
 	log.SetFlags(0)
+	if len(redactRules) == 0 {
+		redactRules = DefaultRedactRules
+	}
 	return &Logger{
-		redactKeys: []string{},
+		redactRules: append([]RedactRule(nil), redactRules...),
+		level:       LevelInfo,
 	}
 }
 
+// SetLevel sets the minimum level of emitted messages
+func (l *Logger) SetLevel(level Level) {
+	l.level = level
+}
+
+// SetOutput sends log lines to w instead of the standard log package's output
+func (l *Logger) SetOutput(w io.Writer) {
+	l.out = log.New(w, "", 0)
+}
+
+// SetFormat selects FormatJSON or FormatText; anything else means JSON
+func (l *Logger) SetFormat(format string) {
+	l.text = strings.EqualFold(format, FormatText)
+}
+
+// Enabled reports whether messages at the given level are emitted
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
 // AddRedactKey adds a key to be redacted from logs
 func (l *Logger) AddRedactKey(key string) {
-	l.redactKeys = append(l.redactKeys, key)
+	l.redactRules = append(l.redactRules, RedactRule{Key: key})
+}
+
+// Debug logs a detailed diagnostic message with structured fields
+func (l *Logger) Debug(message string, fields map[string]interface{}) {
+	if !l.Enabled(LevelDebug) {
+		return
+	}
+	l.log("DEBUG", message, fields, nil)
+	telemetry.RecordLog(context.Background(), "debug", message, fields)
 }
 
 // Info logs an info message with structured fields
 func (l *Logger) Info(message string, fields map[string]interface{}) {
+	if !l.Enabled(LevelInfo) {
+		return
+	}
 	l.log("INFO", message, fields, nil)
 	telemetry.RecordLog(context.Background(), "info", message, fields)
 }
 
+// Warn logs a recoverable problem with structured fields
+func (l *Logger) Warn(message string, err error, fields map[string]interface{}) {
+	if !l.Enabled(LevelWarn) {
+		return
+	}
+	if fields == nil {
+		fields = make(map[string]interface{})
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+	}
+	l.log("WARN", message, fields, err)
+	telemetry.RecordLog(context.Background(), "warn", message, fields)
+}
+
 // Error logs an error message with structured fields
 func (l *Logger) Error(message string, err error, fields map[string]interface{}) {
+	if !l.Enabled(LevelError) {
+		return
+	}
 	if fields == nil {
 		fields = make(map[string]interface{})
 	}
@@ -59,14 +181,64 @@ func (l *Logger) log(level, message string, fields map[string]interface{}, err e
 		entry["fields"] = redactedFields
 	}
 
+	if l.text {
+		l.println(formatText(level, message, redactedFields))
+		return
+	}
+
 	// Convert to JSON
 	jsonData, jsonErr := json.Marshal(entry)
 	if jsonErr != nil {
-		log.Printf("[%s] %s: %v", level, message, fields)
+		l.println(fmt.Sprintf("[%s] %s: %v", level, message, fields))
+		return
+	}
+
+	l.println(string(jsonData))
+}
+
+// println writes one log line to the configured output
+func (l *Logger) println(line string) {
+	if l.out != nil {
+		l.out.Println(line)
 		return
 	}
+	log.Println(line)
+}
+
+// formatText renders an entry as "LEVEL message key=value ..." with the keys
+// sorted. Values with spaces or quotes are quoted, nested values are JSON.
+func formatText(level, message string, fields map[string]interface{}) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-5s %s", level, message)
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		b.WriteString(" " + key + "=" + textValue(fields[key]))
+	}
+	return b.String()
+}
 
-	log.Println(string(jsonData))
+func textValue(v interface{}) string {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case map[string]interface{}, []interface{}, []string:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	default:
+		s = fmt.Sprint(v)
+	}
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
 }
 
 // redactSensitiveData removes or redacts sensitive information from fields
@@ -80,8 +252,7 @@ func (l *Logger) redactSensitiveData(fields map[string]interface{}) map[string]i
 		keyLower := strings.ToLower(k)
 
 		// Redact API keys
-		if strings.Contains(keyLower, "api_key") || strings.Contains(keyLower, "apikey") ||
-			strings.Contains(keyLower, "token") || strings.Contains(keyLower, "secret") {
+		if l.isSensitiveKey(keyLower) {
 			redacted[k] = "[REDACTED]"
 			continue
 		}
@@ -103,8 +274,24 @@ func (l *Logger) redactSensitiveData(fields map[string]interface{}) map[string]i
 			}
 		}
 
+		// Redact nested fields such as forwarded headers
+		if m, ok := v.(map[string]interface{}); ok {
+			redacted[k] = l.redactSensitiveData(m)
+			continue
+		}
+
 		redacted[k] = v
 	}
 
 	return redacted
 }
+
+// isSensitiveKey reports whether a lowercased field name matches a redaction rule
+func (l *Logger) isSensitiveKey(keyLower string) bool {
+	for _, rule := range l.redactRules {
+		if rule.matches(keyLower) {
+			return true
+		}
+	}
+	return false
+}
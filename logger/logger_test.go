@@ -0,0 +1,106 @@
+package logger
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLogger_LevelFiltering(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewLogger()
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	l.SetLevel(LevelWarn)
+	l.Debug("debug message", nil)
+	l.Info("info message", nil)
+	l.Warn("warn message", nil, nil)
+	l.Error("error message", nil, nil)
+
+	out := buf.String()
+	for _, dropped := range []string{"debug message", "info message"} {
+		if strings.Contains(out, dropped) {
+			t.Errorf("expected %q to be filtered at warn level, got %s", dropped, out)
+		}
+	}
+	for _, kept := range []string{`"level":"WARN"`, `"level":"ERROR"`} {
+		if !strings.Contains(out, kept) {
+			t.Errorf("expected output to contain %s, got %s", kept, out)
+		}
+	}
+}
+
+func TestLogger_TextFormat(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewLogger()
+	l.SetOutput(&buf)
+	l.SetFormat(FormatText)
+
+	l.Info("Route step succeeded", map[string]interface{}{
+		"provider": "openai",
+		"step":     1,
+		"api_key":  "sk-secret",
+		"error":    "upstream said no",
+		"headers":  map[string]interface{}{"x-team": "a"},
+	})
+
+	want := `INFO  Route step succeeded api_key=[REDACTED] error="upstream said no" headers={"x-team":"a"} provider=openai step=1` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("unexpected text line:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := map[string]Level{"": LevelInfo, "debug": LevelDebug, "INFO": LevelInfo, "warn": LevelWarn, "error": LevelError}
+	for input, want := range tests {
+		got, err := ParseLevel(input)
+		if err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v; want %v", input, got, err, want)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("expected error for unknown level")
+	}
+}
+
+func TestLogger_RedactRules(t *testing.T) {
+	l := NewLogger(RedactRule{Key: "user_email", Exact: true}, RedactRule{Key: "password"})
+
+	redacted := l.redactSensitiveData(map[string]interface{}{
+		"user_email":       "a@example.com",
+		"user_email_count": 3,
+		"db_password":      "hunter2",
+		"max_tokens":       100,
+	})
+
+	if redacted["user_email"] != "[REDACTED]" {
+		t.Errorf("expected exact match to be redacted, got %v", redacted["user_email"])
+	}
+	if redacted["user_email_count"] != 3 {
+		t.Errorf("expected exact rule not to match longer keys, got %v", redacted["user_email_count"])
+	}
+	if redacted["db_password"] != "[REDACTED]" {
+		t.Errorf("expected substring match to be redacted, got %v", redacted["db_password"])
+	}
+	if redacted["max_tokens"] != 100 {
+		t.Errorf("expected configured rules to replace the defaults, got %v", redacted["max_tokens"])
+	}
+}
+
+func TestLogger_DefaultRedactRules(t *testing.T) {
+	redacted := NewLogger().redactSensitiveData(map[string]interface{}{
+		"provider_api_key": "sk-123",
+		"headers":          map[string]interface{}{"Authorization": "Bearer sk-123", "X-Title": "gateway"},
+	})
+
+	if redacted["provider_api_key"] != "[REDACTED]" {
+		t.Errorf("expected api key to be redacted, got %v", redacted["provider_api_key"])
+	}
+	headers := redacted["headers"].(map[string]interface{})
+	if headers["Authorization"] != "[REDACTED]" || headers["X-Title"] != "gateway" {
+		t.Errorf("unexpected nested redaction result %v", headers)
+	}
+}
@@ -3,9 +3,18 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
+	"ai-gateway/audit"
 	"ai-gateway/config"
 	"ai-gateway/logger"
 	"ai-gateway/providers"
@@ -13,9 +22,24 @@ import (
 	"ai-gateway/telemetry"
 )
 
+// configPath is the configuration file read at startup and on reload:
+// config.yaml, or config.json when there is no YAML file
+var configPath = config.FindConfigFile("config.yaml", "config.json")
+
 func main() {
+	validateOnly := flag.Bool("validate-config", false, "validate "+configPath+", print a summary and exit")
+	flag.Parse()
+
 	// Load configuration
-	cfg, err := config.LoadConfig("config.yaml")
+	cfg, err := config.LoadConfig(configPath)
+	if *validateOnly {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Configuration is invalid: %v\n", err)
+			os.Exit(1)
+		}
+		printConfigSummary(os.Stdout, cfg)
+		return
+	}
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
@@ -32,14 +56,176 @@ func main() {
 	}()
 
 	// Create logger and provider manager
-	logger := logger.NewLogger()
+	level, _ := logger.ParseLevel(cfg.LogLevel) // validated by LoadConfig
+	var redactRules []logger.RedactRule
+	for _, rk := range cfg.RedactKeys {
+		redactRules = append(redactRules, logger.RedactRule{Key: rk.Key, Exact: rk.Match == "exact"})
+	}
+	logger := logger.NewLogger(redactRules...)
+	logger.SetLevel(level)
+	logger.SetFormat(cfg.LogFormat)
+	if cfg.LogOutput == "stderr" {
+		logger.SetOutput(os.Stderr)
+	} else {
+		logger.SetOutput(os.Stdout)
+	}
+	logConfigWarnings(logger, cfg)
 	manager := providers.NewManager(cfg.Providers, cfg.Routes, logger)
+	manager.SetCircuitBreaker(cfg.CircuitBreakerThreshold, cfg.GetCircuitBreakerWindow(), cfg.GetCircuitBreakerCooldown())
+	manager.SetPrices(cfg.Prices)
+	manager.SetRequestTimeout(cfg.GetRequestTimeout())
+	manager.SetRequireChoices(cfg.GetRequireChoices())
+	manager.SetTransportTimeouts(cfg.GetDialTimeout(), cfg.GetResponseHeaderTimeout())
+	if cfg.CacheEnabled {
+		manager.EnableCache(cfg.GetCacheTTL(), cfg.GetCacheMaxEntries())
+	}
+	if cfg.IdempotencyEnabled {
+		manager.EnableIdempotency(cfg.GetIdempotencyTTL(), cfg.GetCacheMaxEntries())
+	}
+	validateModels(manager, cfg, logger)
+	manager.StartHealthChecks(context.Background(), cfg.GetHealthCheckInterval(), cfg.HealthCheckThreshold)
+	if cfg.GetModelsSource() != config.ModelsSourceRoutes {
+		manager.StartModelRefresh(context.Background(), cfg.GetModelsRefreshInterval())
+	}
+	go reloadOnSIGHUP(manager, logger)
 
 	// Create and start server
 	srv := server.NewServer(cfg, logger, manager)
+	srv.SetConfigLoader(func() (*config.Config, error) {
+		return reloadConfig(logger)
+	})
+	if cfg.AuditEnabled {
+		sink, err := audit.NewFileSink(cfg.GetAuditFile(), cfg.GetAuditMaxBytes(), cfg.GetAuditMaxBackups())
+		if err != nil {
+			log.Fatalf("Failed to open audit log: %v", err)
+		}
+		auditLog := audit.NewLogger(sink, cfg.AuditRedactFields, audit.DefaultBufferSize, logger)
+		defer auditLog.Close()
+		srv.SetAuditLogger(auditLog)
+	}
 	fmt.Printf("Starting AI Gateway on port %d\n", cfg.Port)
 
-	if err := srv.Start(); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Start()
+	}()
+
+	// Wait for a stop signal, then let in-flight requests drain
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-serveErr:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server failed to start: %v", err)
+		}
+		return
+	case sig := <-stop:
+		logger.Info("Shutting down", map[string]interface{}{
+			"signal":  sig.String(),
+			"timeout": cfg.GetShutdownTimeout().String(),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.GetShutdownTimeout())
+	defer cancel()
+	if err := srv.Stop(ctx); err != nil {
+		logger.Error("Graceful shutdown did not complete", err, nil)
+	}
+}
+
+// reloadOnSIGHUP reloads providers and routes from the configuration file on
+// each SIGHUP. An invalid configuration is logged and the current one is kept.
+func reloadOnSIGHUP(manager *providers.Manager, logger *logger.Logger) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		cfg, err := reloadConfig(logger)
+		if err != nil {
+			logger.Error("Configuration reload failed, keeping current configuration", err, nil)
+			continue
+		}
+		manager.Reload(cfg.Providers, cfg.Routes)
+	}
+}
+
+// reloadConfig re-reads the configuration file for SIGHUP and POST
+// /admin/reload alike, logging its warnings when it is valid
+func reloadConfig(logger *logger.Logger) (*config.Config, error) {
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	logConfigWarnings(logger, cfg)
+	return cfg, nil
+}
+
+// logConfigWarnings logs configuration that is valid but likely a mistake,
+// such as routes that can outlast the server's write timeout
+func logConfigWarnings(logger *logger.Logger, cfg *config.Config) {
+	for _, warning := range cfg.Warnings() {
+		logger.Warn("Configuration warning", nil, map[string]interface{}{
+			"warning": warning,
+		})
+	}
+}
+
+// validateModels checks the route step models against the providers' model
+// lists when validate_models is set, logging each unknown model or, in error
+// mode, refusing to start
+func validateModels(manager *providers.Manager, cfg *config.Config, logger *logger.Logger) {
+	if cfg.ValidateModels != config.ModelValidationWarn && cfg.ValidateModels != config.ModelValidationError {
+		return
+	}
+	problems := manager.ValidateModels(context.Background())
+	if len(problems) > 0 && cfg.ValidateModels == config.ModelValidationError {
+		log.Fatalf("Unknown route models:\n  %s", strings.Join(problems, "\n  "))
+	}
+	for _, problem := range problems {
+		logger.Warn("Unknown route model", nil, map[string]interface{}{
+			"warning": problem,
+		})
+	}
+}
+
+// printConfigSummary lists the validated providers and routes. API keys are
+// only counted, never printed.
+func printConfigSummary(w io.Writer, cfg *config.Config) {
+	fmt.Fprintf(w, "Configuration is valid: %d providers, %d routes\n", len(cfg.Providers), len(cfg.Routes))
+
+	fmt.Fprintln(w, "\nProviders:")
+	for _, p := range cfg.Providers {
+		providerType := p.Type
+		if providerType == "" {
+			providerType = config.ProviderTypeOpenAI
+		}
+		fmt.Fprintf(w, "  %s (%s) %s, %d API key(s)%s\n", p.Name, providerType, p.BaseURL, len(p.Keys()), disabledSuffix(p.Disabled))
+	}
+
+	fmt.Fprintln(w, "\nRoutes:")
+	for _, r := range cfg.Routes {
+		strategy := r.Strategy
+		if strategy == "" {
+			strategy = "sequential"
+		}
+		steps := make([]string, 0, len(r.Steps))
+		for _, step := range r.Steps {
+			steps = append(steps, step.Provider+"/"+step.Model)
+		}
+		fmt.Fprintf(w, "  %s [%s]: %s%s\n", r.Name, strategy, strings.Join(steps, " -> "), disabledSuffix(r.Disabled))
+	}
+
+	if warnings := cfg.Warnings(); len(warnings) > 0 {
+		fmt.Fprintln(w, "\nWarnings:")
+		for _, warning := range warnings {
+			fmt.Fprintf(w, "  %s\n", warning)
+		}
+	}
+}
+
+// disabledSuffix marks disabled providers and routes in the summary
+func disabledSuffix(disabled bool) string {
+	if disabled {
+		return " (disabled)"
 	}
+	return ""
 }
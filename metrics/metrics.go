@@ -0,0 +1,259 @@
+// Package metrics keeps in-process counters and histograms and exposes them
+// in the Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are latency buckets in seconds suited to LLM provider calls
+var DefaultBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// PromptCharsBuckets are prompt sizes in characters, from short chats to long documents
+var PromptCharsBuckets = []float64{100, 1000, 4000, 16000, 64000, 256000, 1000000}
+
+// Gateway metrics
+var (
+	RequestsTotal = NewCounterVec("ai_gateway_requests_total",
+		"Total HTTP requests handled by the gateway.", "path", "route", "status")
+	ProviderRequestsTotal = NewCounterVec("ai_gateway_provider_requests_total",
+		"Route step outcomes per provider.", "provider", "outcome")
+	UpstreamResponsesTotal = NewCounterVec("ai_gateway_upstream_responses_total",
+		"Upstream HTTP responses per provider and status code.", "provider", "code")
+	StepDuration = NewHistogramVec("ai_gateway_step_duration_seconds",
+		"Route step latency per provider.", DefaultBuckets, "provider")
+	PromptChars = NewHistogramVec("ai_gateway_prompt_chars",
+		"Characters of message text in chat requests per route.", PromptCharsBuckets, "route")
+	TokensTotal = NewCounterVec("ai_gateway_tokens_total",
+		"Tokens reported in provider responses per provider, model and type (prompt or completion).", "provider", "model", "type")
+	ChoicesTotal = NewCounterVec("ai_gateway_choices_total",
+		"Choices in non-streaming chat responses per provider and model; above the response count when clients ask for n > 1.", "provider", "model")
+	CostTotal = NewCounterVec("ai_gateway_cost_total",
+		"Estimated spend per provider and model from the configured price table.", "provider", "model")
+	FallbackResponsesTotal = NewCounterVec("ai_gateway_fallback_responses_total",
+		"Chat requests answered with the route's fallback_response after every step failed.", "route")
+	AuditEntriesDroppedTotal = NewCounterVec("ai_gateway_audit_entries_dropped_total",
+		"Audit log entries not written, by reason (buffer_full or write_failed).", "reason")
+)
+
+var (
+	registryMu sync.Mutex
+	registry   []collector
+)
+
+// collector writes its series in the Prometheus text format
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+func register(c collector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, c)
+}
+
+// CounterVec is a set of counters partitioned by label values
+type CounterVec struct {
+	metricName string
+	help       string
+	labels     []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounterVec creates and registers a counter with the given label names
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		metricName: name,
+		help:       help,
+		labels:     labels,
+		values:     make(map[string]float64),
+	}
+	register(c)
+	return c
+}
+
+// Inc increments the counter for the given label values by one
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increases the counter for the given label values by v
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	key := seriesKey(c.labels, labelValues)
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+// Value returns the current counter value for the given label values
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	key := seriesKey(c.labels, labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[key]
+}
+
+func (c *CounterVec) name() string { return c.metricName }
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.metricName, c.help, c.metricName)
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.metricName, key, formatFloat(c.values[key]))
+	}
+}
+
+// HistogramVec is a set of histograms partitioned by label values
+type HistogramVec struct {
+	metricName string
+	help       string
+	labels     []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	series map[string]*histogram
+}
+
+type histogram struct {
+	labelValues []string
+	counts      []uint64 // cumulative per bucket
+	sum         float64
+	count       uint64
+}
+
+// NewHistogramVec creates and registers a histogram with the given buckets and label names
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		metricName: name,
+		help:       help,
+		labels:     labels,
+		buckets:    buckets,
+		series:     make(map[string]*histogram),
+	}
+	register(h)
+	return h
+}
+
+// Observe records a single observation for the given label values
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	key := seriesKey(h.labels, labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{
+			labelValues: append([]string(nil), labelValues...),
+			counts:      make([]uint64, len(h.buckets)),
+		}
+		h.series[key] = s
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *HistogramVec) name() string { return h.metricName }
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.metricName, h.help, h.metricName)
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	bucketLabels := append(append([]string(nil), h.labels...), "le")
+	for _, key := range keys {
+		s := h.series[key]
+		for i, upper := range h.buckets {
+			bucketKey := seriesKey(bucketLabels, append(append([]string(nil), s.labelValues...), formatFloat(upper)))
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, bucketKey, s.counts[i])
+		}
+		infKey := seriesKey(bucketLabels, append(append([]string(nil), s.labelValues...), "+Inf"))
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, infKey, s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, key, formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, key, s.count)
+	}
+}
+
+// WriteAll writes every registered metric in the Prometheus text format
+func WriteAll(w io.Writer) {
+	registryMu.Lock()
+	collectors := append([]collector(nil), registry...)
+	registryMu.Unlock()
+
+	sort.Slice(collectors, func(i, j int) bool { return collectors[i].name() < collectors[j].name() })
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// Handler serves the registered metrics for Prometheus scraping
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteAll(w)
+	})
+}
+
+// seriesKey renders label pairs as {a="x",b="y"}; missing values are left empty
+func seriesKey(labels, values []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, label := range labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		b.WriteString(label)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(value))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func escapeLabelValue(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, "\n", `\n`)
+	return strings.ReplaceAll(v, `"`, `\"`)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
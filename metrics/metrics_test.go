@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCounterVec(t *testing.T) {
+	c := &CounterVec{metricName: "test_total", help: "Test counter.", labels: []string{"provider", "outcome"}, values: map[string]float64{}}
+	c.Inc("openai", "success")
+	c.Inc("openai", "success")
+	c.Add(3, "openai", "failure")
+
+	if got := c.Value("openai", "success"); got != 2 {
+		t.Errorf("Expected 2 successes, got %v", got)
+	}
+
+	var buf bytes.Buffer
+	c.write(&buf)
+	out := buf.String()
+
+	for _, want := range []string{
+		"# TYPE test_total counter",
+		`test_total{provider="openai",outcome="failure"} 3`,
+		`test_total{provider="openai",outcome="success"} 2`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestHistogramVec(t *testing.T) {
+	h := &HistogramVec{metricName: "test_seconds", help: "Test histogram.", labels: []string{"provider"}, buckets: []float64{0.5, 1}, series: map[string]*histogram{}}
+	h.Observe(0.2, "openai")
+	h.Observe(0.7, "openai")
+	h.Observe(3, "openai")
+
+	var buf bytes.Buffer
+	h.write(&buf)
+	out := buf.String()
+
+	for _, want := range []string{
+		"# TYPE test_seconds histogram",
+		`test_seconds_bucket{provider="openai",le="0.5"} 1`,
+		`test_seconds_bucket{provider="openai",le="1"} 2`,
+		`test_seconds_bucket{provider="openai",le="+Inf"} 3`,
+		`test_seconds_sum{provider="openai"} 3.9`,
+		`test_seconds_count{provider="openai"} 3`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestEscapeLabelValue(t *testing.T) {
+	if got := escapeLabelValue("a\"b\\c\nd"); got != `a\"b\\c\nd` {
+		t.Errorf("Unexpected escaped value: %s", got)
+	}
+}
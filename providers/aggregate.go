@@ -0,0 +1,288 @@
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"ai-gateway/types"
+)
+
+// callAggregated serves a non-streaming request from a force_stream provider:
+// the request is sent with stream set, and the upstream events are read to the
+// end and reassembled into a single chat.completion. The step timeout covers
+// the whole stream.
+func (c *Client) callAggregated(ctx context.Context, reqBody []byte, incoming http.Header) (*types.ChatResponse, error) {
+	reqBody, err := withStreamEnabled(reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	resp, err := c.post(ctx, c.chatCompletionsPath(), reqBody, incoming)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+		return nil, newStatusError(resp, body)
+	}
+
+	// A provider may ignore stream and answer with a plain completion
+	var body []byte
+	start := time.Now()
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == "application/json" {
+		body, err = io.ReadAll(resp.Body)
+	} else {
+		body, err = aggregateStream(resp.Body)
+	}
+	c.upstream += time.Since(start)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var response types.ChatResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, newParseError(resp.Header, body, err)
+	}
+	response.Headers = c.copiedResponseHeaders(resp.Header)
+	return &response, nil
+}
+
+// withStreamEnabled sets stream and asks for the usage chunk, keeping any
+// other stream_options the request carries
+func withStreamEnabled(reqBody []byte) ([]byte, error) {
+	var reqMap map[string]interface{}
+	if err := json.Unmarshal(reqBody, &reqMap); err != nil {
+		return nil, fmt.Errorf("failed to parse request JSON: %w", err)
+	}
+	options, _ := reqMap["stream_options"].(map[string]interface{})
+	if options == nil {
+		options = make(map[string]interface{})
+	}
+	options["include_usage"] = true
+	reqMap["stream"] = true
+	reqMap["stream_options"] = options
+
+	modified, err := json.Marshal(reqMap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	return modified, nil
+}
+
+// streamChunk is one chat.completion.chunk event
+type streamChunk struct {
+	ID                string          `json:"id"`
+	Created           int64           `json:"created"`
+	Model             string          `json:"model"`
+	SystemFingerprint string          `json:"system_fingerprint"`
+	Choices           []chunkChoice   `json:"choices"`
+	Usage             *types.Usage    `json:"usage"`
+	Error             json.RawMessage `json:"error"`
+}
+
+type chunkChoice struct {
+	Index int `json:"index"`
+	Delta struct {
+		Role      string  `json:"role"`
+		Content   *string `json:"content"`
+		Refusal   *string `json:"refusal"`
+		ToolCalls []struct {
+			Index    int    `json:"index"`
+			ID       string `json:"id"`
+			Type     string `json:"type"`
+			Function struct {
+				Name      string `json:"name"`
+				Arguments string `json:"arguments"`
+			} `json:"function"`
+		} `json:"tool_calls"`
+	} `json:"delta"`
+	FinishReason *string `json:"finish_reason"`
+}
+
+// aggregatedChoice collects the deltas of one choice
+type aggregatedChoice struct {
+	role         string
+	content      strings.Builder
+	hasContent   bool
+	refusal      strings.Builder
+	hasRefusal   bool
+	toolCalls    map[int]*aggregatedToolCall
+	finishReason string
+}
+
+type aggregatedToolCall struct {
+	id, callType, name string
+	arguments          strings.Builder
+}
+
+// errStreamIncomplete is returned when a stream ends before any chunk arrived
+var errStreamIncomplete = errors.New("stream ended without any completion chunk")
+
+// aggregateStream reads a chat completion event stream to its end and returns
+// the equivalent chat.completion JSON: content and tool call arguments are
+// concatenated per choice, and the usage comes from the final usage chunk.
+func aggregateStream(body io.Reader) ([]byte, error) {
+	var (
+		first   *streamChunk
+		usage   *types.Usage
+		choices = make(map[int]*aggregatedChoice)
+	)
+	reader := bufio.NewReader(body)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		data, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+		data = bytes.TrimSpace(data)
+		if ok && bytes.Equal(data, []byte("[DONE]")) {
+			break
+		}
+		if ok && len(data) > 0 {
+			var chunk streamChunk
+			if err := json.Unmarshal(data, &chunk); err != nil {
+				return nil, fmt.Errorf("invalid stream chunk: %w", err)
+			}
+			if len(chunk.Error) > 0 && string(chunk.Error) != "null" {
+				return nil, fmt.Errorf("provider sent an error in the stream: %s", chunk.Error)
+			}
+			if first == nil {
+				first = &chunk
+			}
+			if chunk.Usage != nil {
+				usage = chunk.Usage
+			}
+			for _, delta := range chunk.Choices {
+				addDelta(choices, delta)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+	if first == nil {
+		return nil, errStreamIncomplete
+	}
+
+	indexes := make([]int, 0, len(choices))
+	for index := range choices {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	out := make([]map[string]interface{}, 0, len(indexes))
+	for _, index := range indexes {
+		out = append(out, choices[index].completion(index))
+	}
+
+	completion := map[string]interface{}{
+		"id":      first.ID,
+		"object":  "chat.completion",
+		"created": first.Created,
+		"model":   first.Model,
+		"choices": out,
+	}
+	if first.SystemFingerprint != "" {
+		completion["system_fingerprint"] = first.SystemFingerprint
+	}
+	if usage != nil {
+		completion["usage"] = usage
+	}
+	return json.Marshal(completion)
+}
+
+// addDelta appends one choice delta to the choice it belongs to
+func addDelta(choices map[int]*aggregatedChoice, delta chunkChoice) {
+	choice, ok := choices[delta.Index]
+	if !ok {
+		choice = &aggregatedChoice{role: "assistant", toolCalls: make(map[int]*aggregatedToolCall)}
+		choices[delta.Index] = choice
+	}
+	if delta.Delta.Role != "" {
+		choice.role = delta.Delta.Role
+	}
+	if delta.Delta.Content != nil {
+		choice.content.WriteString(*delta.Delta.Content)
+		choice.hasContent = true
+	}
+	if delta.Delta.Refusal != nil {
+		choice.refusal.WriteString(*delta.Delta.Refusal)
+		choice.hasRefusal = true
+	}
+	for _, call := range delta.Delta.ToolCalls {
+		tc, ok := choice.toolCalls[call.Index]
+		if !ok {
+			tc = &aggregatedToolCall{callType: "function"}
+			choice.toolCalls[call.Index] = tc
+		}
+		if call.ID != "" {
+			tc.id = call.ID
+		}
+		if call.Type != "" {
+			tc.callType = call.Type
+		}
+		tc.name += call.Function.Name
+		tc.arguments.WriteString(call.Function.Arguments)
+	}
+	if delta.FinishReason != nil {
+		choice.finishReason = *delta.FinishReason
+	}
+}
+
+// completion returns the choice as it appears in a chat.completion
+func (a *aggregatedChoice) completion(index int) map[string]interface{} {
+	message := map[string]interface{}{"role": a.role, "content": nil}
+	if a.hasContent {
+		message["content"] = a.content.String()
+	}
+	if a.hasRefusal {
+		message["refusal"] = a.refusal.String()
+	}
+	if len(a.toolCalls) > 0 {
+		indexes := make([]int, 0, len(a.toolCalls))
+		for i := range a.toolCalls {
+			indexes = append(indexes, i)
+		}
+		sort.Ints(indexes)
+		calls := make([]map[string]interface{}, 0, len(indexes))
+		for _, i := range indexes {
+			tc := a.toolCalls[i]
+			calls = append(calls, map[string]interface{}{
+				"id":   tc.id,
+				"type": tc.callType,
+				"function": map[string]interface{}{
+					"name":      tc.name,
+					"arguments": tc.arguments.String(),
+				},
+			})
+		}
+		message["tool_calls"] = calls
+	}
+
+	var finishReason interface{}
+	if a.finishReason != "" {
+		finishReason = a.finishReason
+	}
+	return map[string]interface{}{
+		"index":         index,
+		"message":       message,
+		"finish_reason": finishReason,
+	}
+}
@@ -0,0 +1,79 @@
+package providers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ai-gateway/config"
+	"ai-gateway/logger"
+	"ai-gateway/types"
+)
+
+func TestClient_Call_ForceStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Stream        bool `json:"stream"`
+			StreamOptions struct {
+				IncludeUsage bool `json:"include_usage"`
+			} `json:"stream_options"`
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &req); err != nil || !req.Stream || !req.StreamOptions.IncludeUsage {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("expected a streaming request with usage, got " + string(body)))
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range []string{
+			`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1700000000,"model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","content":""},"finish_reason":null}]}`,
+			`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1700000000,"model":"gpt-4o","choices":[{"index":0,"delta":{"content":"Hello"},"finish_reason":null}]}`,
+			`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1700000000,"model":"gpt-4o","choices":[{"index":0,"delta":{"content":" world"},"finish_reason":null}]}`,
+			`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1700000000,"model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"lookup","arguments":"{\"q\":"}}]},"finish_reason":null}]}`,
+			`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1700000000,"model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"go\"}"}}]},"finish_reason":"tool_calls"}]}`,
+			`{"id":"chatcmpl-1","object":"chat.completion.chunk","created":1700000000,"model":"gpt-4o","choices":[],"usage":{"prompt_tokens":5,"completion_tokens":7,"total_tokens":12}}`,
+			`[DONE]`,
+		} {
+			w.Write([]byte("data: " + event + "\n\n"))
+		}
+	}))
+	defer server.Close()
+
+	cfg := config.Provider{Name: "streamer", APIKey: "key", BaseURL: server.URL, ForceStream: true}
+	client := NewClientWithRouteStep(cfg, config.RouteStep{Provider: "streamer", Model: "gpt-4o"}, logger.NewLogger())
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"route","stream":false,"messages":[{"role":"user","content":"Hi"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+
+	resp, err := client.Call(request)
+	if err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+	if resp.ID != "chatcmpl-1" || resp.Object != "chat.completion" || resp.Model != "gpt-4o" {
+		t.Errorf("Unexpected response envelope: id=%s object=%s model=%s", resp.ID, resp.Object, resp.Model)
+	}
+	if len(resp.Choices) != 1 || resp.Choices[0].Message.ContentAsString() != "Hello world" || resp.Choices[0].FinishReason != "tool_calls" {
+		t.Errorf("Unexpected choices %+v", resp.Choices)
+	}
+	if resp.Usage.TotalTokens != 12 {
+		t.Errorf("Expected the usage from the final chunk, got %+v", resp.Usage)
+	}
+	if !strings.Contains(string(resp.Raw), `"arguments":"{\"q\":\"go\"}"`) {
+		t.Errorf("Expected the tool call arguments to be concatenated, got %s", resp.Raw)
+	}
+}
+
+func TestAggregateStream_Errors(t *testing.T) {
+	if _, err := aggregateStream(strings.NewReader("data: [DONE]\n\n")); err == nil {
+		t.Error("Expected an error for a stream without chunks")
+	}
+	if _, err := aggregateStream(strings.NewReader(`data: {"error":{"message":"overloaded"}}` + "\n\n")); err == nil {
+		t.Error("Expected an error event in the stream to fail the call")
+	}
+}
@@ -0,0 +1,200 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// circuitState is the state of a provider's circuit breaker
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuit tracks consecutive failures for one provider
+type circuit struct {
+	state       circuitState
+	failures    int
+	windowStart time.Time
+	openedAt    time.Time
+	openFor     time.Duration // overrides the cooldown when a 503 named its own Retry-After
+	trialActive bool
+}
+
+// circuitBreakers keeps a circuit per provider name. A zero threshold disables breaking.
+type circuitBreakers struct {
+	mu        sync.Mutex
+	threshold int
+	window    time.Duration // zero counts consecutive failures without a time limit
+	cooldown  time.Duration
+	circuits  map[string]*circuit
+	now       func() time.Time
+}
+
+func newCircuitBreakers() *circuitBreakers {
+	return &circuitBreakers{
+		circuits: make(map[string]*circuit),
+		now:      time.Now,
+	}
+}
+
+// allow reports whether a request may be sent to the provider. After the
+// cooldown an open circuit turns half-open and lets a single trial request through.
+func (b *circuitBreakers) allow(provider string) bool {
+	allowed, _ := b.allowTrial(provider)
+	return allowed
+}
+
+// allowTrial is allow that also reports whether the request is the half-open
+// circuit's trial. A trial that ends up not calling the provider must be
+// given back with release, or the circuit never closes again.
+func (b *circuitBreakers) allowTrial(provider string) (allowed, trial bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.threshold <= 0 {
+		return true, false
+	}
+	c, ok := b.circuits[provider]
+	if !ok {
+		return true, false
+	}
+
+	switch c.state {
+	case circuitOpen:
+		cooldown := b.cooldown
+		if c.openFor > 0 {
+			cooldown = c.openFor
+		}
+		if b.now().Sub(c.openedAt) < cooldown {
+			return false, false
+		}
+		c.state = circuitHalfOpen
+		c.trialActive = true
+		return true, true
+	case circuitHalfOpen:
+		if c.trialActive {
+			return false, false
+		}
+		c.trialActive = true
+		return true, true
+	default:
+		return true, false
+	}
+}
+
+// release gives back a trial granted by allowTrial to a step that was
+// skipped before calling the provider, so the next request can take it
+func (b *circuitBreakers) release(provider string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c, ok := b.circuits[provider]; ok && c.state == circuitHalfOpen {
+		c.trialActive = false
+	}
+}
+
+// record updates the provider's circuit with the outcome of a step and
+// reports whether the call opened the circuit
+func (b *circuitBreakers) record(provider string, err error) (opened bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.threshold <= 0 {
+		return false
+	}
+
+	// A call abandoned by the client has no outcome: a trial it held is
+	// given back and the failures counted so far are kept
+	if errors.Is(err, context.Canceled) {
+		if c, ok := b.circuits[provider]; ok && c.state == circuitHalfOpen {
+			c.trialActive = false
+		}
+		return false
+	}
+
+	c, ok := b.circuits[provider]
+	if !ok {
+		c = &circuit{}
+		b.circuits[provider] = c
+	}
+
+	if err == nil || !isProviderFailure(err) {
+		*c = circuit{}
+		return false
+	}
+
+	now := b.now()
+	if c.state == circuitHalfOpen {
+		c.state = circuitOpen
+		c.openedAt = now
+		c.openFor = maintenanceWindow(err)
+		c.trialActive = false
+		return true
+	}
+
+	// A provider announcing downtime longer than a retry could wait is
+	// skipped for that long without waiting for the failure threshold
+	if window := maintenanceWindow(err); window > 0 && c.state == circuitClosed {
+		c.state = circuitOpen
+		c.openedAt = now
+		c.openFor = window
+		return true
+	}
+
+	if c.failures == 0 || (b.window > 0 && now.Sub(c.windowStart) > b.window) {
+		c.failures = 0
+		c.windowStart = now
+	}
+	c.failures++
+	if c.failures >= b.threshold && c.state == circuitClosed {
+		c.state = circuitOpen
+		c.openedAt = now
+		c.openFor = 0
+		return true
+	}
+	return false
+}
+
+// isProviderFailure reports whether err reflects provider trouble rather than a
+// bad client request; 4xx responses other than 429, calls abandoned because
+// the client went away and hedged calls that lost the race do not count against the circuit
+func isProviderFailure(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, errHedgeLost) {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// maintenanceWindow returns the Retry-After of a 503 when it is too long to
+// wait out with a retry, and zero otherwise
+func maintenanceWindow(err error) time.Duration {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusServiceUnavailable && statusErr.RetryAfter > maxRetryDelay {
+		return statusErr.RetryAfter
+	}
+	return 0
+}
+
+// SetCircuitBreaker enables per-provider circuit breaking: after threshold
+// failures within window a provider's steps are skipped for cooldown, then a
+// single trial request decides whether the circuit closes again. A 503 with
+// a Retry-After beyond the longest retry wait opens the circuit at once, for
+// the announced duration instead of the cooldown.
+func (m *Manager) SetCircuitBreaker(threshold int, window, cooldown time.Duration) {
+	m.breakers.mu.Lock()
+	defer m.breakers.mu.Unlock()
+	m.breakers.threshold = threshold
+	m.breakers.window = window
+	m.breakers.cooldown = cooldown
+}
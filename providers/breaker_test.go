@@ -0,0 +1,134 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakers(t *testing.T) {
+	now := time.Unix(1000, 0)
+	b := newCircuitBreakers()
+	b.now = func() time.Time { return now }
+	b.threshold = 2
+	b.cooldown = 10 * time.Second
+
+	failure := &StatusError{StatusCode: 503}
+
+	if b.record("p", failure) {
+		t.Fatal("Expected circuit to stay closed below threshold")
+	}
+	if !b.record("p", failure) {
+		t.Fatal("Expected circuit to open at threshold")
+	}
+	if b.allow("p") {
+		t.Fatal("Expected open circuit to reject requests during cooldown")
+	}
+
+	now = now.Add(11 * time.Second)
+	if !b.allow("p") {
+		t.Fatal("Expected half-open circuit to allow a trial request")
+	}
+	if b.allow("p") {
+		t.Fatal("Expected half-open circuit to allow only a single trial")
+	}
+
+	if !b.record("p", failure) {
+		t.Fatal("Expected failed trial to reopen the circuit")
+	}
+	now = now.Add(11 * time.Second)
+	if !b.allow("p") {
+		t.Fatal("Expected trial after second cooldown")
+	}
+	b.record("p", nil)
+	if !b.allow("p") || !b.allow("p") {
+		t.Fatal("Expected successful trial to close the circuit")
+	}
+}
+
+func TestCircuitBreakers_IgnoresClientErrors(t *testing.T) {
+	b := newCircuitBreakers()
+	b.threshold = 1
+	b.cooldown = time.Minute
+
+	if b.record("p", &StatusError{StatusCode: 400}) {
+		t.Error("Expected 400 not to open the circuit")
+	}
+	if !b.record("p", fmt.Errorf("request failed: connection refused")) {
+		t.Error("Expected network errors to open the circuit")
+	}
+}
+
+func TestCircuitBreakers_IgnoresCancelledCalls(t *testing.T) {
+	now := time.Unix(1000, 0)
+	b := newCircuitBreakers()
+	b.now = func() time.Time { return now }
+	b.threshold = 2
+	b.cooldown = 10 * time.Second
+
+	failure := &StatusError{StatusCode: 503}
+	cancelled := fmt.Errorf("request failed: %w", context.Canceled)
+
+	// A disconnect between failures doesn't reset the count
+	b.record("p", failure)
+	if b.record("p", cancelled) {
+		t.Fatal("Expected a cancelled call not to open the circuit")
+	}
+	if !b.record("p", failure) {
+		t.Fatal("Expected the failures before the cancelled call to still count")
+	}
+
+	// A cancelled trial neither closes nor reopens the circuit
+	now = now.Add(11 * time.Second)
+	if !b.allow("p") {
+		t.Fatal("Expected half-open circuit to allow a trial request")
+	}
+	b.record("p", cancelled)
+	if c := b.circuits["p"]; c.state != circuitHalfOpen || c.failures != 2 {
+		t.Errorf("Expected the circuit to stay half-open with 2 failures, got state %d with %d", c.state, c.failures)
+	}
+	if !b.allow("p") {
+		t.Error("Expected the cancelled trial to be given back")
+	}
+}
+
+func TestCircuitBreakers_Window(t *testing.T) {
+	now := time.Unix(1000, 0)
+	b := newCircuitBreakers()
+	b.now = func() time.Time { return now }
+	b.threshold = 2
+	b.window = 5 * time.Second
+	b.cooldown = time.Minute
+
+	b.record("p", &StatusError{StatusCode: 500})
+	now = now.Add(6 * time.Second)
+	if b.record("p", &StatusError{StatusCode: 500}) {
+		t.Error("Expected failures outside the window not to open the circuit")
+	}
+}
+
+func TestCircuitBreakers_MaintenanceWindow(t *testing.T) {
+	now := time.Unix(1000, 0)
+	b := newCircuitBreakers()
+	b.now = func() time.Time { return now }
+	b.threshold = 3
+	b.cooldown = 10 * time.Second
+
+	// A short Retry-After is left to retries and counts as a normal failure
+	if b.record("p", &StatusError{StatusCode: 503, RetryAfter: 5 * time.Second}) {
+		t.Fatal("Expected a short Retry-After not to open the circuit")
+	}
+
+	if !b.record("p", &StatusError{StatusCode: 503, RetryAfter: 5 * time.Minute}) {
+		t.Fatal("Expected a long Retry-After on 503 to open the circuit below the threshold")
+	}
+	now = now.Add(time.Minute)
+	if b.allow("p") {
+		t.Fatal("Expected the circuit to stay open for the Retry-After, not the cooldown")
+	}
+	now = now.Add(5 * time.Minute)
+	if !b.allow("p") {
+		t.Fatal("Expected a trial request once the Retry-After passed")
+	}
+}
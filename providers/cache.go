@@ -0,0 +1,183 @@
+package providers
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"ai-gateway/types"
+)
+
+// responseCache is an LRU cache of successful chat responses with a TTL
+type responseCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]*list.Element
+	order      *list.List // front is most recently used
+	now        func() time.Time
+}
+
+type cacheEntry struct {
+	key         string
+	response    *types.ChatResponse
+	fingerprint string // request the response belongs to, for idempotency keys
+	expires     time.Time
+}
+
+func newResponseCache(ttl time.Duration, maxEntries int) *responseCache {
+	return &responseCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+		now:        time.Now,
+	}
+}
+
+// get returns the cached response for key if present and not expired
+func (c *responseCache) get(key string) (*types.ChatResponse, bool) {
+	response, _, ok := c.getFingerprinted(key)
+	return response, ok
+}
+
+// getFingerprinted is get that also returns the fingerprint stored with the response
+func (c *responseCache) getFingerprinted(key string) (*types.ChatResponse, string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, "", false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if c.now().After(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, "", false
+	}
+	c.order.MoveToFront(elem)
+	return entry.response, entry.fingerprint, true
+}
+
+// put stores a response, evicting the least recently used entry when full
+func (c *responseCache) put(key string, response *types.ChatResponse) {
+	c.putFingerprinted(key, "", response)
+}
+
+// putFingerprinted is put that keeps a fingerprint of the request with the response
+func (c *responseCache) putFingerprinted(key, fingerprint string, response *types.ChatResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := c.now().Add(c.ttl)
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		entry.response = response
+		entry.fingerprint = fingerprint
+		entry.expires = expires
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, response: response, fingerprint: fingerprint, expires: expires})
+	for c.maxEntries > 0 && c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// requestCacheKey returns a SHA-256 of the request with object keys sorted, so
+// requests that differ only in field order share an entry. The end-user "user"
+// field is left out since it does not affect the completion.
+func requestCacheKey(request types.ChatRequest) (string, error) {
+	var normalized map[string]interface{}
+	if err := json.Unmarshal(request.Raw, &normalized); err != nil {
+		return "", fmt.Errorf("failed to parse request: %w", err)
+	}
+	normalized["model"] = request.Model
+	delete(normalized, "user")
+
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// EnableCache turns on response caching for non-streaming chat completions
+func (m *Manager) EnableCache(ttl time.Duration, maxEntries int) {
+	m.cache = newResponseCache(ttl, maxEntries)
+}
+
+// IdempotencyHeader lets a client retry a request without running it twice
+const IdempotencyHeader = "Idempotency-Key"
+
+// idempotencyCacheKey returns the entry for the request's Idempotency-Key, or
+// "" when it has none. The key is scoped to the caller's credentials so
+// clients choosing the same key never see each other's responses.
+func idempotencyCacheKey(request types.ChatRequest) string {
+	key := request.Headers.Get(IdempotencyHeader)
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(request.Headers.Get("Authorization") + "\x00" + request.Headers.Get("X-Api-Key") + "\x00" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// idempotencyStore keeps the responses of requests sent with an
+// Idempotency-Key, each with a fingerprint of its request so that a key reused
+// for a different request is caught, and the keys of requests still running
+type idempotencyStore struct {
+	responses *responseCache
+	mu        sync.Mutex
+	running   map[string]struct{}
+}
+
+func newIdempotencyStore(ttl time.Duration, maxEntries int) *idempotencyStore {
+	return &idempotencyStore{responses: newResponseCache(ttl, maxEntries), running: make(map[string]struct{})}
+}
+
+// begin returns the stored response to replay for key, or reserves the key so
+// the caller runs the request and reports the outcome to finish. A key stored
+// for another request or still running returns an error instead.
+func (s *idempotencyStore) begin(key, fingerprint string) (*types.ChatResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if response, stored, ok := s.responses.getFingerprinted(key); ok {
+		if stored != fingerprint {
+			return nil, ErrIdempotencyKeyReused
+		}
+		return response, nil
+	}
+	if _, ok := s.running[key]; ok {
+		return nil, ErrIdempotencyKeyInFlight
+	}
+	s.running[key] = struct{}{}
+	return nil, nil
+}
+
+// finish releases a key reserved by begin, storing the response when the
+// request succeeded. Without one the key is free for a retry.
+func (s *idempotencyStore) finish(key, fingerprint string, response *types.ChatResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.running, key)
+	if response != nil {
+		s.responses.putFingerprinted(key, fingerprint, response)
+	}
+}
+
+// EnableIdempotency remembers successful non-streaming chat responses by their
+// Idempotency-Key header for ttl and replays them when the key is sent again
+func (m *Manager) EnableIdempotency(ttl time.Duration, maxEntries int) {
+	m.replays = newIdempotencyStore(ttl, maxEntries)
+}
@@ -0,0 +1,59 @@
+package providers
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"ai-gateway/types"
+)
+
+func TestResponseCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newResponseCache(time.Minute, 2)
+	cache.put("a", &types.ChatResponse{ID: "a"})
+	cache.put("b", &types.ChatResponse{ID: "b"})
+
+	// Touch "a" so "b" becomes the eviction candidate
+	if _, ok := cache.get("a"); !ok {
+		t.Fatal("Expected entry 'a' to be cached")
+	}
+	cache.put("c", &types.ChatResponse{ID: "c"})
+
+	if _, ok := cache.get("b"); ok {
+		t.Error("Expected least recently used entry 'b' to be evicted")
+	}
+	if _, ok := cache.get("a"); !ok {
+		t.Error("Expected entry 'a' to survive eviction")
+	}
+}
+
+func TestResponseCache_Expires(t *testing.T) {
+	now := time.Unix(1000, 0)
+	cache := newResponseCache(time.Minute, 10)
+	cache.now = func() time.Time { return now }
+
+	cache.put("a", &types.ChatResponse{ID: "a"})
+	now = now.Add(2 * time.Minute)
+
+	if _, ok := cache.get("a"); ok {
+		t.Error("Expected expired entry to be dropped")
+	}
+}
+
+func TestRequestCacheKey_IgnoresFieldOrderAndUser(t *testing.T) {
+	var first, second, different types.ChatRequest
+	json.Unmarshal([]byte(`{"model":"m","temperature":0,"messages":[{"role":"user","content":"Hi"}],"user":"alice"}`), &first)
+	json.Unmarshal([]byte(`{"messages":[{"role":"user","content":"Hi"}],"temperature":0,"model":"m","user":"bob"}`), &second)
+	json.Unmarshal([]byte(`{"model":"m","temperature":1,"messages":[{"role":"user","content":"Hi"}]}`), &different)
+
+	keyFirst, _ := requestCacheKey(first)
+	keySecond, _ := requestCacheKey(second)
+	keyDifferent, _ := requestCacheKey(different)
+
+	if keyFirst != keySecond {
+		t.Error("Expected equivalent requests to share a cache key")
+	}
+	if keyFirst == keyDifferent {
+		t.Error("Expected different sampling params to produce different keys")
+	}
+}
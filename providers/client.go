@@ -2,27 +2,59 @@ package providers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
+	"sort"
+	"strings"
 	"time"
 
 	"ai-gateway/config"
 	"ai-gateway/logger"
+	"ai-gateway/telemetry"
 	"ai-gateway/types"
+	"ai-gateway/version"
 )
 
 // Client implements the Provider interface for OpenAI-compatible APIs
 type Client struct {
 	name               string
-	apiKey             string
+	apiKeys            []string
+	keys               *keyRotator // shared key rotation; nil uses the first key
 	baseURL            string
+	chatPath           string // chat completions path, see chatCompletionsPath
+	forceStream        bool   // non-streaming chat requests are streamed upstream and aggregated
+	providerType       string // config.ProviderTypeOpenAI, config.ProviderTypeAzure or config.ProviderTypeGemini
+	apiVersion         string // Azure only
+	deployment         string // Azure only
+	forwardHeaders     []string
+	responseHeaders    []string
+	headers            map[string]string // static provider headers
+	userAgent          string            // empty for the default, see defaultUserAgent
 	model              string
 	timeout            time.Duration
 	conflictResolution string // "tools" or "format" or empty
+	defaults           map[string]interface{}
+	overrides          map[string]interface{}
+	renameParams       map[string]string // request parameter renames, applied last
+	renameResponse     map[string]string // response field renames for non-streaming calls
+	maxMessages        int               // opt-in trimming of old messages, see trimMessages
+	maxContextTokens   int
 	logger             *logger.Logger
 	client             *http.Client
+	// upstream is the time spent in HTTP exchanges with the provider, summed
+	// over the client's calls: until a stream's headers arrive, otherwise
+	// until the response body has been read
+	upstream time.Duration
+	// lenientChoices accepts chat responses without choices, see Manager.SetRequireChoices
+	lenientChoices bool
+	// trimmed counts the messages max_messages and max_context_tokens dropped
+	// from the last request
+	trimmed int
 }
 
 // NewClient creates a new OpenAI-compatible provider client
@@ -30,14 +62,20 @@ func NewClient(cfg config.Provider, logger *logger.Logger) *Client {
 	// Legacy constructor - uses default timeout and no conflict resolution
 	return &Client{
 		name:               cfg.Name,
-		apiKey:             cfg.APIKey,
-		baseURL:            cfg.BaseURL,
+		apiKeys:            cfg.Keys(),
+		baseURL:            strings.TrimRight(cfg.BaseURL, "/"),
+		chatPath:           cfg.ChatCompletionsPath,
+		forceStream:        cfg.ForceStream,
+		providerType:       cfg.Type,
+		apiVersion:         cfg.APIVersion,
+		headers:            cfg.Headers,
+		userAgent:          cfg.UserAgent,
 		model:              "", // Will be overridden by route step
 		timeout:            30 * time.Second,
 		conflictResolution: "",
 		logger:             logger,
 		client: &http.Client{
-			Timeout: 30 * time.Second,
+			Transport: defaultTransports.get(cfg),
 		},
 	}
 }
@@ -47,16 +85,37 @@ func NewClientWithRouteStep(providerCfg config.Provider, step config.RouteStep,
 	// Get timeout from step or use default
 	timeout := config.GetTimeout(step.Timeout, "30s") // Default to 30s if no default configured
 
+	// Azure addresses models by deployment name, which usually matches the model
+	deployment := step.Deployment
+	if deployment == "" {
+		deployment = step.Model
+	}
+
 	return &Client{
 		name:               providerCfg.Name,
-		apiKey:             providerCfg.APIKey,
-		baseURL:            providerCfg.BaseURL,
+		apiKeys:            providerCfg.Keys(),
+		baseURL:            strings.TrimRight(providerCfg.BaseURL, "/"),
+		chatPath:           providerCfg.ChatCompletionsPath,
+		forceStream:        providerCfg.ForceStream,
+		providerType:       providerCfg.Type,
+		apiVersion:         providerCfg.APIVersion,
+		deployment:         deployment,
+		forwardHeaders:     append(append([]string{}, providerCfg.ForwardHeaders...), step.ForwardHeaders...),
+		responseHeaders:    providerCfg.ResponseHeaders,
+		headers:            providerCfg.Headers,
+		userAgent:          providerCfg.UserAgent,
 		model:              step.Model,
 		timeout:            timeout,
 		conflictResolution: step.ConflictResolution,
+		defaults:           step.Defaults,
+		overrides:          step.Overrides,
+		renameParams:       step.RenameParams,
+		renameResponse:     step.RenameResponse,
+		maxMessages:        step.MaxMessages,
+		maxContextTokens:   step.MaxContextTokens,
 		logger:             logger,
 		client: &http.Client{
-			Timeout: timeout,
+			Transport: defaultTransports.get(providerCfg),
 		},
 	}
 }
@@ -69,14 +128,273 @@ func (c *Client) Name() string {
 // IsAvailable checks if the provider is available
 func (c *Client) IsAvailable() bool {
 	// Simple check - could be enhanced with actual health check
-	return c.apiKey != "" && c.baseURL != ""
+	return len(c.apiKeys) > 0 && c.baseURL != ""
+}
+
+// nextAPIKey returns the key for the next upstream request, rotating when
+// the client shares a key rotator with other clients of the same provider
+func (c *Client) nextAPIKey() string {
+	if len(c.apiKeys) == 0 {
+		return ""
+	}
+	if c.keys == nil {
+		return c.apiKeys[0]
+	}
+	return c.apiKeys[c.keys.pick(len(c.apiKeys))]
+}
+
+// CheckHealth issues a lightweight GET {baseURL}/models probe. Any response
+// below 500 counts as reachable, since not every provider implements /models.
+func (c *Client) CheckHealth(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	resp, err := c.getModels(ctx)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return newStatusError(resp, body)
+	}
+	return nil
+}
+
+// maxModelsBytes caps the model list read from a provider
+const maxModelsBytes = 4 << 20
+
+// ListModels returns the models the provider reports at GET {baseURL}/models.
+// Providers without the endpoint answer with an error status, returned as a StatusError.
+func (c *Client) ListModels(ctx context.Context) ([]types.Model, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	resp, err := c.getModels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxModelsBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, newStatusError(resp, body)
+	}
+
+	if c.providerType == config.ProviderTypeGemini {
+		models, err := geminiModels(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode model list: %w", err)
+		}
+		return models, nil
+	}
+
+	var list types.ModelsResponse
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("failed to decode model list: %w", err)
+	}
+	return list.Data, nil
+}
+
+// getModels sends GET {baseURL}/models; Azure lists models under /openai with an api-version
+func (c *Client) getModels(ctx context.Context) (*http.Response, error) {
+	url := c.baseURL + "/models"
+	if c.providerType == config.ProviderTypeAzure {
+		url = fmt.Sprintf("%s/openai/models?api-version=%s", c.baseURL, neturl.QueryEscape(c.apiVersion))
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	c.setStaticHeaders(req)
+	c.setAuth(req)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	return resp, nil
 }
 
 // Call executes a chat completion request
 func (c *Client) Call(request types.ChatRequest) (*types.ChatResponse, error) {
+	return c.CallWithContext(context.Background(), request)
+}
+
+// CallWithContext executes a chat completion request that is aborted when ctx is done
+func (c *Client) CallWithContext(ctx context.Context, request types.ChatRequest) (*types.ChatResponse, error) {
+	response, err := c.callChat(ctx, request)
+	if err == nil && response.Choices == nil && !c.lenientChoices {
+		err = errNoChoices
+	}
+	if err != nil || len(c.renameResponse) == 0 {
+		return response, err
+	}
+	return renameResponseFields(response, c.renameResponse)
+}
+
+// errNoChoices is returned for a 200 chat response without a choices array,
+// such as an empty object, so the step is retried or falls back
+var errNoChoices = errors.New("provider response has no choices")
+
+// callChat sends the chat request in the provider's API and returns the answer
+// as an OpenAI chat completion
+func (c *Client) callChat(ctx context.Context, request types.ChatRequest) (*types.ChatResponse, error) {
+	reqBody, err := c.prepareChatBody(request)
+	if err != nil {
+		return nil, err
+	}
+	if c.providerType == config.ProviderTypeGemini {
+		return c.callGemini(ctx, reqBody, request.Headers)
+	}
+	if c.forceStream {
+		return c.callAggregated(ctx, reqBody, request.Headers)
+	}
+
+	body, header, err := c.postJSON(ctx, c.chatCompletionsPath(), reqBody, request.Headers)
+	if err != nil {
+		return nil, err
+	}
+
+	// Store response as raw JSON (pass through unchanged)
+	var response types.ChatResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, newParseError(header, body, err)
+	}
+	response.Headers = c.copiedResponseHeaders(header)
+
+	return &response, nil
+}
+
+// CallStream executes a streaming chat completion request and returns the
+// upstream event stream once the provider has answered with 200. Non-200
+// responses are read fully and returned as errors so the caller can fall back
+// to the next route step before anything is written to the client. The step
+// timeout covers the wait for the provider's answer, not the stream itself.
+func (c *Client) CallStream(ctx context.Context, request types.ChatRequest) (*Stream, error) {
+	if c.providerType == config.ProviderTypeGemini {
+		return nil, fmt.Errorf("streaming is %w", errGeminiUnsupported)
+	}
+	reqBody, err := c.prepareChatBody(request)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	timer := time.AfterFunc(c.timeout, func() { cancel(context.DeadlineExceeded) })
+
+	resp, err := c.post(ctx, c.chatCompletionsPath(), reqBody, request.Headers)
+	if err != nil {
+		cancel(nil)
+		if errors.Is(context.Cause(ctx), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("request failed: %w", context.DeadlineExceeded)
+		}
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer cancel(nil)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+		return nil, newStatusError(resp, body)
+	}
+
+	if !timer.Stop() {
+		// The timeout fired just as the provider answered
+		resp.Body.Close()
+		cancel(nil)
+		return nil, fmt.Errorf("request failed: %w", context.DeadlineExceeded)
+	}
+
+	return &Stream{
+		Body:        resp.Body,
+		ContentType: resp.Header.Get("Content-Type"),
+		Headers:     c.copiedResponseHeaders(resp.Header),
+		cancel:      func() { cancel(nil) },
+	}, nil
+}
+
+// CallEmbeddings executes an embeddings request
+func (c *Client) CallEmbeddings(ctx context.Context, request types.EmbeddingsRequest) (*types.EmbeddingsResponse, error) {
+	if c.providerType == config.ProviderTypeGemini {
+		return nil, fmt.Errorf("embeddings are %w", errGeminiUnsupported)
+	}
 	// Override model with provider's configured model
 	request.Model = c.model
 
+	reqBody, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	body, header, err := c.postJSON(ctx, "/embeddings", reqBody, request.Headers)
+	if err != nil {
+		return nil, err
+	}
+
+	var response types.EmbeddingsResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, newParseError(header, body, err)
+	}
+
+	return &response, nil
+}
+
+// CallCompletions executes a legacy text completion request against the provider's /completions endpoint
+func (c *Client) CallCompletions(ctx context.Context, request types.CompletionRequest) (*types.CompletionResponse, error) {
+	if c.providerType == config.ProviderTypeGemini {
+		return nil, fmt.Errorf("text completions are %w", errGeminiUnsupported)
+	}
+	// Override model with provider's configured model
+	request.Model = c.model
+
+	reqBody, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	body, header, err := c.postJSON(ctx, "/completions", reqBody, request.Headers)
+	if err != nil {
+		return nil, err
+	}
+
+	var response types.CompletionResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, newParseError(header, body, err)
+	}
+
+	return &response, nil
+}
+
+// prepareChatBody applies the model override, message trimming, step defaults,
+// conflict resolution, step overrides and parameter renames, in that order, and
+// marshals the request
+func (c *Client) prepareChatBody(request types.ChatRequest) ([]byte, error) {
+	// Override model with provider's configured model
+	request.Model = c.model
+
+	// Drop the oldest messages beyond the step's limits
+	if c.maxMessages > 0 || c.maxContextTokens > 0 {
+		trimmed, err := trimMessages(&request, c.maxMessages, c.maxContextTokens)
+		if err != nil {
+			return nil, fmt.Errorf("failed to trim messages: %w", err)
+		}
+		c.trimmed = trimmed
+	}
+
+	// Fill in step defaults the client did not send
+	if len(c.defaults) > 0 {
+		if err := applyParams(&request, c.defaults, false); err != nil {
+			return nil, fmt.Errorf("failed to apply step defaults: %w", err)
+		}
+	}
+
 	// Apply conflict resolution if specified
 	if c.conflictResolution != "" {
 		if err := c.applyConflictResolution(&request); err != nil {
@@ -84,48 +402,85 @@ func (c *Client) Call(request types.ChatRequest) (*types.ChatResponse, error) {
 		}
 	}
 
+	// Force step overrides over whatever the client sent
+	if len(c.overrides) > 0 {
+		if err := applyParams(&request, c.overrides, true); err != nil {
+			return nil, fmt.Errorf("failed to apply step overrides: %w", err)
+		}
+	}
+
+	// Rename parameters to the provider's names
+	if len(c.renameParams) > 0 {
+		if err := renameParams(&request, c.renameParams); err != nil {
+			return nil, fmt.Errorf("failed to rename parameters: %w", err)
+		}
+	}
+
 	// Prepare request body
 	reqBody, err := json.Marshal(request)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
+	return reqBody, nil
+}
 
-	// Create HTTP request
-	url := fmt.Sprintf("%s/chat/completions", c.baseURL)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(reqBody))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
+// postJSON posts the body to the given endpoint path and returns the response body and headers of a 200 reply
+func (c *Client) postJSON(ctx context.Context, path string, reqBody []byte, incoming http.Header) ([]byte, http.Header, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
 
-	// Set headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
-
-	// Execute request
-	resp, err := c.client.Do(req)
+	resp, err := c.post(ctx, path, reqBody, incoming)
 	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+		return nil, nil, err
 	}
 	defer resp.Body.Close()
 
 	// Read response body
+	start := time.Now()
 	body, err := io.ReadAll(resp.Body)
+	c.upstream += time.Since(start)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
 	// Check HTTP status
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("provider returned status %d: %s", resp.StatusCode, string(body))
+		return nil, nil, newStatusError(resp, body)
 	}
 
-	// Store response as raw JSON (pass through unchanged)
-	var response types.ChatResponse
-	if err := json.Unmarshal(body, &response); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+	return body, resp.Header, nil
+}
+
+// post sends the body to the given endpoint path under the provider's base URL.
+// Headers listed in forward_headers are copied from incoming, the client's request headers.
+func (c *Client) post(ctx context.Context, path string, reqBody []byte, incoming http.Header) (*http.Response, error) {
+	// Create HTTP request
+	req, err := http.NewRequestWithContext(ctx, "POST", c.endpointURL(path), bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	return &response, nil
+	// Set headers
+	for name, values := range c.forwardedHeaders(incoming) {
+		req.Header[name] = values
+	}
+	c.setStaticHeaders(req)
+	req.Header.Set("Content-Type", "application/json")
+	c.setAuth(req)
+	// The step span's context replaces any traceparent forwarded from the client
+	telemetry.InjectTraceContext(ctx, req.Header)
+
+	// Execute request
+	start := time.Now()
+	resp, err := c.client.Do(req)
+	c.upstream += time.Since(start)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	if err := decodeResponseBody(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
 }
 
 // applyConflictResolution modifies the request to resolve tools/response_format conflicts
@@ -156,4 +511,185 @@ func (c *Client) applyConflictResolution(request *types.ChatRequest) error {
 
 	request.Raw = modifiedRaw
 	return nil
-}
\ No newline at end of file
+}
+
+// applyParams sets step parameters in the raw request. Without replace only keys
+// missing from the request are added; keys the client sent, even as null, are kept.
+func applyParams(request *types.ChatRequest, params map[string]interface{}, replace bool) error {
+	var reqMap map[string]interface{}
+	if err := json.Unmarshal(request.Raw, &reqMap); err != nil {
+		return fmt.Errorf("failed to parse request JSON: %w", err)
+	}
+
+	for key, value := range params {
+		if _, ok := reqMap[key]; replace || !ok {
+			reqMap[key] = value
+		}
+	}
+
+	modifiedRaw, err := json.Marshal(reqMap)
+	if err != nil {
+		return fmt.Errorf("failed to marshal modified request: %w", err)
+	}
+
+	request.Raw = modifiedRaw
+	return nil
+}
+
+// renameParams renames top-level parameters in the raw request
+func renameParams(request *types.ChatRequest, renames map[string]string) error {
+	var reqMap map[string]interface{}
+	if err := json.Unmarshal(request.Raw, &reqMap); err != nil {
+		return fmt.Errorf("failed to parse request JSON: %w", err)
+	}
+
+	renameFields(reqMap, renames)
+
+	modifiedRaw, err := json.Marshal(reqMap)
+	if err != nil {
+		return fmt.Errorf("failed to marshal modified request: %w", err)
+	}
+
+	request.Raw = modifiedRaw
+	return nil
+}
+
+// renameResponseFields renames fields of a chat completion at the top level
+// and in each choice's message
+func renameResponseFields(response *types.ChatResponse, renames map[string]string) (*types.ChatResponse, error) {
+	var respMap map[string]interface{}
+	if err := json.Unmarshal(response.Raw, &respMap); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	renameFields(respMap, renames)
+	if choices, ok := respMap["choices"].([]interface{}); ok {
+		for _, choice := range choices {
+			if choiceMap, ok := choice.(map[string]interface{}); ok {
+				if message, ok := choiceMap["message"].(map[string]interface{}); ok {
+					renameFields(message, renames)
+				}
+			}
+		}
+	}
+
+	modifiedRaw, err := json.Marshal(respMap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal modified response: %w", err)
+	}
+	var renamed types.ChatResponse
+	if err := json.Unmarshal(modifiedRaw, &renamed); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	renamed.Headers = response.Headers
+	return &renamed, nil
+}
+
+// renameFields moves each renamed field to its new name. All renames apply at
+// once, so two fields can swap names; a field already present under the new
+// name is kept and the renamed one dropped.
+func renameFields(fields map[string]interface{}, renames map[string]string) {
+	moved := make(map[string]interface{}, len(renames))
+	for from, to := range renames {
+		if value, ok := fields[from]; ok {
+			moved[to] = value
+			delete(fields, from)
+		}
+	}
+	for to, value := range moved {
+		if _, ok := fields[to]; !ok {
+			fields[to] = value
+		}
+	}
+}
+
+// overriddenParams returns the sorted names of the parameters the step forces
+func (c *Client) overriddenParams() []string {
+	keys := make([]string, 0, len(c.overrides))
+	for key := range c.overrides {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// chatCompletionsPath returns the provider's chat_completions_path, or the
+// standard "/chat/completions"
+func (c *Client) chatCompletionsPath() string {
+	if c.chatPath == "" {
+		return "/chat/completions"
+	}
+	return c.chatPath
+}
+
+// endpointURL builds the upstream URL for an API path such as "/chat/completions".
+// The path's leading slash is optional. Azure OpenAI nests paths under the
+// deployment and requires an api-version.
+func (c *Client) endpointURL(path string) string {
+	path = "/" + strings.TrimLeft(path, "/")
+	if c.providerType == config.ProviderTypeAzure {
+		return fmt.Sprintf("%s/openai/deployments/%s%s?api-version=%s",
+			c.baseURL, neturl.PathEscape(c.deployment), path, neturl.QueryEscape(c.apiVersion))
+	}
+	return c.baseURL + path
+}
+
+// defaultUserAgent identifies the gateway to providers without a user_agent
+var defaultUserAgent = "ai-gateway/" + version.Version
+
+// setStaticHeaders adds the User-Agent and the provider's configured headers,
+// which may replace it. They are applied before Content-Type and credentials,
+// which always take precedence.
+func (c *Client) setStaticHeaders(req *http.Request) {
+	userAgent := c.userAgent
+	if userAgent == "" {
+		userAgent = defaultUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+	for name, value := range c.headers {
+		req.Header.Set(name, value)
+	}
+}
+
+// setAuth adds the provider's credentials: an api-key header for Azure, an
+// x-goog-api-key header for Gemini, a bearer token otherwise. Gemini also
+// accepts ?key=, but a key in the URL would end up in logged request errors.
+func (c *Client) setAuth(req *http.Request) {
+	switch c.providerType {
+	case config.ProviderTypeAzure:
+		req.Header.Set("api-key", c.nextAPIKey())
+		return
+	case config.ProviderTypeGemini:
+		req.Header.Set("x-goog-api-key", c.nextAPIKey())
+		return
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.nextAPIKey()))
+}
+
+// copiedResponseHeaders returns the upstream response headers selected by response_headers
+func (c *Client) copiedResponseHeaders(upstream http.Header) http.Header {
+	if len(c.responseHeaders) == 0 || len(upstream) == 0 {
+		return nil
+	}
+	copied := make(http.Header)
+	for _, name := range c.responseHeaders {
+		if values := upstream.Values(name); len(values) > 0 {
+			copied[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+		}
+	}
+	return copied
+}
+
+// forwardedHeaders returns the client request headers selected by forward_headers
+func (c *Client) forwardedHeaders(incoming http.Header) http.Header {
+	if len(c.forwardHeaders) == 0 || len(incoming) == 0 {
+		return nil
+	}
+	forwarded := make(http.Header)
+	for _, name := range c.forwardHeaders {
+		if values := incoming.Values(name); len(values) > 0 {
+			forwarded[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+		}
+	}
+	return forwarded
+}
@@ -1,16 +1,23 @@
 package providers
 
 import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"ai-gateway/config"
 	"ai-gateway/logger"
 	"ai-gateway/types"
+	"ai-gateway/version"
 )
 
 func TestClient_Call(t *testing.T) {
@@ -351,6 +358,173 @@ func TestClient_ConflictResolution_Tools(t *testing.T) {
 	}
 }
 
+func TestClient_Call_StepDefaults(t *testing.T) {
+	var received map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &received); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"test","choices":[]}`))
+	}))
+	defer server.Close()
+
+	cfg := config.Provider{Name: "test-provider", APIKey: "test-api-key", BaseURL: server.URL}
+	step := config.RouteStep{
+		Provider: "test-provider",
+		Model:    "gpt-4",
+		Defaults: map[string]interface{}{"temperature": 0.2, "max_tokens": 512, "top_p": 0.9},
+	}
+	client := NewClientWithRouteStep(cfg, step, logger.NewLogger())
+
+	requestJSON := `{"model":"original","messages":[{"role":"user","content":"Hello"}],"temperature":1.0,"top_p":null}`
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(requestJSON), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+
+	if _, err := client.Call(request); err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+
+	if received["temperature"] != 1.0 {
+		t.Errorf("temperature = %v, want client value 1.0", received["temperature"])
+	}
+	if v, ok := received["top_p"]; !ok || v != nil {
+		t.Errorf("top_p = %v, want the client's explicit null", v)
+	}
+	if received["max_tokens"] != float64(512) {
+		t.Errorf("max_tokens = %v, want step default 512", received["max_tokens"])
+	}
+	if received["model"] != "gpt-4" {
+		t.Errorf("model = %v, want gpt-4", received["model"])
+	}
+}
+
+func TestClient_Call_StepOverrides(t *testing.T) {
+	var received map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &received); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"test","choices":[]}`))
+	}))
+	defer server.Close()
+
+	cfg := config.Provider{Name: "test-provider", APIKey: "test-api-key", BaseURL: server.URL}
+	step := config.RouteStep{
+		Provider:           "test-provider",
+		Model:              "gpt-4",
+		ConflictResolution: "tools",
+		Defaults:           map[string]interface{}{"temperature": 0.7, "max_tokens": 256},
+		Overrides:          map[string]interface{}{"temperature": 0, "response_format": map[string]interface{}{"type": "text"}},
+	}
+	client := NewClientWithRouteStep(cfg, step, logger.NewLogger())
+
+	requestJSON := `{"model":"original","messages":[{"role":"user","content":"Hello"}],"temperature":1.0,"tools":[{"function":{"name":"test"}}],"response_format":{"type":"json_object"}}`
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(requestJSON), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+
+	if _, err := client.Call(request); err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+
+	if received["temperature"] != float64(0) {
+		t.Errorf("temperature = %v, want override 0", received["temperature"])
+	}
+	if received["max_tokens"] != float64(256) {
+		t.Errorf("max_tokens = %v, want step default 256", received["max_tokens"])
+	}
+	// Overrides apply after conflict resolution, so the forced response_format survives
+	format, _ := received["response_format"].(map[string]interface{})
+	if format["type"] != "text" {
+		t.Errorf("response_format = %v, want override {type: text}", received["response_format"])
+	}
+	if _, ok := received["tools"]; !ok {
+		t.Error("tools should be preserved")
+	}
+	if received["model"] != "gpt-4" {
+		t.Errorf("model = %v, want gpt-4", received["model"])
+	}
+
+	if got := client.overriddenParams(); len(got) != 2 || got[0] != "response_format" || got[1] != "temperature" {
+		t.Errorf("overriddenParams() = %v, want [response_format temperature]", got)
+	}
+}
+
+func TestClient_Call_StepRenames(t *testing.T) {
+	var received map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &received); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"test","choices":[{"index":0,"message":{"role":"assistant","content":"Hi","reasoning":"thought"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	cfg := config.Provider{Name: "test-provider", APIKey: "test-api-key", BaseURL: server.URL}
+	step := config.RouteStep{
+		Provider:       "test-provider",
+		Model:          "o3",
+		Defaults:       map[string]interface{}{"max_tokens": 256},
+		RenameParams:   map[string]string{"max_tokens": "max_completion_tokens", "user": "safety_identifier"},
+		RenameResponse: map[string]string{"reasoning": "reasoning_content"},
+	}
+	client := NewClientWithRouteStep(cfg, step, logger.NewLogger())
+
+	requestJSON := `{"model":"original","messages":[{"role":"user","content":"Hello"}],"user":"u1","safety_identifier":"s1"}`
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(requestJSON), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+
+	resp, err := client.Call(request)
+	if err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+
+	// Defaults use the client's names and are renamed with the rest
+	if _, ok := received["max_tokens"]; ok {
+		t.Error("max_tokens should be renamed")
+	}
+	if received["max_completion_tokens"] != float64(256) {
+		t.Errorf("max_completion_tokens = %v, want renamed default 256", received["max_completion_tokens"])
+	}
+	// A field the client already sent under the new name is kept
+	if _, ok := received["user"]; ok {
+		t.Error("user should be renamed")
+	}
+	if received["safety_identifier"] != "s1" {
+		t.Errorf("safety_identifier = %v, want the client's s1", received["safety_identifier"])
+	}
+
+	var raw struct {
+		Choices []struct {
+			Message map[string]interface{} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(resp.Raw, &raw); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	message := raw.Choices[0].Message
+	if _, ok := message["reasoning"]; ok || message["reasoning_content"] != "thought" {
+		t.Errorf("message = %v, want reasoning renamed to reasoning_content", message)
+	}
+	if resp.Choices[0].Message.ContentAsString() != "Hi" {
+		t.Errorf("content = %q, want Hi", resp.Choices[0].Message.ContentAsString())
+	}
+}
+
 func TestClient_ConflictResolution_Format(t *testing.T) {
 	// Create mock server that verifies conflict resolution
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -421,4 +595,408 @@ func TestClient_ConflictResolution_Format(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Call() error = %v", err)
 	}
-}
\ No newline at end of file
+}
+func TestClient_CallEmbeddings(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/embeddings" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var received map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if received["model"] != "text-embedding-3-small" || received["input"] != "Hello" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(fmt.Sprintf("unexpected request: %v", received)))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"object":"list","data":[{"object":"embedding","index":0,"embedding":[0.1,0.2]}],"model":"text-embedding-3-small"}`))
+	}))
+	defer server.Close()
+
+	cfg := config.Provider{Name: "test-provider", APIKey: "test-api-key", BaseURL: server.URL}
+	step := config.RouteStep{Provider: "test-provider", Model: "text-embedding-3-small"}
+	client := NewClientWithRouteStep(cfg, step, logger.NewLogger())
+
+	var request types.EmbeddingsRequest
+	if err := json.Unmarshal([]byte(`{"model":"embeddings","input":"Hello"}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+
+	response, err := client.CallEmbeddings(context.Background(), request)
+	if err != nil {
+		t.Fatalf("CallEmbeddings() error = %v", err)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(response.Raw, &body); err != nil {
+		t.Fatalf("Failed to parse raw response: %v", err)
+	}
+	if data, ok := body["data"].([]interface{}); !ok || len(data) != 1 {
+		t.Errorf("Expected raw response to be passed through, got %s", string(response.Raw))
+	}
+}
+
+func TestClient_Call_Azure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/openai/deployments/my-gpt4o/chat/completions" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("unexpected path " + r.URL.Path))
+			return
+		}
+		if got := r.URL.Query().Get("api-version"); got != "2024-06-01" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("unexpected api-version " + got))
+			return
+		}
+		if r.Header.Get("api-key") != "azure-key" || r.Header.Get("Authorization") != "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"test","object":"chat.completion","choices":[]}`))
+	}))
+	defer server.Close()
+
+	cfg := config.Provider{Name: "azure", Type: config.ProviderTypeAzure, APIKey: "azure-key", BaseURL: server.URL, APIVersion: "2024-06-01"}
+	step := config.RouteStep{Provider: "azure", Model: "gpt-4o", Deployment: "my-gpt4o"}
+	client := NewClientWithRouteStep(cfg, step, logger.NewLogger())
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"route","messages":[{"role":"user","content":"Hi"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+
+	if _, err := client.Call(request); err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+}
+
+func TestClient_AzureDeploymentDefaultsToModel(t *testing.T) {
+	cfg := config.Provider{Name: "azure", Type: config.ProviderTypeAzure, APIKey: "k", BaseURL: "https://example.openai.azure.com", APIVersion: "2024-06-01"}
+	client := NewClientWithRouteStep(cfg, config.RouteStep{Provider: "azure", Model: "gpt-4o"}, logger.NewLogger())
+
+	want := "https://example.openai.azure.com/openai/deployments/gpt-4o/chat/completions?api-version=2024-06-01"
+	if got := client.endpointURL("/chat/completions"); got != want {
+		t.Errorf("endpointURL() = %s, want %s", got, want)
+	}
+}
+
+func TestClient_EndpointURL_Slashes(t *testing.T) {
+	tests := []struct {
+		name     string
+		baseURL  string
+		chatPath string
+		want     string
+	}{
+		{name: "no trailing slash", baseURL: "https://api.example.com/v1", want: "https://api.example.com/v1/chat/completions"},
+		{name: "trailing slash", baseURL: "https://api.example.com/v1/", want: "https://api.example.com/v1/chat/completions"},
+		{name: "several trailing slashes", baseURL: "https://api.example.com/v1//", want: "https://api.example.com/v1/chat/completions"},
+		{name: "host only", baseURL: "http://localhost:8000", chatPath: "/v1/chat/completions", want: "http://localhost:8000/v1/chat/completions"},
+		{name: "custom path", baseURL: "https://llm.internal/", chatPath: "/openai/chat", want: "https://llm.internal/openai/chat"},
+		{name: "custom path without leading slash", baseURL: "https://llm.internal/api", chatPath: "generate", want: "https://llm.internal/api/generate"},
+		{name: "both slashes", baseURL: "https://llm.internal/api/", chatPath: "/generate", want: "https://llm.internal/api/generate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Provider{Name: "p", APIKey: "k", BaseURL: tt.baseURL, ChatCompletionsPath: tt.chatPath}
+			client := NewClientWithRouteStep(cfg, config.RouteStep{Provider: "p", Model: "m"}, logger.NewLogger())
+			if got := client.endpointURL(client.chatCompletionsPath()); got != tt.want {
+				t.Errorf("endpointURL() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_Call_ChatCompletionsPath(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/generate" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("unexpected path " + r.URL.Path))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"test","object":"chat.completion","choices":[]}`))
+	}))
+	defer server.Close()
+
+	cfg := config.Provider{Name: "vllm", APIKey: "k", BaseURL: server.URL + "/v1/", ChatCompletionsPath: "/generate"}
+	client := NewClientWithRouteStep(cfg, config.RouteStep{Provider: "vllm", Model: "m"}, logger.NewLogger())
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"route","messages":[{"role":"user","content":"Hi"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+	if _, err := client.CallWithContext(context.Background(), request); err != nil {
+		t.Fatalf("CallWithContext() error = %v", err)
+	}
+}
+
+func TestClient_Call_ForwardHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("OpenAI-Organization") != "org-123" || r.Header.Get("X-Trace-Id") != "trace-1" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("forwarded headers missing"))
+			return
+		}
+		if r.Header.Get("X-Not-Forwarded") != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("unlisted header was forwarded"))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer test-api-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"test","object":"chat.completion","choices":[]}`))
+	}))
+	defer server.Close()
+
+	cfg := config.Provider{Name: "test-provider", APIKey: "test-api-key", BaseURL: server.URL, ForwardHeaders: []string{"OpenAI-Organization"}}
+	step := config.RouteStep{Provider: "test-provider", Model: "gpt-4", ForwardHeaders: []string{"x-trace-id"}}
+	client := NewClientWithRouteStep(cfg, step, logger.NewLogger())
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"route","messages":[{"role":"user","content":"Hi"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+	request.Headers = http.Header{}
+	request.Headers.Set("OpenAI-Organization", "org-123")
+	request.Headers.Set("X-Trace-Id", "trace-1")
+	request.Headers.Set("X-Not-Forwarded", "nope")
+	request.Headers.Set("Authorization", "Bearer gateway-key")
+
+	if _, err := client.Call(request); err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+}
+
+func TestClient_Call_StaticHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("HTTP-Referer") != "https://example.com" || r.Header.Get("X-Title") != "AI Gateway" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("static headers missing"))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer test-api-key" || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"test","object":"chat.completion","choices":[]}`))
+	}))
+	defer server.Close()
+
+	cfg := config.Provider{
+		Name:    "test-provider",
+		APIKey:  "test-api-key",
+		BaseURL: server.URL,
+		Headers: map[string]string{
+			"HTTP-Referer":  "https://example.com",
+			"X-Title":       "AI Gateway",
+			"Authorization": "Bearer should-not-win",
+		},
+	}
+	client := NewClientWithRouteStep(cfg, config.RouteStep{Provider: "test-provider", Model: "gpt-4"}, logger.NewLogger())
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"route","messages":[{"role":"user","content":"Hi"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+
+	if _, err := client.Call(request); err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+}
+
+func TestClient_Call_UserAgent(t *testing.T) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("User-Agent")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"test","object":"chat.completion","choices":[]}`))
+	}))
+	defer server.Close()
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"route","messages":[{"role":"user","content":"Hi"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		userAgent string
+		want      string
+	}{
+		{name: "default", want: "ai-gateway/" + version.Version},
+		{name: "configured", userAgent: "acme-bot/2.0", want: "acme-bot/2.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Provider{Name: "test-provider", APIKey: "key", BaseURL: server.URL, UserAgent: tt.userAgent}
+			client := NewClientWithRouteStep(cfg, config.RouteStep{Provider: "test-provider", Model: "gpt-4"}, logger.NewLogger())
+			if _, err := client.Call(request); err != nil {
+				t.Fatalf("Call() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected User-Agent %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestClient_Call_CompressedResponse(t *testing.T) {
+	responseJSON := `{"id":"test","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"decoded"}}]}`
+
+	tests := []struct {
+		encoding string
+		compress func(w io.Writer) io.WriteCloser
+	}{
+		{"gzip", func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }},
+		{"deflate", func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Content-Encoding", tt.encoding)
+				zw := tt.compress(w)
+				zw.Write([]byte(responseJSON))
+				zw.Close()
+			}))
+			defer server.Close()
+
+			// An explicit Accept-Encoding stops Go's transport from decoding gzip itself
+			cfg := config.Provider{
+				Name:    "test-provider",
+				APIKey:  "test-api-key",
+				BaseURL: server.URL,
+				Headers: map[string]string{"Accept-Encoding": tt.encoding},
+			}
+			client := NewClientWithRouteStep(cfg, config.RouteStep{Provider: "test-provider", Model: "gpt-4"}, logger.NewLogger())
+
+			var request types.ChatRequest
+			if err := json.Unmarshal([]byte(`{"model":"route","messages":[{"role":"user","content":"Hi"}]}`), &request); err != nil {
+				t.Fatalf("Failed to unmarshal test request: %v", err)
+			}
+
+			resp, err := client.Call(request)
+			if err != nil {
+				t.Fatalf("Call() error = %v", err)
+			}
+			if string(resp.Raw) != responseJSON {
+				t.Errorf("response = %s, want %s", resp.Raw, responseJSON)
+			}
+		})
+	}
+}
+
+func TestClient_Call_ProxyURL(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A forward proxy receives the absolute upstream URL
+		if r.URL.Host != "upstream.invalid" || r.URL.Path != "/v1/chat/completions" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		if r.Header.Get("X-Slow") != "" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"proxied","choices":[]}`))
+	}))
+	defer proxy.Close()
+
+	cfg := config.Provider{
+		Name:     "test-provider",
+		APIKey:   "test-api-key",
+		BaseURL:  "http://upstream.invalid/v1",
+		ProxyURL: proxy.URL,
+	}
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"route","messages":[{"role":"user","content":"Hi"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+
+	client := NewClientWithRouteStep(cfg, config.RouteStep{Provider: "test-provider", Model: "gpt-4"}, logger.NewLogger())
+	if _, err := client.Call(request); err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+
+	// The step timeout still applies to proxied requests
+	cfg.Headers = map[string]string{"X-Slow": "1"}
+	client = NewClientWithRouteStep(cfg, config.RouteStep{Provider: "test-provider", Model: "gpt-4", Timeout: "50ms"}, logger.NewLogger())
+	if _, err := client.Call(request); err == nil {
+		t.Fatal("Call() through a slow proxy should time out")
+	}
+}
+
+func TestClient_CallWithContext_Cancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	cfg := config.Provider{Name: "test-provider", APIKey: "test-api-key", BaseURL: server.URL}
+	client := NewClientWithRouteStep(cfg, config.RouteStep{Provider: "test-provider", Model: "gpt-4"}, logger.NewLogger())
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"route","messages":[{"role":"user","content":"Hi"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := client.CallWithContext(ctx, request)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the call to return promptly after cancellation, took %v", elapsed)
+	}
+}
+
+func TestClient_Call_NonJSONResponse(t *testing.T) {
+	page := "<!DOCTYPE html>\n<html>\n  <head><title>Sign in</title></head>\n  <body>" + strings.Repeat("Please sign in. ", 50) + "</body>\n</html>"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(page))
+	}))
+	defer server.Close()
+
+	cfg := config.Provider{Name: "proxied", APIKey: "key", BaseURL: server.URL}
+	client := NewClientWithRouteStep(cfg, config.RouteStep{Provider: "proxied", Model: "gpt-4o"}, logger.NewLogger())
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"chat","messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+
+	_, err := client.Call(request)
+	if err == nil {
+		t.Fatal("Expected an error for an HTML response")
+	}
+	msg := err.Error()
+	if !strings.Contains(msg, "Content-Type: text/html; charset=utf-8") || !strings.Contains(msg, "<!DOCTYPE html> <html> <head><title>Sign in</title>") {
+		t.Errorf("Expected the Content-Type and the start of the page in the error, got %s", msg)
+	}
+	if len(msg) > 2*maxBodyExcerpt+200 || !strings.Contains(msg, "...") {
+		t.Errorf("Expected the body to be truncated, got %d characters: %s", len(msg), msg)
+	}
+}
@@ -0,0 +1,66 @@
+package providers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"ai-gateway/config"
+)
+
+// concurrencyLimits holds a semaphore per provider with max_concurrency set.
+// Semaphores are keyed by provider name so the limit covers every route and
+// request using the provider.
+type concurrencyLimits struct {
+	mu    sync.Mutex
+	slots map[string]chan struct{} // provider name -> semaphore, capacity max_concurrency
+}
+
+func newConcurrencyLimits() *concurrencyLimits {
+	return &concurrencyLimits{slots: make(map[string]chan struct{})}
+}
+
+// semaphore returns the provider's semaphore, replacing it when a reload
+// changed max_concurrency. Requests holding a slot in the old one release it there.
+func (l *concurrencyLimits) semaphore(provider config.Provider) chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	slots, ok := l.slots[provider.Name]
+	if !ok || cap(slots) != provider.MaxConcurrency {
+		slots = make(chan struct{}, provider.MaxConcurrency)
+		l.slots[provider.Name] = slots
+	}
+	return slots
+}
+
+// acquire takes a slot for a request to the provider. It returns the function
+// releasing the slot, how long it waited, and false when no slot was free:
+// immediately with on_saturation "fallback", otherwise after queue_timeout or
+// when ctx ends. Providers without max_concurrency never wait.
+func (l *concurrencyLimits) acquire(ctx context.Context, provider config.Provider) (func(), time.Duration, bool) {
+	if provider.MaxConcurrency <= 0 {
+		return func() {}, 0, true
+	}
+	slots := l.semaphore(provider)
+	release := func() { <-slots }
+
+	select {
+	case slots <- struct{}{}:
+		return release, 0, true
+	default:
+	}
+	if provider.OnSaturation == config.SaturationFallback {
+		return nil, 0, false
+	}
+
+	start := time.Now()
+	timer := time.NewTimer(provider.GetQueueTimeout())
+	defer timer.Stop()
+	select {
+	case slots <- struct{}{}:
+		return release, time.Since(start), true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	return nil, time.Since(start), false
+}
@@ -0,0 +1,168 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ai-gateway/config"
+	"ai-gateway/logger"
+	"ai-gateway/types"
+)
+
+func TestConcurrencyLimits(t *testing.T) {
+	l := newConcurrencyLimits()
+	provider := config.Provider{Name: "p", MaxConcurrency: 1, QueueTimeout: "20ms"}
+
+	release, _, ok := l.acquire(context.Background(), provider)
+	if !ok {
+		t.Fatal("Expected the first request to get a slot")
+	}
+
+	// A waiting request gives up after queue_timeout
+	_, waited, ok := l.acquire(context.Background(), provider)
+	if ok {
+		t.Fatal("Expected no slot while the provider is saturated")
+	}
+	if waited < 20*time.Millisecond {
+		t.Errorf("Expected to wait for queue_timeout, waited %v", waited)
+	}
+
+	// A fallback request gives up right away
+	fallback := provider
+	fallback.OnSaturation = config.SaturationFallback
+	if _, waited, ok := l.acquire(context.Background(), fallback); ok || waited != 0 {
+		t.Errorf("Expected fallback to give up without waiting, got ok=%v waited=%v", ok, waited)
+	}
+
+	// A waiting request gets the slot once it is released
+	time.AfterFunc(10*time.Millisecond, release)
+	provider.QueueTimeout = "1s"
+	release, waited, ok = l.acquire(context.Background(), provider)
+	if !ok {
+		t.Fatal("Expected a slot after it was released")
+	}
+	if waited == 0 {
+		t.Error("Expected the queue wait to be reported")
+	}
+	release()
+
+	// Providers without a limit never wait
+	if _, _, ok := l.acquire(context.Background(), config.Provider{Name: "unlimited"}); !ok {
+		t.Error("Expected providers without max_concurrency to be unlimited")
+	}
+}
+
+func TestManager_Execute_SaturatedProviderFallsBack(t *testing.T) {
+	unblock := make(chan struct{})
+	started := make(chan struct{}, 1)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-unblock
+		w.Write([]byte(`{"id":"slow","object":"chat.completion","choices":[]}`))
+	}))
+	defer slow.Close()
+	defer close(unblock)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"fast","object":"chat.completion","choices":[]}`))
+	}))
+	defer fast.Close()
+
+	providers := []config.Provider{
+		{Name: "slow", APIKey: "key1", BaseURL: slow.URL, MaxConcurrency: 1, OnSaturation: config.SaturationFallback},
+		{Name: "fast", APIKey: "key2", BaseURL: fast.URL},
+	}
+	routes := []config.Route{
+		{
+			Name: "test-model",
+			Steps: []config.RouteStep{
+				{Provider: "slow", Model: "m"},
+				{Provider: "fast", Model: "m"},
+			},
+		},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"test-model","messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+
+	// The first request holds the slow provider's only slot
+	go manager.Execute(request)
+	<-started
+
+	resp, err := manager.Execute(request)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if resp.ID != "fast" {
+		t.Errorf("Expected the saturated provider to be skipped, got response %s", resp.ID)
+	}
+}
+
+func TestManager_Execute_SaturationSkipReleasesCircuitTrial(t *testing.T) {
+	failing := true
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"id":"primary","object":"chat.completion","choices":[]}`))
+	}))
+	defer primary.Close()
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"backup","object":"chat.completion","choices":[]}`))
+	}))
+	defer backup.Close()
+
+	providers := []config.Provider{
+		{Name: "primary", APIKey: "key1", BaseURL: primary.URL, MaxConcurrency: 1, OnSaturation: config.SaturationFallback},
+		{Name: "backup", APIKey: "key2", BaseURL: backup.URL},
+	}
+	routes := []config.Route{
+		{Name: "test-model", Steps: []config.RouteStep{{Provider: "primary", Model: "m"}, {Provider: "backup", Model: "m"}}},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+	manager.SetCircuitBreaker(1, 0, time.Minute)
+	now := time.Now()
+	manager.breakers.now = func() time.Time { return now }
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"test-model","messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+	execute := func() string {
+		resp, err := manager.Execute(request)
+		if err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+		return resp.ID
+	}
+
+	// A failure opens the primary's circuit
+	execute()
+
+	// After the cooldown the half-open trial goes to a request that finds the
+	// primary saturated and is skipped
+	now = now.Add(2 * time.Minute)
+	release, _, ok := manager.limits.acquire(context.Background(), providers[0])
+	if !ok {
+		t.Fatal("Expected to take the primary's only slot")
+	}
+	if id := execute(); id != "backup" {
+		t.Fatalf("Expected the saturated primary to be skipped, got %s", id)
+	}
+	release()
+
+	// The trial was given back, so the recovered primary gets it and closes the circuit
+	failing = false
+	for i := 0; i < 2; i++ {
+		if id := execute(); id != "primary" {
+			t.Fatalf("Request %d: expected the recovered primary to serve, got %s", i+1, id)
+		}
+	}
+}
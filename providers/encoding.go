@@ -0,0 +1,54 @@
+package providers
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// decodeResponseBody replaces resp.Body with a decompressing reader when the
+// provider sent a gzip or deflate Content-Encoding. Go's transport only
+// decodes gzip itself when it added Accept-Encoding, which a forwarded or
+// static header can prevent, and never decodes deflate.
+func decodeResponseBody(resp *http.Response) error {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	var (
+		reader io.ReadCloser
+		err    error
+	)
+	switch encoding {
+	case "", "identity":
+		return nil
+	case "gzip", "x-gzip":
+		reader, err = gzip.NewReader(resp.Body)
+	case "deflate":
+		reader, err = zlib.NewReader(resp.Body)
+	default:
+		return nil
+	}
+	if err != nil {
+		resp.Body.Close()
+		return fmt.Errorf("failed to decode %s response: %w", encoding, err)
+	}
+
+	resp.Body = &decodedBody{Reader: reader, decoder: reader, body: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	return nil
+}
+
+// decodedBody reads through a decompressor and closes both it and the underlying body
+type decodedBody struct {
+	io.Reader
+	decoder io.Closer
+	body    io.Closer
+}
+
+func (d *decodedBody) Close() error {
+	d.decoder.Close()
+	return d.body.Close()
+}
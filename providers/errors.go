@@ -0,0 +1,213 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"ai-gateway/config"
+	"ai-gateway/types"
+)
+
+// ErrRequestTimeout is returned when request_timeout expires before any route step succeeds
+var ErrRequestTimeout = errors.New("request timeout exceeded")
+
+// ErrProviderNotInRoute is returned when the X-Gateway-Provider header names a
+// provider that has no step in the matched route
+var ErrProviderNotInRoute = errors.New("requested provider is not part of the route")
+
+// ErrIdempotencyKeyReused is returned when an Idempotency-Key comes back with a
+// different request than the one its response was stored for
+var ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different request")
+
+// ErrIdempotencyKeyInFlight is returned when an Idempotency-Key is sent again
+// while the first request with it is still running
+var ErrIdempotencyKeyInFlight = errors.New("a request with this idempotency key is still in progress")
+
+// StatusError is returned when a provider answers with a non-200 status
+type StatusError struct {
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration        // zero when the provider did not send Retry-After
+	Upstream   *types.UpstreamError // parsed error body, nil when it isn't recognizable JSON
+}
+
+// Error implements the error interface for StatusError. The upstream message
+// is used when the body could be parsed, the raw body otherwise.
+func (e *StatusError) Error() string {
+	if e.Upstream != nil && e.Upstream.Message != "" {
+		return fmt.Sprintf("provider returned status %d: %s", e.StatusCode, e.Upstream.Message)
+	}
+	return fmt.Sprintf("provider returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// maxBodyExcerpt is how much of an unparseable response body its error quotes
+const maxBodyExcerpt = 200
+
+// newParseError describes a successful response whose body isn't the expected
+// JSON, e.g. an HTML login or error page from a proxy in front of the
+// provider, with its Content-Type and the start of the body
+func newParseError(header http.Header, body []byte, err error) error {
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "none"
+	}
+	return fmt.Errorf("failed to parse response (Content-Type: %s, body: %s): %w", contentType, bodyExcerpt(body), err)
+}
+
+// bodyExcerpt returns the start of body on one line, cut at maxBodyExcerpt
+// bytes without splitting a character
+func bodyExcerpt(body []byte) string {
+	excerpt := strings.Join(strings.Fields(strings.ToValidUTF8(string(body), "")), " ")
+	if excerpt == "" {
+		return "empty"
+	}
+	if len(excerpt) <= maxBodyExcerpt {
+		return excerpt
+	}
+	cut := maxBodyExcerpt
+	for cut > 0 && !utf8.RuneStart(excerpt[cut]) {
+		cut--
+	}
+	return excerpt[:cut] + "..."
+}
+
+// newStatusError builds a StatusError from a provider response and its body
+func newStatusError(resp *http.Response, body []byte) *StatusError {
+	return &StatusError{
+		StatusCode: resp.StatusCode,
+		Body:       string(body),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		Upstream:   parseUpstreamError(body),
+	}
+}
+
+// parseUpstreamError extracts the error details from an OpenAI-style body
+// ({"error": {"message", "type", "code"}}), also accepting {"error": "text"}
+// and a top-level "message". It returns nil when nothing usable is found.
+func parseUpstreamError(body []byte) *types.UpstreamError {
+	var envelope struct {
+		Error   json.RawMessage `json:"error"`
+		Message string          `json:"message"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil
+	}
+
+	var detail struct {
+		Message string          `json:"message"`
+		Type    string          `json:"type"`
+		Code    json.RawMessage `json:"code"`
+		Param   string          `json:"param"`
+	}
+	if err := json.Unmarshal(envelope.Error, &detail); err == nil && detail.Message != "" {
+		return &types.UpstreamError{
+			Message: detail.Message,
+			Type:    detail.Type,
+			Code:    rawCodeString(detail.Code),
+			Param:   detail.Param,
+		}
+	}
+
+	var message string
+	if err := json.Unmarshal(envelope.Error, &message); err == nil && message != "" {
+		return &types.UpstreamError{Message: message}
+	}
+	if envelope.Message != "" {
+		return &types.UpstreamError{Message: envelope.Message}
+	}
+	return nil
+}
+
+// rawCodeString renders an error code that providers send as either a string or a number
+func rawCodeString(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	return string(raw)
+}
+
+// newRouteStepError describes a failed step, carrying the upstream status
+// code and parsed error details when the provider answered with an error
+func newRouteStepError(stepIndex int, step config.RouteStep, err error) types.RouteStepError {
+	stepErr := types.RouteStepError{
+		StepIndex: stepIndex,
+		Provider:  step.Provider,
+		Model:     step.Model,
+		Error:     err.Error(),
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		stepErr.StatusCode = statusErr.StatusCode
+		stepErr.Upstream = statusErr.Upstream
+	}
+	return stepErr
+}
+
+// fallbackAllowed reports whether a failed step's error lets the route move on
+// to its next step under the route's fallback_on. Without it every error does.
+func fallbackAllowed(fallbackOn []string, err error) bool {
+	if len(fallbackOn) == 0 {
+		return true
+	}
+	for _, condition := range fallbackConditions(err) {
+		if slices.Contains(fallbackOn, condition) {
+			return true
+		}
+	}
+	return false
+}
+
+// fallbackConditions returns the fallback_on entries that match err: the
+// upstream status code and its class, "timeout", or "network" for failures
+// without an upstream status
+func fallbackConditions(err error) []string {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		conditions := []string{strconv.Itoa(statusErr.StatusCode)}
+		switch {
+		case statusErr.StatusCode >= 500:
+			conditions = append(conditions, config.FallbackOn5xx)
+		case statusErr.StatusCode >= 400:
+			conditions = append(conditions, config.FallbackOn4xx)
+		}
+		return conditions
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return []string{config.FallbackOnTimeout}
+	}
+	return []string{config.FallbackOnNetwork}
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if d := time.Until(date); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
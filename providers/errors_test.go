@@ -0,0 +1,85 @@
+package providers
+
+import (
+	"errors"
+	"testing"
+
+	"ai-gateway/config"
+)
+
+func TestParseUpstreamError(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantNil     bool
+		wantMessage string
+		wantType    string
+		wantCode    string
+	}{
+		{
+			name:        "openai error object",
+			body:        `{"error":{"message":"Incorrect API key provided","type":"invalid_request_error","code":"invalid_api_key"}}`,
+			wantMessage: "Incorrect API key provided",
+			wantType:    "invalid_request_error",
+			wantCode:    "invalid_api_key",
+		},
+		{
+			name:        "numeric code",
+			body:        `{"error":{"message":"Rate limit exceeded","code":429}}`,
+			wantMessage: "Rate limit exceeded",
+			wantCode:    "429",
+		},
+		{
+			name:        "error string",
+			body:        `{"error":"model not found"}`,
+			wantMessage: "model not found",
+		},
+		{
+			name:        "top-level message",
+			body:        `{"message":"Service unavailable"}`,
+			wantMessage: "Service unavailable",
+		},
+		{
+			name:    "not json",
+			body:    `<html>Bad Gateway</html>`,
+			wantNil: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseUpstreamError([]byte(tt.body))
+			if tt.wantNil {
+				if got != nil {
+					t.Errorf("expected nil, got %+v", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("expected parsed error, got nil")
+			}
+			if got.Message != tt.wantMessage || got.Type != tt.wantType || got.Code != tt.wantCode {
+				t.Errorf("got %+v, want message=%q type=%q code=%q", got, tt.wantMessage, tt.wantType, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestNewRouteStepError(t *testing.T) {
+	step := config.RouteStep{Provider: "openai", Model: "gpt-4o"}
+
+	statusErr := &StatusError{StatusCode: 401, Body: `{"error":{"message":"bad key"}}`}
+	statusErr.Upstream = parseUpstreamError([]byte(statusErr.Body))
+	stepErr := newRouteStepError(2, step, statusErr)
+	if stepErr.StatusCode != 401 || stepErr.Upstream == nil || stepErr.Upstream.Message != "bad key" {
+		t.Errorf("expected status and upstream details, got %+v", stepErr)
+	}
+	if stepErr.Error != "provider returned status 401: bad key" {
+		t.Errorf("expected clean error message, got %q", stepErr.Error)
+	}
+
+	stepErr = newRouteStepError(0, step, errors.New("request failed: connection refused"))
+	if stepErr.StatusCode != 0 || stepErr.Upstream != nil {
+		t.Errorf("expected no status for transport errors, got %+v", stepErr)
+	}
+}
@@ -0,0 +1,59 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"ai-gateway/metrics"
+	"ai-gateway/types"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// FallbackHeader is set on responses synthesized from a route's fallback_response
+const FallbackHeader = "X-Gateway-Fallback"
+
+// fallbackResponse answers a chat request whose route failed on every step
+// with the route's fallback_response as the assistant message, naming the
+// requested model since a pattern route's name isn't one. The step
+// errors were already logged per step; the route failure is logged here too,
+// since the client only sees a normal completion.
+func (m *Manager) fallbackResponse(ctx context.Context, routeErr types.RouteError, model, requestID string) (*types.ChatResponse, error) {
+	route := routeErr.Route
+	fields := map[string]interface{}{
+		"route":  route.Name,
+		"errors": len(routeErr.Errors),
+	}
+	if requestID != "" {
+		fields["request_id"] = requestID
+	}
+	m.logger.Error("All route steps failed, returning fallback_response", routeErr, fields)
+	metrics.FallbackResponsesTotal.Inc(route.Name)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("route.fallback_response", true))
+
+	body, err := json.Marshal(map[string]interface{}{
+		"id":      "chatcmpl-fallback-" + newResponseID(),
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   model,
+		"choices": []map[string]interface{}{{
+			"index":         0,
+			"message":       map[string]interface{}{"role": "assistant", "content": route.FallbackResponse},
+			"finish_reason": "stop",
+		}},
+		"usage": types.Usage{},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build fallback response: %w", err)
+	}
+	var response types.ChatResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to build fallback response: %w", err)
+	}
+	response.Headers = http.Header{FallbackHeader: []string{"true"}}
+	return &response, nil
+}
@@ -0,0 +1,537 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
+
+	"ai-gateway/types"
+)
+
+// Gemini providers (type: gemini) speak the generateContent API. Chat requests
+// are translated into Gemini's contents, with the model in the URL path, and
+// the candidates of the answer are translated back into OpenAI choices.
+
+// errGeminiUnsupported is returned for requests Gemini providers can't translate yet
+var errGeminiUnsupported = errors.New("not supported by gemini providers")
+
+// geminiRequest is the body of a generateContent call
+type geminiRequest struct {
+	Contents          []geminiContent        `json:"contents"`
+	SystemInstruction *geminiContent         `json:"systemInstruction,omitempty"`
+	Tools             []geminiTool           `json:"tools,omitempty"`
+	ToolConfig        *geminiToolConfig      `json:"toolConfig,omitempty"`
+	GenerationConfig  geminiGenerationConfig `json:"generationConfig"`
+}
+
+// geminiContent is one conversation turn; Role is "user" or "model"
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	InlineData       *geminiInlineData       `json:"inlineData,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type geminiInlineData struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"` // base64
+}
+
+type geminiFunctionCall struct {
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	Name     string          `json:"name"`
+	Response json.RawMessage `json:"response"` // must be a JSON object
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parametersJsonSchema,omitempty"`
+}
+
+type geminiToolConfig struct {
+	FunctionCallingConfig geminiFunctionCallingConfig `json:"functionCallingConfig"`
+}
+
+type geminiFunctionCallingConfig struct {
+	Mode                 string   `json:"mode"` // AUTO, ANY or NONE
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+}
+
+type geminiGenerationConfig struct {
+	Temperature      *float64 `json:"temperature,omitempty"`
+	TopP             *float64 `json:"topP,omitempty"`
+	MaxOutputTokens  *int     `json:"maxOutputTokens,omitempty"`
+	CandidateCount   *int     `json:"candidateCount,omitempty"`
+	StopSequences    []string `json:"stopSequences,omitempty"`
+	PresencePenalty  *float64 `json:"presencePenalty,omitempty"`
+	FrequencyPenalty *float64 `json:"frequencyPenalty,omitempty"`
+	Seed             *int64   `json:"seed,omitempty"`
+	ResponseMimeType string   `json:"responseMimeType,omitempty"`
+}
+
+// geminiResponse is the answer to a generateContent call
+type geminiResponse struct {
+	Candidates []struct {
+		Index        int           `json:"index"`
+		Content      geminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	PromptFeedback *struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback"`
+	UsageMetadata struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+		TotalTokenCount      int `json:"totalTokenCount"`
+	} `json:"usageMetadata"`
+	ModelVersion string `json:"modelVersion"`
+	ResponseID   string `json:"responseId"`
+}
+
+// openAIChatRequest holds the chat request fields Gemini has an equivalent for
+type openAIChatRequest struct {
+	Messages []struct {
+		Role       string          `json:"role"`
+		Content    json.RawMessage `json:"content"`
+		ToolCallID string          `json:"tool_call_id"`
+		ToolCalls  []struct {
+			ID       string `json:"id"`
+			Function struct {
+				Name      string `json:"name"`
+				Arguments string `json:"arguments"`
+			} `json:"function"`
+		} `json:"tool_calls"`
+	} `json:"messages"`
+	Tools []struct {
+		Function struct {
+			Name        string          `json:"name"`
+			Description string          `json:"description"`
+			Parameters  json.RawMessage `json:"parameters"`
+		} `json:"function"`
+	} `json:"tools"`
+	ToolChoice          json.RawMessage `json:"tool_choice"`
+	Temperature         *float64        `json:"temperature"`
+	TopP                *float64        `json:"top_p"`
+	MaxTokens           *int            `json:"max_tokens"`
+	MaxCompletionTokens *int            `json:"max_completion_tokens"`
+	N                   *int            `json:"n"`
+	Stop                json.RawMessage `json:"stop"`
+	PresencePenalty     *float64        `json:"presence_penalty"`
+	FrequencyPenalty    *float64        `json:"frequency_penalty"`
+	Seed                *int64          `json:"seed"`
+	ResponseFormat      *struct {
+		Type string `json:"type"`
+	} `json:"response_format"`
+}
+
+// callGemini translates a prepared OpenAI chat body, posts it to the model's
+// generateContent endpoint and translates the answer back
+func (c *Client) callGemini(ctx context.Context, reqBody []byte, incoming http.Header) (*types.ChatResponse, error) {
+	geminiBody, err := toGeminiRequest(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to translate request for gemini: %w", err)
+	}
+	payload, err := json.Marshal(geminiBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	path := fmt.Sprintf("/models/%s:generateContent", neturl.PathEscape(strings.TrimPrefix(c.model, "models/")))
+	body, header, err := c.postJSON(ctx, path, payload, incoming)
+	if err != nil {
+		return nil, err
+	}
+
+	translated, err := fromGeminiResponse(body, c.model)
+	if err != nil {
+		return nil, newParseError(header, body, err)
+	}
+	var response types.ChatResponse
+	if err := json.Unmarshal(translated, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	response.Headers = c.copiedResponseHeaders(header)
+	return &response, nil
+}
+
+// toGeminiRequest builds a generateContent body from an OpenAI chat request.
+// System and developer messages become the systemInstruction, assistant turns
+// the "model" role, and tool results functionResponse parts.
+func toGeminiRequest(reqBody []byte) (*geminiRequest, error) {
+	var req openAIChatRequest
+	if err := json.Unmarshal(reqBody, &req); err != nil {
+		return nil, fmt.Errorf("failed to parse request JSON: %w", err)
+	}
+
+	out := &geminiRequest{}
+	toolNames := make(map[string]string) // tool_call_id -> function name, for tool results
+	for i, msg := range req.Messages {
+		var role string
+		var parts []geminiPart
+		switch msg.Role {
+		case "system", "developer":
+			text, err := geminiTextContent(msg.Content)
+			if err != nil {
+				return nil, fmt.Errorf("messages[%d]: %w", i, err)
+			}
+			if out.SystemInstruction == nil {
+				out.SystemInstruction = &geminiContent{}
+			}
+			out.SystemInstruction.Parts = append(out.SystemInstruction.Parts, geminiPart{Text: text})
+			continue
+		case "user":
+			role = "user"
+			contentParts, err := geminiContentParts(msg.Content)
+			if err != nil {
+				return nil, fmt.Errorf("messages[%d]: %w", i, err)
+			}
+			parts = contentParts
+		case "assistant":
+			role = "model"
+			contentParts, err := geminiContentParts(msg.Content)
+			if err != nil {
+				return nil, fmt.Errorf("messages[%d]: %w", i, err)
+			}
+			parts = contentParts
+			for _, call := range msg.ToolCalls {
+				toolNames[call.ID] = call.Function.Name
+				args := json.RawMessage(call.Function.Arguments)
+				if strings.TrimSpace(call.Function.Arguments) == "" {
+					args = nil
+				} else if !json.Valid(args) {
+					return nil, fmt.Errorf("messages[%d]: tool call '%s' arguments are not valid JSON", i, call.Function.Name)
+				}
+				parts = append(parts, geminiPart{FunctionCall: &geminiFunctionCall{Name: call.Function.Name, Args: args}})
+			}
+		case "tool":
+			role = "user"
+			name, ok := toolNames[msg.ToolCallID]
+			if !ok {
+				return nil, fmt.Errorf("messages[%d]: tool_call_id '%s' does not match an earlier tool call", i, msg.ToolCallID)
+			}
+			text, err := geminiTextContent(msg.Content)
+			if err != nil {
+				return nil, fmt.Errorf("messages[%d]: %w", i, err)
+			}
+			parts = []geminiPart{{FunctionResponse: &geminiFunctionResponse{Name: name, Response: geminiToolResult(text)}}}
+		default:
+			return nil, fmt.Errorf("messages[%d]: unsupported role '%s'", i, msg.Role)
+		}
+		if len(parts) == 0 {
+			continue
+		}
+		// Gemini expects turns to alternate, so consecutive messages of one role are merged
+		if last := len(out.Contents) - 1; last >= 0 && out.Contents[last].Role == role {
+			out.Contents[last].Parts = append(out.Contents[last].Parts, parts...)
+			continue
+		}
+		out.Contents = append(out.Contents, geminiContent{Role: role, Parts: parts})
+	}
+
+	if len(req.Tools) > 0 {
+		tool := geminiTool{}
+		for _, t := range req.Tools {
+			tool.FunctionDeclarations = append(tool.FunctionDeclarations, geminiFunctionDeclaration{
+				Name:        t.Function.Name,
+				Description: t.Function.Description,
+				Parameters:  t.Function.Parameters,
+			})
+		}
+		out.Tools = []geminiTool{tool}
+	}
+	toolConfig, err := geminiToolChoice(req.ToolChoice)
+	if err != nil {
+		return nil, err
+	}
+	out.ToolConfig = toolConfig
+
+	config := geminiGenerationConfig{
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		MaxOutputTokens:  req.MaxTokens,
+		CandidateCount:   req.N,
+		PresencePenalty:  req.PresencePenalty,
+		FrequencyPenalty: req.FrequencyPenalty,
+		Seed:             req.Seed,
+	}
+	if req.MaxCompletionTokens != nil {
+		config.MaxOutputTokens = req.MaxCompletionTokens
+	}
+	if len(req.Stop) > 0 && string(req.Stop) != "null" {
+		var stop string
+		if err := json.Unmarshal(req.Stop, &stop); err == nil {
+			config.StopSequences = []string{stop}
+		} else if err := json.Unmarshal(req.Stop, &config.StopSequences); err != nil {
+			return nil, fmt.Errorf("stop must be a string or an array of strings")
+		}
+	}
+	if req.ResponseFormat != nil && (req.ResponseFormat.Type == "json_object" || req.ResponseFormat.Type == "json_schema") {
+		config.ResponseMimeType = "application/json"
+	}
+	out.GenerationConfig = config
+	return out, nil
+}
+
+// geminiContentParts converts OpenAI message content, a string or an array of
+// content blocks, into Gemini parts. Images must be base64 data: URLs.
+func geminiContentParts(content json.RawMessage) ([]geminiPart, error) {
+	if len(content) == 0 || string(content) == "null" {
+		return nil, nil
+	}
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		if text == "" {
+			return nil, nil
+		}
+		return []geminiPart{{Text: text}}, nil
+	}
+
+	var blocks []struct {
+		Type     string `json:"type"`
+		Text     string `json:"text"`
+		ImageURL struct {
+			URL string `json:"url"`
+		} `json:"image_url"`
+	}
+	if err := json.Unmarshal(content, &blocks); err != nil {
+		return nil, fmt.Errorf("content must be a string or an array of content blocks")
+	}
+	var parts []geminiPart
+	for _, block := range blocks {
+		switch block.Type {
+		case "text":
+			parts = append(parts, geminiPart{Text: block.Text})
+		case "image_url":
+			mimeType, data, ok := parseDataURL(block.ImageURL.URL)
+			if !ok {
+				return nil, fmt.Errorf("image_url must be a base64 data: URL for gemini providers")
+			}
+			parts = append(parts, geminiPart{InlineData: &geminiInlineData{MimeType: mimeType, Data: data}})
+		default:
+			return nil, fmt.Errorf("content block type '%s' is %w", block.Type, errGeminiUnsupported)
+		}
+	}
+	return parts, nil
+}
+
+// geminiTextContent returns the text of a message that may only carry text,
+// joining the blocks of array content
+func geminiTextContent(content json.RawMessage) (string, error) {
+	parts, err := geminiContentParts(content)
+	if err != nil {
+		return "", err
+	}
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part.InlineData != nil {
+			return "", fmt.Errorf("only text content is supported in system and tool messages")
+		}
+		texts = append(texts, part.Text)
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// geminiToolResult wraps a tool message for functionResponse, which takes an
+// object: JSON object results are passed as they are, anything else as {"content": text}
+func geminiToolResult(text string) json.RawMessage {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(text), &object); err == nil && object != nil {
+		return json.RawMessage(text)
+	}
+	wrapped, _ := json.Marshal(map[string]string{"content": text})
+	return wrapped
+}
+
+// geminiToolChoice maps tool_choice to a function calling mode: "auto" to
+// AUTO, "none" to NONE, "required" to ANY, and a named function to ANY
+// restricted to that function
+func geminiToolChoice(raw json.RawMessage) (*geminiToolConfig, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var mode string
+	if err := json.Unmarshal(raw, &mode); err == nil {
+		switch mode {
+		case "auto":
+			return &geminiToolConfig{FunctionCallingConfig: geminiFunctionCallingConfig{Mode: "AUTO"}}, nil
+		case "none":
+			return &geminiToolConfig{FunctionCallingConfig: geminiFunctionCallingConfig{Mode: "NONE"}}, nil
+		case "required":
+			return &geminiToolConfig{FunctionCallingConfig: geminiFunctionCallingConfig{Mode: "ANY"}}, nil
+		}
+		return nil, fmt.Errorf("tool_choice '%s' is %w", mode, errGeminiUnsupported)
+	}
+	var named struct {
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	}
+	if err := json.Unmarshal(raw, &named); err != nil || named.Function.Name == "" {
+		return nil, fmt.Errorf("tool_choice must be a string or name a function")
+	}
+	return &geminiToolConfig{FunctionCallingConfig: geminiFunctionCallingConfig{
+		Mode:                 "ANY",
+		AllowedFunctionNames: []string{named.Function.Name},
+	}}, nil
+}
+
+// fromGeminiResponse builds an OpenAI chat completion from a generateContent
+// answer. A prompt blocked before any candidate was generated yields one
+// empty choice finished with "content_filter".
+func fromGeminiResponse(body []byte, model string) ([]byte, error) {
+	var resp geminiResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	if resp.ModelVersion != "" {
+		model = resp.ModelVersion
+	}
+	id := resp.ResponseID
+	if id == "" {
+		id = newResponseID()
+	}
+
+	choices := make([]map[string]interface{}, 0, len(resp.Candidates))
+	for _, candidate := range resp.Candidates {
+		var texts []string
+		var toolCalls []map[string]interface{}
+		for _, part := range candidate.Content.Parts {
+			if part.FunctionCall != nil {
+				args := "{}"
+				var compact bytes.Buffer
+				if json.Compact(&compact, part.FunctionCall.Args) == nil {
+					args = compact.String()
+				}
+				toolCalls = append(toolCalls, map[string]interface{}{
+					"id":   "call_" + newResponseID(),
+					"type": "function",
+					"function": map[string]interface{}{
+						"name":      part.FunctionCall.Name,
+						"arguments": args,
+					},
+				})
+				continue
+			}
+			if part.Text != "" {
+				texts = append(texts, part.Text)
+			}
+		}
+
+		message := map[string]interface{}{"role": "assistant", "content": nil}
+		if len(texts) > 0 {
+			message["content"] = strings.Join(texts, "")
+		}
+		finishReason := geminiFinishReason(candidate.FinishReason)
+		if len(toolCalls) > 0 {
+			message["tool_calls"] = toolCalls
+			finishReason = "tool_calls"
+		}
+		choices = append(choices, map[string]interface{}{
+			"index":         candidate.Index,
+			"message":       message,
+			"finish_reason": finishReason,
+		})
+	}
+	if len(choices) == 0 && resp.PromptFeedback != nil && resp.PromptFeedback.BlockReason != "" {
+		choices = append(choices, map[string]interface{}{
+			"index":         0,
+			"message":       map[string]interface{}{"role": "assistant", "content": nil},
+			"finish_reason": "content_filter",
+		})
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"id":      "chatcmpl-" + id,
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   model,
+		"choices": choices,
+		"usage": types.Usage{
+			PromptTokens:     resp.UsageMetadata.PromptTokenCount,
+			CompletionTokens: resp.UsageMetadata.CandidatesTokenCount,
+			TotalTokens:      resp.UsageMetadata.TotalTokenCount,
+		},
+	})
+}
+
+// geminiFinishReason maps a Gemini finishReason to its OpenAI equivalent
+func geminiFinishReason(reason string) string {
+	switch reason {
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY":
+		return "content_filter"
+	}
+	return "stop"
+}
+
+// parseDataURL splits a base64 data: URL into its media type and data
+func parseDataURL(url string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(url, "data:")
+	if !ok {
+		return "", "", false
+	}
+	meta, data, ok := strings.Cut(rest, ",")
+	if !ok {
+		return "", "", false
+	}
+	mimeType, ok := strings.CutSuffix(meta, ";base64")
+	if !ok || mimeType == "" {
+		return "", "", false
+	}
+	return mimeType, data, true
+}
+
+// newResponseID generates an identifier for responses and tool calls the
+// gateway builds itself, e.g. the ones Gemini doesn't assign one to
+func newResponseID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// geminiModelList is the answer to GET {base_url}/models
+type geminiModelList struct {
+	Models []struct {
+		Name string `json:"name"` // "models/gemini-2.0-flash"
+	} `json:"models"`
+}
+
+// geminiModels converts Gemini's model list into OpenAI model entries
+func geminiModels(body []byte) ([]types.Model, error) {
+	var list geminiModelList
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, err
+	}
+	models := make([]types.Model, 0, len(list.Models))
+	for _, model := range list.Models {
+		models = append(models, types.Model{
+			ID:      strings.TrimPrefix(model.Name, "models/"),
+			Object:  "model",
+			OwnedBy: "google",
+		})
+	}
+	return models, nil
+}
@@ -0,0 +1,182 @@
+package providers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ai-gateway/config"
+	"ai-gateway/logger"
+	"ai-gateway/types"
+)
+
+func TestToGeminiRequest(t *testing.T) {
+	body := `{
+		"model": "gemini-2.0-flash",
+		"messages": [
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": [{"type": "text", "text": "Weather?"}, {"type": "image_url", "image_url": {"url": "data:image/png;base64,iVBORw0KGgo="}}]},
+			{"role": "assistant", "content": null, "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "sunny"},
+			{"role": "user", "content": "Thanks"}
+		],
+		"tools": [{"type": "function", "function": {"name": "get_weather", "parameters": {"type": "object"}}}],
+		"tool_choice": {"type": "function", "function": {"name": "get_weather"}},
+		"temperature": 0.2,
+		"max_tokens": 100,
+		"stop": "END",
+		"response_format": {"type": "json_object"}
+	}`
+
+	req, err := toGeminiRequest([]byte(body))
+	if err != nil {
+		t.Fatalf("toGeminiRequest() error = %v", err)
+	}
+
+	if req.SystemInstruction == nil || req.SystemInstruction.Parts[0].Text != "Be brief." {
+		t.Errorf("Expected the system message as systemInstruction, got %+v", req.SystemInstruction)
+	}
+	// The tool result and the following user message share one user turn
+	roles := make([]string, 0, len(req.Contents))
+	for _, content := range req.Contents {
+		roles = append(roles, content.Role)
+	}
+	if len(roles) != 3 || roles[0] != "user" || roles[1] != "model" || roles[2] != "user" {
+		t.Fatalf("Expected alternating user/model/user turns, got %v", roles)
+	}
+	if image := req.Contents[0].Parts[1].InlineData; image == nil || image.MimeType != "image/png" || image.Data != "iVBORw0KGgo=" {
+		t.Errorf("Expected the data URL as inline data, got %+v", image)
+	}
+	if call := req.Contents[1].Parts[0].FunctionCall; call == nil || call.Name != "get_weather" || string(call.Args) != `{"city":"Paris"}` {
+		t.Errorf("Expected the tool call as a functionCall, got %+v", call)
+	}
+	result := req.Contents[2].Parts[0].FunctionResponse
+	if result == nil || result.Name != "get_weather" || string(result.Response) != `{"content":"sunny"}` {
+		t.Errorf("Expected the tool result as a functionResponse, got %+v", result)
+	}
+	if req.Contents[2].Parts[1].Text != "Thanks" {
+		t.Errorf("Expected the last user message after the tool result, got %+v", req.Contents[2].Parts)
+	}
+
+	if len(req.Tools) != 1 || req.Tools[0].FunctionDeclarations[0].Name != "get_weather" {
+		t.Errorf("Expected one function declaration, got %+v", req.Tools)
+	}
+	if req.ToolConfig == nil || req.ToolConfig.FunctionCallingConfig.Mode != "ANY" || req.ToolConfig.FunctionCallingConfig.AllowedFunctionNames[0] != "get_weather" {
+		t.Errorf("Expected the named tool_choice as mode ANY, got %+v", req.ToolConfig)
+	}
+	config := req.GenerationConfig
+	if *config.Temperature != 0.2 || *config.MaxOutputTokens != 100 || config.StopSequences[0] != "END" || config.ResponseMimeType != "application/json" {
+		t.Errorf("Unexpected generation config %+v", config)
+	}
+}
+
+func TestToGeminiRequest_UnknownToolCallID(t *testing.T) {
+	body := `{"messages": [{"role": "tool", "tool_call_id": "call_9", "content": "sunny"}]}`
+	if _, err := toGeminiRequest([]byte(body)); err == nil {
+		t.Error("Expected an error for a tool result without a matching tool call")
+	}
+}
+
+func TestClient_Call_Gemini(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/models/gemini-2.0-flash:generateContent" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("unexpected path " + r.URL.Path))
+			return
+		}
+		if r.Header.Get("x-goog-api-key") != "gemini-key" || r.Header.Get("Authorization") != "" || r.URL.Query().Get("key") != "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var req geminiRequest
+		if err := json.Unmarshal(body, &req); err != nil || len(req.Contents) != 1 || req.Contents[0].Parts[0].Text != "Hi" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("unexpected body " + string(body)))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"candidates": [{"index": 0, "content": {"role": "model", "parts": [{"text": "Hello"}, {"text": " there"}]}, "finishReason": "MAX_TOKENS"}],
+			"usageMetadata": {"promptTokenCount": 3, "candidatesTokenCount": 2, "totalTokenCount": 5},
+			"modelVersion": "gemini-2.0-flash-001",
+			"responseId": "abc"
+		}`))
+	}))
+	defer server.Close()
+
+	cfg := config.Provider{Name: "gemini", Type: config.ProviderTypeGemini, APIKey: "gemini-key", BaseURL: server.URL}
+	step := config.RouteStep{Provider: "gemini", Model: "gemini-2.0-flash"}
+	client := NewClientWithRouteStep(cfg, step, logger.NewLogger())
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"route","messages":[{"role":"user","content":"Hi"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+
+	resp, err := client.Call(request)
+	if err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+	if resp.ID != "chatcmpl-abc" || resp.Object != "chat.completion" || resp.Model != "gemini-2.0-flash-001" {
+		t.Errorf("Unexpected response envelope: id=%s object=%s model=%s", resp.ID, resp.Object, resp.Model)
+	}
+	if len(resp.Choices) != 1 || resp.Choices[0].Message.ContentAsString() != "Hello there" || resp.Choices[0].FinishReason != "length" {
+		t.Errorf("Unexpected choices %+v", resp.Choices)
+	}
+	if resp.Usage.PromptTokens != 3 || resp.Usage.CompletionTokens != 2 || resp.Usage.TotalTokens != 5 {
+		t.Errorf("Unexpected usage %+v", resp.Usage)
+	}
+}
+
+func TestFromGeminiResponse_FunctionCall(t *testing.T) {
+	body := `{"candidates": [{"content": {"role": "model", "parts": [{"functionCall": {"name": "get_weather", "args": {"city": "Paris"}}}]}, "finishReason": "STOP"}]}`
+	translated, err := fromGeminiResponse([]byte(body), "gemini-2.0-flash")
+	if err != nil {
+		t.Fatalf("fromGeminiResponse() error = %v", err)
+	}
+
+	var resp struct {
+		Model   string `json:"model"`
+		Choices []struct {
+			Message struct {
+				Content   *string `json:"content"`
+				ToolCalls []struct {
+					ID       string `json:"id"`
+					Function struct {
+						Name      string `json:"name"`
+						Arguments string `json:"arguments"`
+					} `json:"function"`
+				} `json:"tool_calls"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(translated, &resp); err != nil {
+		t.Fatalf("Failed to parse translated response: %v", err)
+	}
+	if resp.Model != "gemini-2.0-flash" {
+		t.Errorf("Expected the step model without a modelVersion, got %s", resp.Model)
+	}
+	choice := resp.Choices[0]
+	if choice.FinishReason != "tool_calls" || choice.Message.Content != nil {
+		t.Errorf("Expected a tool_calls finish without content, got %+v", choice)
+	}
+	if len(choice.Message.ToolCalls) != 1 || choice.Message.ToolCalls[0].ID == "" ||
+		choice.Message.ToolCalls[0].Function.Name != "get_weather" || choice.Message.ToolCalls[0].Function.Arguments != `{"city":"Paris"}` {
+		t.Errorf("Unexpected tool calls %+v", choice.Message.ToolCalls)
+	}
+}
+
+func TestClient_CallStream_GeminiUnsupported(t *testing.T) {
+	cfg := config.Provider{Name: "gemini", Type: config.ProviderTypeGemini, APIKey: "gemini-key", BaseURL: "http://127.0.0.1:0"}
+	client := NewClientWithRouteStep(cfg, config.RouteStep{Provider: "gemini", Model: "gemini-2.0-flash"}, logger.NewLogger())
+
+	if _, err := client.CallStream(t.Context(), types.ChatRequest{Raw: json.RawMessage(`{}`)}); !errors.Is(err, errGeminiUnsupported) {
+		t.Errorf("Expected streaming to be unsupported, got %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package providers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"ai-gateway/config"
+)
+
+// healthTracker records probe results per provider name. Providers that have
+// never been probed are considered healthy.
+type healthTracker struct {
+	mu        sync.RWMutex
+	threshold int
+	failures  map[string]int
+}
+
+func newHealthTracker() *healthTracker {
+	return &healthTracker{
+		threshold: 1,
+		failures:  make(map[string]int),
+	}
+}
+
+// record stores a probe result and reports whether the provider changed state
+func (h *healthTracker) record(provider string, err error) (healthy, changed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	wasHealthy := h.failures[provider] < h.threshold
+	if err == nil {
+		h.failures[provider] = 0
+	} else {
+		h.failures[provider]++
+	}
+	healthy = h.failures[provider] < h.threshold
+	return healthy, healthy != wasHealthy
+}
+
+// isHealthy reports whether the provider is currently considered healthy
+func (h *healthTracker) isHealthy(provider string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.failures[provider] < h.threshold
+}
+
+// StartHealthChecks probes every provider each interval until ctx is cancelled.
+// A provider is marked unhealthy after threshold consecutive failed probes and
+// its route steps are skipped until a probe succeeds again.
+func (m *Manager) StartHealthChecks(ctx context.Context, interval time.Duration, threshold int) {
+	if interval <= 0 {
+		return
+	}
+	if threshold < 1 {
+		threshold = 1
+	}
+
+	m.health.mu.Lock()
+	m.health.threshold = threshold
+	m.health.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		m.checkProviders(ctx, interval)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.checkProviders(ctx, interval)
+			}
+		}
+	}()
+}
+
+// checkProviders probes all enabled providers concurrently
+func (m *Manager) checkProviders(ctx context.Context, timeout time.Duration) {
+	providers, _ := m.snapshot()
+	var wg sync.WaitGroup
+	for _, providerCfg := range providers {
+		if providerCfg.Disabled {
+			continue
+		}
+		wg.Add(1)
+		go func(providerCfg config.Provider) {
+			defer wg.Done()
+
+			probeCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			client := NewClient(providerCfg, m.logger)
+			client.client.Transport = m.transport.get(providerCfg)
+			err := client.CheckHealth(probeCtx)
+			healthy, changed := m.health.record(providerCfg.Name, err)
+			if !changed {
+				return
+			}
+
+			fields := map[string]interface{}{"provider": providerCfg.Name}
+			if healthy {
+				m.logger.Info("Provider became healthy", fields)
+			} else {
+				m.logger.Error("Provider marked unhealthy", err, fields)
+			}
+		}(providerCfg)
+	}
+	wg.Wait()
+}
+
+// Provider health states reported by ProviderHealth
+const (
+	HealthHealthy   = "healthy"
+	HealthUnhealthy = "unhealthy"
+	HealthDisabled  = "disabled"
+)
+
+// ProviderHealth returns each provider's state from the background health
+// checks. Without health checks every enabled provider is healthy.
+func (m *Manager) ProviderHealth() map[string]string {
+	providers, _ := m.snapshot()
+	states := make(map[string]string, len(providers))
+	for name, provider := range providers {
+		switch {
+		case provider.Disabled:
+			states[name] = HealthDisabled
+		case m.health.isHealthy(name):
+			states[name] = HealthHealthy
+		default:
+			states[name] = HealthUnhealthy
+		}
+	}
+	return states
+}
+
+// UnavailableRoutes returns the enabled routes whose enabled providers are all
+// unhealthy. Routes using only disabled providers are left out: they are
+// switched off on purpose and already warned about at startup.
+func (m *Manager) UnavailableRoutes() []string {
+	providers, routes := m.snapshot()
+	var unavailable []string
+	for _, route := range routes {
+		if route.Disabled {
+			continue
+		}
+		enabled, healthy := false, false
+		for _, step := range route.Steps {
+			provider, ok := providers[step.Provider]
+			if !ok || provider.Disabled {
+				continue
+			}
+			enabled = true
+			if m.health.isHealthy(step.Provider) {
+				healthy = true
+				break
+			}
+		}
+		if enabled && !healthy {
+			unavailable = append(unavailable, route.Name)
+		}
+	}
+	return unavailable
+}
@@ -0,0 +1,92 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"ai-gateway/types"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// errHedgeLost is returned by a hedged attempt that succeeded after the other
+// attempt had already been used. The provider did nothing wrong.
+var errHedgeLost = errors.New("hedged request lost the race")
+
+// hedgeResult is the outcome of one hedged step
+type hedgeResult struct {
+	stepIndex int
+	stepErr   *types.RouteStepError
+	err       error
+}
+
+// hedgeSteps starts the first step and, if it has not finished within delay,
+// races the second against it. The first success wins and the other attempt is
+// cancelled; both run to completion before returning so their spans are recorded.
+// It reports whether a step succeeded, and otherwise the errors of both steps.
+func (m *Manager) hedgeSteps(ctx context.Context, rc *routeCall, first, second int, delay time.Duration) ([]types.RouteStepError, bool, error) {
+	hedgeCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	results := make(chan hedgeResult, 2)
+	launch := func(stepIndex int) {
+		go func() {
+			stepErr, err := m.tryStep(hedgeCtx, rc, stepIndex)
+			results <- hedgeResult{stepIndex: stepIndex, stepErr: stepErr, err: err}
+		}()
+	}
+
+	launch(first)
+	launched, pending := 1, 1
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var (
+		stepErrors []types.RouteStepError
+		succeeded  bool
+		fatal      error
+	)
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			if launched == 1 && !succeeded && fatal == nil {
+				rc.span.AddEvent("route.hedged", trace.WithAttributes(
+					attribute.Int("step.index", second),
+					attribute.Int64("hedge.delay_ms", delay.Milliseconds()),
+				))
+				launch(second)
+				launched++
+				pending++
+			}
+		case result := <-results:
+			pending--
+			switch {
+			case succeeded || fatal != nil:
+				// The race is already decided; this is the cancelled attempt
+			case result.err != nil:
+				fatal = result.err
+				cancel(nil)
+			case result.stepErr == nil:
+				succeeded = true
+				rc.span.SetAttributes(attribute.Int("route.hedge.winner", result.stepIndex))
+				cancel(errHedgeLost)
+			default:
+				stepErrors = append(stepErrors, *result.stepErr)
+				// A fast failure starts the second step without waiting for the
+				// delay, unless fallback_on says the error should not fall back
+				if launched == 1 && !result.stepErr.NoFallback {
+					launch(second)
+					launched++
+					pending++
+				}
+			}
+		}
+	}
+
+	if fatal != nil {
+		return nil, false, fatal
+	}
+	return stepErrors, succeeded, nil
+}
@@ -0,0 +1,175 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ai-gateway/config"
+	"ai-gateway/logger"
+	"ai-gateway/types"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newHedgeServer answers after delay with the given id, reporting cancelled requests
+func newHedgeServer(t *testing.T, id string, status int, delay time.Duration, calls, cancelled *atomic.Int32) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		io.ReadAll(r.Body) // lets the server notice the client cancelling
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			cancelled.Add(1)
+			return
+		}
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"` + id + `","object":"chat.completion","choices":[]}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newHedgeManager(slowURL, fastURL string) *Manager {
+	providers := []config.Provider{
+		{Name: "first", APIKey: "key1", BaseURL: slowURL},
+		{Name: "second", APIKey: "key2", BaseURL: fastURL},
+	}
+	routes := []config.Route{
+		{
+			Name:       "hedged",
+			Strategy:   StrategyHedge,
+			HedgeDelay: "50ms",
+			Steps: []config.RouteStep{
+				{Provider: "first", Model: "gpt-4"},
+				{Provider: "second", Model: "gpt-4"},
+			},
+		},
+	}
+	return NewManager(providers, routes, logger.NewLogger())
+}
+
+func hedgeRequest(t *testing.T) types.ChatRequest {
+	t.Helper()
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"hedged","messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+	return request
+}
+
+func TestManager_Execute_HedgeTakesFasterStep(t *testing.T) {
+	var firstCalls, firstCancelled, secondCalls, secondCancelled atomic.Int32
+	first := newHedgeServer(t, "first", http.StatusOK, time.Second, &firstCalls, &firstCancelled)
+	second := newHedgeServer(t, "second", http.StatusOK, 0, &secondCalls, &secondCancelled)
+	manager := newHedgeManager(first.URL, second.URL)
+
+	start := time.Now()
+	resp, err := manager.Execute(hedgeRequest(t))
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the hedged step to answer quickly, took %v", elapsed)
+	}
+	if !json.Valid(resp.Raw) || string(resp.Raw) != `{"id":"second","object":"chat.completion","choices":[]}` {
+		t.Errorf("Expected the second step's response, got %s", resp.Raw)
+	}
+
+	// The losing request is cancelled rather than left running
+	deadline := time.Now().Add(time.Second)
+	for firstCancelled.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if firstCancelled.Load() != 1 {
+		t.Error("Expected the slower step's request to be cancelled")
+	}
+}
+
+func TestManager_TryStep_HedgeLostKeepsCircuit(t *testing.T) {
+	manager := newHedgeManager("http://localhost", "http://localhost")
+	manager.SetCircuitBreaker(3, 0, time.Minute)
+	failure := &StatusError{StatusCode: http.StatusInternalServerError}
+	manager.breakers.record("first", failure)
+	manager.breakers.record("first", failure)
+
+	// The slow step answers after the other one already won the race
+	providers, routes := manager.snapshot()
+	_, span := manager.tracer.Start(context.Background(), "route")
+	rc := &routeCall{
+		route:     &routes[0],
+		providers: providers,
+		model:     "hedged",
+		span:      span,
+		budget:    &attemptBudget{},
+		attempt: func(ctx context.Context, provider *Client, stepSpan trace.Span) (map[string]interface{}, error) {
+			return nil, errHedgeLost
+		},
+	}
+	stepErr, err := manager.tryStep(context.Background(), rc, 0)
+	if err != nil || stepErr == nil {
+		t.Fatalf("Expected a hedge lost step error, got %+v, %v", stepErr, err)
+	}
+	if c := manager.breakers.circuits["first"]; c.failures != 2 {
+		t.Errorf("Expected the losing provider to keep its 2 failures, got %d", c.failures)
+	}
+}
+
+func TestManager_Execute_HedgeSkipsSecondWhenFirstIsFast(t *testing.T) {
+	var firstCalls, firstCancelled, secondCalls, secondCancelled atomic.Int32
+	first := newHedgeServer(t, "first", http.StatusOK, 0, &firstCalls, &firstCancelled)
+	second := newHedgeServer(t, "second", http.StatusOK, 0, &secondCalls, &secondCancelled)
+	manager := newHedgeManager(first.URL, second.URL)
+
+	resp, err := manager.Execute(hedgeRequest(t))
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if string(resp.Raw) != `{"id":"first","object":"chat.completion","choices":[]}` {
+		t.Errorf("Expected the first step's response, got %s", resp.Raw)
+	}
+	if secondCalls.Load() != 0 {
+		t.Errorf("Expected the second step not to be called within the hedge delay, got %d calls", secondCalls.Load())
+	}
+}
+
+func TestManager_Execute_HedgeFallsBackOnFastFailure(t *testing.T) {
+	var firstCalls, firstCancelled, secondCalls, secondCancelled atomic.Int32
+	first := newHedgeServer(t, "first", http.StatusInternalServerError, 0, &firstCalls, &firstCancelled)
+	second := newHedgeServer(t, "second", http.StatusOK, 0, &secondCalls, &secondCancelled)
+	manager := newHedgeManager(first.URL, second.URL)
+
+	resp, err := manager.Execute(hedgeRequest(t))
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if string(resp.Raw) != `{"id":"second","object":"chat.completion","choices":[]}` {
+		t.Errorf("Expected the second step's response, got %s", resp.Raw)
+	}
+}
+
+func TestManager_Execute_HedgeAllFail(t *testing.T) {
+	var firstCalls, firstCancelled, secondCalls, secondCancelled atomic.Int32
+	first := newHedgeServer(t, "first", http.StatusServiceUnavailable, 100*time.Millisecond, &firstCalls, &firstCancelled)
+	second := newHedgeServer(t, "second", http.StatusServiceUnavailable, 0, &secondCalls, &secondCancelled)
+	manager := newHedgeManager(first.URL, second.URL)
+
+	_, err := manager.Execute(hedgeRequest(t))
+	routeErr, ok := err.(types.RouteError)
+	if !ok {
+		t.Fatalf("Expected RouteError, got %v", err)
+	}
+	if len(routeErr.Errors) != 2 {
+		t.Errorf("Expected errors from both hedged steps, got %+v", routeErr.Errors)
+	}
+}
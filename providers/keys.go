@@ -0,0 +1,43 @@
+package providers
+
+import (
+	"sync"
+)
+
+// keyRotator hands out API key indexes round-robin. One rotator is shared by
+// all clients of a provider so consecutive requests and retries spread across keys.
+type keyRotator struct {
+	mu   sync.Mutex
+	next int
+}
+
+// pick returns the index of the key to use out of n keys
+func (r *keyRotator) pick(n int) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := r.next % n
+	r.next = i + 1
+	return i
+}
+
+// keyRotators holds one rotator per provider name
+type keyRotators struct {
+	mu        sync.Mutex
+	providers map[string]*keyRotator
+}
+
+func newKeyRotators() *keyRotators {
+	return &keyRotators{providers: make(map[string]*keyRotator)}
+}
+
+// get returns the rotator for the provider, creating it on first use
+func (k *keyRotators) get(provider string) *keyRotator {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	r, ok := k.providers[provider]
+	if !ok {
+		r = &keyRotator{}
+		k.providers[provider] = r
+	}
+	return r
+}
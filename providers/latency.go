@@ -0,0 +1,58 @@
+package providers
+
+import (
+	"sync"
+	"time"
+)
+
+// latencyAlpha weighs the newest sample in the moving average; 0.3 follows a
+// change in a provider's speed within a handful of requests
+const latencyAlpha = 0.3
+
+// latencyTracker keeps an exponentially weighted moving average of each
+// provider's successful call duration, used by the latency strategy
+type latencyTracker struct {
+	mu   sync.Mutex
+	ewma map[string]time.Duration // provider name -> average, absent until the first success
+}
+
+func newLatencyTracker() *latencyTracker {
+	return &latencyTracker{ewma: make(map[string]time.Duration)}
+}
+
+// record folds a successful call's duration into the provider's average
+func (l *latencyTracker) record(provider string, duration time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	current, ok := l.ewma[provider]
+	if !ok {
+		l.ewma[provider] = duration
+		return
+	}
+	l.ewma[provider] = time.Duration(latencyAlpha*float64(duration) + (1-latencyAlpha)*float64(current))
+}
+
+// get returns the provider's average and whether it has one yet
+func (l *latencyTracker) get(provider string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	latency, ok := l.ewma[provider]
+	return latency, ok
+}
+
+// snapshot copies the averages for reporting
+func (l *latencyTracker) snapshot() map[string]time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make(map[string]time.Duration, len(l.ewma))
+	for provider, latency := range l.ewma {
+		out[provider] = latency
+	}
+	return out
+}
+
+// ProviderLatencies returns the moving average latency of every provider that
+// has completed a call, as used to order steps on latency routes
+func (m *Manager) ProviderLatencies() map[string]time.Duration {
+	return m.latency.snapshot()
+}
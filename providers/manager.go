@@ -3,11 +3,19 @@ package providers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"ai-gateway/config"
 	"ai-gateway/logger"
+	"ai-gateway/metrics"
 	"ai-gateway/telemetry"
 	"ai-gateway/types"
 
@@ -18,35 +26,166 @@ import (
 
 // Manager handles route-based execution of providers
 type Manager struct {
+	mu        sync.RWMutex               // guards providers and routes, which Reload swaps
 	providers map[string]config.Provider // provider name -> provider config
 	routes    []config.Route
 	logger    *logger.Logger
 	tracer    trace.Tracer
+	health    *healthTracker
+	keys      *keyRotators
+	transport *transportPool // shared by all clients so connections are pooled
+	breakers  *circuitBreakers
+	limits    *concurrencyLimits // per-provider max_concurrency
+	throttle  *rateLimits        // per-provider rate_limit_rpm and rate_limit_tpm
+	latency   *latencyTracker    // per-provider moving average for the latency strategy
+	models    *modelCatalog      // upstream model lists for /v1/models
+	randIntN  func(n int) int
+	cache     *responseCache    // nil when caching is disabled
+	replays   *idempotencyStore // responses by Idempotency-Key, nil when disabled
+	prices    config.PriceTable
+	timeout   time.Duration // global request_timeout, 0 for none
+	// lenientChoices accepts chat responses without choices, when require_choices is off
+	lenientChoices bool
 }
 
 // NewManager creates a new provider manager
 func NewManager(providers []config.Provider, routes []config.Route, logger *logger.Logger) *Manager {
-	// Build provider map for quick lookup
-	providerMap := make(map[string]config.Provider)
-	for _, provider := range providers {
-		providerMap[provider.Name] = provider
-	}
-
 	return &Manager{
-		providers: providerMap,
+		providers: providerMap(providers),
 		routes:    routes,
 		logger:    logger,
 		tracer:    telemetry.Tracer("ai-gateway.providers"),
+		health:    newHealthTracker(),
+		keys:      newKeyRotators(),
+		transport: newTransportPool(),
+		breakers:  newCircuitBreakers(),
+		limits:    newConcurrencyLimits(),
+		throttle:  newRateLimits(),
+		latency:   newLatencyTracker(),
+		models:    newModelCatalog(),
+		randIntN:  rand.IntN,
 	}
 }
 
-// GetRoute finds a route by exact model name match
+// SetRequestTimeout limits how long a request may spend across all route steps.
+// Routes can override it with their own request_timeout; 0 means no limit.
+func (m *Manager) SetRequestTimeout(timeout time.Duration) {
+	m.timeout = timeout
+}
+
+// SetTransportTimeouts limits connecting to providers and waiting for their
+// response headers. It replaces the pooled connections, so call it before
+// serving requests; 0 keeps net/http's default.
+func (m *Manager) SetTransportTimeouts(dial, responseHeader time.Duration) {
+	m.transport = newTransportPool()
+	m.transport.timeouts = transportTimeouts{dial: dial, responseHeader: responseHeader}
+}
+
+// SetRequireChoices decides whether a 200 chat response without a choices
+// array fails the step, so it can be retried or fall back. On by default.
+func (m *Manager) SetRequireChoices(require bool) {
+	m.lenientChoices = !require
+}
+
+// providerMap builds the provider name lookup used by route steps
+func providerMap(providers []config.Provider) map[string]config.Provider {
+	byName := make(map[string]config.Provider)
+	for _, provider := range providers {
+		byName[provider.Name] = provider
+	}
+	return byName
+}
+
+// Reload atomically replaces the providers and routes. Requests already in
+// progress finish with the configuration they started with.
+func (m *Manager) Reload(providers []config.Provider, routes []config.Route) {
+	byName := providerMap(providers)
+
+	m.mu.Lock()
+	m.providers = byName
+	m.routes = routes
+	m.mu.Unlock()
+
+	m.logger.Info("Configuration reloaded", map[string]interface{}{
+		"providers": len(providers),
+		"routes":    len(routes),
+	})
+}
+
+// snapshot returns the current providers and routes. Both are replaced, never
+// modified, on reload, so callers may use them without holding the lock.
+func (m *Manager) snapshot() (map[string]config.Provider, []config.Route) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.providers, m.routes
+}
+
+// Routes returns the currently configured routes
+func (m *Manager) Routes() []config.Route {
+	_, routes := m.snapshot()
+	return routes
+}
+
+// Providers returns the currently configured providers sorted by name
+func (m *Manager) Providers() []config.Provider {
+	providers, _ := m.snapshot()
+	list := make([]config.Provider, 0, len(providers))
+	for _, provider := range providers {
+		list = append(list, provider)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// newClient creates a provider client for a route step that shares the
+// manager's per-provider state such as API key rotation and pooled connections
+func (m *Manager) newClient(providerCfg config.Provider, step config.RouteStep) *Client {
+	client := NewClientWithRouteStep(providerCfg, step, m.logger)
+	client.keys = m.keys.get(providerCfg.Name)
+	client.client.Transport = m.transport.get(providerCfg)
+	client.lenientChoices = m.lenientChoices
+	return client
+}
+
+// GetRoute finds the route for a model. Precedence:
+//  1. a route whose name equals the model exactly (case-sensitive)
+//  2. the matching glob pattern (e.g. "gpt-4o-2024-*") with the most literal characters
+//  3. among equally specific patterns, the one listed first in the config
+//  4. the catch-all default route (name "*" or default: true), if configured
 func (m *Manager) GetRoute(model string) (*config.Route, error) {
-	for _, route := range m.routes {
-		if route.Name == model {
+	_, routes := m.snapshot()
+	return findRoute(routes, model)
+}
+
+// findRoute applies the GetRoute precedence to the given routes, ignoring disabled ones
+func findRoute(routes []config.Route, model string) (*config.Route, error) {
+	for _, route := range routes {
+		if route.Name == model && !route.Disabled {
 			return &route, nil
 		}
 	}
+
+	var best *config.Route
+	bestScore := -1
+	for i := range routes {
+		route := routes[i]
+		if route.Disabled || route.IsDefault() || !isPattern(route.Name) || !globMatch(route.Name, model) {
+			continue
+		}
+		if score := patternSpecificity(route.Name); score > bestScore {
+			best, bestScore = &route, score
+		}
+	}
+	if best != nil {
+		return best, nil
+	}
+
+	for _, route := range routes {
+		if route.IsDefault() && !route.Disabled {
+			return &route, nil
+		}
+	}
+
 	return nil, fmt.Errorf("no route found for model '%s'", model)
 }
 
@@ -57,16 +196,322 @@ func (m *Manager) Execute(request types.ChatRequest) (*types.ChatResponse, error
 
 // ExecuteWithTracing runs the request through the route for the model until one succeeds with request tracing
 func (m *Manager) ExecuteWithTracing(ctx context.Context, request types.ChatRequest, requestID string) (*types.ChatResponse, error) {
+	// Replay the response of an earlier request with the same Idempotency-Key
+	var succeeded *types.ChatResponse
+	if m.replays != nil && !request.IsStream() {
+		idempotencyKey := idempotencyCacheKey(request)
+		// The fingerprint tells a retry from another request reusing the key
+		fingerprint, err := requestCacheKey(request)
+		if idempotencyKey != "" && err == nil {
+			span := trace.SpanFromContext(ctx)
+			stored, err := m.replays.begin(idempotencyKey, fingerprint)
+			if err != nil {
+				return nil, err
+			}
+			if stored != nil {
+				span.SetAttributes(attribute.Bool("idempotency.replayed", true))
+				fields := map[string]interface{}{"model": request.Model}
+				if requestID != "" {
+					fields["request_id"] = requestID
+				}
+				m.logger.Info("Replaying response for idempotency key", fields)
+				return stored, nil
+			}
+			span.SetAttributes(attribute.Bool("idempotency.replayed", false))
+			// Release the key however the request ends, storing the response on success
+			defer func() { m.replays.finish(idempotencyKey, fingerprint, succeeded) }()
+		}
+	}
+
+	// Serve identical requests from the cache when enabled
+	var cacheKey string
+	if m.cache != nil && !request.IsStream() {
+		key, err := requestCacheKey(request)
+		if err == nil {
+			cacheKey = key
+			span := trace.SpanFromContext(ctx)
+			if cached, ok := m.cache.get(cacheKey); ok {
+				span.SetAttributes(attribute.Bool("cache.hit", true))
+				fields := map[string]interface{}{"model": request.Model}
+				if requestID != "" {
+					fields["request_id"] = requestID
+				}
+				m.logger.Info("Serving response from cache", fields)
+				return cached, nil
+			}
+			span.SetAttributes(attribute.Bool("cache.hit", false))
+		}
+	}
+
+	var (
+		mu       sync.Mutex // hedge routes run two attempts at once
+		response *types.ChatResponse
+	)
+	err := m.executeRoute(ctx, request.Model, requestID, routeOptions{
+		hedgeable:      true,
+		pinnedProvider: request.Headers.Get(ProviderHeader),
+		tokens:         estimateTokens(request.Raw),
+	}, func(ctx context.Context, provider *Client, stepSpan trace.Span) (map[string]interface{}, error) {
+		setOverrideAttributes(stepSpan, provider)
+		if provider.forceStream {
+			stepSpan.SetAttributes(attribute.Bool("step.stream_aggregated", true))
+		}
+		resp, err := provider.CallWithContext(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		m.recordUsage(ctx, provider.Name(), provider.model, resp.Usage)
+		m.recordChoices(provider.Name(), provider.model, len(resp.Choices))
+		stepSpan.SetAttributes(attribute.Int("step.choices", len(resp.Choices)))
+
+		// Only the first successful attempt answers the request
+		mu.Lock()
+		defer mu.Unlock()
+		if response != nil {
+			return nil, errHedgeLost
+		}
+
+		// Convert response to JSON for logging (with truncated message contents)
+		truncatedResp := resp.TruncateResponseForLogging()
+		responseJSON, _ := json.Marshal(truncatedResp)
+		stepSpan.SetAttributes(attribute.String("step.response", string(responseJSON)))
+
+		debugFields := map[string]interface{}{
+			"provider":      provider.Name(),
+			"model":         provider.model,
+			"response_json": string(responseJSON),
+		}
+		if requestID != "" {
+			debugFields["request_id"] = requestID
+		}
+		m.logger.Debug("Route step response", debugFields)
+
+		resp.Provider = provider.Name()
+		response = resp
+		return withForwardedHeaders(map[string]interface{}{"choices": len(resp.Choices)}, provider, request.Headers), nil
+	})
+	var routeErr types.RouteError
+	if errors.As(err, &routeErr) && routeErr.Route.FallbackResponse != "" && !routeErr.FallbackStopped {
+		return m.fallbackResponse(ctx, routeErr, request.Model, requestID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cacheKey != "" {
+		m.cache.put(cacheKey, response)
+	}
+	succeeded = response
+	return response, nil
+}
+
+// ExecuteStreamWithTracing runs a streaming request through the route for the model.
+// Steps fall back as usual until one provider starts streaming; after that the
+// stream belongs to the caller, who must close it.
+func (m *Manager) ExecuteStreamWithTracing(ctx context.Context, request types.ChatRequest, requestID string) (*Stream, error) {
+	// The upstream stream outlives executeRoute, so it gets its own context that
+	// follows the client's and is cancelled on Close. The request timeout only
+	// applies until a provider starts streaming.
+	streamCtx, cancel := context.WithCancel(ctx)
+	var stream *Stream
+	var streamProvider, streamModel string
+	var streamSpan trace.Span
+	var streamStart time.Time
+	err := m.executeRoute(ctx, request.Model, requestID, routeOptions{streaming: true, tokens: estimateTokens(request.Raw)}, func(ctx context.Context, provider *Client, stepSpan trace.Span) (map[string]interface{}, error) {
+		setOverrideAttributes(stepSpan, provider)
+		stop := context.AfterFunc(ctx, cancel)
+		start := time.Now()
+		s, err := provider.CallStream(streamCtx, request)
+		if !stop() {
+			if err == nil {
+				s.Close()
+			}
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			return nil, err
+		}
+		stepSpan.SetAttributes(attribute.Bool("step.streamed", true))
+
+		stream = s
+		stream.Provider = provider.Name()
+		streamProvider, streamModel = provider.Name(), provider.model
+		streamSpan, streamStart = stepSpan, start
+		return withForwardedHeaders(nil, provider, request.Headers), nil
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	stream.Body = newUsageReader(newTracedBody(stream.Body, streamSpan, streamStart), func(usage *types.Usage) {
+		if usage == nil {
+			m.logger.Warn("Stream ended without a usage chunk, recording zero usage", nil, map[string]interface{}{
+				"request_id": requestID,
+				"provider":   streamProvider,
+				"model":      streamModel,
+			})
+			usage = &types.Usage{}
+		}
+		m.recordUsage(ctx, streamProvider, streamModel, *usage)
+	})
+	release := stream.cancel
+	stream.cancel = func() {
+		if release != nil {
+			release()
+		}
+		cancel()
+	}
+	return stream, nil
+}
+
+// ExecuteEmbeddingsWithTracing runs an embeddings request through the route for the model until one succeeds
+func (m *Manager) ExecuteEmbeddingsWithTracing(ctx context.Context, request types.EmbeddingsRequest, requestID string) (*types.EmbeddingsResponse, error) {
+	var response *types.EmbeddingsResponse
+	err := m.executeRoute(ctx, request.Model, requestID, routeOptions{tokens: estimateTokens(request.Raw)}, func(ctx context.Context, provider *Client, stepSpan trace.Span) (map[string]interface{}, error) {
+		resp, err := provider.CallEmbeddings(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		m.recordUsage(ctx, provider.Name(), provider.model, resp.Usage)
+		resp.Provider = provider.Name()
+		response = resp
+		return withForwardedHeaders(nil, provider, request.Headers), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// ExecuteCompletionsWithTracing runs a legacy text completion request through the route for the model until one succeeds
+func (m *Manager) ExecuteCompletionsWithTracing(ctx context.Context, request types.CompletionRequest, requestID string) (*types.CompletionResponse, error) {
+	var response *types.CompletionResponse
+	err := m.executeRoute(ctx, request.Model, requestID, routeOptions{tokens: estimateTokens(request.Raw)}, func(ctx context.Context, provider *Client, stepSpan trace.Span) (map[string]interface{}, error) {
+		resp, err := provider.CallCompletions(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		m.recordUsage(ctx, provider.Name(), provider.model, resp.Usage)
+		resp.Provider = provider.Name()
+		response = resp
+		return withForwardedHeaders(nil, provider, request.Headers), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// withForwardedHeaders adds the headers forwarded to the provider to the step
+// success log fields. The logger redacts sensitive header values.
+func withForwardedHeaders(fields map[string]interface{}, provider *Client, incoming http.Header) map[string]interface{} {
+	forwarded := provider.forwardedHeaders(incoming)
+	if len(forwarded) == 0 {
+		return fields
+	}
+	if fields == nil {
+		fields = make(map[string]interface{})
+	}
+	headers := make(map[string]interface{}, len(forwarded))
+	for name, values := range forwarded {
+		headers[name] = strings.Join(values, ", ")
+	}
+	fields["forwarded_headers"] = headers
+	return fields
+}
+
+// setOverrideAttributes records the request parameters the step's overrides replace
+func setOverrideAttributes(stepSpan trace.Span, provider *Client) {
+	if len(provider.overrides) == 0 {
+		return
+	}
+	stepSpan.SetAttributes(attribute.StringSlice("step.overridden_params", provider.overriddenParams()))
+}
+
+// stepAttempt calls the provider for a single route step. On success it may
+// return extra fields to include in the step success log.
+type stepAttempt func(ctx context.Context, provider *Client, stepSpan trace.Span) (map[string]interface{}, error)
+
+// routeCall is one request's pass through a route, shared by its steps
+type routeCall struct {
+	route     *config.Route
+	providers map[string]config.Provider
+	model     string // requested model, which may differ from a pattern route's name
+	requestID string
+	span      trace.Span
+	attempt   stepAttempt
+	budget    *attemptBudget
+	streaming bool
+	tokens    int // estimated request tokens, for providers' rate_limit_tpm
+}
+
+// logFields returns the log fields identifying the step within the request
+func (rc *routeCall) logFields(step config.RouteStep) map[string]interface{} {
+	fields := map[string]interface{}{
+		"provider": step.Provider,
+		"model":    step.Model,
+		"route":    rc.route.Name,
+	}
+	if rc.requestID != "" {
+		fields["request_id"] = rc.requestID
+	}
+	if rc.model != rc.route.Name {
+		fields["requested_model"] = rc.model
+	}
+	return fields
+}
+
+// routeOptions adjusts how executeRoute runs a route for one kind of request
+type routeOptions struct {
+	// hedgeable lets hedge routes race their first two steps, meaning the
+	// attempt is safe to run concurrently and rejects all but the first success
+	hedgeable bool
+	// pinnedProvider, when set, moves the route's step for that provider to the
+	// front; the other steps remain as fallbacks
+	pinnedProvider string
+	// streaming hands the successful step's span to the attempt, which ends it
+	// once the stream it returned is finished
+	streaming bool
+	// tokens is the request's estimated size, taken from providers' rate_limit_tpm
+	tokens int
+}
+
+// executeRoute resolves the route for the model and tries each step in order
+// until attempt succeeds, returning a RouteError when every step fails.
+func (m *Manager) executeRoute(ctx context.Context, model string, requestID string, opts routeOptions, attempt stepAttempt) (err error) {
 	// Find the route for this model
-	route, err := m.GetRoute(request.Model)
+	providers, routes := m.snapshot()
+	route, err := findRoute(routes, model)
 	if err != nil {
-		return nil, fmt.Errorf("route lookup failed: %w", err)
+		return fmt.Errorf("route lookup failed: %w", err)
+	}
+
+	order, selectionReason := m.stepOrder(route)
+	order, canaryVariant := m.applyCanary(route, order)
+	if canaryVariant == CanaryVariantCanary {
+		selectionReason = fmt.Sprintf("canary: %d%% of requests", route.Steps[order[0]].Canary)
+	}
+	if opts.pinnedProvider != "" {
+		pinned := stepForProvider(route, opts.pinnedProvider)
+		if pinned < 0 {
+			return fmt.Errorf("%w: '%s' is not a provider of route '%s'", ErrProviderNotInRoute, opts.pinnedProvider, route.Name)
+		}
+		order = moveToFront(order, pinned)
+		selectionReason = "pinned by " + ProviderHeader + " header"
+	}
+
+	// Bound the whole fallback chain, not just the individual steps
+	timeout := route.GetRequestTimeout(m.timeout)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 
 	rootCtx, routeSpan := m.tracer.Start(ctx, fmt.Sprintf("route/%s", route.Name),
 		trace.WithAttributes(
 			attribute.String("route.name", route.Name),
-			attribute.String("route.model", request.Model),
+			attribute.String("route.model", model),
 		),
 	)
 	if requestID != "" {
@@ -74,106 +519,419 @@ func (m *Manager) ExecuteWithTracing(ctx context.Context, request types.ChatRequ
 	}
 	defer routeSpan.End()
 
+	if canaryVariant != "" {
+		routeSpan.SetAttributes(attribute.String("route.canary_variant", canaryVariant))
+	}
+	if route.Strategy != "" || opts.pinnedProvider != "" || canaryVariant != "" {
+		routeSpan.SetAttributes(
+			attribute.String("route.strategy", route.Strategy),
+			attribute.String("route.selected_provider", route.Steps[order[0]].Provider),
+			attribute.String("route.selected_model", route.Steps[order[0]].UpstreamModel(model)),
+			attribute.Int("route.selected_step", order[0]),
+			attribute.String("route.selection_reason", selectionReason),
+		)
+	}
+
+	rc := &routeCall{
+		route:     route,
+		providers: providers,
+		model:     model,
+		requestID: requestID,
+		span:      routeSpan,
+		attempt:   attempt,
+		budget:    &attemptBudget{max: int32(route.MaxAttempts)},
+		streaming: opts.streaming,
+		tokens:    opts.tokens,
+	}
+	start := time.Now()
 	var stepErrors []types.RouteStepError
+	defer func() {
+		routeSpan.SetAttributes(attribute.Int("route.attempts", int(rc.budget.used.Load())))
+		if err != nil {
+			setFailureSummary(routeSpan, stepErrors, time.Since(start))
+		}
+	}()
 
-	// Try each step in the route
-	for stepIndex, step := range route.Steps {
-		// Get provider config
-		providerCfg, exists := m.providers[step.Provider]
-		if !exists {
-			err := fmt.Errorf("route '%s' step %d: provider '%s' not found", route.Name, stepIndex, step.Provider)
-			routeSpan.RecordError(err)
-			routeSpan.SetStatus(codes.Error, err.Error())
-			return nil, err
+	// Race the first two steps, then fall back through the rest as usual
+	if route.Strategy == StrategyHedge && opts.hedgeable && len(order) >= 2 {
+		hedgeErrors, succeeded, err := m.hedgeSteps(rootCtx, rc, order[0], order[1], route.GetHedgeDelay())
+		if err != nil || succeeded {
+			return err
+		}
+		stepErrors = append(stepErrors, hedgeErrors...)
+		for _, stepErr := range hedgeErrors {
+			if stepErr.NoFallback {
+				return stopFallback(routeSpan, route, stepErrors)
+			}
 		}
+		order = order[2:]
+	}
 
-		fields := map[string]interface{}{
-			"provider": step.Provider,
-			"model":    step.Model,
-			"route":    route.Name,
+	// Try each step in the route
+	for _, stepIndex := range order {
+		if ctx.Err() != nil {
+			break
 		}
-		if requestID != "" {
-			fields["request_id"] = requestID
+		if rc.budget.exhausted() {
+			routeSpan.AddEvent("route.attempt_budget_exhausted", trace.WithAttributes(
+				attribute.Int("route.max_attempts", route.MaxAttempts),
+			))
+			break
+		}
+		stepErr, err := m.tryStep(rootCtx, rc, stepIndex)
+		if err != nil {
+			return err
 		}
+		if stepErr == nil {
+			return nil
+		}
+		stepErrors = append(stepErrors, *stepErr)
+		if stepErr.NoFallback {
+			return stopFallback(routeSpan, route, stepErrors)
+		}
+	}
 
-		m.logger.Info("Trying route step", fields)
+	if timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		routeSpan.SetStatus(codes.Error, "request timeout")
+		routeSpan.AddEvent("route.timeout", trace.WithAttributes(attribute.Int64("route.timeout_ms", timeout.Milliseconds())))
+		return fmt.Errorf("%w: route '%s' did not complete within %s", ErrRequestTimeout, route.Name, timeout)
+	}
 
-		_, stepSpan := m.tracer.Start(rootCtx, fmt.Sprintf("route.%s.step.%d", route.Name, stepIndex),
-			trace.WithAttributes(
-				attribute.String("step.provider", step.Provider),
-				attribute.String("step.model", step.Model),
-				attribute.Int("step.index", stepIndex),
-			),
-			trace.WithSpanKind(trace.SpanKindClient),
-		)
+	// The client went away; later steps were not attempted
+	if errors.Is(ctx.Err(), context.Canceled) {
+		routeSpan.SetStatus(codes.Error, "request cancelled")
+		return fmt.Errorf("route '%s' abandoned: %w", route.Name, ctx.Err())
+	}
 
-		start := time.Now()
-		// Create provider client on-demand with route step configuration
-		provider := NewClientWithRouteStep(providerCfg, step, m.logger)
-		response, err := provider.Call(request)
-		duration := time.Since(start)
+	// All route steps failed
+	routeSpan.SetStatus(codes.Error, "all steps failed")
+	routeSpan.AddEvent("route.failed", trace.WithAttributes(attribute.Int("route.step.failures", len(route.Steps))))
+	return types.RouteError{
+		Route:  *route,
+		Errors: stepErrors,
+	}
+}
 
-		stepSpan.SetAttributes(attribute.Int64("step.duration_ms", duration.Milliseconds()))
+// setFailureSummary describes a failed route on its span, so the span alone
+// tells which providers failed and how without expanding the step spans:
+// step failures by upstream status class, the first and last error and the
+// time the route took
+func setFailureSummary(routeSpan trace.Span, stepErrors []types.RouteStepError, elapsed time.Duration) {
+	routeSpan.SetAttributes(
+		attribute.Int("route.failure.steps", len(stepErrors)),
+		attribute.Int64("route.duration_ms", elapsed.Milliseconds()),
+	)
+	if len(stepErrors) == 0 {
+		return
+	}
 
-		if err != nil {
-			errorFields := map[string]interface{}{
-				"provider":    step.Provider,
-				"model":       step.Model,
-				"route":       route.Name,
-				"step":        stepIndex,
-				"duration_ms": duration.Milliseconds(),
-			}
-			if requestID != "" {
-				errorFields["request_id"] = requestID
-			}
+	classes := make(map[string]int)
+	providers := make([]string, 0, len(stepErrors))
+	for _, stepErr := range stepErrors {
+		class := "none" // skipped, or no response such as a timeout
+		if stepErr.StatusCode > 0 {
+			class = fmt.Sprintf("%dxx", stepErr.StatusCode/100)
+		}
+		classes[class]++
+		providers = append(providers, stepErr.Provider)
+	}
+	for class, count := range classes {
+		routeSpan.SetAttributes(attribute.Int("route.failure.status_"+class, count))
+	}
+	first, last := stepErrors[0], stepErrors[len(stepErrors)-1]
+	routeSpan.SetAttributes(
+		attribute.StringSlice("route.failure.providers", providers),
+		attribute.String("route.failure.first_error", first.Provider+": "+first.Error),
+		attribute.String("route.failure.last_error", last.Provider+": "+last.Error),
+	)
+}
 
-			m.logger.Error("Route step failed", err, errorFields)
-			stepSpan.RecordError(err)
-			stepSpan.SetStatus(codes.Error, err.Error())
-			routeSpan.RecordError(err)
-			routeSpan.AddEvent("step.failed", trace.WithAttributes(
-				attribute.String("step.error", err.Error()),
-				attribute.String("step.provider", step.Provider),
-			))
-			stepErrors = append(stepErrors, types.RouteStepError{
+// stopFallback ends a route at a step error its fallback_on does not cover,
+// without trying the remaining steps
+func stopFallback(routeSpan trace.Span, route *config.Route, stepErrors []types.RouteStepError) error {
+	last := stepErrors[len(stepErrors)-1]
+	routeSpan.SetStatus(codes.Error, "step error not in fallback_on")
+	routeSpan.AddEvent("route.fallback_stopped", trace.WithAttributes(
+		attribute.Int("step.index", last.StepIndex),
+		attribute.String("step.provider", last.Provider),
+		attribute.Int("step.status_code", last.StatusCode),
+	))
+	return types.RouteError{
+		Route:           *route,
+		Errors:          stepErrors,
+		FallbackStopped: true,
+	}
+}
+
+// tryStep runs a single route step. It returns nil on success, the step's
+// error when it was skipped or failed, or an error that ends the route.
+func (m *Manager) tryStep(ctx context.Context, rc *routeCall, stepIndex int) (*types.RouteStepError, error) {
+	route, routeSpan := rc.route, rc.span
+	step := route.Steps[stepIndex]
+	// Logs, spans and step errors show the model actually sent upstream
+	step.Model = step.UpstreamModel(rc.model)
+	// Get provider config
+	providerCfg, exists := rc.providers[step.Provider]
+	if !exists {
+		err := fmt.Errorf("route '%s' step %d: provider '%s' not found", route.Name, stepIndex, step.Provider)
+		routeSpan.RecordError(err)
+		routeSpan.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	fields := rc.logFields(step)
+
+	// Skip providers switched off in the configuration
+	if providerCfg.Disabled {
+		m.logger.Debug("Skipping route step for disabled provider", fields)
+		routeSpan.AddEvent("step.skipped", trace.WithAttributes(
+			attribute.String("step.provider", step.Provider),
+			attribute.Int("step.index", stepIndex),
+			attribute.String("step.skip_reason", "disabled"),
+		))
+		return &types.RouteStepError{
+			StepIndex: stepIndex,
+			Provider:  step.Provider,
+			Model:     step.Model,
+			Error:     "step skipped: provider is disabled",
+		}, nil
+	}
+
+	// Skip providers the background health checker knows to be down
+	if !m.health.isHealthy(step.Provider) {
+		m.logger.Warn("Skipping route step for unhealthy provider", nil, fields)
+		routeSpan.AddEvent("step.skipped", trace.WithAttributes(
+			attribute.String("step.provider", step.Provider),
+			attribute.Int("step.index", stepIndex),
+			attribute.String("step.skip_reason", "unhealthy"),
+		))
+		return &types.RouteStepError{
+			StepIndex: stepIndex,
+			Provider:  step.Provider,
+			Model:     step.Model,
+			Error:     "step skipped: provider is marked unhealthy",
+		}, nil
+	}
+
+	// Short-circuit providers whose breaker is open
+	allowed, trial := m.breakers.allowTrial(step.Provider)
+	if !allowed {
+		m.logger.Warn("Skipping route step, circuit open", nil, fields)
+		routeSpan.AddEvent("circuit_open", trace.WithAttributes(
+			attribute.String("step.provider", step.Provider),
+			attribute.Int("step.index", stepIndex),
+		))
+		return &types.RouteStepError{
+			StepIndex: stepIndex,
+			Provider:  step.Provider,
+			Model:     step.Model,
+			Error:     "step skipped: circuit open for provider",
+		}, nil
+	}
+
+	// Wait for the provider's rate limits, or fall back when that takes too long
+	throttleWait, ok := m.throttle.reserve(providerCfg, rc.tokens, maxThrottleWait(ctx, providerCfg, step))
+	if !ok {
+		if trial {
+			m.breakers.release(step.Provider)
+		}
+		fields["throttle_wait_ms"] = throttleWait.Milliseconds()
+		m.logger.Warn("Skipping route step, provider rate limit reached", nil, fields)
+		routeSpan.AddEvent("step.skipped", trace.WithAttributes(
+			attribute.String("step.provider", step.Provider),
+			attribute.Int("step.index", stepIndex),
+			attribute.String("step.skip_reason", "rate_limited"),
+			attribute.Int64("step.throttle_wait_ms", throttleWait.Milliseconds()),
+		))
+		return &types.RouteStepError{
+			StepIndex: stepIndex,
+			Provider:  step.Provider,
+			Model:     step.Model,
+			Error:     "step skipped: provider rate limit reached",
+		}, nil
+	}
+	if throttleWait > 0 {
+		timer := time.NewTimer(throttleWait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			m.throttle.refund(providerCfg, rc.tokens)
+			if trial {
+				m.breakers.release(step.Provider)
+			}
+			return &types.RouteStepError{
 				StepIndex: stepIndex,
 				Provider:  step.Provider,
 				Model:     step.Model,
-				Error:     err.Error(),
-			})
-			stepSpan.End()
-			continue
+				Error:     "step skipped: request ended while waiting for provider rate limit",
+			}, nil
 		}
+	}
 
-		// Convert response to JSON for logging (with truncated message contents)
-		truncatedResp := response.TruncateResponseForLogging()
-		responseJSON, _ := json.Marshal(truncatedResp)
+	// Hold a slot for the provider's max_concurrency while the step runs
+	release, queueWait, ok := m.limits.acquire(ctx, providerCfg)
+	if !ok {
+		m.throttle.refund(providerCfg, rc.tokens)
+		if trial {
+			m.breakers.release(step.Provider)
+		}
+		fields["queue_wait_ms"] = queueWait.Milliseconds()
+		m.logger.Warn("Skipping route step, provider saturated", nil, fields)
+		routeSpan.AddEvent("step.skipped", trace.WithAttributes(
+			attribute.String("step.provider", step.Provider),
+			attribute.Int("step.index", stepIndex),
+			attribute.String("step.skip_reason", "saturated"),
+			attribute.Int64("step.queue_wait_ms", queueWait.Milliseconds()),
+		))
+		return &types.RouteStepError{
+			StepIndex: stepIndex,
+			Provider:  step.Provider,
+			Model:     step.Model,
+			Error:     "step skipped: provider at max_concurrency",
+		}, nil
+	}
+	defer release()
 
-		successFields := map[string]interface{}{
-			"provider":      step.Provider,
-			"model":         step.Model,
-			"route":         route.Name,
-			"step":          stepIndex,
-			"response_json": string(responseJSON),
-			"duration_ms":   duration.Milliseconds(),
+	// Hedged steps run concurrently, so the budget may run out after the route checked it
+	if !rc.budget.take() {
+		m.throttle.refund(providerCfg, rc.tokens)
+		if trial {
+			m.breakers.release(step.Provider)
 		}
-		if requestID != "" {
-			successFields["request_id"] = requestID
+		return &types.RouteStepError{
+			StepIndex: stepIndex,
+			Provider:  step.Provider,
+			Model:     step.Model,
+			Error:     "step skipped: route attempt budget exhausted",
+		}, nil
+	}
+
+	m.logger.Debug("Trying route step", fields)
+
+	stepCtx, stepSpan := m.tracer.Start(ctx, fmt.Sprintf("route.%s.step.%d", route.Name, stepIndex),
+		trace.WithAttributes(
+			attribute.String("step.provider", step.Provider),
+			attribute.String("step.model", step.Model),
+			attribute.Int("step.index", stepIndex),
+		),
+		trace.WithSpanKind(trace.SpanKindClient),
+	)
+	succeeded := false
+	defer func() {
+		// A successful stream's span stays open until the stream is finished
+		if !succeeded || !rc.streaming {
+			stepSpan.End()
 		}
+	}()
+	if providerCfg.MaxConcurrency > 0 {
+		stepSpan.SetAttributes(attribute.Int64("step.queue_wait_ms", queueWait.Milliseconds()))
+	}
+	if providerCfg.RateLimitRPM > 0 || providerCfg.RateLimitTPM > 0 {
+		stepSpan.SetAttributes(attribute.Int64("step.throttle_wait_ms", throttleWait.Milliseconds()))
+	}
 
-		m.logger.Info("Route step succeeded", successFields)
-		stepSpan.SetAttributes(attribute.String("step.response", string(responseJSON)))
+	start := time.Now()
+	// Create provider client on-demand with route step configuration
+	provider := m.newClient(providerCfg, step)
+	extraFields, err := attemptWithRetry(stepCtx, step, stepSpan, rc.budget, func() (map[string]interface{}, error) {
+		fields, err := rc.attempt(stepCtx, provider, stepSpan)
+		metrics.UpstreamResponsesTotal.Inc(step.Provider, upstreamStatusLabel(err))
+		return fields, err
+	})
+	duration := time.Since(start)
+	metrics.StepDuration.Observe(duration.Seconds(), step.Provider)
+	// Losing a hedge race says nothing about the provider, so it only gives
+	// back a circuit trial it held
+	hedgeLost := err != nil && (errors.Is(err, errHedgeLost) || errors.Is(context.Cause(ctx), errHedgeLost))
+	if hedgeLost {
+		m.breakers.release(step.Provider)
+	} else if m.breakers.record(step.Provider, err) {
+		openFields := map[string]interface{}{"provider": step.Provider}
+		openAttrs := []attribute.KeyValue{attribute.String("step.provider", step.Provider)}
+		if window := maintenanceWindow(err); window > 0 {
+			openFields["retry_after_ms"] = window.Milliseconds()
+			openAttrs = append(openAttrs, attribute.Int64("circuit.retry_after_ms", window.Milliseconds()))
+		}
+		m.logger.Error("Circuit opened for provider", err, openFields)
+		routeSpan.AddEvent("circuit.opened", trace.WithAttributes(openAttrs...))
+	}
+
+	// The step's total time, and the part spent waiting on the provider
+	stepSpan.SetAttributes(
+		attribute.Int64("step.duration_ms", duration.Milliseconds()),
+		attribute.Int64("step.upstream_ms", provider.upstream.Milliseconds()),
+	)
+
+	fields["step"] = stepIndex
+	fields["duration_ms"] = duration.Milliseconds()
+	fields["upstream_ms"] = provider.upstream.Milliseconds()
+	if provider.trimmed > 0 {
+		stepSpan.SetAttributes(attribute.Int("step.trimmed_messages", provider.trimmed))
+		fields["trimmed_messages"] = provider.trimmed
+	}
+
+	// The other hedged step already answered the request
+	if hedgeLost {
+		m.logger.Debug("Hedged route step abandoned", fields)
+		stepSpan.SetAttributes(attribute.Bool("step.hedge_lost", true))
+		stepErr := newRouteStepError(stepIndex, step, errHedgeLost)
+		stepErr.DurationMs = duration.Milliseconds()
+		return &stepErr, nil
+	}
+
+	if err != nil {
+		m.logger.Error("Route step failed", err, fields)
+		metrics.ProviderRequestsTotal.Inc(step.Provider, "failure")
+		stepSpan.RecordError(err)
+		stepSpan.SetStatus(codes.Error, err.Error())
+		routeSpan.RecordError(err)
+		routeSpan.AddEvent("step.failed", trace.WithAttributes(
+			attribute.String("step.error", err.Error()),
+			attribute.String("step.provider", step.Provider),
+		))
+		stepErr := newRouteStepError(stepIndex, step, err)
+		stepErr.DurationMs = duration.Milliseconds()
+		stepErr.NoFallback = !fallbackAllowed(route.FallbackOn, err)
+		return &stepErr, nil
+	}
+
+	for k, v := range extraFields {
+		fields[k] = v
+	}
+	m.logger.Info("Route step succeeded", fields)
+	m.latency.record(step.Provider, duration)
+	metrics.ProviderRequestsTotal.Inc(step.Provider, "success")
+	succeeded = true
+	if !rc.streaming {
 		stepSpan.SetStatus(codes.Ok, "success")
-		stepSpan.End()
-		return response, nil
 	}
+	return nil, nil
+}
 
-	// All route steps failed
-	routeSpan.SetStatus(codes.Error, "all steps failed")
-	routeSpan.AddEvent("route.failed", trace.WithAttributes(attribute.Int("route.step.failures", len(route.Steps))))
-	routeError := types.RouteError{
-		Route:  *route,
-		Errors: stepErrors,
+// maxThrottleWait returns how long a step may wait for the provider's rate
+// limits: nothing with on_saturation "fallback", otherwise its step timeout
+// as long as the request's deadline allows
+func maxThrottleWait(ctx context.Context, provider config.Provider, step config.RouteStep) time.Duration {
+	if provider.OnSaturation == config.SaturationFallback {
+		return 0
+	}
+	wait := config.GetTimeout(step.Timeout, "30s")
+	if deadline, ok := ctx.Deadline(); ok {
+		wait = min(wait, time.Until(deadline))
+	}
+	return wait
+}
+
+// upstreamStatusLabel returns the upstream HTTP status for metrics, or "error"
+// when the call failed without a provider response
+func upstreamStatusLabel(err error) string {
+	if err == nil || errors.Is(err, errHedgeLost) {
+		return strconv.Itoa(http.StatusOK)
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return strconv.Itoa(statusErr.StatusCode)
 	}
-	return nil, routeError
+	return "error"
 }
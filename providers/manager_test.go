@@ -1,17 +1,28 @@
 package providers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"ai-gateway/config"
 	"ai-gateway/logger"
 	"ai-gateway/types"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestManager_Execute(t *testing.T) {
@@ -499,4 +510,1494 @@ func TestManager_Execute_MultipleRoutes(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestManager_ExecuteStream_FallsBackBeforeStreaming(t *testing.T) {
+	server1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server1.Close()
+
+	server2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"Hi\"}}]}\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server2.Close()
+
+	providers := []config.Provider{
+		{Name: "provider1", APIKey: "key1", BaseURL: server1.URL},
+		{Name: "provider2", APIKey: "key2", BaseURL: server2.URL},
+	}
+	routes := []config.Route{
+		{
+			Name: "stream-model",
+			Steps: []config.RouteStep{
+				{Provider: "provider1", Model: "gpt-4"},
+				{Provider: "provider2", Model: "gpt-4"},
+			},
+		},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+
+	requestJSON := `{"model":"stream-model","stream":true,"messages":[{"role":"user","content":"Hello"}]}`
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(requestJSON), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+
+	stream, err := manager.ExecuteStreamWithTracing(context.Background(), request, "")
+	if err != nil {
+		t.Fatalf("ExecuteStreamWithTracing() error = %v", err)
+	}
+	defer stream.Close()
+
+	if stream.ContentType != "text/event-stream" {
+		t.Errorf("Expected content type 'text/event-stream', got '%s'", stream.ContentType)
+	}
+
+	body, err := io.ReadAll(stream.Body)
+	if err != nil {
+		t.Fatalf("Failed to read stream: %v", err)
+	}
+	if !strings.HasSuffix(string(body), "data: [DONE]\n\n") {
+		t.Errorf("Expected stream to end with [DONE] terminator, got %q", string(body))
+	}
+}
+
+func TestManager_Execute_RetriesTransientErrors(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"test-id","object":"chat.completion","model":"gpt-4","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	providers := []config.Provider{
+		{Name: "provider1", APIKey: "key1", BaseURL: server.URL},
+	}
+	routes := []config.Route{
+		{
+			Name: "retry-model",
+			Steps: []config.RouteStep{
+				{Provider: "provider1", Model: "gpt-4", Retries: 2, Backoff: "1ms"},
+			},
+		},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"retry-model","messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+
+	if _, err := manager.Execute(request); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("Expected 3 upstream calls, got %d", got)
+	}
+}
+
+func TestManager_Execute_AttemptBudget(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	providers := []config.Provider{
+		{Name: "provider1", APIKey: "key1", BaseURL: server.URL},
+		{Name: "provider2", APIKey: "key2", BaseURL: server.URL},
+		{Name: "provider3", APIKey: "key3", BaseURL: server.URL},
+	}
+	routes := []config.Route{
+		{
+			Name:        "budget-model",
+			MaxAttempts: 4,
+			Steps: []config.RouteStep{
+				{Provider: "provider1", Model: "gpt-4", Retries: 2, Backoff: "1ms"},
+				{Provider: "provider2", Model: "gpt-4", Retries: 2, Backoff: "1ms"},
+				{Provider: "provider3", Model: "gpt-4", Retries: 2, Backoff: "1ms"},
+			},
+		},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"budget-model","messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+
+	_, err := manager.Execute(request)
+	var routeErr types.RouteError
+	if !errors.As(err, &routeErr) {
+		t.Fatalf("Expected RouteError, got %v", err)
+	}
+	// Step 1 uses 3 attempts, step 2 gets the last one and step 3 never runs
+	if got := atomic.LoadInt32(&calls); got != 4 {
+		t.Errorf("Expected the budget to cap upstream calls at 4, got %d", got)
+	}
+	if len(routeErr.Errors) != 2 {
+		t.Errorf("Expected errors for the 2 steps that ran, got %+v", routeErr.Errors)
+	}
+}
+
+func TestManager_TryStep_BudgetSkipReleasesLimits(t *testing.T) {
+	providers := []config.Provider{
+		{Name: "limited", APIKey: "key1", BaseURL: "http://localhost", RateLimitRPM: 1},
+	}
+	routes := []config.Route{
+		{Name: "model", MaxAttempts: 1, Steps: []config.RouteStep{{Provider: "limited", Model: "gpt-4"}}},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+	manager.SetCircuitBreaker(1, 0, time.Minute)
+	now := time.Now()
+	manager.breakers.now = func() time.Time { return now }
+	manager.throttle.now = func() time.Time { return now }
+
+	// Open the circuit and wait out the cooldown so the next step gets the trial
+	manager.breakers.record("limited", errors.New("connection refused"))
+	now = now.Add(90 * time.Second)
+
+	// Another step of the request used the last attempt in the meantime
+	budget := &attemptBudget{max: 1}
+	budget.used.Store(1)
+	_, span := manager.tracer.Start(context.Background(), "route")
+	rc := &routeCall{
+		route:     &routes[0],
+		providers: map[string]config.Provider{"limited": providers[0]},
+		model:     "model",
+		span:      span,
+		budget:    budget,
+	}
+	stepErr, err := manager.tryStep(context.Background(), rc, 0)
+	if err != nil || stepErr == nil || !strings.Contains(stepErr.Error, "attempt budget exhausted") {
+		t.Fatalf("Expected the step to be skipped for the attempt budget, got %+v, %v", stepErr, err)
+	}
+
+	// The skipped step leaves the circuit trial and the minute's request to others
+	if !manager.breakers.allow("limited") {
+		t.Error("Expected the half-open circuit trial to be released")
+	}
+	if _, ok := manager.throttle.reserve(providers[0], 0, 0); !ok {
+		t.Error("Expected the rate limit reservation to be refunded")
+	}
+}
+
+func TestManager_Execute_DoesNotRetryClientErrors(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	providers := []config.Provider{
+		{Name: "provider1", APIKey: "key1", BaseURL: server.URL},
+	}
+	routes := []config.Route{
+		{
+			Name: "retry-model",
+			Steps: []config.RouteStep{
+				{Provider: "provider1", Model: "gpt-4", Retries: 3, Backoff: "1ms"},
+			},
+		},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"retry-model","messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+
+	if _, err := manager.Execute(request); err == nil {
+		t.Fatal("Expected error for 400 response")
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("Expected 1 upstream call for non-retryable status, got %d", got)
+	}
+}
+
+func TestManager_Execute_FallbackOn(t *testing.T) {
+	var status int32
+	var backupCalls int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer primary.Close()
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&backupCalls, 1)
+		w.Write([]byte(`{"id":"backup","object":"chat.completion","choices":[]}`))
+	}))
+	defer backup.Close()
+
+	providers := []config.Provider{
+		{Name: "primary", APIKey: "key1", BaseURL: primary.URL},
+		{Name: "backup", APIKey: "key2", BaseURL: backup.URL},
+	}
+	routes := []config.Route{
+		{
+			Name:       "test-model",
+			FallbackOn: []string{"5xx", "timeout", "429"},
+			Steps: []config.RouteStep{
+				{Provider: "primary", Model: "m"},
+				{Provider: "backup", Model: "m"},
+			},
+		},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"test-model","messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+
+	// A client error is returned without trying the next step
+	atomic.StoreInt32(&status, http.StatusBadRequest)
+	_, err := manager.Execute(request)
+	routeErr, ok := err.(types.RouteError)
+	if !ok {
+		t.Fatalf("Expected RouteError, got %v", err)
+	}
+	if !routeErr.FallbackStopped || len(routeErr.Errors) != 1 || routeErr.Errors[0].StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected the route to stop at the 400, got %+v", routeErr)
+	}
+	if got := atomic.LoadInt32(&backupCalls); got != 0 {
+		t.Errorf("Expected no fallback on 400, backup was called %d times", got)
+	}
+
+	// Listed errors still fall back
+	for _, code := range []int32{http.StatusTooManyRequests, http.StatusBadGateway} {
+		atomic.StoreInt32(&status, code)
+		resp, err := manager.Execute(request)
+		if err != nil {
+			t.Fatalf("Execute() with primary status %d error = %v", code, err)
+		}
+		if resp.ID != "backup" {
+			t.Errorf("Expected fallback on %d, got response %s", code, resp.ID)
+		}
+	}
+}
+
+func TestFallbackAllowed(t *testing.T) {
+	tests := []struct {
+		name       string
+		fallbackOn []string
+		err        error
+		want       bool
+	}{
+		{name: "no policy", err: &StatusError{StatusCode: 400}, want: true},
+		{name: "status class", fallbackOn: []string{"5xx"}, err: &StatusError{StatusCode: 503}, want: true},
+		{name: "status code", fallbackOn: []string{"429"}, err: &StatusError{StatusCode: 429}, want: true},
+		{name: "unlisted status", fallbackOn: []string{"5xx", "429"}, err: &StatusError{StatusCode: 422}, want: false},
+		{name: "timeout", fallbackOn: []string{"timeout"}, err: fmt.Errorf("request failed: %w", context.DeadlineExceeded), want: true},
+		{name: "network", fallbackOn: []string{"network"}, err: errors.New("connection refused"), want: true},
+		{name: "unlisted network", fallbackOn: []string{"5xx", "timeout"}, err: errors.New("connection refused"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fallbackAllowed(tt.fallbackOn, tt.err); got != tt.want {
+				t.Errorf("fallbackAllowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	base := 100 * time.Millisecond
+
+	if got := retryDelay(base, 1, &StatusError{StatusCode: 503}); got != 100*time.Millisecond {
+		t.Errorf("Expected first retry delay 100ms, got %v", got)
+	}
+	if got := retryDelay(base, 3, &StatusError{StatusCode: 503}); got != 400*time.Millisecond {
+		t.Errorf("Expected third retry delay 400ms, got %v", got)
+	}
+	if got := retryDelay(base, 1, &StatusError{StatusCode: 429, RetryAfter: 2 * time.Second}); got != 2*time.Second {
+		t.Errorf("Expected Retry-After to be honored on 429, got %v", got)
+	}
+	if got := retryDelay(base, 1, &StatusError{StatusCode: 503, RetryAfter: 5 * time.Second}); got != 5*time.Second {
+		t.Errorf("Expected Retry-After to be honored on 503, got %v", got)
+	}
+}
+
+func TestManager_Execute_SkipsUnhealthyProvider(t *testing.T) {
+	var chatCalls int32
+	unhealthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chat/completions" {
+			atomic.AddInt32(&chatCalls, 1)
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unhealthy.Close()
+
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/models" {
+			w.Write([]byte(`{"object":"list","data":[]}`))
+			return
+		}
+		w.Write([]byte(`{"id":"test-id","object":"chat.completion","model":"gpt-4","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	defer healthy.Close()
+
+	providers := []config.Provider{
+		{Name: "down", APIKey: "key1", BaseURL: unhealthy.URL},
+		{Name: "up", APIKey: "key2", BaseURL: healthy.URL},
+	}
+	routes := []config.Route{
+		{
+			Name: "test-model",
+			Steps: []config.RouteStep{
+				{Provider: "down", Model: "gpt-4"},
+				{Provider: "up", Model: "gpt-4"},
+			},
+		},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+	manager.checkProviders(context.Background(), time.Second)
+
+	if manager.health.isHealthy("down") {
+		t.Fatal("Expected provider returning 503 on /models to be unhealthy")
+	}
+	if !manager.health.isHealthy("up") {
+		t.Fatal("Expected provider answering /models to be healthy")
+	}
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"test-model","messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+	if _, err := manager.Execute(request); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if got := atomic.LoadInt32(&chatCalls); got != 0 {
+		t.Errorf("Expected unhealthy provider to be skipped, got %d chat calls", got)
+	}
+}
+
+func TestManager_Execute_SkipsDisabledProvider(t *testing.T) {
+	var disabledCalls int32
+	disabled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&disabledCalls, 1)
+	}))
+	defer disabled.Close()
+	enabled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"enabled","object":"chat.completion","choices":[]}`))
+	}))
+	defer enabled.Close()
+
+	providers := []config.Provider{
+		{Name: "off", APIKey: "key1", BaseURL: disabled.URL, Disabled: true},
+		{Name: "on", APIKey: "key2", BaseURL: enabled.URL},
+	}
+	routes := []config.Route{
+		{
+			Name: "test-model",
+			Steps: []config.RouteStep{
+				{Provider: "off", Model: "m"},
+				{Provider: "on", Model: "m"},
+			},
+		},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"test-model","messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+	resp, err := manager.Execute(request)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if resp.ID != "enabled" || atomic.LoadInt32(&disabledCalls) != 0 {
+		t.Errorf("Expected the disabled provider to be skipped, got response %s and %d calls", resp.ID, disabledCalls)
+	}
+}
+
+func TestHealthTracker_Threshold(t *testing.T) {
+	h := newHealthTracker()
+	h.threshold = 2
+
+	if _, changed := h.record("p", fmt.Errorf("down")); changed {
+		t.Error("Expected single failure below threshold not to change state")
+	}
+	if healthy, changed := h.record("p", fmt.Errorf("down")); healthy || !changed {
+		t.Errorf("Expected provider to become unhealthy at threshold, healthy=%v changed=%v", healthy, changed)
+	}
+	if healthy, changed := h.record("p", nil); !healthy || !changed {
+		t.Errorf("Expected successful probe to restore health, healthy=%v changed=%v", healthy, changed)
+	}
+}
+
+func TestManager_Execute_RotatesKeysOnRateLimit(t *testing.T) {
+	var seenKeys []string
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		mu.Lock()
+		seenKeys = append(seenKeys, auth)
+		mu.Unlock()
+
+		if auth == "Bearer key-a" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"test-id","object":"chat.completion","model":"gpt-4","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	providers := []config.Provider{
+		{Name: "provider1", APIKeys: []string{"key-a", "key-b"}, BaseURL: server.URL},
+	}
+	routes := []config.Route{
+		{
+			Name: "test-model",
+			Steps: []config.RouteStep{
+				{Provider: "provider1", Model: "gpt-4", Retries: 1, Backoff: "1ms"},
+			},
+		},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"test-model","messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+	if _, err := manager.Execute(request); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if len(seenKeys) != 2 || seenKeys[0] != "Bearer key-a" || seenKeys[1] != "Bearer key-b" {
+		t.Errorf("Expected retry after 429 to use the next key, got %v", seenKeys)
+	}
+}
+
+func TestManager_Execute_CircuitOpenSkipsProvider(t *testing.T) {
+	var failingCalls int32
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&failingCalls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"test-id","object":"chat.completion","model":"gpt-4","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	defer working.Close()
+
+	providers := []config.Provider{
+		{Name: "failing", APIKey: "key1", BaseURL: failing.URL},
+		{Name: "working", APIKey: "key2", BaseURL: working.URL},
+	}
+	routes := []config.Route{
+		{
+			Name: "test-model",
+			Steps: []config.RouteStep{
+				{Provider: "failing", Model: "gpt-4"},
+				{Provider: "working", Model: "gpt-4"},
+			},
+		},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+	manager.SetCircuitBreaker(2, 0, time.Minute)
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"test-model","messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		if _, err := manager.Execute(request); err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+	}
+	if got := atomic.LoadInt32(&failingCalls); got != 2 {
+		t.Errorf("Expected failing provider to be called until the circuit opened (2), got %d", got)
+	}
+}
+
+func TestManager_Execute_ServesFromCache(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"test-id","object":"chat.completion","model":"gpt-4","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	providers := []config.Provider{
+		{Name: "provider1", APIKey: "key1", BaseURL: server.URL},
+	}
+	routes := []config.Route{
+		{
+			Name:  "test-model",
+			Steps: []config.RouteStep{{Provider: "provider1", Model: "gpt-4"}},
+		},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+	manager.EnableCache(time.Minute, 10)
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"test-model","temperature":0,"messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		response, err := manager.Execute(request)
+		if err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+		if response.ID != "test-id" {
+			t.Errorf("Expected cached response id 'test-id', got '%s'", response.ID)
+		}
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("Expected a single upstream call with caching enabled, got %d", got)
+	}
+}
+
+func TestManager_Execute_IdempotencyKey(t *testing.T) {
+	var calls, failing int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(fmt.Sprintf(`{"id":"resp-%d","object":"chat.completion","choices":[]}`, n)))
+	}))
+	defer server.Close()
+
+	providers := []config.Provider{
+		{Name: "provider1", APIKey: "key1", BaseURL: server.URL},
+	}
+	routes := []config.Route{
+		{
+			Name:  "test-model",
+			Steps: []config.RouteStep{{Provider: "provider1", Model: "gpt-4"}},
+		},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+	manager.EnableIdempotency(time.Minute, 10)
+
+	execute := func(idempotencyKey, apiKey string) (string, error) {
+		var request types.ChatRequest
+		if err := json.Unmarshal([]byte(`{"model":"test-model","messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+			t.Fatalf("Failed to unmarshal test request: %v", err)
+		}
+		request.Headers = http.Header{}
+		request.Headers.Set("Authorization", "Bearer "+apiKey)
+		if idempotencyKey != "" {
+			request.Headers.Set(IdempotencyHeader, idempotencyKey)
+		}
+		resp, err := manager.Execute(request)
+		if err != nil {
+			return "", err
+		}
+		return resp.ID, nil
+	}
+
+	// Failures are not remembered, so the client's retry runs the route again
+	atomic.StoreInt32(&failing, 1)
+	if _, err := execute("retry-1", "client-a"); err == nil {
+		t.Fatal("Expected the failing upstream to fail the request")
+	}
+	atomic.StoreInt32(&failing, 0)
+
+	first, err := execute("retry-1", "client-a")
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if replay, _ := execute("retry-1", "client-a"); replay != first {
+		t.Errorf("Expected the stored response %s to be replayed, got %s", first, replay)
+	}
+	if other, _ := execute("retry-1", "client-b"); other == first {
+		t.Error("Expected another client's identical key not to replay the response")
+	}
+	if fresh, _ := execute("", "client-a"); fresh == first {
+		t.Error("Expected requests without a key to run the route")
+	}
+	if got := atomic.LoadInt32(&calls); got != 4 {
+		t.Errorf("Expected 4 upstream calls, got %d", got)
+	}
+}
+
+func TestManager_Execute_IdempotencyKeyConflicts(t *testing.T) {
+	var calls int32
+	started := make(chan struct{}, 1)
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		started <- struct{}{}
+		<-unblock
+		w.Write([]byte(`{"id":"resp-1","object":"chat.completion","choices":[]}`))
+	}))
+	defer server.Close()
+
+	providers := []config.Provider{
+		{Name: "provider1", APIKey: "key1", BaseURL: server.URL},
+	}
+	routes := []config.Route{
+		{Name: "test-model", Steps: []config.RouteStep{{Provider: "provider1", Model: "gpt-4"}}},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+	manager.EnableIdempotency(time.Minute, 10)
+
+	execute := func(content string) (*types.ChatResponse, error) {
+		var request types.ChatRequest
+		if err := json.Unmarshal([]byte(`{"model":"test-model","messages":[{"role":"user","content":"`+content+`"}]}`), &request); err != nil {
+			t.Fatalf("Failed to unmarshal test request: %v", err)
+		}
+		request.Headers = http.Header{}
+		request.Headers.Set(IdempotencyHeader, "order-1")
+		return manager.Execute(request)
+	}
+
+	// A duplicate sent while the first request runs doesn't reach the provider
+	done := make(chan error, 1)
+	go func() {
+		_, err := execute("Hello")
+		done <- err
+	}()
+	<-started
+	if _, err := execute("Hello"); !errors.Is(err, ErrIdempotencyKeyInFlight) {
+		t.Errorf("Expected ErrIdempotencyKeyInFlight for a concurrent duplicate, got %v", err)
+	}
+	close(unblock)
+	if err := <-done; err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if resp, err := execute("Hello"); err != nil || resp.ID != "resp-1" {
+		t.Errorf("Expected the stored response to be replayed, got %v, %v", resp, err)
+	}
+	if _, err := execute("Something else"); !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Errorf("Expected ErrIdempotencyKeyReused for a different request, got %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("Expected 1 upstream call, got %d", got)
+	}
+}
+
+func TestManager_GetRoute_Patterns(t *testing.T) {
+	step := []config.RouteStep{{Provider: "provider1", Model: "gpt-4"}}
+	routes := []config.Route{
+		{Name: "gpt-*", Steps: step},
+		{Name: "gpt-4o-2024-*", Steps: step},
+		{Name: "gpt-4*", Steps: step},
+		{Name: "gpt-4o-2024-05-13", Steps: step},
+		{Name: "claude-?", Steps: step},
+		{Name: "claude-*", Steps: step},
+	}
+	manager := NewManager([]config.Provider{{Name: "provider1", APIKey: "key1", BaseURL: "http://example.com"}}, routes, logger.NewLogger())
+
+	tests := []struct {
+		model         string
+		expectedRoute string
+	}{
+		{model: "gpt-4o-2024-05-13", expectedRoute: "gpt-4o-2024-05-13"},
+		{model: "gpt-4o-2024-08-06", expectedRoute: "gpt-4o-2024-*"},
+		{model: "gpt-4-turbo", expectedRoute: "gpt-4*"},
+		{model: "gpt-3.5-turbo", expectedRoute: "gpt-*"},
+		// Equally specific patterns: first listed wins
+		{model: "claude-3", expectedRoute: "claude-?"},
+		{model: "claude-3-opus", expectedRoute: "claude-*"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			route, err := manager.GetRoute(tt.model)
+			if err != nil {
+				t.Fatalf("GetRoute(%s) error = %v", tt.model, err)
+			}
+			if route.Name != tt.expectedRoute {
+				t.Errorf("Expected route %s, got %s", tt.expectedRoute, route.Name)
+			}
+		})
+	}
+
+	if _, err := manager.GetRoute("llama-3"); err == nil {
+		t.Error("Expected no route for unmatched model")
+	}
+}
+
+func TestManager_GetRoute_Default(t *testing.T) {
+	step := []config.RouteStep{{Provider: "provider1", Model: "gpt-4"}}
+	providers := []config.Provider{{Name: "provider1", APIKey: "key1", BaseURL: "http://example.com"}}
+
+	tests := []struct {
+		name   string
+		routes []config.Route
+	}{
+		{
+			name:   "default flag",
+			routes: []config.Route{{Name: "fallback", Default: true, Steps: step}, {Name: "gpt-*", Steps: step}},
+		},
+		{
+			name:   "star name",
+			routes: []config.Route{{Name: "*", Steps: step}, {Name: "gpt-*", Steps: step}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := NewManager(providers, tt.routes, logger.NewLogger())
+
+			route, err := manager.GetRoute("gpt-4")
+			if err != nil || route.Name != "gpt-*" {
+				t.Errorf("Expected pattern route to win over default, got %v (err %v)", route, err)
+			}
+
+			route, err = manager.GetRoute("unconfigured-model")
+			if err != nil {
+				t.Fatalf("Expected default route for unconfigured model, got error: %v", err)
+			}
+			if route.Name != tt.routes[0].Name {
+				t.Errorf("Expected default route %s, got %s", tt.routes[0].Name, route.Name)
+			}
+		})
+	}
+}
+
+func TestManager_GetRoute_Disabled(t *testing.T) {
+	routes := []config.Route{
+		{Name: "gpt-4o", Disabled: true, Steps: []config.RouteStep{{Provider: "p", Model: "m"}}},
+		{Name: "gpt-*", Steps: []config.RouteStep{{Provider: "p", Model: "m"}}},
+		{Name: "*", Disabled: true, Steps: []config.RouteStep{{Provider: "p", Model: "m"}}},
+	}
+	manager := NewManager(nil, routes, logger.NewLogger())
+
+	route, err := manager.GetRoute("gpt-4o")
+	if err != nil || route.Name != "gpt-*" {
+		t.Errorf("Expected the disabled exact route to be passed over for the pattern, got %v, %v", route, err)
+	}
+	if _, err := manager.GetRoute("claude"); err == nil {
+		t.Error("Expected no route when the default route is disabled")
+	}
+}
+
+func TestManager_Reload(t *testing.T) {
+	providers := []config.Provider{{Name: "old", APIKey: "key", BaseURL: "http://old.example"}}
+	routes := []config.Route{{Name: "old-route", Steps: []config.RouteStep{{Provider: "old", Model: "m"}}}}
+	manager := NewManager(providers, routes, logger.NewLogger())
+
+	manager.Reload(
+		[]config.Provider{{Name: "new", APIKey: "key", BaseURL: "http://new.example"}},
+		[]config.Route{{Name: "new-route", Steps: []config.RouteStep{{Provider: "new", Model: "m"}}}},
+	)
+
+	if _, err := manager.GetRoute("old-route"); err == nil {
+		t.Error("Expected old route to be gone after reload")
+	}
+	route, err := manager.GetRoute("new-route")
+	if err != nil {
+		t.Fatalf("Expected new route after reload, got %v", err)
+	}
+	if route.Steps[0].Provider != "new" {
+		t.Errorf("Expected step provider 'new', got %s", route.Steps[0].Provider)
+	}
+	if got := manager.Routes(); len(got) != 1 || got[0].Name != "new-route" {
+		t.Errorf("Routes() = %v, want only new-route", got)
+	}
+}
+
+func TestManager_Execute_RequestTimeout(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		io.ReadAll(r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	providers := []config.Provider{
+		{Name: "provider1", APIKey: "key1", BaseURL: server.URL},
+	}
+	routes := []config.Route{
+		{
+			Name:           "test-model",
+			RequestTimeout: "100ms",
+			Steps: []config.RouteStep{
+				{Provider: "provider1", Model: "slow-1"},
+				{Provider: "provider1", Model: "slow-2"},
+				{Provider: "provider1", Model: "slow-3"},
+			},
+		},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"test-model","messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+
+	start := time.Now()
+	_, err := manager.Execute(request)
+	if !errors.Is(err, ErrRequestTimeout) {
+		t.Fatalf("Expected ErrRequestTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the route to be aborted near the 100ms request timeout, took %v", elapsed)
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("Expected remaining steps to be skipped after the timeout, got %d calls", got)
+	}
+}
+
+func TestManager_Execute_ReusesConnections(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"test-id","object":"chat.completion","choices":[]}`))
+	}))
+	var newConns atomic.Int32
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			newConns.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	providers := []config.Provider{{Name: "provider1", APIKey: "key1", BaseURL: server.URL}}
+	routes := []config.Route{
+		{Name: "test-model", Steps: []config.RouteStep{{Provider: "provider1", Model: "gpt-4"}}},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"test-model","messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := manager.Execute(request); err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+	}
+
+	if got := newConns.Load(); got != 1 {
+		t.Errorf("Expected sequential requests to share one connection, got %d connections", got)
+	}
+}
+
+func TestManager_ExecuteStream_OutlivesStepTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"Hi\"}}]}\n\n"))
+		w.(http.Flusher).Flush()
+		time.Sleep(150 * time.Millisecond)
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	providers := []config.Provider{{Name: "provider1", APIKey: "key1", BaseURL: server.URL}}
+	routes := []config.Route{
+		{Name: "stream-model", Steps: []config.RouteStep{{Provider: "provider1", Model: "gpt-4", Timeout: "50ms"}}},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"stream-model","stream":true,"messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+
+	stream, err := manager.ExecuteStreamWithTracing(context.Background(), request, "")
+	if err != nil {
+		t.Fatalf("ExecuteStreamWithTracing() error = %v", err)
+	}
+	defer stream.Close()
+
+	// The step timeout only covers the wait for the provider's answer
+	body, err := io.ReadAll(stream.Body)
+	if err != nil {
+		t.Fatalf("Failed to read stream: %v", err)
+	}
+	if !strings.HasSuffix(string(body), "data: [DONE]\n\n") {
+		t.Errorf("Expected stream to end with [DONE] terminator, got %q", string(body))
+	}
+}
+
+func TestManager_Execute_PinnedProvider(t *testing.T) {
+	var calls []string
+	newServer := func(name string, status int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls = append(calls, name)
+			w.WriteHeader(status)
+			w.Write([]byte(`{"id":"` + name + `","object":"chat.completion","choices":[]}`))
+		}))
+	}
+	first := newServer("first", http.StatusOK)
+	defer first.Close()
+	second := newServer("second", http.StatusInternalServerError)
+	defer second.Close()
+
+	providers := []config.Provider{
+		{Name: "first", APIKey: "key1", BaseURL: first.URL},
+		{Name: "second", APIKey: "key2", BaseURL: second.URL},
+	}
+	routes := []config.Route{
+		{
+			Name: "test-model",
+			Steps: []config.RouteStep{
+				{Provider: "first", Model: "m"},
+				{Provider: "second", Model: "m"},
+			},
+		},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"test-model","messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+	request.Headers = http.Header{}
+	request.Headers.Set(ProviderHeader, "second")
+
+	// The pinned step runs first and still falls back on failure
+	if _, err := manager.ExecuteWithTracing(context.Background(), request, ""); err != nil {
+		t.Fatalf("ExecuteWithTracing() error = %v", err)
+	}
+	if len(calls) != 2 || calls[0] != "second" || calls[1] != "first" {
+		t.Errorf("Expected calls [second first], got %v", calls)
+	}
+
+	calls = nil
+	request.Headers.Set(ProviderHeader, "unknown")
+	_, err := manager.ExecuteWithTracing(context.Background(), request, "")
+	if !errors.Is(err, ErrProviderNotInRoute) {
+		t.Errorf("Expected ErrProviderNotInRoute, got %v", err)
+	}
+	if len(calls) != 0 {
+		t.Errorf("Expected no upstream calls, got %v", calls)
+	}
+}
+
+func TestManager_ExecuteStream_StepSpan(t *testing.T) {
+	const events = "data: {\"choices\":[{\"delta\":{\"content\":\"Hi\"}}]}\n\ndata: [DONE]\n\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(events))
+	}))
+	defer server.Close()
+
+	providers := []config.Provider{{Name: "provider1", APIKey: "key1", BaseURL: server.URL}}
+	routes := []config.Route{
+		{Name: "stream-model", Steps: []config.RouteStep{{Provider: "provider1", Model: "gpt-4"}}},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+	recorder := tracetest.NewSpanRecorder()
+	manager.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"stream-model","stream":true,"messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+
+	stepSpan := func() sdktrace.ReadOnlySpan {
+		for _, span := range recorder.Ended() {
+			if strings.Contains(span.Name(), ".step.") {
+				return span
+			}
+		}
+		return nil
+	}
+
+	// Completed stream
+	stream, err := manager.ExecuteStreamWithTracing(context.Background(), request, "")
+	if err != nil {
+		t.Fatalf("ExecuteStreamWithTracing() error = %v", err)
+	}
+	if stepSpan() != nil {
+		t.Fatal("Expected the step span to stay open while streaming")
+	}
+	if _, err := io.ReadAll(stream.Body); err != nil {
+		t.Fatalf("Failed to read stream: %v", err)
+	}
+	stream.Close()
+
+	span := stepSpan()
+	if span == nil {
+		t.Fatal("Expected the step span to end with the stream")
+	}
+	attrs := make(map[string]interface{})
+	for _, kv := range span.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	if attrs["step.streamed"] != true {
+		t.Errorf("Expected step.streamed, got %v", attrs["step.streamed"])
+	}
+	if _, ok := attrs["step.ttfb_ms"]; !ok {
+		t.Error("Expected step.ttfb_ms to be recorded")
+	}
+	if attrs["step.bytes_streamed"] != int64(len(events)) {
+		t.Errorf("Expected step.bytes_streamed %d, got %v", len(events), attrs["step.bytes_streamed"])
+	}
+	if span.Status().Code != codes.Ok {
+		t.Errorf("Expected status Ok, got %v", span.Status())
+	}
+
+	// Stream closed by the client before the end
+	recorder = tracetest.NewSpanRecorder()
+	manager.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+	stream, err = manager.ExecuteStreamWithTracing(context.Background(), request, "")
+	if err != nil {
+		t.Fatalf("ExecuteStreamWithTracing() error = %v", err)
+	}
+	stream.Close()
+	if span := stepSpan(); span == nil || span.Status().Code != codes.Error {
+		t.Errorf("Expected an abandoned stream to end its span with an error status")
+	}
+}
+
+func TestManager_Execute_WeightedCanary(t *testing.T) {
+	var models []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string `json:"model"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		models = append(models, body.Model)
+		if body.Model == "gpt-5" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"test","choices":[]}`))
+	}))
+	defer server.Close()
+
+	// Both variants use the same provider, so only the step tells them apart
+	providers := []config.Provider{{Name: "provider1", APIKey: "key1", BaseURL: server.URL}}
+	routes := []config.Route{
+		{Name: "chat", Strategy: StrategyWeighted, Steps: []config.RouteStep{
+			{Provider: "provider1", Model: "gpt-4o", Weight: 90},
+			{Provider: "provider1", Model: "gpt-5", Weight: 10},
+		}},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+	manager.randIntN = func(n int) int { return 95 }
+	recorder := tracetest.NewSpanRecorder()
+	manager.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"chat","messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+	if _, err := manager.ExecuteWithTracing(context.Background(), request, ""); err != nil {
+		t.Fatalf("ExecuteWithTracing() error = %v", err)
+	}
+
+	// The canary step was picked first and its failure fell back to the other step
+	if len(models) != 2 || models[0] != "gpt-5" || models[1] != "gpt-4o" {
+		t.Errorf("Expected calls to gpt-5 then gpt-4o, got %v", models)
+	}
+	var attrs map[string]interface{}
+	for _, span := range recorder.Ended() {
+		if span.Name() == "route/chat" {
+			attrs = make(map[string]interface{})
+			for _, kv := range span.Attributes() {
+				attrs[string(kv.Key)] = kv.Value.AsInterface()
+			}
+		}
+	}
+	if attrs["route.selected_step"] != int64(1) || attrs["route.selected_model"] != "gpt-5" {
+		t.Errorf("Expected the canary step as the selected variant, got step %v model %v", attrs["route.selected_step"], attrs["route.selected_model"])
+	}
+}
+
+func TestManager_Execute_CanaryStep(t *testing.T) {
+	var models []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string `json:"model"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		models = append(models, body.Model)
+		if body.Model == "gpt-5" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"test","choices":[]}`))
+	}))
+	defer server.Close()
+
+	providers := []config.Provider{{Name: "provider1", APIKey: "key1", BaseURL: server.URL}}
+	routes := []config.Route{
+		{Name: "chat", Steps: []config.RouteStep{
+			{Provider: "provider1", Model: "gpt-5", Canary: 10},
+			{Provider: "provider1", Model: "gpt-4o"},
+		}},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+	recorder := tracetest.NewSpanRecorder()
+	manager.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"chat","messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+
+	tests := []struct {
+		roll     int
+		variant  string
+		expected []string
+	}{
+		// The canary's failure falls back to the stable step
+		{roll: 9, variant: CanaryVariantCanary, expected: []string{"gpt-5", "gpt-4o"}},
+		{roll: 10, variant: CanaryVariantStable, expected: []string{"gpt-4o"}},
+	}
+	for _, tt := range tests {
+		models = nil
+		recorder.Reset()
+		manager.randIntN = func(n int) int {
+			if n != 100 {
+				t.Fatalf("Expected a roll out of 100, got %d", n)
+			}
+			return tt.roll
+		}
+		if _, err := manager.ExecuteWithTracing(context.Background(), request, ""); err != nil {
+			t.Fatalf("ExecuteWithTracing() error = %v", err)
+		}
+		if !slices.Equal(models, tt.expected) {
+			t.Errorf("roll %d: expected calls to %v, got %v", tt.roll, tt.expected, models)
+		}
+		var variant interface{}
+		for _, span := range recorder.Ended() {
+			if span.Name() == "route/chat" {
+				for _, kv := range span.Attributes() {
+					if kv.Key == "route.canary_variant" {
+						variant = kv.Value.AsInterface()
+					}
+				}
+			}
+		}
+		if variant != tt.variant {
+			t.Errorf("roll %d: expected route.canary_variant %q, got %v", tt.roll, tt.variant, variant)
+		}
+	}
+}
+
+func TestManager_Execute_PreserveModel(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string `json:"model"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		received = body.Model
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"test","choices":[]}`))
+	}))
+	defer server.Close()
+
+	providers := []config.Provider{{Name: "provider1", APIKey: "key1", BaseURL: server.URL}}
+	routes := []config.Route{
+		{Name: "gpt-*", Steps: []config.RouteStep{{Provider: "provider1", PreserveModel: true}}},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"gpt-4o-mini","messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+	if _, err := manager.Execute(request); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if received != "gpt-4o-mini" {
+		t.Errorf("Expected the requested model to reach the provider, got %q", received)
+	}
+}
+
+func TestManager_Execute_UpstreamTime(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(30 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"test","choices":[]}`))
+	}))
+	defer server.Close()
+
+	providers := []config.Provider{{Name: "provider1", APIKey: "key1", BaseURL: server.URL}}
+	routes := []config.Route{
+		{Name: "model", Steps: []config.RouteStep{{Provider: "provider1", Model: "gpt-4"}}},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+	recorder := tracetest.NewSpanRecorder()
+	manager.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"model","messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+	if _, err := manager.Execute(request); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	var attrs map[string]interface{}
+	for _, span := range recorder.Ended() {
+		if strings.Contains(span.Name(), ".step.") {
+			attrs = make(map[string]interface{})
+			for _, kv := range span.Attributes() {
+				attrs[string(kv.Key)] = kv.Value.AsInterface()
+			}
+		}
+	}
+	upstream, _ := attrs["step.upstream_ms"].(int64)
+	total, _ := attrs["step.duration_ms"].(int64)
+	if upstream < 30 || upstream > total {
+		t.Errorf("Expected step.upstream_ms to cover the provider's 30ms and fit in step.duration_ms, got %d of %d", upstream, total)
+	}
+}
+
+func TestManager_Execute_NoChoicesFallsBack(t *testing.T) {
+	empty := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer empty.Close()
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"backup","choices":[{"index":0,"message":{"role":"assistant","content":"Hi"},"finish_reason":"stop"}]}`))
+	}))
+	defer backup.Close()
+
+	providers := []config.Provider{
+		{Name: "empty", APIKey: "key1", BaseURL: empty.URL},
+		{Name: "backup", APIKey: "key2", BaseURL: backup.URL},
+	}
+	routes := []config.Route{
+		{Name: "model", Steps: []config.RouteStep{
+			{Provider: "empty", Model: "gpt-4"},
+			{Provider: "backup", Model: "gpt-4"},
+		}},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"model","messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+	resp, err := manager.Execute(request)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if resp.ID != "backup" {
+		t.Errorf("Expected a response without choices to fall back, got %s", resp.ID)
+	}
+
+	// With require_choices off the empty response is passed through
+	manager.SetRequireChoices(false)
+	resp, err = manager.Execute(request)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if resp.ID != "" || string(resp.Raw) != `{}` {
+		t.Errorf("Expected the empty response to be returned, got %s", resp.Raw)
+	}
+}
+
+func TestManager_Execute_ResponseHeaderTimeout(t *testing.T) {
+	stalled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+		w.Write([]byte(`{"id":"stalled","choices":[]}`))
+	}))
+	defer stalled.Close()
+	// Headers arrive at once; the body takes longer than the header timeout
+	slowBody := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte(`{"id":"slow-body","choices":[]}`))
+	}))
+	defer slowBody.Close()
+
+	providers := []config.Provider{
+		{Name: "stalled", APIKey: "key1", BaseURL: stalled.URL},
+		{Name: "slow-body", APIKey: "key2", BaseURL: slowBody.URL},
+	}
+	routes := []config.Route{
+		{Name: "model", Steps: []config.RouteStep{
+			{Provider: "stalled", Model: "gpt-4", Timeout: "5s"},
+			{Provider: "slow-body", Model: "gpt-4", Timeout: "5s"},
+		}},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+	manager.SetTransportTimeouts(time.Second, 100*time.Millisecond)
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"model","messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+	start := time.Now()
+	resp, err := manager.Execute(request)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if resp.ID != "slow-body" {
+		t.Errorf("Expected the stalled provider to time out and the slow body to be read, got %s", resp.ID)
+	}
+	if elapsed := time.Since(start); elapsed >= 500*time.Millisecond {
+		t.Errorf("Expected the stalled provider to be abandoned after the header timeout, took %s", elapsed)
+	}
+}
+
+func TestManager_Execute_FailureSummary(t *testing.T) {
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"error":{"message":"overloaded"}}`))
+	}))
+	defer unavailable.Close()
+	limited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":{"message":"slow down"}}`))
+	}))
+	defer limited.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	down.Close()
+
+	providers := []config.Provider{
+		{Name: "unavailable", APIKey: "key1", BaseURL: unavailable.URL},
+		{Name: "limited", APIKey: "key2", BaseURL: limited.URL},
+		{Name: "down", APIKey: "key3", BaseURL: down.URL},
+	}
+	routes := []config.Route{
+		{Name: "chat", Steps: []config.RouteStep{
+			{Provider: "unavailable", Model: "gpt-4o"},
+			{Provider: "limited", Model: "gpt-4o"},
+			{Provider: "down", Model: "gpt-4o"},
+		}},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+	recorder := tracetest.NewSpanRecorder()
+	manager.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"chat","messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+	if _, err := manager.ExecuteWithTracing(context.Background(), request, ""); err == nil {
+		t.Fatal("Expected every step to fail")
+	}
+
+	attrs := make(map[string]interface{})
+	for _, span := range recorder.Ended() {
+		if span.Name() == "route/chat" {
+			for _, kv := range span.Attributes() {
+				attrs[string(kv.Key)] = kv.Value.AsInterface()
+			}
+		}
+	}
+	if attrs["route.failure.steps"] != int64(3) || attrs["route.failure.status_5xx"] != int64(1) ||
+		attrs["route.failure.status_4xx"] != int64(1) || attrs["route.failure.status_none"] != int64(1) {
+		t.Errorf("Expected one failure per status class, got %v", attrs)
+	}
+	if providers, _ := attrs["route.failure.providers"].([]string); len(providers) != 3 || providers[0] != "unavailable" || providers[2] != "down" {
+		t.Errorf("Expected the failed providers in order, got %v", attrs["route.failure.providers"])
+	}
+	if first, _ := attrs["route.failure.first_error"].(string); !strings.HasPrefix(first, "unavailable: ") || !strings.Contains(first, "503") {
+		t.Errorf("Expected the first error from the unavailable provider, got %q", first)
+	}
+	if last, _ := attrs["route.failure.last_error"].(string); !strings.HasPrefix(last, "down: ") {
+		t.Errorf("Expected the last error from the down provider, got %q", last)
+	}
+	if _, ok := attrs["route.duration_ms"]; !ok {
+		t.Error("Expected the route duration")
+	}
+}
+
+func TestManager_Execute_FallbackResponse(t *testing.T) {
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+	invalid := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer invalid.Close()
+
+	providers := []config.Provider{
+		{Name: "unavailable", APIKey: "key1", BaseURL: unavailable.URL},
+		{Name: "invalid", APIKey: "key2", BaseURL: invalid.URL},
+	}
+	routes := []config.Route{
+		{Name: "chat-*", FallbackResponse: "The assistant is temporarily unavailable.", Steps: []config.RouteStep{
+			{Provider: "unavailable", Model: "gpt-4o"},
+		}},
+		{Name: "strict", FallbackResponse: "Unavailable.", FallbackOn: []string{"5xx"}, Steps: []config.RouteStep{
+			{Provider: "invalid", Model: "gpt-4o"},
+			{Provider: "unavailable", Model: "gpt-4o"},
+		}},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"chat-mini","messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+	resp, err := manager.ExecuteWithTracing(context.Background(), request, "")
+	if err != nil {
+		t.Fatalf("Expected the fallback response, got error %v", err)
+	}
+	// The response names the requested model, not the route pattern
+	if resp.Object != "chat.completion" || resp.Model != "chat-mini" || len(resp.Choices) != 1 ||
+		resp.Choices[0].Message.ContentAsString() != "The assistant is temporarily unavailable." {
+		t.Errorf("Unexpected fallback response %s", resp.Raw)
+	}
+	if resp.Headers.Get(FallbackHeader) != "true" {
+		t.Errorf("Expected the %s header on the fallback response", FallbackHeader)
+	}
+
+	// An error that fallback_on stops at still reaches the client
+	request.Model = "strict"
+	if _, err := manager.ExecuteWithTracing(context.Background(), request, ""); err == nil {
+		t.Error("Expected the 400 that fallback_on does not cover to be returned")
+	}
+}
+
+func TestManager_Execute_PropagatesTraceContext(t *testing.T) {
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.Write([]byte(`{"id":"ok","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"Hi"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	providers := []config.Provider{{Name: "traced", APIKey: "key", BaseURL: server.URL}}
+	routes := []config.Route{{Name: "chat", Steps: []config.RouteStep{{Provider: "traced", Model: "gpt-4o"}}}}
+	manager := NewManager(providers, routes, logger.NewLogger())
+	recorder := tracetest.NewSpanRecorder()
+	manager.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"chat","messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+	if _, err := manager.ExecuteWithTracing(context.Background(), request, ""); err != nil {
+		t.Fatalf("ExecuteWithTracing() error = %v", err)
+	}
+
+	for _, span := range recorder.Ended() {
+		if span.Name() != "route.chat.step.0" {
+			continue
+		}
+		want := fmt.Sprintf("00-%s-%s-01", span.SpanContext().TraceID(), span.SpanContext().SpanID())
+		if traceparent != want {
+			t.Errorf("Expected the step span as traceparent %s, got %q", want, traceparent)
+		}
+		return
+	}
+	t.Fatal("Expected a step span")
+}
@@ -0,0 +1,42 @@
+package providers
+
+import (
+	"strings"
+)
+
+// isPattern reports whether a route name contains glob wildcards
+func isPattern(name string) bool {
+	return strings.ContainsAny(name, "*?")
+}
+
+// globMatch matches name against pattern where '*' matches any run of
+// characters (including '/') and '?' matches exactly one character
+func globMatch(pattern, name string) bool {
+	p, n := 0, 0
+	starP, starN := -1, 0
+	for n < len(name) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == name[n]):
+			p++
+			n++
+		case p < len(pattern) && pattern[p] == '*':
+			starP, starN = p, n
+			p++
+		case starP >= 0:
+			// Let the last '*' absorb one more character and retry
+			starN++
+			p, n = starP+1, starN
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// patternSpecificity ranks patterns by their number of literal characters
+func patternSpecificity(pattern string) int {
+	return len(pattern) - strings.Count(pattern, "*") - strings.Count(pattern, "?")
+}
@@ -0,0 +1,29 @@
+package providers
+
+import (
+	"testing"
+)
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"gpt-4*", "gpt-4", true},
+		{"gpt-4*", "gpt-4o-2024-08-06", true},
+		{"gpt-4*", "gpt-3.5-turbo", false},
+		{"*/free", "nvidia/nemotron/free", true},
+		{"gpt-?o", "gpt-4o", true},
+		{"gpt-?o", "gpt-40o", false},
+		{"*", "anything", true},
+		{"a*b*c", "axxbyyc", true},
+		{"a*b*c", "axxbyy", false},
+	}
+
+	for _, tt := range tests {
+		if got := globMatch(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("globMatch(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
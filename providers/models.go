@@ -0,0 +1,149 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"ai-gateway/config"
+	"ai-gateway/types"
+)
+
+// modelCatalog caches the model lists reported by each provider's /models
+// endpoint. A provider whose last fetch failed keeps its previous list.
+type modelCatalog struct {
+	mu     sync.RWMutex
+	models map[string][]types.Model // provider name -> models it reported
+}
+
+func newModelCatalog() *modelCatalog {
+	return &modelCatalog{models: make(map[string][]types.Model)}
+}
+
+// StartModelRefresh fetches every provider's model list now and again each
+// interval until ctx is cancelled, for UpstreamModels
+func (m *Manager) StartModelRefresh(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		m.refreshModels(ctx)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.refreshModels(ctx)
+			}
+		}
+	}()
+}
+
+// refreshModels fetches all enabled providers' model lists concurrently.
+// Providers removed or disabled by a reload are dropped from the catalog.
+func (m *Manager) refreshModels(ctx context.Context) {
+	providers, _ := m.snapshot()
+	var wg sync.WaitGroup
+	for _, providerCfg := range providers {
+		if providerCfg.Disabled {
+			continue
+		}
+		wg.Add(1)
+		go func(providerCfg config.Provider) {
+			defer wg.Done()
+
+			client := NewClient(providerCfg, m.logger)
+			client.client.Transport = m.transport.get(providerCfg)
+			models, err := client.ListModels(ctx)
+			if err != nil {
+				m.logger.Warn("Failed to list provider models", err, map[string]interface{}{"provider": providerCfg.Name})
+				return
+			}
+
+			m.models.mu.Lock()
+			m.models.models[providerCfg.Name] = models
+			m.models.mu.Unlock()
+		}(providerCfg)
+	}
+	wg.Wait()
+
+	m.models.mu.Lock()
+	for name := range m.models.models {
+		if provider, ok := providers[name]; !ok || provider.Disabled {
+			delete(m.models.models, name)
+		}
+	}
+	m.models.mu.Unlock()
+}
+
+// UpstreamModels returns the models the providers reported at their last
+// refresh, sorted by ID. A model offered by several providers is listed once,
+// from the first provider in name order; models without an owner are
+// attributed to their provider. It is empty until a list has been fetched.
+func (m *Manager) UpstreamModels() []types.Model {
+	m.models.mu.RLock()
+	defer m.models.mu.RUnlock()
+
+	names := make([]string, 0, len(m.models.models))
+	for name := range m.models.models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	seen := make(map[string]bool)
+	var models []types.Model
+	for _, name := range names {
+		for _, model := range m.models.models[name] {
+			if model.ID == "" || seen[model.ID] {
+				continue
+			}
+			seen[model.ID] = true
+			if model.Object == "" {
+				model.Object = "model"
+			}
+			if model.OwnedBy == "" {
+				model.OwnedBy = name
+			}
+			models = append(models, model)
+		}
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+	return models
+}
+
+// ValidateModels fetches the providers' model lists and describes each step
+// of an enabled route whose model its provider doesn't list, to catch typos
+// at startup. Providers whose list can't be fetched or is empty are skipped,
+// as are Azure providers, which are addressed by deployment, and
+// preserve_model steps.
+func (m *Manager) ValidateModels(ctx context.Context) []string {
+	m.refreshModels(ctx)
+	providers, routes := m.snapshot()
+
+	m.models.mu.RLock()
+	defer m.models.mu.RUnlock()
+	var problems []string
+	for _, route := range routes {
+		if route.Disabled {
+			continue
+		}
+		for i, step := range route.Steps {
+			listed := m.models.models[step.Provider]
+			if len(listed) == 0 || step.PreserveModel || providers[step.Provider].Type == config.ProviderTypeAzure {
+				continue
+			}
+			if !slices.ContainsFunc(listed, func(model types.Model) bool { return model.ID == step.Model }) {
+				problems = append(problems, fmt.Sprintf("route '%s' step[%d]: provider '%s' does not list model '%s'",
+					route.Name, i, step.Provider, step.Model))
+			}
+		}
+	}
+	return problems
+}
@@ -0,0 +1,96 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ai-gateway/config"
+	"ai-gateway/logger"
+)
+
+func TestManager_UpstreamModels(t *testing.T) {
+	listing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/models" || r.Header.Get("Authorization") != "Bearer key1" {
+			t.Errorf("Unexpected models request %s with %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		w.Write([]byte(`{"object":"list","data":[{"id":"gpt-4o","object":"model","owned_by":"openai"},{"id":"shared"}]}`))
+	}))
+	defer listing.Close()
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":[{"id":"shared"},{"id":"llama-3"}]}`))
+	}))
+	defer other.Close()
+	// Not every provider implements /models
+	missing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer missing.Close()
+
+	providers := []config.Provider{
+		{Name: "a", APIKey: "key1", BaseURL: listing.URL},
+		{Name: "b", APIKey: "key2", BaseURL: other.URL},
+		{Name: "c", APIKey: "key3", BaseURL: missing.URL},
+	}
+	manager := NewManager(providers, nil, logger.NewLogger())
+	if models := manager.UpstreamModels(); len(models) != 0 {
+		t.Fatalf("Expected no models before a refresh, got %v", models)
+	}
+
+	manager.refreshModels(context.Background())
+	models := manager.UpstreamModels()
+	want := []struct{ id, owner string }{
+		{"gpt-4o", "openai"},
+		{"llama-3", "b"},
+		{"shared", "a"},
+	}
+	if len(models) != len(want) {
+		t.Fatalf("Expected %d models, got %+v", len(want), models)
+	}
+	for i, w := range want {
+		if models[i].ID != w.id || models[i].OwnedBy != w.owner || models[i].Object != "model" {
+			t.Errorf("Expected model %s owned by %s, got %+v", w.id, w.owner, models[i])
+		}
+	}
+
+	// A failed refresh keeps the last list
+	listing.Close()
+	manager.refreshModels(context.Background())
+	if got := manager.UpstreamModels(); len(got) != len(want) {
+		t.Errorf("Expected the cached list to survive a failed refresh, got %+v", got)
+	}
+}
+
+func TestManager_ValidateModels(t *testing.T) {
+	listing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":[{"id":"gpt-4o"},{"id":"gpt-4o-mini"}]}`))
+	}))
+	defer listing.Close()
+	missing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer missing.Close()
+
+	providers := []config.Provider{
+		{Name: "openai", APIKey: "key1", BaseURL: listing.URL},
+		{Name: "no-models", APIKey: "key2", BaseURL: missing.URL},
+	}
+	routes := []config.Route{
+		{Name: "chat", Steps: []config.RouteStep{
+			{Provider: "openai", Model: "gpt-4o"},
+			{Provider: "openai", Model: "gpt-4o-mnii"},
+			// Not checked: the provider has no model list
+			{Provider: "no-models", Model: "anything"},
+			{Provider: "openai", PreserveModel: true},
+		}},
+		{Name: "off", Disabled: true, Steps: []config.RouteStep{{Provider: "openai", Model: "typo"}}},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+
+	problems := manager.ValidateModels(context.Background())
+	want := "route 'chat' step[1]: provider 'openai' does not list model 'gpt-4o-mnii'"
+	if len(problems) != 1 || problems[0] != want {
+		t.Errorf("Expected only %q, got %v", want, problems)
+	}
+}
@@ -0,0 +1,119 @@
+package providers
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"ai-gateway/config"
+)
+
+// rateLimits holds the request and token buckets of providers with
+// rate_limit_rpm or rate_limit_tpm set. Buckets are keyed by provider name so
+// the limit covers every route and request using the provider.
+type rateLimits struct {
+	mu      sync.Mutex
+	buckets map[string]*providerBuckets
+	now     func() time.Time
+}
+
+// providerBuckets meters one provider. A bucket's level may go negative: a
+// request that waits for capacity reserves it up front, so later requests
+// queue behind it.
+type providerBuckets struct {
+	rpm, tpm int
+	requests rateBucket
+	tokens   rateBucket
+}
+
+type rateBucket struct {
+	level float64
+	last  time.Time
+}
+
+func newRateLimits() *rateLimits {
+	return &rateLimits{buckets: make(map[string]*providerBuckets), now: time.Now}
+}
+
+// reserve takes one request and the estimated tokens from the provider's
+// buckets. It returns how long the caller must wait before sending, or false
+// without taking anything when that wait would be longer than maxWait.
+// Providers without rate limits never wait.
+func (l *rateLimits) reserve(provider config.Provider, tokens int, maxWait time.Duration) (time.Duration, bool) {
+	if provider.RateLimitRPM <= 0 && provider.RateLimitTPM <= 0 {
+		return 0, true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[provider.Name]
+	if !ok || b.rpm != provider.RateLimitRPM || b.tpm != provider.RateLimitTPM {
+		// New provider, or a reload changed its limits: start with full buckets
+		b = &providerBuckets{
+			rpm:      provider.RateLimitRPM,
+			tpm:      provider.RateLimitTPM,
+			requests: rateBucket{level: float64(provider.RateLimitRPM), last: now},
+			tokens:   rateBucket{level: float64(provider.RateLimitTPM), last: now},
+		}
+		l.buckets[provider.Name] = b
+	}
+
+	// A request larger than the whole bucket only has to wait for a full one
+	tokens = min(tokens, b.tpm)
+	wait := max(b.requests.waitFor(1, b.rpm, now), b.tokens.waitFor(tokens, b.tpm, now))
+	if wait > maxWait {
+		return wait, false
+	}
+	if b.rpm > 0 {
+		b.requests.level--
+	}
+	if b.tpm > 0 {
+		b.tokens.level -= float64(tokens)
+	}
+	return wait, true
+}
+
+// refund gives back a reservation whose step was skipped before calling the
+// provider, so skipped steps don't use up its rate limit
+func (l *rateLimits) refund(provider config.Provider, tokens int) {
+	if provider.RateLimitRPM <= 0 && provider.RateLimitTPM <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[provider.Name]
+	if !ok || b.rpm != provider.RateLimitRPM || b.tpm != provider.RateLimitTPM {
+		return
+	}
+	if b.rpm > 0 {
+		b.requests.level = math.Min(float64(b.rpm), b.requests.level+1)
+	}
+	if b.tpm > 0 {
+		b.tokens.level = math.Min(float64(b.tpm), b.tokens.level+float64(min(tokens, b.tpm)))
+	}
+}
+
+// waitFor refills the bucket for the time elapsed and returns how long until
+// it holds n, for a bucket of perMinute capacity refilled at that rate
+func (b *rateBucket) waitFor(n, perMinute int, now time.Time) time.Duration {
+	if perMinute <= 0 {
+		return 0
+	}
+	rate := float64(perMinute) / 60 // per second
+	b.level = math.Min(float64(perMinute), b.level+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if missing := float64(n) - b.level; missing > 0 {
+		return time.Duration(missing / rate * float64(time.Second))
+	}
+	return 0
+}
+
+// estimateTokens roughly estimates a request's tokens from its JSON size,
+// at about four bytes per token
+func estimateTokens(raw []byte) int {
+	return (len(raw) + 3) / 4
+}
@@ -0,0 +1,187 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ai-gateway/config"
+	"ai-gateway/logger"
+	"ai-gateway/types"
+)
+
+func TestRateLimits_Requests(t *testing.T) {
+	l := newRateLimits()
+	now := time.Unix(0, 0)
+	l.now = func() time.Time { return now }
+	provider := config.Provider{Name: "p", RateLimitRPM: 2}
+
+	for i := 0; i < 2; i++ {
+		if wait, ok := l.reserve(provider, 0, 0); !ok || wait != 0 {
+			t.Fatalf("request %d: expected the burst to pass without waiting, got wait=%v ok=%v", i, wait, ok)
+		}
+	}
+
+	// One request refills every 30s; a shorter allowed wait falls back
+	if wait, ok := l.reserve(provider, 0, time.Second); ok || wait != 30*time.Second {
+		t.Errorf("Expected to fall back with a 30s wait, got wait=%v ok=%v", wait, ok)
+	}
+	if wait, ok := l.reserve(provider, 0, time.Minute); !ok || wait != 30*time.Second {
+		t.Errorf("Expected to wait 30s, got wait=%v ok=%v", wait, ok)
+	}
+	// The reservation above queues the next request behind it
+	if wait, _ := l.reserve(provider, 0, 0); wait != time.Minute {
+		t.Errorf("Expected the next request to wait a minute, got %v", wait)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if wait, ok := l.reserve(provider, 0, 0); !ok || wait != 0 {
+		t.Errorf("Expected capacity after the buckets refilled, got wait=%v ok=%v", wait, ok)
+	}
+
+	if _, ok := l.reserve(config.Provider{Name: "unlimited"}, 1000, 0); !ok {
+		t.Error("Expected providers without rate limits to be unlimited")
+	}
+}
+
+func TestRateLimits_Tokens(t *testing.T) {
+	l := newRateLimits()
+	now := time.Unix(0, 0)
+	l.now = func() time.Time { return now }
+	provider := config.Provider{Name: "p", RateLimitTPM: 600}
+
+	if _, ok := l.reserve(provider, 500, 0); !ok {
+		t.Fatal("Expected the first request to fit the token bucket")
+	}
+	// 100 tokens left, 400 missing at 10 tokens per second
+	if wait, ok := l.reserve(provider, 500, 0); ok || wait != 40*time.Second {
+		t.Errorf("Expected to fall back with a 40s wait, got wait=%v ok=%v", wait, ok)
+	}
+
+	// A request larger than the bucket waits for a full one instead of forever
+	now = now.Add(time.Minute)
+	if wait, ok := l.reserve(provider, 10000, 0); !ok || wait != 0 {
+		t.Errorf("Expected an oversized request to pass on a full bucket, got wait=%v ok=%v", wait, ok)
+	}
+}
+
+func TestRateLimits_Refund(t *testing.T) {
+	l := newRateLimits()
+	now := time.Unix(0, 0)
+	l.now = func() time.Time { return now }
+	provider := config.Provider{Name: "p", RateLimitRPM: 1, RateLimitTPM: 600}
+
+	if _, ok := l.reserve(provider, 500, 0); !ok {
+		t.Fatal("Expected the first request to pass")
+	}
+	l.refund(provider, 500)
+	if wait, ok := l.reserve(provider, 500, 0); !ok || wait != 0 {
+		t.Errorf("Expected the refunded capacity to be available again, got wait=%v ok=%v", wait, ok)
+	}
+}
+
+func TestManager_Execute_RateLimitedProviderFallsBack(t *testing.T) {
+	var calls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"test","choices":[]}`))
+	}))
+	defer server.Close()
+
+	providers := []config.Provider{
+		{Name: "limited", APIKey: "key1", BaseURL: server.URL, RateLimitRPM: 1, OnSaturation: config.SaturationFallback},
+		{Name: "backup", APIKey: "key2", BaseURL: server.URL},
+	}
+	routes := []config.Route{
+		{Name: "model", Steps: []config.RouteStep{
+			{Provider: "limited", Model: "gpt-4"},
+			{Provider: "backup", Model: "gpt-4"},
+		}},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"model","messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := manager.Execute(request); err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+	}
+
+	if len(calls) != 2 || calls[0] != "Bearer key1" || calls[1] != "Bearer key2" {
+		t.Errorf("Expected the second request to fall back to the backup provider, got %v", calls)
+	}
+}
+
+func TestManager_Execute_RateLimitSkips(t *testing.T) {
+	failing := true
+	var calls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Header.Get("Authorization"))
+		if failing && r.Header.Get("Authorization") == "Bearer key1" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"test","choices":[]}`))
+	}))
+	defer server.Close()
+
+	providers := []config.Provider{
+		{Name: "limited", APIKey: "key1", BaseURL: server.URL, RateLimitRPM: 1, MaxConcurrency: 1, OnSaturation: config.SaturationFallback},
+		{Name: "backup", APIKey: "key2", BaseURL: server.URL},
+	}
+	routes := []config.Route{
+		{Name: "model", Steps: []config.RouteStep{
+			{Provider: "limited", Model: "gpt-4"},
+			{Provider: "backup", Model: "gpt-4"},
+		}},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+	manager.SetCircuitBreaker(1, 0, time.Minute)
+	now := time.Now()
+	manager.breakers.now = func() time.Time { return now }
+	manager.throttle.now = func() time.Time { return now }
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"model","messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+	execute := func() string {
+		calls = nil
+		if _, err := manager.Execute(request); err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+		return calls[len(calls)-1]
+	}
+
+	// The failure opens the circuit and uses the minute's only request
+	execute()
+
+	// After the cooldown the half-open trial goes to a request skipped by the rate limit
+	now = now.Add(90 * time.Second)
+	manager.throttle.reserve(providers[0], 0, 0)
+	if got := execute(); got != "Bearer key2" {
+		t.Fatalf("Expected the rate limited provider to be skipped, got %s", got)
+	}
+
+	// A step skipped as saturated gives its reservation back
+	now = now.Add(2 * time.Minute)
+	release, _, _ := manager.limits.acquire(context.Background(), providers[0])
+	if got := execute(); got != "Bearer key2" {
+		t.Fatalf("Expected the saturated provider to be skipped, got %s", got)
+	}
+	release()
+
+	// So the recovered provider still has its request for the minute and the circuit trial
+	failing = false
+	if got := execute(); got != "Bearer key1" {
+		t.Errorf("Expected the recovered provider to serve, got %s", got)
+	}
+}
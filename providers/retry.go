@@ -0,0 +1,105 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"ai-gateway/config"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxRetryDelay caps the wait between retries; a longer Retry-After fails the step instead
+const maxRetryDelay = 30 * time.Second
+
+// isRetryable reports whether err is a transient provider failure worth retrying
+func isRetryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusInternalServerError,
+			http.StatusBadGateway, http.StatusServiceUnavailable:
+			return true
+		}
+		return false
+	}
+
+	if errors.Is(err, errNoChoices) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// retryDelay returns the wait before the given retry (1-based), honoring Retry-After on 429 and 503
+func retryDelay(base time.Duration, retry int, err error) time.Duration {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 &&
+		(statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode == http.StatusServiceUnavailable) {
+		return statusErr.RetryAfter
+	}
+	return base << (retry - 1)
+}
+
+// attemptWithRetry runs call and retries transient failures up to step.Retries times
+// with exponential backoff, recording each retry as an event on the step span.
+// Retries stop early once the route's attempt budget is spent.
+func attemptWithRetry(ctx context.Context, step config.RouteStep, stepSpan trace.Span, budget *attemptBudget, call func() (map[string]interface{}, error)) (map[string]interface{}, error) {
+	fields, err := call()
+	for retry := 1; err != nil && retry <= step.Retries && isRetryable(err); retry++ {
+		delay := retryDelay(step.GetBackoff(), retry, err)
+		if delay > maxRetryDelay {
+			break
+		}
+		if !budget.take() {
+			stepSpan.AddEvent("step.retry_budget_exhausted")
+			break
+		}
+
+		stepSpan.AddEvent("step.retry", trace.WithAttributes(
+			attribute.Int("retry.attempt", retry),
+			attribute.Int64("retry.delay_ms", delay.Milliseconds()),
+			attribute.String("retry.reason", err.Error()),
+		))
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+
+		fields, err = call()
+	}
+	return fields, err
+}
+
+// attemptBudget caps the upstream calls one request may make across all of its
+// route steps and their retries. A zero max leaves the count unlimited.
+type attemptBudget struct {
+	max  int32
+	used atomic.Int32
+}
+
+// take reserves one upstream call, reporting false when the budget is spent
+func (b *attemptBudget) take() bool {
+	for {
+		used := b.used.Load()
+		if b.max > 0 && used >= b.max {
+			return false
+		}
+		if b.used.CompareAndSwap(used, used+1) {
+			return true
+		}
+	}
+}
+
+// exhausted reports whether no upstream calls are left
+func (b *attemptBudget) exhausted() bool {
+	return b.max > 0 && b.used.Load() >= b.max
+}
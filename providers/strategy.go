@@ -0,0 +1,144 @@
+package providers
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+
+	"ai-gateway/config"
+)
+
+// Route strategies
+const (
+	StrategySequential = "sequential"
+	StrategyWeighted   = "weighted"
+	StrategyHedge      = "hedge"   // races the first two steps, see hedgeSteps
+	StrategyLatency    = "latency" // fastest provider first, see latencyOrder
+)
+
+// Canary variants recorded on the route span of routes with a canary step
+const (
+	CanaryVariantCanary = "canary"
+	CanaryVariantStable = "stable"
+)
+
+// ProviderHeader lets a client pin the provider a route starts with, e.g. for A/B tests
+const ProviderHeader = "X-Gateway-Provider"
+
+// stepOrder returns the order in which route steps are tried and a short
+// explanation of how the first step was chosen, for tracing
+func (m *Manager) stepOrder(route *config.Route) ([]int, string) {
+	order := make([]int, len(route.Steps))
+	for i := range order {
+		order[i] = i
+	}
+
+	switch route.Strategy {
+	case StrategyWeighted:
+		first, reason := m.pickWeighted(route.Steps)
+		return moveToFront(order, first), reason
+	case StrategyHedge:
+		return order, "hedge: first step, second after the hedge delay"
+	case StrategyLatency:
+		return m.latencyOrder(route.Steps)
+	default:
+		return order, "sequential order"
+	}
+}
+
+// pickWeighted chooses a step index with probability proportional to its weight.
+// When no step has a positive weight every step is equally likely.
+func (m *Manager) pickWeighted(steps []config.RouteStep) (int, string) {
+	total := 0
+	for _, step := range steps {
+		total += step.Weight
+	}
+	if total == 0 {
+		i := m.randIntN(len(steps))
+		return i, fmt.Sprintf("weighted: no weights set, picked uniformly 1 of %d", len(steps))
+	}
+
+	n := m.randIntN(total)
+	for i, step := range steps {
+		if n < step.Weight {
+			return i, fmt.Sprintf("weighted: weight %d of %d", step.Weight, total)
+		}
+		n -= step.Weight
+	}
+	return 0, "weighted: fallback to first step"
+}
+
+// latencyOrder sorts the steps by their provider's moving average latency,
+// fastest first. Providers without a successful call yet go first, in
+// configured order, so every provider gets measured; ties keep configured order.
+func (m *Manager) latencyOrder(steps []config.RouteStep) ([]int, string) {
+	latencies := make([]int64, len(steps))
+	order := make([]int, len(steps))
+	for i, step := range steps {
+		order[i] = i
+		if latency, ok := m.latency.get(step.Provider); ok {
+			latencies[i] = int64(latency)
+		} else {
+			latencies[i] = -1
+		}
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(latencies[a], latencies[b])
+	})
+
+	first := order[0]
+	if latencies[first] < 0 {
+		return order, fmt.Sprintf("latency: %s has no latency recorded yet", steps[first].Provider)
+	}
+	return order, fmt.Sprintf("latency: %s averages %dms", steps[first].Provider, time.Duration(latencies[first]).Milliseconds())
+}
+
+// applyCanary moves the route's canary step to the front of order for its
+// percentage of requests and to the back for the rest, returning the variant
+// the request got, or "" when the route has no canary step
+func (m *Manager) applyCanary(route *config.Route, order []int) ([]int, string) {
+	for i, step := range route.Steps {
+		if step.Canary <= 0 {
+			continue
+		}
+		if m.randIntN(100) < step.Canary {
+			return moveToFront(order, i), CanaryVariantCanary
+		}
+		return moveToBack(order, i), CanaryVariantStable
+	}
+	return order, ""
+}
+
+// moveToFront returns order with the given index first and the rest in configured order
+func moveToFront(order []int, index int) []int {
+	result := make([]int, 0, len(order))
+	result = append(result, index)
+	for _, i := range order {
+		if i != index {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+// moveToBack returns order with the given index last and the rest in configured order
+func moveToBack(order []int, index int) []int {
+	result := make([]int, 0, len(order))
+	for _, i := range order {
+		if i != index {
+			result = append(result, i)
+		}
+	}
+	return append(result, index)
+}
+
+// stepForProvider returns the index of the route's first step using the provider, or -1
+func stepForProvider(route *config.Route, provider string) int {
+	for i, step := range route.Steps {
+		if step.Provider == provider {
+			return i
+		}
+	}
+	return -1
+}
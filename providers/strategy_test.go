@@ -0,0 +1,107 @@
+package providers
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"ai-gateway/config"
+	"ai-gateway/logger"
+)
+
+func TestStepOrder_Weighted(t *testing.T) {
+	manager := NewManager(nil, nil, logger.NewLogger())
+	route := &config.Route{
+		Name:     "weighted",
+		Strategy: StrategyWeighted,
+		Steps: []config.RouteStep{
+			{Provider: "a", Model: "m", Weight: 1},
+			{Provider: "b", Model: "m", Weight: 3},
+			{Provider: "c", Model: "m", Weight: 0},
+		},
+	}
+
+	tests := []struct {
+		roll     int
+		expected []int
+	}{
+		{roll: 0, expected: []int{0, 1, 2}},
+		{roll: 1, expected: []int{1, 0, 2}},
+		{roll: 3, expected: []int{1, 0, 2}},
+	}
+
+	for _, tt := range tests {
+		manager.randIntN = func(n int) int {
+			if n != 4 {
+				t.Fatalf("Expected total weight 4, got %d", n)
+			}
+			return tt.roll
+		}
+		order, reason := manager.stepOrder(route)
+		if len(order) != len(tt.expected) {
+			t.Fatalf("Expected order %v, got %v", tt.expected, order)
+		}
+		for i := range order {
+			if order[i] != tt.expected[i] {
+				t.Errorf("roll %d: expected order %v, got %v (%s)", tt.roll, tt.expected, order, reason)
+				break
+			}
+		}
+	}
+}
+
+func TestStepOrder_Sequential(t *testing.T) {
+	manager := NewManager(nil, nil, logger.NewLogger())
+	route := &config.Route{
+		Name: "sequential",
+		Steps: []config.RouteStep{
+			{Provider: "a", Model: "m", Weight: 5},
+			{Provider: "b", Model: "m"},
+		},
+	}
+
+	order, _ := manager.stepOrder(route)
+	if len(order) != 2 || order[0] != 0 || order[1] != 1 {
+		t.Errorf("Expected sequential order [0 1], got %v", order)
+	}
+}
+
+func TestStepOrder_Latency(t *testing.T) {
+	manager := NewManager(nil, nil, logger.NewLogger())
+	route := &config.Route{
+		Name:     "latency",
+		Strategy: StrategyLatency,
+		Steps: []config.RouteStep{
+			{Provider: "a", Model: "m"},
+			{Provider: "b", Model: "m"},
+			{Provider: "c", Model: "m"},
+		},
+	}
+
+	// Unmeasured providers are tried first so they get a latency
+	manager.latency.record("a", 300*time.Millisecond)
+	order, reason := manager.stepOrder(route)
+	if want := []int{1, 2, 0}; !slices.Equal(order, want) {
+		t.Errorf("Expected order %v, got %v", want, order)
+	}
+	if !strings.Contains(reason, "no latency") {
+		t.Errorf("Expected reason to mention the missing latency, got %q", reason)
+	}
+
+	manager.latency.record("b", 500*time.Millisecond)
+	manager.latency.record("c", 100*time.Millisecond)
+	order, _ = manager.stepOrder(route)
+	if want := []int{2, 0, 1}; !slices.Equal(order, want) {
+		t.Errorf("Expected order %v, got %v", want, order)
+	}
+
+	// The average follows a provider that slows down
+	for range 5 {
+		manager.latency.record("c", time.Second)
+	}
+	order, reason = manager.stepOrder(route)
+	if want := []int{0, 1, 2}; !slices.Equal(order, want) {
+		t.Errorf("Expected order %v after c slowed down, got %v (%s)", want, order, reason)
+	}
+}
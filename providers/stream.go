@@ -0,0 +1,159 @@
+package providers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"ai-gateway/types"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Stream is an upstream server-sent events body proxied to the client as-is
+type Stream struct {
+	Body        io.ReadCloser
+	ContentType string
+	Headers     http.Header // upstream headers selected by response_headers
+	Provider    string      // provider that serves the stream
+	cancel      func()      // releases the stream's request context, may be nil
+}
+
+// Close releases the upstream connection
+func (s *Stream) Close() error {
+	err := s.Body.Close()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	return err
+}
+
+// usageReader passes a stream body through unchanged while watching its
+// "data:" events for the usage object OpenAI sends in the final chunk when
+// stream_options.include_usage is set. Only the current line is buffered.
+// done is called once, at EOF or Close, with the usage if one was seen.
+type usageReader struct {
+	body  io.ReadCloser
+	line  []byte
+	usage *types.Usage
+	once  sync.Once
+	done  func(usage *types.Usage)
+}
+
+func newUsageReader(body io.ReadCloser, done func(usage *types.Usage)) *usageReader {
+	return &usageReader{body: body, done: done}
+}
+
+func (r *usageReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	r.scan(p[:n])
+	if err == io.EOF {
+		r.scanLine(r.line)
+		r.line = nil
+		r.finish()
+	}
+	return n, err
+}
+
+func (r *usageReader) Close() error {
+	r.finish()
+	return r.body.Close()
+}
+
+func (r *usageReader) finish() {
+	r.once.Do(func() { r.done(r.usage) })
+}
+
+// scan feeds chunk into the line buffer and inspects every completed line
+func (r *usageReader) scan(chunk []byte) {
+	for len(chunk) > 0 {
+		i := bytes.IndexByte(chunk, '\n')
+		if i < 0 {
+			r.line = append(r.line, chunk...)
+			return
+		}
+		if len(r.line) > 0 {
+			r.line = append(r.line, chunk[:i]...)
+			r.scanLine(r.line)
+			r.line = r.line[:0]
+		} else {
+			r.scanLine(chunk[:i])
+		}
+		chunk = chunk[i+1:]
+	}
+}
+
+// scanLine records the usage from a "data:" event that carries one
+func (r *usageReader) scanLine(line []byte) {
+	data, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+	if !ok || !bytes.Contains(data, []byte(`"usage"`)) {
+		return
+	}
+	var chunk struct {
+		Usage *types.Usage `json:"usage"`
+	}
+	if err := json.Unmarshal(bytes.TrimSpace(data), &chunk); err == nil && chunk.Usage != nil {
+		r.usage = chunk.Usage
+	}
+}
+
+// tracedBody records a stream's progress on the step span that started it and
+// ends the span when the stream is finished: at EOF, on a read error, or when
+// it is closed early because the client went away.
+type tracedBody struct {
+	body      io.ReadCloser
+	span      trace.Span
+	start     time.Time // when the step called the provider
+	bytes     int64
+	firstByte bool
+	once      sync.Once
+}
+
+func newTracedBody(body io.ReadCloser, span trace.Span, start time.Time) *tracedBody {
+	return &tracedBody{body: body, span: span, start: start}
+}
+
+func (b *tracedBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if n > 0 && !b.firstByte {
+		b.firstByte = true
+		b.span.SetAttributes(attribute.Int64("step.ttfb_ms", time.Since(b.start).Milliseconds()))
+	}
+	b.bytes += int64(n)
+	if err != nil {
+		b.finish(err)
+	}
+	return n, err
+}
+
+func (b *tracedBody) Close() error {
+	b.finish(errStreamClosed)
+	return b.body.Close()
+}
+
+// errStreamClosed marks a stream closed before the provider finished it
+var errStreamClosed = errors.New("stream closed before completion")
+
+// finish sets the span status from how the stream ended and ends the span
+func (b *tracedBody) finish(err error) {
+	b.once.Do(func() {
+		b.span.SetAttributes(attribute.Int64("step.bytes_streamed", b.bytes))
+		switch {
+		case err == io.EOF:
+			b.span.SetStatus(codes.Ok, "stream completed")
+		case errors.Is(err, errStreamClosed):
+			b.span.AddEvent("stream.client_disconnected")
+			b.span.SetStatus(codes.Error, err.Error())
+		default:
+			b.span.RecordError(err)
+			b.span.SetStatus(codes.Error, "stream interrupted")
+		}
+		b.span.End()
+	})
+}
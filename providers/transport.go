@@ -0,0 +1,89 @@
+package providers
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"ai-gateway/config"
+)
+
+// maxIdleConnsPerHost keeps enough warm connections per provider for
+// concurrent requests; net/http's default of 2 forces new TLS handshakes under load
+const maxIdleConnsPerHost = 32
+
+// transportPool holds one pooled transport per proxy URL and TLS setup.
+// Clients are created for every request, so sharing transports is what lets
+// connections be reused.
+type transportPool struct {
+	mu         sync.Mutex
+	transports map[transportKey]*http.Transport
+	timeouts   transportTimeouts
+}
+
+// transportKey identifies the provider settings a transport is built from
+type transportKey struct {
+	proxyURL                  string // "" for none
+	clientCert, clientKey, ca string // mutual TLS files, "" for none
+	insecure                  bool
+}
+
+// transportTimeouts bound the connection phases of upstream requests, so a
+// dead provider fails fast while a slow generation can still take the whole
+// step timeout. Zero values keep net/http's defaults.
+type transportTimeouts struct {
+	dial           time.Duration
+	responseHeader time.Duration
+}
+
+func newTransportPool() *transportPool {
+	return &transportPool{transports: make(map[transportKey]*http.Transport)}
+}
+
+// defaultTransports serves clients created outside a Manager
+var defaultTransports = newTransportPool()
+
+// get returns the transport for the provider's proxy URL and TLS files,
+// creating it on first use
+func (p *transportPool) get(provider config.Provider) *http.Transport {
+	key := transportKey{
+		proxyURL:   provider.ProxyURL,
+		clientCert: provider.TLSClientCert,
+		clientKey:  provider.TLSClientKey,
+		ca:         provider.TLSCA,
+		insecure:   provider.InsecureSkipVerify,
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t, ok := p.transports[key]
+	if !ok {
+		t = newTransport(provider, p.timeouts)
+		p.transports[key] = t
+	}
+	return t
+}
+
+// newTransport builds a keep-alive transport from http.DefaultTransport's
+// settings. Without a proxy URL it honors HTTP_PROXY, HTTPS_PROXY and NO_PROXY.
+func newTransport(provider config.Provider, timeouts transportTimeouts) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	if timeouts.dial > 0 {
+		// With a proxy this bounds connecting to the proxy
+		t.DialContext = (&net.Dialer{Timeout: timeouts.dial, KeepAlive: 30 * time.Second}).DialContext
+	}
+	t.ResponseHeaderTimeout = timeouts.responseHeader
+	if provider.ProxyURL != "" {
+		// The config validates proxy_url, so a parse error only happens for hand-built configs
+		if u, err := url.Parse(provider.ProxyURL); err == nil {
+			t.Proxy = http.ProxyURL(u)
+		}
+	}
+	// Likewise the TLS files were checked by the config validation
+	if tlsConfig, err := provider.TLSConfig(); err == nil && tlsConfig != nil {
+		t.TLSClientConfig = tlsConfig
+	}
+	return t
+}
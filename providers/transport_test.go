@@ -0,0 +1,122 @@
+package providers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ai-gateway/config"
+	"ai-gateway/logger"
+	"ai-gateway/types"
+)
+
+// writeClientCert writes a self-signed client certificate and its key as PEM
+// files and returns their paths and the parsed certificate
+func writeClientCert(t *testing.T, dir string) (string, string, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ai-gateway"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile, cert
+}
+
+func TestClient_Call_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, clientCert := writeClientCert(t, dir)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"mtls","choices":[]}`))
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	// The provider's certificate is trusted through tls_ca
+	caFile := filepath.Join(dir, "ca.pem")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"chat","messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+	step := config.RouteStep{Provider: "self-hosted", Model: "llama"}
+
+	cfg := config.Provider{Name: "self-hosted", APIKey: "key", BaseURL: server.URL, TLSCA: caFile}
+	if _, err := NewClientWithRouteStep(cfg, step, logger.NewLogger()).Call(request); err == nil {
+		t.Error("Expected the server to refuse a connection without a client certificate")
+	}
+
+	cfg.TLSClientCert, cfg.TLSClientKey = certFile, keyFile
+	resp, err := NewClientWithRouteStep(cfg, step, logger.NewLogger()).Call(request)
+	if err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+	if resp.ID != "mtls" {
+		t.Errorf("Expected the mutual TLS provider's response, got %s", resp.ID)
+	}
+}
+
+func TestClient_Call_InsecureSkipVerify(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"self-signed","choices":[]}`))
+	}))
+	defer server.Close()
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"chat","messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+	step := config.RouteStep{Provider: "vllm", Model: "llama"}
+
+	cfg := config.Provider{Name: "vllm", APIKey: "key", BaseURL: server.URL}
+	if _, err := NewClientWithRouteStep(cfg, step, logger.NewLogger()).Call(request); err == nil {
+		t.Error("Expected the self-signed certificate to be rejected by default")
+	}
+
+	cfg.InsecureSkipVerify = true
+	resp, err := NewClientWithRouteStep(cfg, step, logger.NewLogger()).Call(request)
+	if err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+	if resp.ID != "self-signed" {
+		t.Errorf("Expected the self-signed provider's response, got %s", resp.ID)
+	}
+}
@@ -0,0 +1,82 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"ai-gateway/types"
+)
+
+// trimMessages drops the oldest messages of a chat request so that at most
+// maxMessages remain and their estimated tokens fit maxTokens; a zero limit is
+// not applied. System and developer messages are always kept and count toward
+// the limits, as does the last message, so a request is never emptied. Tool
+// results whose assistant tool call was dropped go with it, since providers
+// reject them on their own. It returns the number of messages dropped.
+func trimMessages(request *types.ChatRequest, maxMessages, maxTokens int) (int, error) {
+	var reqMap map[string]json.RawMessage
+	if err := json.Unmarshal(request.Raw, &reqMap); err != nil {
+		return 0, fmt.Errorf("failed to parse request JSON: %w", err)
+	}
+	var messages []json.RawMessage
+	if err := json.Unmarshal(reqMap["messages"], &messages); err != nil || len(messages) == 0 {
+		return 0, nil
+	}
+
+	roles := make([]string, len(messages))
+	count, tokens := len(messages), 0
+	for i, message := range messages {
+		var m struct {
+			Role string `json:"role"`
+		}
+		json.Unmarshal(message, &m)
+		roles[i] = m.Role
+		tokens += estimateTokens(message)
+	}
+	over := func() bool {
+		return (maxMessages > 0 && count > maxMessages) || (maxTokens > 0 && tokens > maxTokens)
+	}
+
+	// Drop from the oldest, skipping system messages and stopping before the last message
+	dropped := make([]bool, len(messages))
+	for i := 0; i < len(messages) && over(); i++ {
+		if roles[i] == "system" || roles[i] == "developer" {
+			continue
+		}
+		// A message is dropped together with the tool results that follow it
+		end := i
+		for end+1 < len(messages) && roles[end+1] == "tool" {
+			end++
+		}
+		if end == len(messages)-1 {
+			break
+		}
+		for ; i <= end; i++ {
+			dropped[i] = true
+			count--
+			tokens -= estimateTokens(messages[i])
+		}
+		i = end
+	}
+	if count == len(messages) {
+		return 0, nil
+	}
+
+	kept := make([]json.RawMessage, 0, count)
+	for i, message := range messages {
+		if !dropped[i] {
+			kept = append(kept, message)
+		}
+	}
+	trimmed, err := json.Marshal(kept)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal messages: %w", err)
+	}
+	reqMap["messages"] = trimmed
+	modifiedRaw, err := json.Marshal(reqMap)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal modified request: %w", err)
+	}
+	request.Raw = modifiedRaw
+	return len(messages) - count, nil
+}
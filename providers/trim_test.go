@@ -0,0 +1,96 @@
+package providers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"ai-gateway/types"
+)
+
+func TestTrimMessages(t *testing.T) {
+	conversation := `[
+		{"role":"system","content":"Be brief."},
+		{"role":"user","content":"first"},
+		{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"f","arguments":"{}"}}]},
+		{"role":"tool","tool_call_id":"call_1","content":"result"},
+		{"role":"assistant","content":"answer"},
+		{"role":"user","content":"second"}
+	]`
+
+	tests := []struct {
+		name        string
+		messages    string
+		maxMessages int
+		maxTokens   int
+		wantContent []string
+	}{
+		{
+			name:        "within limits",
+			messages:    conversation,
+			maxMessages: 6,
+			wantContent: []string{"Be brief.", "first", "", "result", "answer", "second"},
+		},
+		{
+			name:        "keeps the system message",
+			messages:    conversation,
+			maxMessages: 3,
+			wantContent: []string{"Be brief.", "answer", "second"},
+		},
+		{
+			// Dropping the tool call takes its result along, going below the limit
+			name:        "tool results go with their call",
+			messages:    conversation,
+			maxMessages: 4,
+			wantContent: []string{"Be brief.", "answer", "second"},
+		},
+		{
+			name:        "never drops the last message",
+			messages:    conversation,
+			maxMessages: 1,
+			wantContent: []string{"Be brief.", "second"},
+		},
+		{
+			name:        "token budget",
+			messages:    `[{"role":"user","content":"` + strings.Repeat("a", 400) + `"},{"role":"assistant","content":"ok"},{"role":"user","content":"short"}]`,
+			maxTokens:   50,
+			wantContent: []string{"ok", "short"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request types.ChatRequest
+			if err := json.Unmarshal([]byte(`{"model":"m","temperature":0.5,"messages":`+tt.messages+`}`), &request); err != nil {
+				t.Fatalf("Failed to unmarshal test request: %v", err)
+			}
+			before := len(request.Raw)
+
+			dropped, err := trimMessages(&request, tt.maxMessages, tt.maxTokens)
+			if err != nil {
+				t.Fatalf("trimMessages() error = %v", err)
+			}
+
+			var got struct {
+				Temperature float64         `json:"temperature"`
+				Messages    []types.Message `json:"messages"`
+			}
+			if err := json.Unmarshal(request.Raw, &got); err != nil {
+				t.Fatalf("Failed to parse trimmed request: %v", err)
+			}
+			contents := make([]string, len(got.Messages))
+			for i, message := range got.Messages {
+				contents[i] = message.ContentAsString()
+			}
+			if strings.Join(contents, "|") != strings.Join(tt.wantContent, "|") {
+				t.Errorf("Expected messages %q, got %q", tt.wantContent, contents)
+			}
+			if got.Temperature != 0.5 {
+				t.Errorf("Expected other parameters to be kept, got temperature %v", got.Temperature)
+			}
+			if dropped == 0 && len(request.Raw) != before {
+				t.Error("Expected the request to be left untouched when nothing is dropped")
+			}
+		})
+	}
+}
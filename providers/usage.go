@@ -0,0 +1,49 @@
+package providers
+
+import (
+	"context"
+
+	"ai-gateway/config"
+	"ai-gateway/metrics"
+	"ai-gateway/types"
+)
+
+// SetPrices sets the per-model price table used to compute request cost.
+// Models without a price only have their tokens counted.
+func (m *Manager) SetPrices(prices config.PriceTable) {
+	m.prices = prices
+}
+
+// costObserverKey is the context key for the function WithCostObserver sets
+type costObserverKey struct{}
+
+// WithCostObserver returns a context whose provider calls report their cost to
+// observe, e.g. to charge it to the caller's budget. Calls to models without a
+// price are not reported.
+func WithCostObserver(ctx context.Context, observe func(cost float64)) context.Context {
+	return context.WithValue(ctx, costObserverKey{}, observe)
+}
+
+// recordUsage adds the response's token usage, and its cost when the model
+// has a configured price, to the usage metrics and the context's cost observer
+func (m *Manager) recordUsage(ctx context.Context, provider, model string, usage types.Usage) {
+	metrics.TokensTotal.Add(float64(usage.PromptTokens), provider, model, "prompt")
+	metrics.TokensTotal.Add(float64(usage.CompletionTokens), provider, model, "completion")
+
+	price, ok := m.prices[model]
+	if !ok {
+		return
+	}
+	cost := float64(usage.PromptTokens)/1000*price.PricePer1KPrompt +
+		float64(usage.CompletionTokens)/1000*price.PricePer1KCompletion
+	metrics.CostTotal.Add(cost, provider, model)
+	if observe, ok := ctx.Value(costObserverKey{}).(func(cost float64)); ok {
+		observe(cost)
+	}
+}
+
+// recordChoices counts the choices of a chat response, so requests with n > 1
+// show up next to the completion tokens they used
+func (m *Manager) recordChoices(provider, model string, choices int) {
+	metrics.ChoicesTotal.Add(float64(choices), provider, model)
+}
@@ -0,0 +1,178 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"ai-gateway/config"
+	"ai-gateway/logger"
+	"ai-gateway/metrics"
+	"ai-gateway/types"
+)
+
+func TestManager_Execute_RecordsUsage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"test-id","object":"chat.completion","choices":[],"usage":{"prompt_tokens":1000,"completion_tokens":500,"total_tokens":1500}}`))
+	}))
+	defer server.Close()
+
+	providers := []config.Provider{
+		{Name: "usage-provider", APIKey: "key1", BaseURL: server.URL},
+	}
+	routes := []config.Route{
+		{
+			Name:  "test-model",
+			Steps: []config.RouteStep{{Provider: "usage-provider", Model: "usage-model"}},
+		},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+	manager.SetPrices(config.PriceTable{
+		"usage-model": {PricePer1KPrompt: 0.01, PricePer1KCompletion: 0.03},
+	})
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"test-model","messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+	if _, err := manager.Execute(request); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if got := metrics.TokensTotal.Value("usage-provider", "usage-model", "prompt"); got != 1000 {
+		t.Errorf("Expected 1000 prompt tokens, got %v", got)
+	}
+	if got := metrics.TokensTotal.Value("usage-provider", "usage-model", "completion"); got != 500 {
+		t.Errorf("Expected 500 completion tokens, got %v", got)
+	}
+	if got := metrics.CostTotal.Value("usage-provider", "usage-model"); math.Abs(got-0.025) > 1e-9 {
+		t.Errorf("Expected cost 0.025, got %v", got)
+	}
+}
+
+func TestManager_Execute_MultipleChoices(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"test-id","object":"chat.completion","choices":[
+			{"index":0,"message":{"role":"assistant","content":"First"},"finish_reason":"stop"},
+			{"index":1,"message":{"role":"assistant","content":"Second"},"finish_reason":"stop"},
+			{"index":2,"message":{"role":"assistant","content":"Third"},"finish_reason":"length"}
+		],"usage":{"prompt_tokens":10,"completion_tokens":30,"total_tokens":40}}`))
+	}))
+	defer server.Close()
+
+	providers := []config.Provider{
+		{Name: "choices-provider", APIKey: "key1", BaseURL: server.URL},
+	}
+	routes := []config.Route{
+		{
+			Name:  "test-model",
+			Steps: []config.RouteStep{{Provider: "choices-provider", Model: "choices-model"}},
+		},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"test-model","n":3,"messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+	resp, err := manager.Execute(request)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if len(resp.Choices) != 3 || resp.Choices[2].Message.ContentAsString() != "Third" || resp.Choices[2].FinishReason != "length" {
+		t.Errorf("Expected all three choices, got %+v", resp.Choices)
+	}
+	if got := metrics.ChoicesTotal.Value("choices-provider", "choices-model"); got != 3 {
+		t.Errorf("Expected 3 choices counted, got %v", got)
+	}
+	if got := metrics.TokensTotal.Value("choices-provider", "choices-model", "completion"); got != 30 {
+		t.Errorf("Expected the completion tokens of all choices, got %v", got)
+	}
+	var logged struct {
+		Choices []json.RawMessage `json:"choices"`
+	}
+	if err := json.Unmarshal(resp.TruncateResponseForLogging().Raw, &logged); err != nil || len(logged.Choices) != 3 {
+		t.Errorf("Expected the logged response to keep every choice, got %d (%v)", len(logged.Choices), err)
+	}
+}
+
+func TestManager_ExecuteStream_RecordsUsage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"Hi\"}}]}\n\n"))
+		w.Write([]byte("data: {\"choices\":[],\"usage\":{\"prompt_tokens\":200,\"completion_tokens\":100,\"total_tokens\":300}}\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	providers := []config.Provider{
+		{Name: "stream-usage-provider", APIKey: "key1", BaseURL: server.URL},
+	}
+	routes := []config.Route{
+		{
+			Name:  "test-model",
+			Steps: []config.RouteStep{{Provider: "stream-usage-provider", Model: "stream-usage-model"}},
+		},
+	}
+	manager := NewManager(providers, routes, logger.NewLogger())
+	manager.SetPrices(config.PriceTable{
+		"stream-usage-model": {PricePer1KPrompt: 0.01, PricePer1KCompletion: 0.03},
+	})
+
+	var request types.ChatRequest
+	if err := json.Unmarshal([]byte(`{"model":"test-model","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"Hello"}]}`), &request); err != nil {
+		t.Fatalf("Failed to unmarshal test request: %v", err)
+	}
+	stream, err := manager.ExecuteStreamWithTracing(context.Background(), request, "")
+	if err != nil {
+		t.Fatalf("ExecuteStreamWithTracing() error = %v", err)
+	}
+	// Read in small pieces so the usage event is split across reads
+	body, err := io.ReadAll(iotest.HalfReader(stream.Body))
+	stream.Close()
+	if err != nil {
+		t.Fatalf("Failed to read stream: %v", err)
+	}
+	if !strings.Contains(string(body), `"usage"`) || !strings.HasSuffix(string(body), "data: [DONE]\n\n") {
+		t.Errorf("Expected the stream to be passed through unchanged, got %q", body)
+	}
+
+	if got := metrics.TokensTotal.Value("stream-usage-provider", "stream-usage-model", "prompt"); got != 200 {
+		t.Errorf("Expected 200 prompt tokens, got %v", got)
+	}
+	if got := metrics.TokensTotal.Value("stream-usage-provider", "stream-usage-model", "completion"); got != 100 {
+		t.Errorf("Expected 100 completion tokens, got %v", got)
+	}
+	if got := metrics.CostTotal.Value("stream-usage-provider", "stream-usage-model"); math.Abs(got-0.005) > 1e-9 {
+		t.Errorf("Expected cost 0.005, got %v", got)
+	}
+}
+
+func TestUsageReader_NoUsageChunk(t *testing.T) {
+	calls := 0
+	var got *types.Usage
+	r := newUsageReader(io.NopCloser(strings.NewReader("data: {\"choices\":[]}\n\ndata: [DONE]\n\n")), func(usage *types.Usage) {
+		calls++
+		got = usage
+	})
+	if _, err := io.ReadAll(r); err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	r.Close()
+
+	if calls != 1 {
+		t.Errorf("Expected done to be called once, got %d", calls)
+	}
+	if got != nil {
+		t.Errorf("Expected no usage, got %+v", got)
+	}
+}
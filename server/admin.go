@@ -0,0 +1,184 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"ai-gateway/config"
+)
+
+// SetConfigLoader sets how POST /admin/reload re-reads the configuration file
+func (s *Server) SetConfigLoader(load func() (*config.Config, error)) {
+	s.loadConfig = load
+}
+
+// adminAuthMiddleware accepts only the admin_api_key, sent like the gateway key
+func (s *Server) adminAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		apiKey := requestAPIKey(r)
+		if apiKey == "" || subtle.ConstantTimeCompare([]byte(apiKey), []byte(s.config.AdminAPIKey)) != 1 {
+			s.logger.Error("Admin authentication failed", nil, map[string]interface{}{
+				"path":    r.URL.Path,
+				"has_key": apiKey != "",
+			})
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// handleAdminReload re-reads and validates the configuration file, then swaps
+// in its providers and routes. An invalid file leaves the running configuration in place.
+func (s *Server) handleAdminReload(w http.ResponseWriter, r *http.Request) {
+	if s.loadConfig == nil {
+		s.writeErrorResponse(w, "server_error", "Configuration reload is not available", "RELOAD_UNAVAILABLE", http.StatusNotImplemented, nil)
+		return
+	}
+
+	cfg, err := s.loadConfig()
+	if err != nil {
+		s.logger.Error("Configuration reload failed, keeping current configuration", err, nil)
+		s.writeErrorResponse(w, "validation_error", err.Error(), "INVALID_CONFIG", http.StatusBadRequest, nil)
+		return
+	}
+	s.manager.Reload(cfg.Providers, cfg.Routes)
+
+	response := map[string]interface{}{
+		"status":    "reloaded",
+		"routes":    len(cfg.Routes),
+		"providers": len(cfg.Providers),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// adminRoute is a route as reported by GET /admin/routes
+type adminRoute struct {
+	Name           string      `json:"name"`
+	Strategy       string      `json:"strategy"`
+	Default        bool        `json:"default,omitempty"`
+	Disabled       bool        `json:"disabled,omitempty"`
+	RequestTimeout string      `json:"request_timeout,omitempty"` // effective limit, empty when unlimited
+	AllowedKeys    []string    `json:"allowed_keys,omitempty"`
+	StepCount      int         `json:"step_count"`
+	Steps          []adminStep `json:"steps"`
+}
+
+// adminStep is a route step with its effective timeout
+type adminStep struct {
+	Provider           string   `json:"provider"`
+	Model              string   `json:"model"`
+	Timeout            string   `json:"timeout"`
+	ConflictResolution string   `json:"conflict_resolution,omitempty"`
+	Retries            int      `json:"retries,omitempty"`
+	Weight             int      `json:"weight,omitempty"`
+	Deployment         string   `json:"deployment,omitempty"`
+	ForwardHeaders     []string `json:"forward_headers,omitempty"`
+	PreserveModel      bool     `json:"preserve_model,omitempty"`
+}
+
+// adminProvider is a provider with its credentials redacted
+type adminProvider struct {
+	Name           string   `json:"name"`
+	Type           string   `json:"type"`
+	BaseURL        string   `json:"base_url"`
+	APIVersion     string   `json:"api_version,omitempty"`
+	APIKeys        []string `json:"api_keys"` // masked
+	ProxyURL       string   `json:"proxy_url,omitempty"`
+	ForwardHeaders []string `json:"forward_headers,omitempty"`
+	Headers        []string `json:"headers,omitempty"` // names only, values may be secrets
+	Disabled       bool     `json:"disabled,omitempty"`
+	// LatencyEWMAMs is the moving average of successful calls, absent before the first
+	LatencyEWMAMs *int64 `json:"latency_ewma_ms,omitempty"`
+}
+
+// handleAdminRoutes reports the routes and providers the manager is currently serving
+func (s *Server) handleAdminRoutes(w http.ResponseWriter, r *http.Request) {
+	routes := []adminRoute{}
+	for _, route := range s.manager.Routes() {
+		strategy := route.Strategy
+		if strategy == "" {
+			strategy = "sequential"
+		}
+		out := adminRoute{
+			Name:        route.Name,
+			Strategy:    strategy,
+			Default:     route.IsDefault(),
+			Disabled:    route.Disabled,
+			StepCount:   len(route.Steps),
+			AllowedKeys: route.AllowedKeys,
+			Steps:       make([]adminStep, 0, len(route.Steps)),
+		}
+		if timeout := route.GetRequestTimeout(s.config.GetRequestTimeout()); timeout > 0 {
+			out.RequestTimeout = timeout.String()
+		}
+		for _, step := range route.Steps {
+			out.Steps = append(out.Steps, adminStep{
+				Provider:           step.Provider,
+				Model:              step.Model,
+				Timeout:            config.GetTimeout(step.Timeout, "30s").String(),
+				ConflictResolution: step.ConflictResolution,
+				Retries:            step.Retries,
+				Weight:             step.Weight,
+				Deployment:         step.Deployment,
+				ForwardHeaders:     step.ForwardHeaders,
+				PreserveModel:      step.PreserveModel,
+			})
+		}
+		routes = append(routes, out)
+	}
+
+	latencies := s.manager.ProviderLatencies()
+	providerList := []adminProvider{}
+	for _, provider := range s.manager.Providers() {
+		providerType := provider.Type
+		if providerType == "" {
+			providerType = config.ProviderTypeOpenAI
+		}
+		out := adminProvider{
+			Name:           provider.Name,
+			Type:           providerType,
+			BaseURL:        provider.BaseURL,
+			APIVersion:     provider.APIVersion,
+			APIKeys:        make([]string, 0, len(provider.Keys())),
+			ForwardHeaders: provider.ForwardHeaders,
+			Disabled:       provider.Disabled,
+		}
+		for _, key := range provider.Keys() {
+			out.APIKeys = append(out.APIKeys, maskSecret(key))
+		}
+		if provider.ProxyURL != "" {
+			if u, err := url.Parse(provider.ProxyURL); err == nil {
+				out.ProxyURL = u.Redacted()
+			}
+		}
+		for name := range provider.Headers {
+			out.Headers = append(out.Headers, name)
+		}
+		sort.Strings(out.Headers)
+		if latency, ok := latencies[provider.Name]; ok {
+			ms := latency.Milliseconds()
+			out.LatencyEWMAMs = &ms
+		}
+		providerList = append(providerList, out)
+	}
+
+	response := map[string]interface{}{
+		"routes":    routes,
+		"providers": providerList,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// maskSecret hides all but the last four characters of longer secrets
+func maskSecret(secret string) string {
+	if len(secret) <= 8 {
+		return "****"
+	}
+	return "****" + secret[len(secret)-4:]
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+
+	"ai-gateway/audit"
+	"ai-gateway/types"
+)
+
+// SetAuditLogger enables audit entries for chat completion requests
+func (s *Server) SetAuditLogger(a *audit.Logger) {
+	s.audit = a
+}
+
+// auditRecorder keeps the response status and body for the audit entry. Stream
+// bodies are not kept; skipBody is set once the response turns into a stream.
+type auditRecorder struct {
+	statusRecorder
+	body     bytes.Buffer
+	skipBody bool
+}
+
+// Write keeps a copy of the response body unless it is a stream
+func (r *auditRecorder) Write(b []byte) (int, error) {
+	if !r.skipBody {
+		r.body.Write(b)
+	}
+	return r.statusRecorder.Write(b)
+}
+
+// recordAudit queues the audit entry for a completed chat completion request.
+// Redaction and writing happen on the audit logger's goroutine.
+func (s *Server) recordAudit(r *http.Request, rec *auditRecorder, req *types.ChatRequest, requestID string, start time.Time) {
+	entry := audit.Entry{
+		Time:       start.UTC(),
+		RequestID:  requestID,
+		Path:       r.URL.Path,
+		Model:      req.Model,
+		Status:     rec.Status(),
+		DurationMs: time.Since(start).Milliseconds(),
+		Request:    req.Raw,
+	}
+	if !rec.skipBody {
+		entry.Response = bytes.TrimSpace(rec.body.Bytes())
+	}
+	s.audit.Record(entry, r.Header)
+}
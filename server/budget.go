@@ -0,0 +1,137 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"ai-gateway/config"
+	"ai-gateway/providers"
+)
+
+// BudgetStore keeps the spend of each key label per budget period. Periods
+// are named by their start ("2026-10" or "2026-10-16"), so a new period starts
+// from zero without an explicit reset. The default store is in memory and
+// starts over on restart; a durable store can replace it with SetBudgetStore.
+type BudgetStore interface {
+	Spent(label, period string) (float64, error)
+	Add(label, period string, cost float64) error
+}
+
+// memoryBudgetStore keeps the spend of the current period per label
+type memoryBudgetStore struct {
+	mu    sync.Mutex
+	spend map[string]periodSpend
+}
+
+type periodSpend struct {
+	period string
+	cost   float64
+}
+
+func newMemoryBudgetStore() *memoryBudgetStore {
+	return &memoryBudgetStore{spend: make(map[string]periodSpend)}
+}
+
+func (m *memoryBudgetStore) Spent(label, period string) (float64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if spend := m.spend[label]; spend.period == period {
+		return spend.cost, nil
+	}
+	return 0, nil
+}
+
+func (m *memoryBudgetStore) Add(label, period string, cost float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	spend := m.spend[label]
+	if spend.period != period {
+		spend = periodSpend{period: period}
+	}
+	spend.cost += cost
+	m.spend[label] = spend
+	return nil
+}
+
+// budgetTracker charges request costs to the caller's key label and tells
+// whether the label still has budget left in the current period
+type budgetTracker struct {
+	limits config.BudgetTable
+	period string
+	store  BudgetStore
+	now    func() time.Time
+}
+
+func newBudgetTracker(limits config.BudgetTable, period string) *budgetTracker {
+	return &budgetTracker{limits: limits, period: period, store: newMemoryBudgetStore(), now: time.Now}
+}
+
+// currentPeriod returns the name of the period containing now and when it ends
+func (b *budgetTracker) currentPeriod() (string, time.Time) {
+	now := b.now().UTC()
+	if b.period == config.BudgetPeriodDaily {
+		start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		return start.Format("2006-01-02"), start.AddDate(0, 0, 1)
+	}
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start.Format("2006-01"), start.AddDate(0, 1, 0)
+}
+
+// SetBudgetStore replaces the in-memory budget store, e.g. with one that
+// survives restarts or is shared between replicas
+func (s *Server) SetBudgetStore(store BudgetStore) {
+	if s.budgets != nil {
+		s.budgets.store = store
+	}
+}
+
+// budgetMiddleware rejects requests from key labels that have spent their
+// budget for the period with 402 BUDGET_EXCEEDED, and charges the cost of the
+// provider calls a request makes to its label. It runs after authMiddleware,
+// which records the label.
+func (s *Server) budgetMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		label := requestKeyLabel(r)
+		limit, ok := s.config.Budgets[label]
+		if s.budgets == nil || !ok {
+			next(w, r)
+			return
+		}
+
+		period, resets := s.budgets.currentPeriod()
+		spent, err := s.budgets.store.Spent(label, period)
+		if err != nil {
+			// An unavailable store doesn't take the gateway down with it
+			s.logger.Error("Failed to read budget spend, allowing request", err, map[string]interface{}{
+				"key_label": label,
+			})
+		}
+		if spent >= limit {
+			retryAfter := int(math.Ceil(resets.Sub(s.budgets.now()).Seconds()))
+			s.logger.Warn("Budget exceeded", nil, map[string]interface{}{
+				"key_label": label,
+				"period":    period,
+				"spent":     spent,
+				"budget":    limit,
+			})
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			s.writeErrorResponse(w, "budget_error", "Budget exceeded for this API key until "+resets.Format(time.RFC3339), "BUDGET_EXCEEDED", http.StatusPaymentRequired, nil)
+			return
+		}
+
+		ctx := providers.WithCostObserver(r.Context(), func(cost float64) {
+			// The period is taken again, a request may finish after it rolled over
+			period, _ := s.budgets.currentPeriod()
+			if err := s.budgets.store.Add(label, period, cost); err != nil {
+				s.logger.Error("Failed to record budget spend", err, map[string]interface{}{
+					"key_label": label,
+					"cost":      cost,
+				})
+			}
+		})
+		next(w, r.WithContext(ctx))
+	}
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ai-gateway/config"
+	"ai-gateway/logger"
+	"ai-gateway/providers"
+	"ai-gateway/types"
+)
+
+func TestBudgetMiddleware(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"ok","object":"chat.completion","choices":[],"usage":{"prompt_tokens":1000,"completion_tokens":1000,"total_tokens":2000}}`))
+	}))
+	defer upstream.Close()
+
+	providersList := []config.Provider{
+		{Name: "provider1", APIKey: "key1", BaseURL: upstream.URL},
+	}
+	routes := []config.Route{
+		{Name: "gpt-4", Steps: []config.RouteStep{{Provider: "provider1", Model: "gpt-4"}}},
+	}
+	cfg := &config.Config{
+		APIKey:  "test-key",
+		APIKeys: []config.ClientKey{{Label: "research", Key: "research-key"}},
+		Budgets: config.BudgetTable{"research": 0.05},
+		Port:    8080,
+	}
+	logger := logger.NewLogger()
+	manager := providers.NewManager(providersList, routes, logger)
+	// Each request costs 0.03
+	manager.SetPrices(config.PriceTable{"gpt-4": {PricePer1KPrompt: 0.01, PricePer1KCompletion: 0.02}})
+	srv := NewServer(cfg, logger, manager)
+	now := time.Date(2026, 10, 31, 23, 0, 0, 0, time.UTC)
+	srv.budgets.now = func() time.Time { return now }
+
+	send := func(apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"Hello"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Api-Key", apiKey)
+		rr := httptest.NewRecorder()
+		srv.httpSrv.Handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// The second request goes over the budget, the third is rejected
+	for i := 0; i < 2; i++ {
+		if rr := send("research-key"); rr.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected status 200 within budget, got %d: %s", i+1, rr.Code, rr.Body.String())
+		}
+	}
+	rr := send("research-key")
+	if rr.Code != http.StatusPaymentRequired || rr.Header().Get("Retry-After") != "3600" {
+		t.Fatalf("Expected 402 with Retry-After until the end of the month, got %d %q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+	var errorResp types.ErrorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &errorResp); err != nil {
+		t.Fatalf("Failed to unmarshal error response: %v", err)
+	}
+	if errorResp.Error.Code != "BUDGET_EXCEEDED" {
+		t.Errorf("Expected code BUDGET_EXCEEDED, got %s", errorResp.Error.Code)
+	}
+
+	// Keys without a budget are not limited
+	if rr := send("test-key"); rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for a key without a budget, got %d", rr.Code)
+	}
+
+	// The next period starts from zero
+	now = now.Add(time.Hour)
+	if rr := send("research-key"); rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200 in the next period, got %d", rr.Code)
+	}
+}
+
+func TestBudgetMiddleware_Embeddings(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"object":"list","data":[{"object":"embedding","index":0,"embedding":[0.1]}],"usage":{"prompt_tokens":1000,"total_tokens":1000}}`))
+	}))
+	defer upstream.Close()
+
+	providersList := []config.Provider{
+		{Name: "provider1", APIKey: "key1", BaseURL: upstream.URL},
+	}
+	routes := []config.Route{
+		{Name: "text-embedding-3-small", Steps: []config.RouteStep{{Provider: "provider1", Model: "text-embedding-3-small"}}},
+	}
+	cfg := &config.Config{
+		APIKey:  "test-key",
+		APIKeys: []config.ClientKey{{Label: "research", Key: "research-key"}},
+		Budgets: config.BudgetTable{"research": 0.03},
+		Port:    8080,
+	}
+	logger := logger.NewLogger()
+	manager := providers.NewManager(providersList, routes, logger)
+	// Each request costs 0.02
+	manager.SetPrices(config.PriceTable{"text-embedding-3-small": {PricePer1KPrompt: 0.02}})
+	srv := NewServer(cfg, logger, manager)
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/embeddings", strings.NewReader(`{"model":"text-embedding-3-small","input":"Hello"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Api-Key", "research-key")
+		rr := httptest.NewRecorder()
+		srv.httpSrv.Handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i := 0; i < 2; i++ {
+		if rr := send(); rr.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected status 200 within budget, got %d: %s", i+1, rr.Code, rr.Body.String())
+		}
+	}
+	if rr := send(); rr.Code != http.StatusPaymentRequired {
+		t.Errorf("Expected embeddings spend to exhaust the budget with 402, got %d", rr.Code)
+	}
+}
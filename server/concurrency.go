@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net/http"
+	"time"
+)
+
+// concurrencyMiddleware lets at most max_concurrent_requests chat completions
+// run at once. A request over the limit waits up to request_queue_timeout for
+// a slot and is otherwise rejected with 429 CONCURRENCY_LIMITED. Streaming
+// requests hold their slot until the stream ends.
+func (s *Server) concurrencyMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.slots == nil {
+			next(w, r)
+			return
+		}
+
+		if !s.acquireSlot(r) {
+			s.logger.Warn("Concurrent request limit reached", nil, map[string]interface{}{
+				"path":  r.URL.Path,
+				"limit": cap(s.slots),
+			})
+			w.Header().Set("Retry-After", "1")
+			s.writeErrorResponse(w, "rate_limit_error", "Too many concurrent requests, retry later", "CONCURRENCY_LIMITED", http.StatusTooManyRequests, nil)
+			return
+		}
+		defer func() { <-s.slots }()
+
+		next(w, r)
+	}
+}
+
+// acquireSlot takes a slot, waiting up to the queue timeout or until the
+// client goes away
+func (s *Server) acquireSlot(r *http.Request) bool {
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	default:
+	}
+	timeout := s.config.GetRequestQueueTimeout()
+	if timeout <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+	case <-r.Context().Done():
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ai-gateway/config"
+	"ai-gateway/logger"
+	"ai-gateway/providers"
+)
+
+func TestConcurrencyMiddleware(t *testing.T) {
+	cfg := &config.Config{APIKey: "test-api-key", MaxConcurrentRequests: 1}
+	logger := logger.NewLogger()
+	srv := NewServer(cfg, logger, providers.NewManager([]config.Provider{}, []config.Route{}, logger))
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := srv.concurrencyMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Block") != "" {
+			close(started)
+			<-release
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	send := func(block bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		if block {
+			req.Header.Set("X-Block", "1")
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- send(true) }()
+	<-started
+
+	// Without a queue timeout the request over the limit is rejected at once
+	rr := send(false)
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected 429 with Retry-After while the slot is taken, got %d %q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+
+	// With one it waits for the slot to be released
+	cfg.RequestQueueTimeout = "5s"
+	queued := make(chan *httptest.ResponseRecorder)
+	go func() { queued <- send(false) }()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	if rr := <-done; rr.Code != http.StatusOK {
+		t.Errorf("Expected the first request to succeed, got %d", rr.Code)
+	}
+	if rr := <-queued; rr.Code != http.StatusOK {
+		t.Errorf("Expected the queued request to get the released slot, got %d", rr.Code)
+	}
+}
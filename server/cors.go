@@ -0,0 +1,61 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"ai-gateway/providers"
+)
+
+// Default CORS methods and headers used when the config leaves them empty
+var (
+	defaultCORSMethods = []string{"GET", "POST", "OPTIONS"}
+	defaultCORSHeaders = []string{"Authorization", "Content-Type", "X-Api-Key", "X-Request-Id", "X-Gateway-Provider", "Idempotency-Key"}
+)
+
+// corsMiddleware answers preflight requests and adds Access-Control-Allow-*
+// headers for allowed origins. It is a no-op when cors_allowed_origins is empty.
+func (s *Server) corsMiddleware(next http.Handler) http.Handler {
+	origins := s.config.CORSAllowedOrigins
+	if len(origins) == 0 {
+		return next
+	}
+	methods := strings.Join(orDefault(s.config.CORSAllowedMethods, defaultCORSMethods), ", ")
+	headers := strings.Join(orDefault(s.config.CORSAllowedHeaders, defaultCORSHeaders), ", ")
+	exposed := "X-Request-Id"
+	if s.config.DebugHeaders {
+		exposed += ", " + RouteHeader + ", " + providers.ProviderHeader
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		allowed := origin != "" && (slices.Contains(origins, "*") || slices.Contains(origins, origin))
+		if allowed {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Add("Vary", "Origin")
+			w.Header().Set("Access-Control-Expose-Headers", exposed)
+		}
+
+		// Preflight requests never reach the auth middleware
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			if allowed {
+				w.Header().Set("Access-Control-Allow-Methods", methods)
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+				w.Header().Set("Access-Control-Max-Age", "600")
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// orDefault returns values, or fallback when values is empty
+func orDefault(values, fallback []string) []string {
+	if len(values) == 0 {
+		return fallback
+	}
+	return values
+}
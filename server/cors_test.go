@@ -0,0 +1,77 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ai-gateway/config"
+	"ai-gateway/logger"
+	"ai-gateway/providers"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	cfg := &config.Config{
+		APIKey:             "test-api-key",
+		CORSAllowedOrigins: []string{"https://app.example.com"},
+	}
+	logger := logger.NewLogger()
+	manager := providers.NewManager([]config.Provider{}, []config.Route{}, logger)
+	srv := NewServer(cfg, logger, manager)
+
+	tests := []struct {
+		name           string
+		method         string
+		origin         string
+		preflight      bool
+		expectedStatus int
+		expectedOrigin string
+	}{
+		{
+			name:           "preflight from allowed origin",
+			method:         "OPTIONS",
+			origin:         "https://app.example.com",
+			preflight:      true,
+			expectedStatus: http.StatusNoContent,
+			expectedOrigin: "https://app.example.com",
+		},
+		{
+			name:           "preflight from other origin",
+			method:         "OPTIONS",
+			origin:         "https://evil.example.com",
+			preflight:      true,
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "actual request from allowed origin",
+			method:         "GET",
+			origin:         "https://app.example.com",
+			expectedStatus: http.StatusOK,
+			expectedOrigin: "https://app.example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/v1/models", nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("X-Api-Key", "test-api-key")
+			if tt.preflight {
+				req.Header.Set("Access-Control-Request-Method", "POST")
+			}
+
+			w := httptest.NewRecorder()
+			srv.httpSrv.Handler.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.expectedOrigin {
+				t.Errorf("expected Access-Control-Allow-Origin %q, got %q", tt.expectedOrigin, got)
+			}
+			if tt.preflight && tt.expectedOrigin != "" && w.Header().Get("Access-Control-Allow-Methods") != "GET, POST, OPTIONS" {
+				t.Errorf("unexpected Access-Control-Allow-Methods %q", w.Header().Get("Access-Control-Allow-Methods"))
+			}
+		})
+	}
+}
@@ -1,15 +1,31 @@
 package server
 
 import (
+	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"time"
+	"unicode/utf8"
 
+	"ai-gateway/config"
+	"ai-gateway/metrics"
+	"ai-gateway/providers"
 	"ai-gateway/types"
+	"ai-gateway/version"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// statusClientClosedRequest is the non-standard status recorded when the client disconnects mid-request
+const statusClientClosedRequest = 499
+
 // generateRequestID generates a unique request ID
 func generateRequestID() string {
 	bytes := make([]byte, 8)
@@ -17,6 +33,36 @@ func generateRequestID() string {
 	return hex.EncodeToString(bytes)
 }
 
+// maxRequestIDLength bounds client-supplied X-Request-Id values
+const maxRequestIDLength = 128
+
+// requestIDFor returns the request's ID: the client's X-Request-Id when it is a
+// sensible value, otherwise a generated one. The ID is echoed in the response
+// X-Request-Id header and recorded for the access log.
+func requestIDFor(w http.ResponseWriter, r *http.Request) string {
+	requestID := r.Header.Get("X-Request-Id")
+	if !validRequestID(requestID) {
+		requestID = generateRequestID()
+	}
+	w.Header().Set("X-Request-Id", requestID)
+	setRequestID(r, requestID)
+	return requestID
+}
+
+// validRequestID accepts non-empty IDs of printable ASCII without spaces, so
+// they are safe to log and echo in headers
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
 // handleHealth handles health check requests
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	response := map[string]string{"status": "healthy"}
@@ -24,19 +70,54 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// handleVersion reports the running build so deployments can be verified
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(version.Get())
+}
+
+// handleReady reports readiness for load balancers: 503 when some route has
+// no healthy provider left, according to the background health checks
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	unavailable := s.manager.UnavailableRoutes()
+	response := map[string]interface{}{
+		"status":    "ready",
+		"providers": s.manager.ProviderHealth(),
+	}
+	status := http.StatusOK
+	if len(unavailable) > 0 {
+		response["status"] = "unavailable"
+		response["unavailable_routes"] = unavailable
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
 // handleModels handles model listing requests
 func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
 	var models []types.Model
 
-	// Return route names as available models
-	for _, route := range s.config.Routes {
-		model := types.Model{
-			ID:      route.Name,
-			Object:  "model",
-			Created: 1677610602,
-			OwnedBy: "ai-gateway",
+	// Route names first, then upstream models not already listed, per models_source
+	source := s.config.GetModelsSource()
+	if source != config.ModelsSourceUpstream {
+		models = s.routeModels()
+	}
+	if source != config.ModelsSourceRoutes {
+		listed := make(map[string]bool, len(models))
+		for _, model := range models {
+			listed[model.ID] = true
 		}
-		models = append(models, model)
+		for _, model := range s.manager.UpstreamModels() {
+			if !listed[model.ID] {
+				models = append(models, model)
+			}
+		}
+	}
+	// Providers without a usable /models endpoint leave only the route names
+	if len(models) == 0 {
+		models = s.routeModels()
 	}
 
 	response := types.ModelsResponse{
@@ -48,6 +129,25 @@ func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// routeModels lists the enabled routes as models
+func (s *Server) routeModels() []types.Model {
+	var models []types.Model
+	for _, route := range s.manager.Routes() {
+		if route.Disabled {
+			continue
+		}
+		model := types.Model{
+			ID:       route.Name,
+			Object:   "model",
+			Created:  1677610602,
+			OwnedBy:  "ai-gateway",
+			Metadata: route.Metadata,
+		}
+		models = append(models, model)
+	}
+	return models
+}
+
 // writeErrorResponse writes a unified error response
 func (s *Server) writeErrorResponse(w http.ResponseWriter, errorType, message, code string, statusCode int, details interface{}) {
 	response := types.ErrorResponse{
@@ -64,23 +164,86 @@ func (s *Server) writeErrorResponse(w http.ResponseWriter, errorType, message, c
 	json.NewEncoder(w).Encode(response)
 }
 
+// decodeRequestBody parses the JSON request body, refusing bodies above the configured limit.
+// The body must be valid UTF-8 and a JSON object.
+// It writes the error response itself and returns false when the body cannot be used.
+func (s *Server) decodeRequestBody(w http.ResponseWriter, r *http.Request, v interface{}, requestID string) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, s.config.GetMaxRequestBytes())
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = parseRequestBody(body, v)
+	}
+	if err != nil {
+		s.logger.Error("Failed to parse request", err, map[string]interface{}{
+			"request_id": requestID,
+		})
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr):
+			s.writeErrorResponse(w, "request_error", fmt.Sprintf("Request body exceeds the limit of %d bytes", maxBytesErr.Limit), "REQUEST_TOO_LARGE", http.StatusRequestEntityTooLarge, nil)
+		case errors.Is(err, errBodyNotUTF8):
+			s.writeErrorResponse(w, "parsing_error", "Request body must be valid UTF-8", "INVALID_ENCODING", http.StatusBadRequest, nil)
+		case errors.Is(err, errBodyNotObject):
+			s.writeErrorResponse(w, "parsing_error", "Request body must be a JSON object", "INVALID_JSON", http.StatusBadRequest, nil)
+		default:
+			s.writeErrorResponse(w, "parsing_error", "Invalid JSON in request body", "INVALID_JSON", http.StatusBadRequest, nil)
+		}
+		return false
+	}
+	return true
+}
+
+var (
+	errBodyNotUTF8   = errors.New("request body is not valid UTF-8")
+	errBodyNotObject = errors.New("request body is not a JSON object")
+)
+
+// parseRequestBody checks the body is UTF-8 and a JSON object before decoding it.
+// The JSON decoder would otherwise replace invalid bytes silently, and arrays,
+// scalars and null would surface later as confusing validation errors.
+func parseRequestBody(body []byte, v interface{}) error {
+	if !utf8.Valid(body) {
+		return errBodyNotUTF8
+	}
+	if trimmed := bytes.TrimSpace(body); len(trimmed) == 0 || trimmed[0] != '{' {
+		return errBodyNotObject
+	}
+	return json.NewDecoder(bytes.NewReader(body)).Decode(v)
+}
+
 // handleChatCompletions handles chat completion requests
 func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
-	// Generate unique request ID for tracing
-	requestID := generateRequestID()
+	// Reuse the caller's request ID for tracing, or generate one
+	requestID := requestIDFor(w, r)
 
 	// Parse request
 	var req types.ChatRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		s.logger.Error("Failed to parse request", err, map[string]interface{}{
-			"request_id": requestID,
-		})
-		s.writeErrorResponse(w, "parsing_error", "Invalid JSON in request body", "INVALID_JSON", http.StatusBadRequest, nil)
+	var auditRec *auditRecorder
+	if s.audit != nil {
+		auditRec = &auditRecorder{statusRecorder: statusRecorder{ResponseWriter: w}}
+		w = auditRec
+		defer s.recordAudit(r, auditRec, &req, requestID, time.Now())
+	}
+	if !s.decodeRequestBody(w, r, &req, requestID) {
 		return
 	}
+	req.Headers = r.Header
 
 	// Validate request
-	if err := validateChatRequest(&req); err != nil {
+	err := validateChatRequest(&req, s.config.MaxMessages)
+	if err == nil {
+		err = validateParamLimits(req.Raw, s.config.ParamLimits)
+	}
+	if err == nil && s.config.ValidateTools {
+		err = validateTools(req.Raw)
+	}
+	if err == nil && s.config.ValidateStop {
+		err = validateStop(req.Raw)
+	}
+	if err == nil && s.config.ValidateContentBlocks {
+		err = validateContentBlocks(req.Raw, s.config.MaxInlineImageBytes)
+	}
+	if err != nil {
 		// Log detailed error with truncated request content for debugging
 		truncatedReq := req.TruncateRequestForLogging()
 		requestJSON, _ := json.Marshal(truncatedReq)
@@ -93,6 +256,14 @@ func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.recordRoute(r, req.Model)
+	if !s.authorizeRoute(w, r, req.Model, requestID) {
+		return
+	}
+	if !s.checkPromptSize(w, req, requestID) {
+		return
+	}
+
 	// Convert request to JSON for logging (with truncated message contents)
 	truncatedReq := req.TruncateRequestForLogging()
 	requestJSON, _ := json.Marshal(truncatedReq)
@@ -105,38 +276,340 @@ func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
 	messageCount := len(temp.Messages)
 
 	// Log request summary with truncated JSON
-	s.logger.Info("Chat completion request", map[string]interface{}{
+	fields := map[string]interface{}{
 		"request_id":   requestID,
 		"model":        req.Model,
 		"messages":     messageCount,
 		"request_json": string(requestJSON),
-	})
+	}
+	// Correlate traffic with the client's end user when it sends one
+	if req.User != "" {
+		fields["user"] = req.User
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("enduser.id", req.User))
+	}
+	s.logger.Info("Chat completion request", fields)
+
+	if req.IsStream() {
+		if auditRec != nil {
+			auditRec.skipBody = true
+		}
+		s.handleChatCompletionsStream(w, r, req, requestID)
+		return
+	}
 
 	// Execute route for the requested model
 	response, err := s.manager.ExecuteWithTracing(r.Context(), req, requestID)
 	if err != nil {
-		s.logger.Error("Request execution failed", err, map[string]interface{}{
+		s.writeExecutionError(w, req.Model, requestID, err)
+		return
+	}
+
+	copyHeaders(w.Header(), response.Headers)
+	s.setDebugHeaders(w, r, response.Provider)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// copyHeaders adds the upstream headers a provider's response_headers selected
+func copyHeaders(dst, upstream http.Header) {
+	for name, values := range upstream {
+		dst[name] = values
+	}
+}
+
+// RouteHeader names the matched route on responses when debug_headers is on
+const RouteHeader = "X-Gateway-Route"
+
+// setDebugHeaders names the matched route and the provider that served the
+// response, when debug_headers is on. They are off by default since they
+// reveal the gateway's topology to clients.
+func (s *Server) setDebugHeaders(w http.ResponseWriter, r *http.Request, provider string) {
+	if !s.config.DebugHeaders {
+		return
+	}
+	if route := requestRoute(r); route != "" {
+		w.Header().Set(RouteHeader, route)
+	}
+	if provider != "" {
+		w.Header().Set(providers.ProviderHeader, provider)
+	}
+}
+
+// handleChatCompletionsStream proxies the provider's event stream to the client chunk by chunk
+func (s *Server) handleChatCompletionsStream(w http.ResponseWriter, r *http.Request, req types.ChatRequest, requestID string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.writeErrorResponse(w, "server_error", "Streaming is not supported by the server", "STREAMING_UNSUPPORTED", http.StatusInternalServerError, nil)
+		return
+	}
+
+	stream, err := s.manager.ExecuteStreamWithTracing(r.Context(), req, requestID)
+	if err != nil {
+		s.writeExecutionError(w, req.Model, requestID, err)
+		return
+	}
+	defer stream.Close()
+
+	contentType := stream.ContentType
+	if contentType == "" {
+		contentType = "text/event-stream"
+	}
+	copyHeaders(w.Header(), stream.Headers)
+	s.setDebugHeaders(w, r, stream.Provider)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// Copy upstream chunks as they arrive, including the final "data: [DONE]" event
+	buf := make([]byte, 4096)
+	for {
+		n, readErr := stream.Body.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				s.logger.Error("Failed to write stream chunk", err, map[string]interface{}{
+					"request_id": requestID,
+					"model":      req.Model,
+				})
+				return
+			}
+			flusher.Flush()
+		}
+		if readErr == io.EOF {
+			return
+		}
+		if readErr != nil {
+			s.logger.Error("Upstream stream interrupted", readErr, map[string]interface{}{
+				"request_id": requestID,
+				"model":      req.Model,
+			})
+			return
+		}
+	}
+}
+
+// recordRoute attaches the configured route matching the model to the request for
+// instrumentation; unknown models are not recorded to keep metric labels bounded
+func (s *Server) recordRoute(r *http.Request, model string) {
+	if route, err := s.manager.GetRoute(model); err == nil {
+		setRequestRoute(r, route.Name)
+	}
+}
+
+// authorizeRoute writes a 403 and returns false when the route matching the
+// model has allowed_keys that don't include the caller's key label
+func (s *Server) authorizeRoute(w http.ResponseWriter, r *http.Request, model, requestID string) bool {
+	route, err := s.manager.GetRoute(model)
+	if err != nil {
+		return true
+	}
+	label := requestKeyLabel(r)
+	if route.AllowsKey(label) {
+		return true
+	}
+	s.logger.Warn("API key not allowed for route", nil, map[string]interface{}{
+		"request_id": requestID,
+		"key_label":  label,
+		"route":      route.Name,
+	})
+	s.writeErrorResponse(w, "permission_error", fmt.Sprintf("API key is not allowed to use model '%s'", model), "KEY_NOT_ALLOWED", http.StatusForbidden, nil)
+	return false
+}
+
+// checkPromptSize records the prompt size for the route matching the model and
+// writes a 413 and returns false when it exceeds the route's max_prompt_chars
+func (s *Server) checkPromptSize(w http.ResponseWriter, req types.ChatRequest, requestID string) bool {
+	route, err := s.manager.GetRoute(req.Model)
+	if err != nil {
+		return true
+	}
+	chars := promptChars(req.Raw)
+	metrics.PromptChars.Observe(float64(chars), route.Name)
+	if route.MaxPromptChars == 0 || chars <= route.MaxPromptChars {
+		return true
+	}
+	s.logger.Warn("Prompt exceeds route limit", nil, map[string]interface{}{
+		"request_id":       requestID,
+		"route":            route.Name,
+		"prompt_chars":     chars,
+		"max_prompt_chars": route.MaxPromptChars,
+	})
+	s.writeErrorResponse(w, "request_error", fmt.Sprintf("Prompt has %d characters, more than the limit of %d for model '%s'", chars, route.MaxPromptChars, req.Model), "PROMPT_TOO_LARGE", http.StatusRequestEntityTooLarge, nil)
+	return false
+}
+
+// writeExecutionError maps route execution failures to error responses
+func (s *Server) writeExecutionError(w http.ResponseWriter, model, requestID string, err error) {
+	// Nobody is listening for the response; record the nginx-style 499 for metrics
+	if errors.Is(err, context.Canceled) {
+		s.logger.Warn("Client disconnected before completion", err, map[string]interface{}{
 			"request_id": requestID,
-			"model":      req.Model,
+			"model":      model,
 		})
+		w.WriteHeader(statusClientClosedRequest)
+		return
+	}
 
-		// Check if it's a route lookup error (no route found)
-		if err.Error() == fmt.Sprintf("route lookup failed: no route found for model '%s'", req.Model) {
-			s.writeErrorResponse(w, "route_error", fmt.Sprintf("No route configured for model '%s'", req.Model), "ROUTE_NOT_FOUND", http.StatusNotFound, nil)
-			return
+	s.logger.Error("Request execution failed", err, map[string]interface{}{
+		"request_id": requestID,
+		"model":      model,
+	})
+
+	// Check if it's a route lookup error (no route found)
+	if err.Error() == fmt.Sprintf("route lookup failed: no route found for model '%s'", model) {
+		s.writeErrorResponse(w, "route_error", fmt.Sprintf("No route configured for model '%s'", model), "ROUTE_NOT_FOUND", http.StatusNotFound, nil)
+		return
+	}
+
+	// X-Gateway-Provider named a provider the route doesn't use
+	if errors.Is(err, providers.ErrProviderNotInRoute) {
+		s.writeErrorResponse(w, "route_error", err.Error(), "PROVIDER_NOT_IN_ROUTE", http.StatusBadRequest, nil)
+		return
+	}
+
+	// The Idempotency-Key belongs to another request, or its first request is still running
+	if errors.Is(err, providers.ErrIdempotencyKeyReused) {
+		s.writeErrorResponse(w, "idempotency_error", err.Error(), "IDEMPOTENCY_KEY_REUSED", http.StatusUnprocessableEntity, nil)
+		return
+	}
+	if errors.Is(err, providers.ErrIdempotencyKeyInFlight) {
+		s.writeErrorResponse(w, "idempotency_error", err.Error(), "IDEMPOTENCY_KEY_IN_USE", http.StatusConflict, nil)
+		return
+	}
+
+	// The overall request_timeout expired before any step succeeded
+	if errors.Is(err, providers.ErrRequestTimeout) {
+		s.writeErrorResponse(w, "timeout_error", err.Error(), "REQUEST_TIMEOUT", http.StatusGatewayTimeout, nil)
+		return
+	}
+
+	// Check if it's a detailed route error with step information
+	if routeErr, ok := err.(types.RouteError); ok {
+		message := "All route steps failed"
+		if routeErr.FallbackStopped {
+			message = "Route step failed without fallback"
 		}
+		s.writeErrorResponse(w, "execution_error", message, "ROUTE_EXECUTION_FAILED", routeErrorStatus(routeErr), routeErr)
+		return
+	}
 
-		// Check if it's a detailed route error with step information
-		if routeErr, ok := err.(types.RouteError); ok {
-			s.writeErrorResponse(w, "execution_error", "All route steps failed", "ROUTE_EXECUTION_FAILED", http.StatusBadGateway, routeErr)
-			return
+	// Fallback for other errors
+	s.writeErrorResponse(w, "execution_error", err.Error(), "EXECUTION_FAILED", http.StatusBadGateway, nil)
+}
+
+// routeErrorStatus reduces the per-step upstream statuses to the response status.
+// When every step failed the same way the client sees that cause, e.g. 401 when
+// all providers rejected their keys or 429 when all were rate limited. Mixed
+// failures, transport errors and skipped steps map to 502. A route stopped by
+// fallback_on reports the status of the step that stopped it.
+func routeErrorStatus(routeErr types.RouteError) int {
+	if len(routeErr.Errors) == 0 {
+		return http.StatusBadGateway
+	}
+	if routeErr.FallbackStopped {
+		routeErr.Errors = routeErr.Errors[len(routeErr.Errors)-1:]
+	}
+
+	first := routeErr.Errors[0].StatusCode
+	same, auth := true, true
+	for _, stepErr := range routeErr.Errors {
+		if stepErr.StatusCode != first {
+			same = false
 		}
+		if stepErr.StatusCode != http.StatusUnauthorized && stepErr.StatusCode != http.StatusForbidden {
+			auth = false
+		}
+	}
+
+	switch {
+	case auth && !same:
+		return http.StatusUnauthorized
+	case !same || first == 0:
+		return http.StatusBadGateway
+	case first >= 400 && first < 500:
+		return first
+	case first == http.StatusServiceUnavailable || first == http.StatusGatewayTimeout:
+		return first
+	}
+	return http.StatusBadGateway
+}
+
+// handleEmbeddings handles embeddings requests
+func (s *Server) handleEmbeddings(w http.ResponseWriter, r *http.Request) {
+	requestID := requestIDFor(w, r)
+
+	var req types.EmbeddingsRequest
+	if !s.decodeRequestBody(w, r, &req, requestID) {
+		return
+	}
+	req.Headers = r.Header
+
+	if err := validateEmbeddingsRequest(&req); err != nil {
+		s.logger.Error("Invalid request", err, map[string]interface{}{
+			"request_id": requestID,
+			"model":      req.Model,
+		})
+		s.writeErrorResponse(w, "validation_error", err.Error(), "VALIDATION_FAILED", http.StatusBadRequest, nil)
+		return
+	}
+
+	s.recordRoute(r, req.Model)
+	if !s.authorizeRoute(w, r, req.Model, requestID) {
+		return
+	}
+
+	s.logger.Info("Embeddings request", map[string]interface{}{
+		"request_id": requestID,
+		"model":      req.Model,
+	})
+
+	response, err := s.manager.ExecuteEmbeddingsWithTracing(r.Context(), req, requestID)
+	if err != nil {
+		s.writeExecutionError(w, req.Model, requestID, err)
+		return
+	}
+
+	s.setDebugHeaders(w, r, response.Provider)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleCompletions handles legacy text completion requests
+func (s *Server) handleCompletions(w http.ResponseWriter, r *http.Request) {
+	requestID := requestIDFor(w, r)
+
+	var req types.CompletionRequest
+	if !s.decodeRequestBody(w, r, &req, requestID) {
+		return
+	}
+	req.Headers = r.Header
+
+	if err := validateCompletionRequest(&req); err != nil {
+		s.logger.Error("Invalid request", err, map[string]interface{}{
+			"request_id": requestID,
+			"model":      req.Model,
+		})
+		s.writeErrorResponse(w, "validation_error", err.Error(), "VALIDATION_FAILED", http.StatusBadRequest, nil)
+		return
+	}
 
-		// Fallback for other errors
-		s.writeErrorResponse(w, "execution_error", err.Error(), "EXECUTION_FAILED", http.StatusBadGateway, nil)
+	s.recordRoute(r, req.Model)
+	if !s.authorizeRoute(w, r, req.Model, requestID) {
+		return
+	}
+
+	s.logger.Info("Completion request", map[string]interface{}{
+		"request_id": requestID,
+		"model":      req.Model,
+	})
+
+	response, err := s.manager.ExecuteCompletionsWithTracing(r.Context(), req, requestID)
+	if err != nil {
+		s.writeExecutionError(w, req.Model, requestID, err)
 		return
 	}
 
+	s.setDebugHeaders(w, r, response.Provider)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
@@ -1,18 +1,38 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"ai-gateway/audit"
 	"ai-gateway/config"
 	"ai-gateway/logger"
 	"ai-gateway/providers"
 	"ai-gateway/types"
+	"ai-gateway/version"
 )
 
+func TestNewServer_Timeouts(t *testing.T) {
+	logger := logger.NewLogger()
+	manager := providers.NewManager(nil, nil, logger)
+
+	srv := NewServer(&config.Config{APIKey: "test-key"}, logger, manager)
+	if srv.httpSrv.ReadTimeout != 30*time.Second || srv.httpSrv.WriteTimeout != 30*time.Second {
+		t.Errorf("Expected 30s default timeouts, got read %s write %s", srv.httpSrv.ReadTimeout, srv.httpSrv.WriteTimeout)
+	}
+
+	srv = NewServer(&config.Config{APIKey: "test-key", ReadTimeout: "10s", WriteTimeout: "5m"}, logger, manager)
+	if srv.httpSrv.ReadTimeout != 10*time.Second || srv.httpSrv.WriteTimeout != 5*time.Minute {
+		t.Errorf("Expected configured timeouts, got read %s write %s", srv.httpSrv.ReadTimeout, srv.httpSrv.WriteTimeout)
+	}
+}
+
 func TestHandleHealth(t *testing.T) {
 	cfg := &config.Config{APIKey: "test-key", Port: 8080}
 	logger := logger.NewLogger()
@@ -34,10 +54,130 @@ func TestHandleHealth(t *testing.T) {
 	}
 }
 
+func TestHandleVersion(t *testing.T) {
+	cfg := &config.Config{APIKey: "test-key", Port: 8080}
+	logger := logger.NewLogger()
+	manager := providers.NewManager([]config.Provider{}, []config.Route{}, logger)
+	srv := NewServer(cfg, logger, manager)
+
+	defer func(v, c, d string) { version.Version, version.Commit, version.BuildDate = v, c, d }(version.Version, version.Commit, version.BuildDate)
+	version.Version, version.Commit, version.BuildDate = "1.2.3", "abc123", "2026-01-02T03:04:05Z"
+
+	// No API key needed
+	req := httptest.NewRequest("GET", "/version", nil)
+	rr := httptest.NewRecorder()
+	srv.httpSrv.Handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+	var response map[string]string
+	json.NewDecoder(rr.Body).Decode(&response)
+	if response["version"] != "1.2.3" || response["commit"] != "abc123" || response["build_date"] != "2026-01-02T03:04:05Z" {
+		t.Errorf("Unexpected version response %v", response)
+	}
+}
+
+func TestBasePath(t *testing.T) {
+	cfg := &config.Config{APIKey: "test-key", Port: 8080, BasePath: "/ai"}
+	logger := logger.NewLogger()
+	manager := providers.NewManager([]config.Provider{}, []config.Route{}, logger)
+	srv := NewServer(cfg, logger, manager)
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/ai/health", http.StatusOK},
+		{"/ai/version", http.StatusOK},
+		{"/ai/v1/models", http.StatusOK},
+		{"/health", http.StatusNotFound},
+		{"/v1/models", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.Header.Set("Authorization", "Bearer test-key")
+		rr := httptest.NewRecorder()
+		srv.httpSrv.Handler.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("GET %s: expected status %d, got %d", tt.path, tt.want, rr.Code)
+		}
+	}
+}
+
+func TestHandleReady(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer down.Close()
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"object":"list","data":[]}`))
+	}))
+	defer up.Close()
+
+	providersList := []config.Provider{
+		{Name: "down", APIKey: "key1", BaseURL: down.URL},
+		{Name: "up", APIKey: "key2", BaseURL: up.URL},
+		{Name: "off", APIKey: "key3", BaseURL: up.URL, Disabled: true},
+	}
+	routes := []config.Route{
+		{Name: "broken", Steps: []config.RouteStep{{Provider: "down", Model: "m"}}},
+		{Name: "fallback", Steps: []config.RouteStep{{Provider: "down", Model: "m"}, {Provider: "up", Model: "m"}}},
+		{Name: "switched-off", Steps: []config.RouteStep{{Provider: "off", Model: "m"}}},
+	}
+	cfg := &config.Config{APIKey: "test-key", Port: 8080}
+	logger := logger.NewLogger()
+	manager := providers.NewManager(providersList, routes, logger)
+	handler := NewServer(cfg, logger, manager).setupRoutes()
+
+	ready := func() (int, map[string]interface{}) {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/ready", nil))
+		var response map[string]interface{}
+		json.NewDecoder(rr.Body).Decode(&response)
+		return rr.Code, response
+	}
+
+	// Providers count as healthy until a probe says otherwise
+	if code, response := ready(); code != http.StatusOK || response["status"] != "ready" {
+		t.Fatalf("Expected 200 ready before any probe, got %d %v", code, response)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	manager.StartHealthChecks(ctx, time.Hour, 1)
+
+	deadline := time.Now().Add(2 * time.Second)
+	code, response := ready()
+	for code == http.StatusOK && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		code, response = ready()
+	}
+	if code != http.StatusServiceUnavailable || response["status"] != "unavailable" {
+		t.Fatalf("Expected 503 once a route's only provider is down, got %d %v", code, response)
+	}
+	unavailable, _ := response["unavailable_routes"].([]interface{})
+	if len(unavailable) != 1 || unavailable[0] != "broken" {
+		t.Errorf("Expected only the broken route to be unavailable, got %v", response["unavailable_routes"])
+	}
+	states, _ := response["providers"].(map[string]interface{})
+	if states["down"] != "unhealthy" || states["up"] != "healthy" || states["off"] != "disabled" {
+		t.Errorf("Unexpected provider states %v", states)
+	}
+
+	// Liveness is unaffected
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/health", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected /health to stay 200, got %d", rr.Code)
+	}
+}
+
 func TestHandleModels(t *testing.T) {
 	routes := []config.Route{
 		{Name: "test-route-1"},
 		{Name: "test-route-2"},
+		{Name: "disabled-route", Disabled: true},
 	}
 	cfg := &config.Config{APIKey: "test-key", Port: 8080, Routes: routes}
 	logger := logger.NewLogger()
@@ -66,6 +206,89 @@ func TestHandleModels(t *testing.T) {
 	}
 }
 
+func TestHandleModels_Upstream(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"object":"list","data":[{"id":"gpt-4o","object":"model","owned_by":"openai"},{"id":"chat"},{"id":"embed"}]}`))
+	}))
+	defer upstream.Close()
+
+	routes := []config.Route{{Name: "chat"}, {Name: "zeta"}}
+	providerCfgs := []config.Provider{{Name: "openai", APIKey: "key", BaseURL: upstream.URL}}
+	logger := logger.NewLogger()
+	manager := providers.NewManager(providerCfgs, routes, logger)
+
+	listModels := func(source string) string {
+		cfg := &config.Config{APIKey: "test-key", ModelsSource: source}
+		srv := NewServer(cfg, logger, manager)
+		rr := httptest.NewRecorder()
+		srv.handleModels(rr, httptest.NewRequest("GET", "/v1/models", nil))
+		var response types.ModelsResponse
+		json.NewDecoder(rr.Body).Decode(&response)
+		var ids []string
+		for _, model := range response.Data {
+			ids = append(ids, model.ID)
+		}
+		return strings.Join(ids, ",")
+	}
+
+	// Route names stand in until the upstream lists are fetched
+	if got := listModels(config.ModelsSourceUpstream); got != "chat,zeta" {
+		t.Errorf("Expected route names before the first refresh, got %s", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	manager.StartModelRefresh(ctx, time.Hour)
+	deadline := time.Now().Add(2 * time.Second)
+	for len(manager.UpstreamModels()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	tests := map[string]string{
+		config.ModelsSourceRoutes:   "chat,zeta",
+		config.ModelsSourceUpstream: "chat,embed,gpt-4o",
+		config.ModelsSourceBoth:     "chat,zeta,embed,gpt-4o",
+	}
+	for source, want := range tests {
+		if got := listModels(source); got != want {
+			t.Errorf("models_source %s: expected %s, got %s", source, want, got)
+		}
+	}
+}
+
+func TestHandleModels_Metadata(t *testing.T) {
+	routes := []config.Route{
+		{Name: "plain"},
+		{Name: "smart", Metadata: map[string]interface{}{"context_window": 128000, "supports_tools": true}},
+	}
+	cfg := &config.Config{APIKey: "test-key", Port: 8080, Routes: routes}
+	logger := logger.NewLogger()
+	manager := providers.NewManager([]config.Provider{}, routes, logger)
+	srv := NewServer(cfg, logger, manager)
+
+	req := httptest.NewRequest("GET", "/v1/models", nil)
+	req.Header.Set("X-Api-Key", "test-key")
+	rr := httptest.NewRecorder()
+	srv.handleModels(rr, req)
+
+	var response struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Data) != 2 {
+		t.Fatalf("Expected 2 models, got %d", len(response.Data))
+	}
+	if _, ok := response.Data[0]["metadata"]; ok {
+		t.Errorf("Expected no metadata field for a route without metadata, got %v", response.Data[0])
+	}
+	metadata, ok := response.Data[1]["metadata"].(map[string]interface{})
+	if !ok || metadata["context_window"] != float64(128000) || metadata["supports_tools"] != true {
+		t.Errorf("Expected route metadata to be surfaced, got %v", response.Data[1])
+	}
+}
+
 func TestHandleChatCompletions_AllStepsFail(t *testing.T) {
 	// Create mock server that always fails
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -170,4 +393,640 @@ func TestHandleChatCompletions_AllStepsFail(t *testing.T) {
 	if stepErr["error"] == "" {
 		t.Error("Expected non-empty error message")
 	}
-}
\ No newline at end of file
+	if _, ok := stepErr["duration_ms"].(float64); !ok {
+		t.Errorf("Expected the step duration in duration_ms, got %v", stepErr["duration_ms"])
+	}
+}
+func TestHandleChatCompletions_ProviderNotInRoute(t *testing.T) {
+	providersList := []config.Provider{
+		{Name: "provider1", APIKey: "key1", BaseURL: "http://127.0.0.1:0"},
+	}
+	routes := []config.Route{
+		{
+			Name:  "test-model",
+			Steps: []config.RouteStep{{Provider: "provider1", Model: "gpt-4"}},
+		},
+	}
+
+	cfg := &config.Config{APIKey: "test-key", Port: 8080}
+	logger := logger.NewLogger()
+	manager := providers.NewManager(providersList, routes, logger)
+	srv := NewServer(cfg, logger, manager)
+
+	requestBody := `{"model":"test-model","messages":[{"role":"user","content":"Hello"}]}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Api-Key", "test-key")
+	req.Header.Set(providers.ProviderHeader, "provider2")
+	rr := httptest.NewRecorder()
+
+	srv.handleChatCompletions(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rr.Code)
+	}
+	var errorResp types.ErrorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &errorResp); err != nil {
+		t.Fatalf("Failed to unmarshal error response: %v", err)
+	}
+	if errorResp.Error.Code != "PROVIDER_NOT_IN_ROUTE" {
+		t.Errorf("Expected code PROVIDER_NOT_IN_ROUTE, got %s", errorResp.Error.Code)
+	}
+}
+
+func TestHandleChatCompletions_AllowedKeys(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"ok","object":"chat.completion","choices":[]}`))
+	}))
+	defer upstream.Close()
+
+	providersList := []config.Provider{
+		{Name: "provider1", APIKey: "key1", BaseURL: upstream.URL},
+	}
+	routes := []config.Route{
+		{
+			Name:        "gpt-4",
+			AllowedKeys: []string{"research"},
+			Steps:       []config.RouteStep{{Provider: "provider1", Model: "gpt-4"}},
+		},
+		{
+			Name:  "gpt-4o-mini",
+			Steps: []config.RouteStep{{Provider: "provider1", Model: "gpt-4o-mini"}},
+		},
+	}
+
+	cfg := &config.Config{
+		APIKey:  "test-key",
+		APIKeys: []config.ClientKey{{Label: "research", Key: "research-key"}},
+		Port:    8080,
+	}
+	logger := logger.NewLogger()
+	manager := providers.NewManager(providersList, routes, logger)
+	handler := NewServer(cfg, logger, manager).setupRoutes()
+
+	tests := []struct {
+		name   string
+		apiKey string
+		model  string
+		want   int
+	}{
+		{name: "allowed key", apiKey: "research-key", model: "gpt-4", want: http.StatusOK},
+		{name: "key not allowed", apiKey: "test-key", model: "gpt-4", want: http.StatusForbidden},
+		{name: "open route", apiKey: "test-key", model: "gpt-4o-mini", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requestBody := `{"model":"` + tt.model + `","messages":[{"role":"user","content":"Hello"}]}`
+			req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Api-Key", tt.apiKey)
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.want {
+				t.Fatalf("Expected status %d, got %d: %s", tt.want, rr.Code, rr.Body.String())
+			}
+			if tt.want != http.StatusForbidden {
+				return
+			}
+			var errorResp types.ErrorResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &errorResp); err != nil {
+				t.Fatalf("Failed to unmarshal error response: %v", err)
+			}
+			if errorResp.Error.Code != "KEY_NOT_ALLOWED" {
+				t.Errorf("Expected code KEY_NOT_ALLOWED, got %s", errorResp.Error.Code)
+			}
+		})
+	}
+}
+
+func TestHandleChatCompletions_Stream(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"}}]}\n\n"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"lo\"}}]}\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer upstream.Close()
+
+	providersList := []config.Provider{
+		{Name: "provider1", APIKey: "key1", BaseURL: upstream.URL},
+	}
+	routes := []config.Route{
+		{
+			Name: "test-model",
+			Steps: []config.RouteStep{
+				{Provider: "provider1", Model: "gpt-4"},
+			},
+		},
+	}
+
+	cfg := &config.Config{APIKey: "test-key", Port: 8080}
+	logger := logger.NewLogger()
+	manager := providers.NewManager(providersList, routes, logger)
+	srv := NewServer(cfg, logger, manager)
+
+	requestBody := `{"model":"test-model","stream":true,"messages":[{"role":"user","content":"Hello"}]}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Api-Key", "test-key")
+	rr := httptest.NewRecorder()
+
+	srv.handleChatCompletions(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "text/event-stream; charset=utf-8" {
+		t.Errorf("Expected upstream Content-Type to be propagated, got '%s'", ct)
+	}
+	if !rr.Flushed {
+		t.Error("Expected response to be flushed while streaming")
+	}
+	body := rr.Body.String()
+	if !strings.Contains(body, `"content":"Hel"`) || !strings.Contains(body, `"content":"lo"`) {
+		t.Errorf("Expected both chunks to be proxied, got %q", body)
+	}
+	if !strings.HasSuffix(body, "data: [DONE]\n\n") {
+		t.Errorf("Expected [DONE] terminator to be preserved, got %q", body)
+	}
+}
+
+func TestHandleChatCompletions_RequestTooLarge(t *testing.T) {
+	cfg := &config.Config{APIKey: "test-key", Port: 8080, MaxRequestBytes: 64}
+	logger := logger.NewLogger()
+	manager := providers.NewManager([]config.Provider{}, []config.Route{}, logger)
+	srv := NewServer(cfg, logger, manager)
+
+	requestBody := `{"model":"test-model","messages":[{"role":"user","content":"` + strings.Repeat("a", 128) + `"}]}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(requestBody))
+	req.Header.Set("X-Api-Key", "test-key")
+	rr := httptest.NewRecorder()
+
+	srv.handleChatCompletions(rr, req)
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Expected status 413, got %d", rr.Code)
+	}
+
+	var errorResp types.ErrorResponse
+	if err := json.NewDecoder(rr.Body).Decode(&errorResp); err != nil {
+		t.Fatalf("Expected JSON ErrorResponse, got error: %v", err)
+	}
+	if errorResp.Error.Code != "REQUEST_TOO_LARGE" {
+		t.Errorf("Expected error code 'REQUEST_TOO_LARGE', got '%s'", errorResp.Error.Code)
+	}
+}
+
+func TestHandleChatCompletions_ResponseHeaders(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Ratelimit-Remaining-Requests", "42")
+		w.Header().Set("Openai-Processing-Ms", "120")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"ok","object":"chat.completion","choices":[]}`))
+	}))
+	defer upstream.Close()
+
+	providersList := []config.Provider{
+		{Name: "provider1", APIKey: "key1", BaseURL: upstream.URL, ResponseHeaders: []string{"x-ratelimit-remaining-requests"}},
+	}
+	routes := []config.Route{
+		{Name: "gpt-4", Steps: []config.RouteStep{{Provider: "provider1", Model: "gpt-4"}}},
+	}
+	cfg := &config.Config{APIKey: "test-key", Port: 8080}
+	logger := logger.NewLogger()
+	srv := NewServer(cfg, logger, providers.NewManager(providersList, routes, logger))
+
+	for _, stream := range []bool{false, true} {
+		requestBody := fmt.Sprintf(`{"model":"gpt-4","stream":%t,"messages":[{"role":"user","content":"Hello"}]}`, stream)
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(requestBody))
+		req.Header.Set("X-Api-Key", "test-key")
+		rr := httptest.NewRecorder()
+
+		srv.handleChatCompletions(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("stream=%t: expected status 200, got %d: %s", stream, rr.Code, rr.Body.String())
+		}
+		if got := rr.Header().Get("X-Ratelimit-Remaining-Requests"); got != "42" {
+			t.Errorf("stream=%t: expected the listed upstream header to be copied, got %q", stream, got)
+		}
+		if got := rr.Header().Get("Openai-Processing-Ms"); got != "" {
+			t.Errorf("stream=%t: expected unlisted upstream headers to be dropped, got %q", stream, got)
+		}
+	}
+}
+
+func TestHandleChatCompletions_MaxPromptChars(t *testing.T) {
+	var upstreamCalls int
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls++
+		w.Write([]byte(`{"id":"ok","object":"chat.completion","choices":[]}`))
+	}))
+	defer upstream.Close()
+
+	providersList := []config.Provider{{Name: "provider1", APIKey: "key1", BaseURL: upstream.URL}}
+	routes := []config.Route{
+		{Name: "small", MaxPromptChars: 10, Steps: []config.RouteStep{{Provider: "provider1", Model: "gpt-4o-mini"}}},
+	}
+	cfg := &config.Config{APIKey: "test-key", Port: 8080}
+	logger := logger.NewLogger()
+	srv := NewServer(cfg, logger, providers.NewManager(providersList, routes, logger))
+
+	tests := []struct {
+		name     string
+		messages string
+		want     int
+	}{
+		{name: "within limit", messages: `[{"role":"system","content":"Be nice"},{"role":"user","content":"Hi"}]`, want: http.StatusOK},
+		// Characters, not bytes, are counted
+		{name: "multibyte within limit", messages: `[{"role":"user","content":"Привет мир"}]`, want: http.StatusOK},
+		{name: "string content over limit", messages: `[{"role":"user","content":"Hello world"}]`, want: http.StatusRequestEntityTooLarge},
+		{name: "text blocks over limit", messages: `[{"role":"user","content":[{"type":"text","text":"Hello"},{"type":"image_url","image_url":{"url":"https://example.com/a.png"}},{"type":"text","text":"world!"}]}]`, want: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstreamCalls = 0
+			requestBody := `{"model":"small","messages":` + tt.messages + `}`
+			req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(requestBody))
+			req.Header.Set("X-Api-Key", "test-key")
+			rr := httptest.NewRecorder()
+
+			srv.handleChatCompletions(rr, req)
+
+			if rr.Code != tt.want {
+				t.Fatalf("Expected status %d, got %d: %s", tt.want, rr.Code, rr.Body.String())
+			}
+			if tt.want == http.StatusOK {
+				return
+			}
+			var errorResp types.ErrorResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &errorResp); err != nil {
+				t.Fatalf("Failed to unmarshal error response: %v", err)
+			}
+			if errorResp.Error.Code != "PROMPT_TOO_LARGE" {
+				t.Errorf("Expected error code 'PROMPT_TOO_LARGE', got '%s'", errorResp.Error.Code)
+			}
+			if upstreamCalls != 0 {
+				t.Errorf("Expected no upstream calls, got %d", upstreamCalls)
+			}
+		})
+	}
+}
+
+func TestHandleChatCompletions_MalformedBody(t *testing.T) {
+	cfg := &config.Config{APIKey: "test-key", Port: 8080}
+	logger := logger.NewLogger()
+	manager := providers.NewManager([]config.Provider{}, []config.Route{}, logger)
+	srv := NewServer(cfg, logger, manager)
+
+	tests := []struct {
+		name        string
+		body        string
+		wantCode    string
+		wantMessage string
+	}{
+		{"array", `[{"model":"test-model"}]`, "INVALID_JSON", "Request body must be a JSON object"},
+		{"string", `"hello"`, "INVALID_JSON", "Request body must be a JSON object"},
+		{"null", ` null`, "INVALID_JSON", "Request body must be a JSON object"},
+		{"empty", ``, "INVALID_JSON", "Request body must be a JSON object"},
+		{"invalid UTF-8", "{\"model\":\"test-model\",\"messages\":[{\"role\":\"user\",\"content\":\"\xff\"}]}", "INVALID_ENCODING", "Request body must be valid UTF-8"},
+		{"truncated object", `{"model":`, "INVALID_JSON", "Invalid JSON in request body"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(tt.body))
+			req.Header.Set("X-Api-Key", "test-key")
+			rr := httptest.NewRecorder()
+
+			srv.handleChatCompletions(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status 400, got %d", rr.Code)
+			}
+			var errorResp types.ErrorResponse
+			if err := json.NewDecoder(rr.Body).Decode(&errorResp); err != nil {
+				t.Fatalf("Expected JSON ErrorResponse, got error: %v", err)
+			}
+			if errorResp.Error.Code != tt.wantCode || errorResp.Error.Message != tt.wantMessage {
+				t.Errorf("Expected %s %q, got %s %q", tt.wantCode, tt.wantMessage, errorResp.Error.Code, errorResp.Error.Message)
+			}
+		})
+	}
+}
+
+func TestHandleEmbeddings(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/embeddings" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"object":"list","data":[{"object":"embedding","index":0,"embedding":[0.5]}],"model":"embed-v1"}`))
+	}))
+	defer upstream.Close()
+
+	providersList := []config.Provider{
+		{Name: "provider1", APIKey: "key1", BaseURL: upstream.URL},
+	}
+	routes := []config.Route{
+		{
+			Name: "embeddings",
+			Steps: []config.RouteStep{
+				{Provider: "provider1", Model: "embed-v1"},
+			},
+		},
+	}
+
+	cfg := &config.Config{APIKey: "test-key", Port: 8080}
+	logger := logger.NewLogger()
+	manager := providers.NewManager(providersList, routes, logger)
+	srv := NewServer(cfg, logger, manager)
+
+	req := httptest.NewRequest("POST", "/v1/embeddings", strings.NewReader(`{"model":"embeddings","input":["Hello"]}`))
+	req.Header.Set("X-Api-Key", "test-key")
+	rr := httptest.NewRecorder()
+
+	srv.handleEmbeddings(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var response map[string]interface{}
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response["model"] != "embed-v1" {
+		t.Errorf("Expected upstream response to be passed through, got %v", response)
+	}
+}
+
+func TestHandleCompletions(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/completions" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["model"] != "text-v1" || body["prompt"] != "Say hello" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"object":"text_completion","model":"text-v1","choices":[{"text":"hello","index":0}]}`))
+	}))
+	defer upstream.Close()
+
+	providersList := []config.Provider{
+		{Name: "provider1", APIKey: "key1", BaseURL: upstream.URL},
+	}
+	routes := []config.Route{
+		{
+			Name: "legacy",
+			Steps: []config.RouteStep{
+				{Provider: "provider1", Model: "text-v1"},
+			},
+		},
+	}
+
+	cfg := &config.Config{APIKey: "test-key", Port: 8080}
+	logger := logger.NewLogger()
+	manager := providers.NewManager(providersList, routes, logger)
+	srv := NewServer(cfg, logger, manager)
+
+	req := httptest.NewRequest("POST", "/v1/completions", strings.NewReader(`{"model":"legacy","prompt":"Say hello"}`))
+	req.Header.Set("X-Api-Key", "test-key")
+	rr := httptest.NewRecorder()
+
+	srv.handleCompletions(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var response map[string]interface{}
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response["object"] != "text_completion" {
+		t.Errorf("Expected upstream response to be passed through, got %v", response)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	cfg := &config.Config{APIKey: "test-key", Port: 8080, MetricsEnabled: true}
+	logger := logger.NewLogger()
+	manager := providers.NewManager([]config.Provider{}, []config.Route{}, logger)
+	srv := NewServer(cfg, logger, manager)
+	handler := srv.setupRoutes()
+
+	// Generate some traffic first so the request counter has a series
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/health", nil))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 without auth, got %d", rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), `ai_gateway_requests_total{path="/health",route="",status="200"}`) {
+		t.Errorf("Expected health request to be counted, got:\n%s", rr.Body.String())
+	}
+}
+
+func TestMetricsEndpoint_Disabled(t *testing.T) {
+	cfg := &config.Config{APIKey: "test-key", Port: 8080}
+	logger := logger.NewLogger()
+	manager := providers.NewManager([]config.Provider{}, []config.Route{}, logger)
+	srv := NewServer(cfg, logger, manager)
+
+	rr := httptest.NewRecorder()
+	srv.setupRoutes().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 when metrics are disabled, got %d", rr.Code)
+	}
+}
+
+func TestRouteErrorStatus(t *testing.T) {
+	steps := func(codes ...int) types.RouteError {
+		var routeErr types.RouteError
+		for i, code := range codes {
+			routeErr.Errors = append(routeErr.Errors, types.RouteStepError{StepIndex: i, StatusCode: code})
+		}
+		return routeErr
+	}
+
+	tests := []struct {
+		name string
+		err  types.RouteError
+		want int
+	}{
+		{name: "no steps", err: steps(), want: http.StatusBadGateway},
+		{name: "all unauthorized", err: steps(401, 401), want: http.StatusUnauthorized},
+		{name: "mixed auth errors", err: steps(401, 403), want: http.StatusUnauthorized},
+		{name: "all rate limited", err: steps(429, 429, 429), want: http.StatusTooManyRequests},
+		{name: "all unavailable", err: steps(503, 503), want: http.StatusServiceUnavailable},
+		{name: "all internal errors", err: steps(500, 500), want: http.StatusBadGateway},
+		{name: "mixed failures", err: steps(429, 500), want: http.StatusBadGateway},
+		{name: "transport error", err: steps(0, 429), want: http.StatusBadGateway},
+		{name: "stopped by fallback_on", err: types.RouteError{FallbackStopped: true, Errors: []types.RouteStepError{{StatusCode: 0}, {StatusCode: 422}}}, want: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := routeErrorStatus(tt.err); got != tt.want {
+				t.Errorf("routeErrorStatus() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// auditSink collects audit entries written by the server
+type auditSink struct {
+	entries []audit.Entry
+}
+
+func (s *auditSink) Write(entry audit.Entry) error {
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+func (s *auditSink) Close() error { return nil }
+
+func TestHandleChatCompletions_Audit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"test-id","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"Hi there"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	providersList := []config.Provider{
+		{Name: "provider1", APIKey: "key1", BaseURL: server.URL},
+	}
+	routes := []config.Route{
+		{
+			Name:  "test-model",
+			Steps: []config.RouteStep{{Provider: "provider1", Model: "gpt-4"}},
+		},
+	}
+
+	cfg := &config.Config{APIKey: "test-key", Port: 8080}
+	logger := logger.NewLogger()
+	manager := providers.NewManager(providersList, routes, logger)
+	srv := NewServer(cfg, logger, manager)
+	sink := &auditSink{}
+	auditLog := audit.NewLogger(sink, nil, 0, logger)
+	srv.SetAuditLogger(auditLog)
+
+	requestBody := `{"model":"test-model","messages":[{"role":"user","content":"` + strings.Repeat("long ", 200) + `"}]}`
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(requestBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer test-key")
+	rr := httptest.NewRecorder()
+
+	srv.handleChatCompletions(rr, req)
+	auditLog.Close()
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+	if len(sink.entries) != 1 {
+		t.Fatalf("Expected 1 audit entry, got %d", len(sink.entries))
+	}
+	entry := sink.entries[0]
+	if entry.Status != http.StatusOK || entry.Model != "test-model" || entry.RequestID == "" {
+		t.Errorf("Unexpected audit entry: %+v", entry)
+	}
+	if !strings.Contains(string(entry.Request), strings.Repeat("long ", 200)) {
+		t.Errorf("Expected the full request body, got %s", entry.Request)
+	}
+	if !strings.Contains(string(entry.Response), "Hi there") {
+		t.Errorf("Expected the response body, got %s", entry.Response)
+	}
+	if entry.Headers["Authorization"] != "[REDACTED]" {
+		t.Errorf("Expected Authorization to be redacted, got %q", entry.Headers["Authorization"])
+	}
+}
+
+func TestHandleChatCompletions_DebugHeaders(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"ok","object":"chat.completion","choices":[]}`))
+	}))
+	defer upstream.Close()
+
+	providersList := []config.Provider{
+		{Name: "provider1", APIKey: "key1", BaseURL: upstream.URL},
+	}
+	routes := []config.Route{
+		{Name: "gpt-4", Steps: []config.RouteStep{{Provider: "provider1", Model: "gpt-4"}}},
+	}
+	logger := logger.NewLogger()
+	manager := providers.NewManager(providersList, routes, logger)
+
+	for _, debug := range []bool{false, true} {
+		cfg := &config.Config{APIKey: "test-key", Port: 8080, DebugHeaders: debug}
+		srv := NewServer(cfg, logger, manager)
+
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"Hello"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Api-Key", "test-key")
+		rr := httptest.NewRecorder()
+		srv.httpSrv.Handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		route, provider := rr.Header().Get(RouteHeader), rr.Header().Get(providers.ProviderHeader)
+		if debug && (route != "gpt-4" || provider != "provider1") {
+			t.Errorf("Expected the route and provider headers with debug_headers, got %q and %q", route, provider)
+		}
+		if !debug && (route != "" || provider != "") {
+			t.Errorf("Expected no debug headers by default, got %q and %q", route, provider)
+		}
+	}
+}
+
+func TestHandleChatCompletions_IdempotencyKeyReused(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":"ok","object":"chat.completion","choices":[]}`))
+	}))
+	defer upstream.Close()
+
+	providersList := []config.Provider{
+		{Name: "provider1", APIKey: "key1", BaseURL: upstream.URL},
+	}
+	routes := []config.Route{
+		{Name: "gpt-4", Steps: []config.RouteStep{{Provider: "provider1", Model: "gpt-4"}}},
+	}
+	cfg := &config.Config{APIKey: "test-key", Port: 8080}
+	logger := logger.NewLogger()
+	manager := providers.NewManager(providersList, routes, logger)
+	manager.EnableIdempotency(time.Minute, 10)
+	srv := NewServer(cfg, logger, manager)
+
+	send := func(content string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"`+content+`"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Api-Key", "test-key")
+		req.Header.Set(providers.IdempotencyHeader, "order-1")
+		rr := httptest.NewRecorder()
+		srv.httpSrv.Handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := send("Hello"); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr := send("Something else")
+	var errorResp types.ErrorResponse
+	json.Unmarshal(rr.Body.Bytes(), &errorResp)
+	if rr.Code != http.StatusUnprocessableEntity || errorResp.Error.Code != "IDEMPOTENCY_KEY_REUSED" {
+		t.Errorf("Expected 422 IDEMPOTENCY_KEY_REUSED for a reused key, got %d %s", rr.Code, errorResp.Error.Code)
+	}
+}
@@ -1,10 +1,51 @@
 package server
 
 import (
+	"context"
+	"crypto/subtle"
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
+// shutdownRetryAfter is the Retry-After, in seconds, sent while shutting down
+const shutdownRetryAfter = 5
+
+// shutdownMiddleware answers new requests with 503 once Stop has been called,
+// so clients on a kept-alive connection get a clean retryable error instead
+// of a reset. Requests already being handled are left to finish.
+func (s *Server) shutdownMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.shuttingDown.Load() {
+			w.Header().Set("Retry-After", strconv.Itoa(shutdownRetryAfter))
+			w.Header().Set("Connection", "close")
+			s.writeErrorResponse(w, "server_error", "Server is shutting down, retry later", "SHUTTING_DOWN", http.StatusServiceUnavailable, nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowMethod answers requests with any other method with 405 and an Allow
+// header, instead of letting e.g. a GET fail later on its empty body. A plain
+// OPTIONS request gets the Allow header with 204; CORS preflights are
+// answered before reaching it.
+func (s *Server) allowMethod(method string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == method {
+			next(w, r)
+			return
+		}
+		w.Header().Set("Allow", method+", OPTIONS")
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		s.writeErrorResponse(w, "request_error", fmt.Sprintf("Method %s is not allowed, use %s", r.Method, method), "METHOD_NOT_ALLOWED", http.StatusMethodNotAllowed, nil)
+	}
+}
+
 // authMiddleware validates API key authentication
 func (s *Server) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -14,19 +55,11 @@ func (s *Server) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		// Check X-Api-Key header
-		apiKey := r.Header.Get("X-Api-Key")
-
-		// If not found, check Authorization header
-		if apiKey == "" {
-			authHeader := r.Header.Get("Authorization")
-			if strings.HasPrefix(authHeader, "Bearer ") {
-				apiKey = strings.TrimPrefix(authHeader, "Bearer ")
-			}
-		}
+		apiKey := requestAPIKey(r)
 
 		// Validate API key
-		if apiKey == "" || apiKey != s.config.APIKey {
+		label, ok := s.keyLabel(apiKey)
+		if !ok {
 			s.logger.Error("Authentication failed", nil, map[string]interface{}{
 				"path": r.URL.Path,
 				"has_key": apiKey != "",
@@ -34,8 +67,126 @@ func (s *Server) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
+		setRequestKeyLabel(r, label)
 
 		// Call next handler
 		next(w, r)
 	}
-}
\ No newline at end of file
+}
+
+// keyLabel returns the label of the client key matching apiKey
+func (s *Server) keyLabel(apiKey string) (string, bool) {
+	if apiKey == "" {
+		return "", false
+	}
+	for _, key := range s.config.ClientKeys() {
+		if subtle.ConstantTimeCompare([]byte(apiKey), []byte(key.Key)) == 1 {
+			return key.Label, true
+		}
+	}
+	return "", false
+}
+
+// requestAPIKey returns the gateway API key sent in the X-Api-Key header or,
+// failing that, as an Authorization bearer token
+func requestAPIKey(r *http.Request) string {
+	// Check X-Api-Key header
+	apiKey := r.Header.Get("X-Api-Key")
+
+	// If not found, check Authorization header
+	if apiKey == "" {
+		authHeader := r.Header.Get("Authorization")
+		if strings.HasPrefix(authHeader, "Bearer ") {
+			apiKey = strings.TrimPrefix(authHeader, "Bearer ")
+		}
+	}
+	return apiKey
+}
+
+// statusRecorder captures the response status while passing writes and flushes through
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status code before writing it
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Write records an implicit 200 status if no header was written yet
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush forwards to the underlying writer so streaming keeps working
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Status returns the recorded status code, defaulting to 200
+func (r *statusRecorder) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+// requestInfo carries details discovered by handlers back to the instrumentation middleware
+type requestInfo struct {
+	route     string
+	requestID string
+	keyLabel  string // label of the client key the request authenticated with
+}
+
+type requestInfoKey struct{}
+
+// withRequestInfo attaches an empty requestInfo to the request context
+func withRequestInfo(ctx context.Context, info *requestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// setRequestRoute records the matched gateway route for the current request
+func setRequestRoute(r *http.Request, route string) {
+	if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+		info.route = route
+	}
+}
+
+// requestRoute returns the route recorded for the current request, empty when there is none
+func requestRoute(r *http.Request) string {
+	if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+		return info.route
+	}
+	return ""
+}
+
+// setRequestID records the gateway request ID so the access log can include it
+func setRequestID(r *http.Request, requestID string) {
+	if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+		info.requestID = requestID
+	}
+}
+
+// setRequestKeyLabel records the label of the authenticated client key
+func setRequestKeyLabel(r *http.Request, label string) {
+	if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+		info.keyLabel = label
+	}
+}
+
+// requestKeyLabel returns the label recorded by authMiddleware, empty when there is none
+func requestKeyLabel(r *http.Request) string {
+	if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+		return info.keyLabel
+	}
+	return ""
+}
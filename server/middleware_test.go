@@ -1,8 +1,13 @@
 package server
 
 import (
+	"bytes"
+	"encoding/json"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
 
 	"ai-gateway/config"
@@ -12,8 +17,9 @@ import (
 
 func TestAuthMiddleware(t *testing.T) {
 	cfg := &config.Config{
-		APIKey: "test-api-key",
-		Port:   8080,
+		APIKey:  "test-api-key",
+		APIKeys: []config.ClientKey{{Label: "team-a", Key: "team-a-key"}},
+		Port:    8080,
 	}
 	logger := logger.NewLogger()
 	manager := providers.NewManager([]config.Provider{}, []config.Route{}, logger)
@@ -38,6 +44,12 @@ func TestAuthMiddleware(t *testing.T) {
 			path:           "/v1/models",
 			expectedStatus: http.StatusOK,
 		},
+		{
+			name:           "labeled api key",
+			apiKey:         "team-a-key",
+			path:           "/v1/models",
+			expectedStatus: http.StatusOK,
+		},
 		{
 			name:           "missing auth",
 			path:           "/v1/models",
@@ -73,4 +85,135 @@ func TestAuthMiddleware(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestInstrument_AccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	cfg := &config.Config{APIKey: "test-key", Port: 8080}
+	logger := logger.NewLogger()
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	manager := providers.NewManager([]config.Provider{}, []config.Route{}, logger)
+	srv := NewServer(cfg, logger, manager)
+
+	req := httptest.NewRequest("POST", "/v1/embeddings", strings.NewReader(`{}`))
+	req.Header.Set("X-Api-Key", "test-key")
+	srv.setupRoutes().ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry struct {
+		Message string                 `json:"message"`
+		Fields  map[string]interface{} `json:"fields"`
+	}
+	found := false
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if json.Unmarshal([]byte(line), &entry) == nil && entry.Message == "HTTP request" {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Fatalf("Expected an access log entry, got:\n%s", buf.String())
+	}
+	if entry.Fields["method"] != "POST" || entry.Fields["path"] != "/v1/embeddings" || entry.Fields["status"] != float64(http.StatusBadRequest) {
+		t.Errorf("Unexpected access log fields: %v", entry.Fields)
+	}
+	if _, ok := entry.Fields["duration_ms"]; !ok {
+		t.Errorf("Expected duration_ms in access log, got %v", entry.Fields)
+	}
+	if id, _ := entry.Fields["request_id"].(string); id == "" {
+		t.Errorf("Expected the handler's request ID in access log, got %v", entry.Fields)
+	}
+}
+
+func TestAllowMethod(t *testing.T) {
+	cfg := &config.Config{APIKey: "test-api-key", Port: 8080}
+	logger := logger.NewLogger()
+	srv := NewServer(cfg, logger, providers.NewManager([]config.Provider{}, []config.Route{}, logger))
+
+	tests := []struct {
+		method     string
+		path       string
+		wantStatus int
+		wantAllow  string
+	}{
+		{http.MethodGet, "/v1/chat/completions", http.StatusMethodNotAllowed, "POST, OPTIONS"},
+		{http.MethodPut, "/v1/embeddings", http.StatusMethodNotAllowed, "POST, OPTIONS"},
+		{http.MethodPost, "/v1/models", http.StatusMethodNotAllowed, "GET, OPTIONS"},
+		{http.MethodOptions, "/v1/chat/completions", http.StatusNoContent, "POST, OPTIONS"},
+		{http.MethodGet, "/v1/models", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("X-Api-Key", "test-api-key")
+		rr := httptest.NewRecorder()
+		srv.httpSrv.Handler.ServeHTTP(rr, req)
+
+		if rr.Code != tt.wantStatus || rr.Header().Get("Allow") != tt.wantAllow {
+			t.Errorf("%s %s: got %d with Allow %q, want %d with %q", tt.method, tt.path, rr.Code, rr.Header().Get("Allow"), tt.wantStatus, tt.wantAllow)
+		}
+		if tt.wantStatus == http.StatusMethodNotAllowed && !strings.Contains(rr.Body.String(), "METHOD_NOT_ALLOWED") {
+			t.Errorf("%s %s: expected the METHOD_NOT_ALLOWED error code, got %s", tt.method, tt.path, rr.Body.String())
+		}
+	}
+}
+
+func TestShutdownMiddleware(t *testing.T) {
+	cfg := &config.Config{APIKey: "test-api-key", Port: 8080}
+	logger := logger.NewLogger()
+	srv := NewServer(cfg, logger, providers.NewManager([]config.Provider{}, []config.Route{}, logger))
+
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+		req.Header.Set("X-Api-Key", "test-api-key")
+		rr := httptest.NewRecorder()
+		srv.httpSrv.Handler.ServeHTTP(rr, req)
+		return rr
+	}
+	if rr := serve(); rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 before shutdown, got %d", rr.Code)
+	}
+
+	if err := srv.Stop(t.Context()); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	rr := serve()
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") != "5" {
+		t.Errorf("Expected 503 with Retry-After 5 while shutting down, got %d %q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+	if !strings.Contains(rr.Body.String(), "SHUTTING_DOWN") {
+		t.Errorf("Expected the SHUTTING_DOWN error code, got %s", rr.Body.String())
+	}
+}
+
+func TestRequestIDFor(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		reuse    bool
+	}{
+		{"client supplied", "trace-abc-123", true},
+		{"absent", "", false},
+		{"contains spaces", "bad id", false},
+		{"too long", strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+			if tt.incoming != "" {
+				req.Header.Set("X-Request-Id", tt.incoming)
+			}
+			rr := httptest.NewRecorder()
+
+			id := requestIDFor(rr, req)
+			if id == "" {
+				t.Fatal("Expected a request ID")
+			}
+			if (id == tt.incoming) != tt.reuse {
+				t.Errorf("requestIDFor() = %q with incoming %q, reuse %v", id, tt.incoming, tt.reuse)
+			}
+			if got := rr.Header().Get("X-Request-Id"); got != id {
+				t.Errorf("Expected X-Request-Id response header %q, got %q", id, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimiter keeps a token bucket per gateway API key
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    float64 // tokens added per second
+	burst   float64 // bucket capacity
+	buckets map[string]*tokenBucket
+	now     func() time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter creates a limiter allowing rps requests per second per key with the given burst
+func newRateLimiter(rps float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:    rps,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+// allow takes a token from the key's bucket. When the bucket is empty it
+// returns false and how long until the next token is available.
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	// Refill for the time elapsed since the last request
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// rateLimitMiddleware rejects requests above the per-key rate with 429 RATE_LIMITED.
+// It runs after authMiddleware, so the key has already been validated.
+func (s *Server) rateLimitMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.limiter == nil {
+			next(w, r)
+			return
+		}
+
+		ok, wait := s.limiter.allow(requestAPIKey(r))
+		if !ok {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			s.logger.Warn("Rate limit exceeded", nil, map[string]interface{}{
+				"path":        r.URL.Path,
+				"retry_after": retryAfter,
+			})
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			s.writeErrorResponse(w, "rate_limit_error", "Rate limit exceeded, retry later", "RATE_LIMITED", http.StatusTooManyRequests, nil)
+			return
+		}
+
+		next(w, r)
+	}
+}
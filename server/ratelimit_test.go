@@ -0,0 +1,75 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ai-gateway/config"
+	"ai-gateway/logger"
+	"ai-gateway/providers"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := newRateLimiter(2, 2)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := limiter.allow("team-a"); !ok {
+			t.Fatalf("request %d within burst was rejected", i+1)
+		}
+	}
+	ok, wait := limiter.allow("team-a")
+	if ok {
+		t.Fatal("expected request beyond burst to be rejected")
+	}
+	if wait != 500*time.Millisecond {
+		t.Errorf("expected 500ms until next token, got %v", wait)
+	}
+
+	// Other keys have their own bucket
+	if ok, _ := limiter.allow("team-b"); !ok {
+		t.Error("expected a different key to be allowed")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if ok, _ := limiter.allow("team-a"); !ok {
+		t.Error("expected request to be allowed after refill")
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	cfg := &config.Config{
+		APIKey:         "test-api-key",
+		RateLimitRPS:   1,
+		RateLimitBurst: 1,
+	}
+	logger := logger.NewLogger()
+	manager := providers.NewManager([]config.Provider{}, []config.Route{}, logger)
+	srv := NewServer(cfg, logger, manager)
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/v1/models", nil)
+		req.Header.Set("X-Api-Key", "test-api-key")
+		w := httptest.NewRecorder()
+		srv.httpSrv.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send(); w.Code != http.StatusOK {
+		t.Fatalf("expected first request to succeed, got %d", w.Code)
+	}
+	w := send()
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected Retry-After 1, got %q", w.Header().Get("Retry-After"))
+	}
+	if !strings.Contains(w.Body.String(), "RATE_LIMITED") {
+		t.Errorf("expected RATE_LIMITED code, got %s", w.Body.String())
+	}
+}
@@ -5,12 +5,18 @@ import (
 	"crypto/tls"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"ai-gateway/audit"
 	"ai-gateway/config"
 	"ai-gateway/logger"
+	"ai-gateway/metrics"
 	"ai-gateway/providers"
 	"ai-gateway/telemetry"
+	"ai-gateway/version"
 
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
@@ -22,6 +28,14 @@ type Server struct {
 	manager *providers.Manager
 	logger  *logger.Logger
 	httpSrv *http.Server
+	limiter *rateLimiter   // nil when rate limiting is disabled
+	slots   chan struct{}  // running chat completions, nil without max_concurrent_requests
+	budgets *budgetTracker // nil without budgets
+	audit   *audit.Logger  // nil when audit_enabled is off
+	// loadConfig re-reads the configuration for POST /admin/reload
+	loadConfig func() (*config.Config, error)
+	// shuttingDown is set by Stop; new requests then get a 503
+	shuttingDown atomic.Bool
 }
 
 // NewServer creates a new server instance
@@ -31,6 +45,15 @@ func NewServer(cfg *config.Config, logger *logger.Logger, manager *providers.Man
 		logger:  logger,
 		manager: manager,
 	}
+	if cfg.RateLimitRPS > 0 {
+		srv.limiter = newRateLimiter(cfg.RateLimitRPS, cfg.GetRateLimitBurst())
+	}
+	if len(cfg.Budgets) > 0 {
+		srv.budgets = newBudgetTracker(cfg.Budgets, cfg.GetBudgetPeriod())
+	}
+	if cfg.MaxConcurrentRequests > 0 {
+		srv.slots = make(chan struct{}, cfg.MaxConcurrentRequests)
+	}
 
 	mux := srv.setupRoutes()
 	srv.httpSrv = &http.Server{
@@ -39,8 +62,8 @@ func NewServer(cfg *config.Config, logger *logger.Logger, manager *providers.Man
 		TLSConfig: &tls.Config{
 			MinVersion: tls.VersionTLS12,
 		},
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 30 * time.Second,
+		ReadTimeout:  cfg.GetReadTimeout(),
+		WriteTimeout: cfg.GetWriteTimeout(),
 	}
 
 	return srv
@@ -49,15 +72,41 @@ func NewServer(cfg *config.Config, logger *logger.Logger, manager *providers.Man
 // setupRoutes configures HTTP routes
 func (s *Server) setupRoutes() http.Handler {
 	mux := http.NewServeMux()
+	path := func(pattern string) string { return withBasePath(s.config.BasePath, pattern) }
 
 	// Health endpoint (no auth required)
-	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc(path("/health"), s.handleHealth)
+	// Readiness reflects provider health checks (no auth required)
+	mux.HandleFunc(path("/ready"), s.handleReady)
+	// Build version (no auth required)
+	mux.HandleFunc(path("GET /version"), s.handleVersion)
+
+	// Prometheus metrics (no auth required)
+	if s.config.MetricsEnabled {
+		mux.Handle(path("/metrics"), metrics.Handler())
+	}
 
 	// Protected endpoints
-	mux.HandleFunc("/v1/models", s.authMiddleware(s.handleModels))
-	mux.HandleFunc("/v1/chat/completions", s.authMiddleware(s.handleChatCompletions))
+	mux.HandleFunc(path("/v1/models"), s.allowMethod(http.MethodGet, s.authMiddleware(s.rateLimitMiddleware(s.handleModels))))
+	mux.HandleFunc(path("/v1/chat/completions"), s.allowMethod(http.MethodPost, s.authMiddleware(s.rateLimitMiddleware(s.budgetMiddleware(s.concurrencyMiddleware(s.handleChatCompletions))))))
+	mux.HandleFunc(path("/v1/embeddings"), s.allowMethod(http.MethodPost, s.authMiddleware(s.rateLimitMiddleware(s.budgetMiddleware(s.handleEmbeddings)))))
+	mux.HandleFunc(path("/v1/completions"), s.allowMethod(http.MethodPost, s.authMiddleware(s.rateLimitMiddleware(s.budgetMiddleware(s.handleCompletions)))))
+
+	// Admin endpoints use their own key and are disabled without one
+	if s.config.AdminAPIKey != "" {
+		mux.HandleFunc(path("POST /admin/reload"), s.adminAuthMiddleware(s.handleAdminReload))
+		mux.HandleFunc(path("GET /admin/routes"), s.adminAuthMiddleware(s.handleAdminRoutes))
+	}
+
+	return s.instrument(s.shutdownMiddleware(s.corsMiddleware(mux)))
+}
 
-	return s.instrument(mux)
+// withBasePath prefixes the path of a mux pattern, which may start with a method
+func withBasePath(base, pattern string) string {
+	if method, path, ok := strings.Cut(pattern, " "); ok {
+		return method + " " + base + path
+	}
+	return base + pattern
 }
 
 func (s *Server) instrument(next http.Handler) http.Handler {
@@ -72,14 +121,52 @@ func (s *Server) instrument(next http.Handler) http.Handler {
 		)
 		defer span.End()
 
-		next.ServeHTTP(w, r.WithContext(ctx))
+		start := time.Now()
+		info := &requestInfo{}
+		rec := &statusRecorder{ResponseWriter: w}
+		req := r.WithContext(withRequestInfo(ctx, info))
+		next.ServeHTTP(rec, req)
+		duration := time.Since(start)
+
+		// The mux fills in the matched pattern; unmatched paths share one label to bound cardinality
+		path := req.Pattern
+		if path == "" {
+			path = "unmatched"
+		}
+		metrics.RequestsTotal.Inc(path, info.route, strconv.Itoa(rec.Status()))
+		s.logAccess(r, rec.Status(), duration, info)
 	})
 }
 
-// Start starts the HTTPS server
+// logAccess writes the access log entry for a completed request
+func (s *Server) logAccess(r *http.Request, status int, duration time.Duration, info *requestInfo) {
+	fields := map[string]interface{}{
+		"method":      r.Method,
+		"path":        r.URL.Path,
+		"status":      status,
+		"duration_ms": duration.Milliseconds(),
+	}
+	if info.route != "" {
+		fields["route"] = info.route
+	}
+	if info.requestID != "" {
+		fields["request_id"] = info.requestID
+	}
+	if info.keyLabel != "" {
+		fields["key_label"] = info.keyLabel
+	}
+	s.logger.Info("HTTP request", fields)
+}
+
+// Start starts the server, serving HTTPS when a TLS certificate is configured
 func (s *Server) Start() error {
+	build := version.Get()
 	s.logger.Info("Starting server", map[string]interface{}{
+		"version":    build.Version,
+		"commit":     build.Commit,
+		"build_date": build.BuildDate,
 		"port":       s.config.Port,
+		"tls":        s.config.TLSEnabled(),
 		"providers":  len(s.config.Providers),
 		"routes":     len(s.config.Routes),
 		"route_names": func(routes []config.Route) []string {
@@ -92,11 +179,16 @@ func (s *Server) Start() error {
 		"env_vars": s.config.EnvVars,
 	})
 
-	// For now, start HTTP server. In production, this should be HTTPS
+	if s.config.TLSEnabled() {
+		return s.httpSrv.ListenAndServeTLS(s.config.TLSCertFile, s.config.TLSKeyFile)
+	}
+	// Without a certificate, TLS is expected to be terminated by a reverse proxy
 	return s.httpSrv.ListenAndServe()
 }
 
-// Stop gracefully stops the server
+// Stop gracefully stops the server: new requests are refused with a 503
+// while in-flight ones finish
 func (s *Server) Stop(ctx context.Context) error {
+	s.shuttingDown.Store(true)
 	return s.httpSrv.Shutdown(ctx)
 }
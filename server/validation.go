@@ -1,15 +1,21 @@
 package server
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"net/url"
+	"sort"
 	"strings"
+	"unicode/utf8"
 
+	"ai-gateway/config"
 	"ai-gateway/types"
 )
 
-// validateChatRequest performs basic validation on chat completion requests
-func validateChatRequest(req *types.ChatRequest) error {
+// validateChatRequest performs basic validation on chat completion requests.
+// maxMessages rejects requests with more messages, 0 for no limit.
+func validateChatRequest(req *types.ChatRequest, maxMessages int) error {
 	// Extract messages from raw JSON
 	var temp struct {
 		Messages []types.Message `json:"messages"`
@@ -22,6 +28,9 @@ func validateChatRequest(req *types.ChatRequest) error {
 	if len(temp.Messages) == 0 {
 		return fmt.Errorf("messages array is required and cannot be empty")
 	}
+	if maxMessages > 0 && len(temp.Messages) > maxMessages {
+		return fmt.Errorf("too many messages: %d, at most %d are allowed", len(temp.Messages), maxMessages)
+	}
 
 	// Validate each message
 	for i, msg := range temp.Messages {
@@ -71,4 +80,313 @@ func validateChatRequest(req *types.ChatRequest) error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// promptChars counts the characters of message text in a chat request: string
+// content and the text of text blocks. Images, audio and files are not counted.
+func promptChars(raw json.RawMessage) int {
+	var temp struct {
+		Messages []types.Message `json:"messages"`
+	}
+	if err := json.Unmarshal(raw, &temp); err != nil {
+		return 0
+	}
+
+	chars := 0
+	for _, msg := range temp.Messages {
+		if blocks := msg.ContentAsArray(); blocks != nil {
+			for _, block := range blocks {
+				if blockMap, ok := block.(map[string]interface{}); ok {
+					if text, ok := blockMap["text"].(string); ok {
+						chars += utf8.RuneCountInString(text)
+					}
+				}
+			}
+			continue
+		}
+		chars += utf8.RuneCountInString(msg.ContentAsString())
+	}
+	return chars
+}
+
+// validateEmbeddingsRequest performs basic validation on embeddings requests
+func validateEmbeddingsRequest(req *types.EmbeddingsRequest) error {
+	if strings.TrimSpace(req.Model) == "" {
+		return fmt.Errorf("model is required")
+	}
+
+	var temp struct {
+		Input json.RawMessage `json:"input"`
+	}
+	if err := json.Unmarshal(req.Raw, &temp); err != nil {
+		return fmt.Errorf("failed to parse input: %w", err)
+	}
+	if len(temp.Input) == 0 || string(temp.Input) == "null" {
+		return fmt.Errorf("input is required")
+	}
+
+	return nil
+}
+
+// validateCompletionRequest performs basic validation on legacy text completion requests
+func validateCompletionRequest(req *types.CompletionRequest) error {
+	if strings.TrimSpace(req.Model) == "" {
+		return fmt.Errorf("model is required")
+	}
+
+	var temp struct {
+		Prompt json.RawMessage `json:"prompt"`
+		Stream bool            `json:"stream"`
+	}
+	if err := json.Unmarshal(req.Raw, &temp); err != nil {
+		return fmt.Errorf("failed to parse prompt: %w", err)
+	}
+	if temp.Stream {
+		return fmt.Errorf("streaming is not supported for text completions")
+	}
+	if len(temp.Prompt) == 0 || string(temp.Prompt) == "null" {
+		return fmt.Errorf("prompt is required")
+	}
+
+	// The prompt may be a string, an array of strings or token arrays
+	var prompt interface{}
+	if err := json.Unmarshal(temp.Prompt, &prompt); err != nil {
+		return fmt.Errorf("failed to parse prompt: %w", err)
+	}
+	switch p := prompt.(type) {
+	case string:
+		if strings.TrimSpace(p) == "" {
+			return fmt.Errorf("prompt cannot be empty")
+		}
+	case []interface{}:
+		if len(p) == 0 {
+			return fmt.Errorf("prompt cannot be empty")
+		}
+	default:
+		return fmt.Errorf("prompt must be a string or an array")
+	}
+
+	return nil
+}
+
+// validateParamLimits checks the request's numeric parameters against the
+// configured ranges. Parameters that are absent or null are not checked.
+func validateParamLimits(raw json.RawMessage, limits config.ParamLimits) error {
+	if len(limits) == 0 {
+		return nil
+	}
+
+	var params map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return fmt.Errorf("failed to parse request: %w", err)
+	}
+
+	// Check in a stable order so the reported error is deterministic
+	names := make([]string, 0, len(limits))
+	for name := range limits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value, ok := params[name]
+		if !ok || string(value) == "null" {
+			continue
+		}
+		var number float64
+		if err := json.Unmarshal(value, &number); err != nil {
+			return fmt.Errorf("%s must be a number", name)
+		}
+		limit := limits[name]
+		if limit.Min != nil && number < *limit.Min {
+			return fmt.Errorf("%s must be at least %g, got %g", name, *limit.Min, number)
+		}
+		if limit.Max != nil && number > *limit.Max {
+			return fmt.Errorf("%s must be at most %g, got %g", name, *limit.Max, number)
+		}
+	}
+	return nil
+}
+
+// validateTools checks that each tool has a type and, for function tools, a
+// function name, and that tool_choice names one of the defined functions
+func validateTools(raw json.RawMessage) error {
+	var temp struct {
+		Tools []struct {
+			Type     string `json:"type"`
+			Function *struct {
+				Name string `json:"name"`
+			} `json:"function"`
+		} `json:"tools"`
+		ToolChoice json.RawMessage `json:"tool_choice"`
+	}
+	if err := json.Unmarshal(raw, &temp); err != nil {
+		return fmt.Errorf("failed to parse tools: %w", err)
+	}
+
+	names := make(map[string]bool)
+	for i, tool := range temp.Tools {
+		if strings.TrimSpace(tool.Type) == "" {
+			return fmt.Errorf("tools[%d]: type is required", i)
+		}
+		if tool.Type != "function" {
+			continue
+		}
+		if tool.Function == nil || strings.TrimSpace(tool.Function.Name) == "" {
+			return fmt.Errorf("tools[%d]: function.name is required", i)
+		}
+		names[tool.Function.Name] = true
+	}
+
+	if len(temp.ToolChoice) == 0 || string(temp.ToolChoice) == "null" {
+		return nil
+	}
+
+	// tool_choice is either "none", "auto", "required" or a specific function
+	var mode string
+	if err := json.Unmarshal(temp.ToolChoice, &mode); err == nil {
+		switch mode {
+		case "none", "auto":
+			return nil
+		case "required":
+			if len(temp.Tools) == 0 {
+				return fmt.Errorf("tool_choice: 'required' needs at least one tool")
+			}
+			return nil
+		}
+		return fmt.Errorf("tool_choice: must be 'none', 'auto', 'required' or a function, got '%s'", mode)
+	}
+
+	var choice struct {
+		Type     string `json:"type"`
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	}
+	if err := json.Unmarshal(temp.ToolChoice, &choice); err != nil {
+		return fmt.Errorf("tool_choice: must be a string or an object")
+	}
+	if choice.Type == "function" && !names[choice.Function.Name] {
+		return fmt.Errorf("tool_choice: function '%s' is not defined in tools", choice.Function.Name)
+	}
+	return nil
+}
+
+// maxStopSequences is the most stop sequences OpenAI accepts in one request
+const maxStopSequences = 4
+
+// validateStop checks that stop, when present, is a string or an array of at
+// most maxStopSequences strings
+func validateStop(raw json.RawMessage) error {
+	var temp struct {
+		Stop json.RawMessage `json:"stop"`
+	}
+	if err := json.Unmarshal(raw, &temp); err != nil {
+		return fmt.Errorf("failed to parse stop: %w", err)
+	}
+	if len(temp.Stop) == 0 || string(temp.Stop) == "null" {
+		return nil
+	}
+
+	var sequence string
+	if err := json.Unmarshal(temp.Stop, &sequence); err == nil {
+		return nil
+	}
+	var sequences []json.RawMessage
+	if err := json.Unmarshal(temp.Stop, &sequences); err != nil {
+		return fmt.Errorf("stop: must be a string or an array of strings")
+	}
+	if len(sequences) > maxStopSequences {
+		return fmt.Errorf("stop: at most %d sequences are allowed, got %d", maxStopSequences, len(sequences))
+	}
+	for i, item := range sequences {
+		if err := json.Unmarshal(item, &sequence); err != nil {
+			return fmt.Errorf("stop[%d]: must be a string, got %s", i, item)
+		}
+	}
+	return nil
+}
+
+// contentBlockTypes are the message content block types accepted by validateContentBlocks
+var contentBlockTypes = map[string]bool{
+	"text":        true,
+	"image_url":   true,
+	"input_audio": true,
+	"file":        true,
+	"refusal":     true,
+}
+
+// validateContentBlocks checks array message content: every block needs a known
+// type, text blocks need text, and image_url blocks need an https or base64
+// data: URL. Inline images larger than maxImageBytes (when positive) are rejected.
+func validateContentBlocks(raw json.RawMessage, maxImageBytes int64) error {
+	var temp struct {
+		Messages []types.Message `json:"messages"`
+	}
+	if err := json.Unmarshal(raw, &temp); err != nil {
+		return fmt.Errorf("failed to parse messages: %w", err)
+	}
+
+	for i, msg := range temp.Messages {
+		if !msg.IsContentArray() {
+			continue
+		}
+		var blocks []struct {
+			Type     string  `json:"type"`
+			Text     *string `json:"text"`
+			ImageURL *struct {
+				URL string `json:"url"`
+			} `json:"image_url"`
+		}
+		if err := json.Unmarshal(msg.Content, &blocks); err != nil {
+			return fmt.Errorf("message[%d]: content blocks must be objects", i)
+		}
+		for j, block := range blocks {
+			if !contentBlockTypes[block.Type] {
+				return fmt.Errorf("message[%d].content[%d]: unknown type '%s'", i, j, block.Type)
+			}
+			switch block.Type {
+			case "text":
+				if block.Text == nil {
+					return fmt.Errorf("message[%d].content[%d]: text is required", i, j)
+				}
+			case "image_url":
+				if block.ImageURL == nil {
+					return fmt.Errorf("message[%d].content[%d]: image_url.url is required", i, j)
+				}
+				if err := validateImageURL(block.ImageURL.URL, maxImageBytes); err != nil {
+					return fmt.Errorf("message[%d].content[%d]: image_url.url %w", i, j, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// validateImageURL accepts an https URL or a base64 data: URL within maxBytes
+func validateImageURL(rawURL string, maxBytes int64) error {
+	if data, ok := strings.CutPrefix(rawURL, "data:"); ok {
+		mediaType, payload, found := strings.Cut(data, ",")
+		if !found || !strings.HasSuffix(mediaType, ";base64") {
+			return fmt.Errorf("must be a base64 data URL")
+		}
+		if !strings.HasPrefix(mediaType, "image/") {
+			return fmt.Errorf("must have an image media type, got '%s'", strings.TrimSuffix(mediaType, ";base64"))
+		}
+		// Check the size before decoding so oversized images aren't copied again
+		size := int64(base64.StdEncoding.DecodedLen(len(payload)) - (len(payload) - len(strings.TrimRight(payload, "="))))
+		if maxBytes > 0 && size > maxBytes {
+			return fmt.Errorf("inline image of %d bytes exceeds the limit of %d bytes", size, maxBytes)
+		}
+		if _, err := base64.StdEncoding.DecodeString(payload); err != nil {
+			return fmt.Errorf("contains invalid base64 data")
+		}
+		return nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("must be an https URL or a base64 data URL")
+	}
+	return nil
+}
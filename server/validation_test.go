@@ -3,14 +3,16 @@ package server
 import (
 	"testing"
 
+	"ai-gateway/config"
 	"ai-gateway/types"
 )
 
 func TestValidateChatRequest(t *testing.T) {
 	tests := []struct {
-		name     string
-		jsonData string
-		wantErr  bool
+		name        string
+		jsonData    string
+		maxMessages int
+		wantErr     bool
 	}{
 		{
 			name:     "valid request",
@@ -47,6 +49,18 @@ func TestValidateChatRequest(t *testing.T) {
 			jsonData: `{"model":"gpt-4","messages":[{"role":"invalid","content":"Hello"}]}`,
 			wantErr:  true,
 		},
+		{
+			name:        "messages within max_messages",
+			jsonData:    `{"model":"gpt-4","messages":[{"role":"system","content":"Be brief"},{"role":"user","content":"Hello"}]}`,
+			maxMessages: 2,
+			wantErr:     false,
+		},
+		{
+			name:        "too many messages",
+			jsonData:    `{"model":"gpt-4","messages":[{"role":"system","content":"Be brief"},{"role":"user","content":"Hello"},{"role":"user","content":"Hi"}]}`,
+			maxMessages: 2,
+			wantErr:     true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -56,10 +70,346 @@ func TestValidateChatRequest(t *testing.T) {
 				t.Fatalf("Failed to unmarshal test data: %v", err)
 			}
 
-			err := validateChatRequest(&request)
+			err := validateChatRequest(&request, tt.maxMessages)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("validateChatRequest() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestValidateEmbeddingsRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		jsonData string
+		wantErr  bool
+	}{
+		{
+			name:     "string input",
+			jsonData: `{"model":"embed","input":"Hello"}`,
+			wantErr:  false,
+		},
+		{
+			name:     "array input",
+			jsonData: `{"model":"embed","input":["Hello","World"]}`,
+			wantErr:  false,
+		},
+		{
+			name:     "missing model",
+			jsonData: `{"input":"Hello"}`,
+			wantErr:  true,
+		},
+		{
+			name:     "missing input",
+			jsonData: `{"model":"embed"}`,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request types.EmbeddingsRequest
+			if err := request.UnmarshalJSON([]byte(tt.jsonData)); err != nil {
+				t.Fatalf("Failed to unmarshal test data: %v", err)
+			}
+
+			err := validateEmbeddingsRequest(&request)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateEmbeddingsRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateCompletionRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		jsonData string
+		wantErr  bool
+	}{
+		{
+			name:     "string prompt",
+			jsonData: `{"model":"text","prompt":"Say hello"}`,
+			wantErr:  false,
+		},
+		{
+			name:     "array prompt",
+			jsonData: `{"model":"text","prompt":["Say hello","Say bye"]}`,
+			wantErr:  false,
+		},
+		{
+			name:     "missing prompt",
+			jsonData: `{"model":"text"}`,
+			wantErr:  true,
+		},
+		{
+			name:     "empty prompt",
+			jsonData: `{"model":"text","prompt":"  "}`,
+			wantErr:  true,
+		},
+		{
+			name:     "missing model",
+			jsonData: `{"prompt":"Say hello"}`,
+			wantErr:  true,
+		},
+		{
+			name:     "streaming",
+			jsonData: `{"model":"text","prompt":"Say hello","stream":true}`,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request types.CompletionRequest
+			if err := request.UnmarshalJSON([]byte(tt.jsonData)); err != nil {
+				t.Fatalf("Failed to unmarshal test data: %v", err)
+			}
+
+			err := validateCompletionRequest(&request)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateCompletionRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateParamLimits(t *testing.T) {
+	zero, one, two, maxTokens := 0.0, 1.0, 2.0, 4096.0
+	limits := config.ParamLimits{
+		"temperature": {Min: &zero, Max: &two},
+		"max_tokens":  {Min: &one, Max: &maxTokens},
+		"n":           {Max: &one},
+	}
+
+	tests := []struct {
+		name     string
+		jsonData string
+		wantErr  bool
+	}{
+		{
+			name:     "within limits",
+			jsonData: `{"model":"m","temperature":0.7,"max_tokens":100,"n":1}`,
+			wantErr:  false,
+		},
+		{
+			name:     "params absent",
+			jsonData: `{"model":"m","top_k":50}`,
+			wantErr:  false,
+		},
+		{
+			name:     "null param",
+			jsonData: `{"model":"m","temperature":null}`,
+			wantErr:  false,
+		},
+		{
+			name:     "temperature too high",
+			jsonData: `{"model":"m","temperature":5.0}`,
+			wantErr:  true,
+		},
+		{
+			name:     "negative max_tokens",
+			jsonData: `{"model":"m","max_tokens":-1}`,
+			wantErr:  true,
+		},
+		{
+			name:     "n above cap",
+			jsonData: `{"model":"m","n":3}`,
+			wantErr:  true,
+		},
+		{
+			name:     "non-numeric value",
+			jsonData: `{"model":"m","temperature":"hot"}`,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateParamLimits([]byte(tt.jsonData), limits)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateParamLimits() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := validateParamLimits([]byte(`{"temperature":9}`), nil); err != nil {
+		t.Errorf("expected no validation without configured limits, got %v", err)
+	}
+}
+
+func TestValidateTools(t *testing.T) {
+	const weather = `{"type":"function","function":{"name":"get_weather","parameters":{"type":"object"}}}`
+
+	tests := []struct {
+		name     string
+		jsonData string
+		wantErr  string
+	}{
+		{
+			name:     "valid tools and choice",
+			jsonData: `{"tools":[` + weather + `],"tool_choice":{"type":"function","function":{"name":"get_weather"}}}`,
+		},
+		{
+			name:     "auto choice",
+			jsonData: `{"tools":[` + weather + `],"tool_choice":"auto"}`,
+		},
+		{
+			name:     "no tools",
+			jsonData: `{"messages":[]}`,
+		},
+		{
+			name:     "missing type",
+			jsonData: `{"tools":[` + weather + `,{"function":{"name":"x"}}]}`,
+			wantErr:  "tools[1]: type is required",
+		},
+		{
+			name:     "missing function name",
+			jsonData: `{"tools":[{"type":"function","function":{"parameters":{}}}]}`,
+			wantErr:  "tools[0]: function.name is required",
+		},
+		{
+			name:     "choice references unknown tool",
+			jsonData: `{"tools":[` + weather + `],"tool_choice":{"type":"function","function":{"name":"get_time"}}}`,
+			wantErr:  "tool_choice: function 'get_time' is not defined in tools",
+		},
+		{
+			name:     "required without tools",
+			jsonData: `{"tool_choice":"required"}`,
+			wantErr:  "tool_choice: 'required' needs at least one tool",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTools([]byte(tt.jsonData))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateTools() unexpected error = %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("validateTools() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateStop(t *testing.T) {
+	tests := []struct {
+		name     string
+		jsonData string
+		wantErr  string
+	}{
+		{name: "no stop", jsonData: `{"messages":[]}`},
+		{name: "null stop", jsonData: `{"stop":null}`},
+		{name: "string stop", jsonData: `{"stop":"END"}`},
+		{name: "four sequences", jsonData: `{"stop":["a","b","c","d"]}`},
+		{
+			name:     "too many sequences",
+			jsonData: `{"stop":["a","b","c","d","e"]}`,
+			wantErr:  "stop: at most 4 sequences are allowed, got 5",
+		},
+		{
+			name:     "non-string sequence",
+			jsonData: `{"stop":["a",1]}`,
+			wantErr:  "stop[1]: must be a string, got 1",
+		},
+		{
+			name:     "object stop",
+			jsonData: `{"stop":{"text":"END"}}`,
+			wantErr:  "stop: must be a string or an array of strings",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateStop([]byte(tt.jsonData))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateStop() unexpected error = %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("validateStop() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateContentBlocks(t *testing.T) {
+	// 16 bytes of image data
+	const image = `data:image/png;base64,iVBORw0KGgoAAAANSUhEUg==`
+	message := func(blocks string) string {
+		return `{"messages":[{"role":"system","content":"Describe images"},{"role":"user","content":[` + blocks + `]}]}`
+	}
+
+	tests := []struct {
+		name     string
+		jsonData string
+		maxBytes int64
+		wantErr  string
+	}{
+		{
+			name:     "text and inline image",
+			jsonData: message(`{"type":"text","text":"What is this?"},{"type":"image_url","image_url":{"url":"` + image + `"}}`),
+			maxBytes: 16,
+		},
+		{
+			name:     "https image",
+			jsonData: message(`{"type":"image_url","image_url":{"url":"https://example.com/cat.png","detail":"low"}}`),
+		},
+		{
+			name:     "unknown type",
+			jsonData: message(`{"type":"video","video":{}}`),
+			wantErr:  "message[1].content[0]: unknown type 'video'",
+		},
+		{
+			name:     "text block without text",
+			jsonData: message(`{"type":"text"}`),
+			wantErr:  "message[1].content[0]: text is required",
+		},
+		{
+			name:     "missing image_url",
+			jsonData: message(`{"type":"image_url"}`),
+			wantErr:  "message[1].content[0]: image_url.url is required",
+		},
+		{
+			name:     "http image",
+			jsonData: message(`{"type":"image_url","image_url":{"url":"http://example.com/cat.png"}}`),
+			wantErr:  "message[1].content[0]: image_url.url must be an https URL or a base64 data URL",
+		},
+		{
+			name:     "malformed base64",
+			jsonData: message(`{"type":"image_url","image_url":{"url":"data:image/png;base64,not*base64"}}`),
+			wantErr:  "message[1].content[0]: image_url.url contains invalid base64 data",
+		},
+		{
+			name:     "non-image data URL",
+			jsonData: message(`{"type":"image_url","image_url":{"url":"data:text/plain;base64,aGk="}}`),
+			wantErr:  "message[1].content[0]: image_url.url must have an image media type, got 'text/plain'",
+		},
+		{
+			name:     "oversized image",
+			jsonData: message(`{"type":"text","text":"Hi"},{"type":"image_url","image_url":{"url":"` + image + `"}}`),
+			maxBytes: 8,
+			wantErr:  "message[1].content[1]: image_url.url inline image of 16 bytes exceeds the limit of 8 bytes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateContentBlocks([]byte(tt.jsonData), tt.maxBytes)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateContentBlocks() unexpected error = %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("validateContentBlocks() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -5,19 +5,27 @@ import (
 	"encoding/base64"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.opentelemetry.io/otel/trace"
 )
 
+// propagator carries the trace context to providers in W3C traceparent and
+// tracestate headers, along with any baggage
+var propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
 var (
 	provider     *sdktrace.TracerProvider
 	providerOnce sync.Once
@@ -45,6 +53,12 @@ func Init(ctx context.Context) (func(context.Context) error, error) {
 			serviceName = "ai-gateway"
 		}
 
+		sampler, samplerName, err := traceSampler()
+		if err != nil {
+			initErr = err
+			return
+		}
+
 		var tp *sdktrace.TracerProvider
 		if endpoint == "" || apiKey == "" {
 			tp = sdktrace.NewTracerProvider()
@@ -61,20 +75,26 @@ func Init(ctx context.Context) (func(context.Context) error, error) {
 				_ = exporter.Shutdown(ctx)
 				return
 			}
-			tp = sdktrace.NewTracerProvider(
+			opts := []sdktrace.TracerProviderOption{
 				sdktrace.WithBatcher(exporter),
 				sdktrace.WithResource(res),
-			)
+			}
+			if sampler != nil {
+				opts = append(opts, sdktrace.WithSampler(sampler))
+			}
+			tp = sdktrace.NewTracerProvider(opts...)
 		}
 
 		provider = tp
 		otel.SetTracerProvider(tp)
+		otel.SetTextMapPropagator(propagator)
 		initialized = true
 		shutdown = func(stopCtx context.Context) error {
 			return tp.Shutdown(stopCtx)
 		}
 		if endpoint != "" && apiKey != "" {
-			log.Printf("Telemetry initialized: endpoint=%s service=%s", endpoint, serviceName)
+			protocol, _ := exporterProtocol()
+			log.Printf("Telemetry initialized: endpoint=%s protocol=%s service=%s sampler=%s", endpoint, protocol, serviceName, samplerName)
 		}
 	})
 
@@ -89,6 +109,13 @@ func Tracer(name string) trace.Tracer {
 	return otel.Tracer(name)
 }
 
+// InjectTraceContext adds the trace context of the span in ctx to outbound
+// request headers, so instrumented upstreams continue the same trace. Nothing
+// is added when ctx has no valid span.
+func InjectTraceContext(ctx context.Context, header http.Header) {
+	propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
+
 // RecordLog writes log events as OTLP span events to ensure they reach the exporter.
 func RecordLog(ctx context.Context, level, message string, fields map[string]interface{}) {
 	tracer := Tracer("logger")
@@ -118,7 +145,74 @@ func RecordLog(ctx context.Context, level, message string, fields map[string]int
 	span.End()
 }
 
+// traceSampler returns the sampler for OTLP_SAMPLE_RATIO, which keeps that
+// fraction of new traces and follows the parent's decision for the rest.
+// Without it the sampler is nil and the SDK default applies: OTEL_TRACES_SAMPLER
+// when set, otherwise every trace is sampled. The name describes the effective
+// sampling for the startup log.
+func traceSampler() (sdktrace.Sampler, string, error) {
+	raw := strings.TrimSpace(os.Getenv("OTLP_SAMPLE_RATIO"))
+	if raw == "" {
+		if name := strings.TrimSpace(os.Getenv("OTEL_TRACES_SAMPLER")); name != "" {
+			if arg := strings.TrimSpace(os.Getenv("OTEL_TRACES_SAMPLER_ARG")); arg != "" {
+				return nil, fmt.Sprintf("%s(%s)", name, arg), nil
+			}
+			return nil, name, nil
+		}
+		return nil, "parentbased_always_on", nil
+	}
+	ratio, err := strconv.ParseFloat(raw, 64)
+	if err != nil || ratio < 0 || ratio > 1 {
+		return nil, "", fmt.Errorf("OTLP_SAMPLE_RATIO must be a number between 0 and 1, got '%s'", raw)
+	}
+	return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio)), fmt.Sprintf("parentbased_traceidratio(%g)", ratio), nil
+}
+
+// OTLP exporter protocols selected with OTLP_PROTOCOL
+const (
+	protocolHTTP = "http"
+	protocolGRPC = "grpc"
+)
+
+// exporterProtocol returns the OTLP_PROTOCOL setting, defaulting to http
+func exporterProtocol() (string, error) {
+	protocol := strings.ToLower(strings.TrimSpace(os.Getenv("OTLP_PROTOCOL")))
+	switch protocol {
+	case "":
+		return protocolHTTP, nil
+	case protocolHTTP, protocolGRPC:
+		return protocol, nil
+	}
+	return "", fmt.Errorf("OTLP_PROTOCOL must be 'http' or 'grpc', got '%s'", protocol)
+}
+
 func newTraceExporter(ctx context.Context, endpoint, apiKey string) (*otlptrace.Exporter, error) {
+	protocol, err := exporterProtocol()
+	if err != nil {
+		return nil, err
+	}
+	headers := exporterHeaders(apiKey)
+	if protocol == protocolGRPC {
+		addr, opts := normalizeGRPCEndpoint(endpoint)
+		opts = append(opts,
+			otlptracegrpc.WithEndpoint(addr),
+			otlptracegrpc.WithHeaders(headers),
+		)
+		return otlptracegrpc.New(ctx, opts...)
+	}
+
+	addr, opts := normalizeEndpoint(endpoint)
+	opts = append(opts,
+		otlptracehttp.WithEndpoint(addr),
+		otlptracehttp.WithHeaders(headers),
+	)
+
+	return otlptracehttp.New(ctx, opts...)
+}
+
+// exporterHeaders builds the auth header from the API key plus any OTLP_HEADERS.
+// gRPC sends them as metadata, which lowercases the names.
+func exporterHeaders(apiKey string) map[string]string {
 	// For Grafana Cloud, the API key might be a "glc_" prefixed token.
 	// Grafana Cloud OTLP HTTP requires Basic auth with InstanceID as username and API Key as password.
 	// We'll try to extract the InstanceID from the glc_ token (which contains base64 encoded JSON).
@@ -159,26 +253,27 @@ func newTraceExporter(ctx context.Context, endpoint, apiKey string) (*otlptrace.
 			headers[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
 		}
 	}
+	return headers
+}
 
-	addr, opts := normalizeEndpoint(endpoint)
-	opts = append(opts,
-		otlptracehttp.WithEndpoint(addr),
-		otlptracehttp.WithHeaders(headers),
-	)
-
-	return otlptracehttp.New(ctx, opts...)
+// splitScheme removes an http:// or https:// prefix from the endpoint and
+// reports whether the connection should skip TLS. TLS is the default.
+func splitScheme(raw string) (string, bool) {
+	if strings.HasPrefix(raw, "https://") {
+		return strings.TrimPrefix(raw, "https://"), false
+	}
+	if strings.HasPrefix(raw, "http://") {
+		return strings.TrimPrefix(raw, "http://"), true
+	}
+	return raw, false
 }
 
 func normalizeEndpoint(raw string) (string, []otlptracehttp.Option) {
 	opts := make([]otlptracehttp.Option, 0, 2)
-	address := raw
 
 	// Handle protocol
-	if strings.HasPrefix(raw, "https://") {
-		address = strings.TrimPrefix(raw, "https://")
-		// TLS is default for https://
-	} else if strings.HasPrefix(raw, "http://") {
-		address = strings.TrimPrefix(raw, "http://")
+	address, insecure := splitScheme(raw)
+	if insecure {
 		opts = append(opts, otlptracehttp.WithInsecure())
 	}
 
@@ -196,6 +291,18 @@ func normalizeEndpoint(raw string) (string, []otlptracehttp.Option) {
 	return address, opts
 }
 
+// normalizeGRPCEndpoint handles the scheme like normalizeEndpoint. gRPC
+// endpoints are host:port only, so any path is dropped.
+func normalizeGRPCEndpoint(raw string) (string, []otlptracegrpc.Option) {
+	var opts []otlptracegrpc.Option
+	address, insecure := splitScheme(raw)
+	if insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	address, _, _ = strings.Cut(address, "/")
+	return address, opts
+}
+
 func buildResource(serviceName string) (*resource.Resource, error) {
 	attrs := []attribute.KeyValue{
 		attribute.String("service.name", serviceName),
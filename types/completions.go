@@ -0,0 +1,78 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// CompletionRequest represents a legacy OpenAI text completion request
+// Stores raw JSON and allows model replacement only
+type CompletionRequest struct {
+	Raw     json.RawMessage // Complete raw JSON from client
+	Model   string          // Extracted model for routing/logging
+	Headers http.Header     // Incoming client headers, used for forward_headers
+}
+
+// UnmarshalJSON stores the raw JSON and extracts the model
+func (r *CompletionRequest) UnmarshalJSON(data []byte) error {
+	r.Raw = make(json.RawMessage, len(data))
+	copy(r.Raw, data)
+
+	var temp struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(data, &temp); err != nil {
+		return err
+	}
+	r.Model = temp.Model
+	return nil
+}
+
+// MarshalJSON replaces only the model field in the raw JSON
+func (r CompletionRequest) MarshalJSON() ([]byte, error) {
+	if r.Raw == nil {
+		return nil, fmt.Errorf("no raw JSON to marshal")
+	}
+
+	var temp map[string]interface{}
+	if err := json.Unmarshal(r.Raw, &temp); err != nil {
+		return nil, err
+	}
+	temp["model"] = r.Model
+	return json.Marshal(temp)
+}
+
+// CompletionResponse represents a legacy OpenAI text completion response
+// Stores raw JSON to pass responses through unchanged
+type CompletionResponse struct {
+	Raw json.RawMessage // Complete raw JSON response from provider
+
+	// Extracted fields for logging/processing
+	Usage Usage `json:"-"`
+
+	Provider string `json:"-"` // provider that served the response
+}
+
+// UnmarshalJSON stores the raw JSON response and extracts token usage
+func (r *CompletionResponse) UnmarshalJSON(data []byte) error {
+	r.Raw = make(json.RawMessage, len(data))
+	copy(r.Raw, data)
+
+	var temp struct {
+		Usage Usage `json:"usage"`
+	}
+	if err := json.Unmarshal(data, &temp); err != nil {
+		return err
+	}
+	r.Usage = temp.Usage
+	return nil
+}
+
+// MarshalJSON returns the raw JSON unchanged
+func (r CompletionResponse) MarshalJSON() ([]byte, error) {
+	if r.Raw == nil {
+		return nil, fmt.Errorf("no raw JSON to marshal")
+	}
+	return r.Raw, nil
+}
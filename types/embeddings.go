@@ -0,0 +1,81 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// EmbeddingsRequest represents an OpenAI-compatible embeddings request
+// Stores raw JSON and allows model replacement only
+type EmbeddingsRequest struct {
+	Raw     json.RawMessage // Complete raw JSON from client
+	Model   string          // Extracted model for routing/logging
+	Headers http.Header     // Incoming client headers, used for forward_headers
+}
+
+// UnmarshalJSON stores the raw JSON and extracts the model
+func (r *EmbeddingsRequest) UnmarshalJSON(data []byte) error {
+	r.Raw = make(json.RawMessage, len(data))
+	copy(r.Raw, data)
+
+	var temp struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(data, &temp); err != nil {
+		return err
+	}
+	r.Model = temp.Model
+	return nil
+}
+
+// MarshalJSON replaces only the model field in the raw JSON
+func (r EmbeddingsRequest) MarshalJSON() ([]byte, error) {
+	if r.Raw == nil {
+		return nil, fmt.Errorf("no raw JSON to marshal")
+	}
+
+	var temp map[string]interface{}
+	if err := json.Unmarshal(r.Raw, &temp); err != nil {
+		return nil, err
+	}
+	temp["model"] = r.Model
+	return json.Marshal(temp)
+}
+
+// EmbeddingsResponse represents an OpenAI-compatible embeddings response
+// Stores raw JSON to pass responses through unchanged
+type EmbeddingsResponse struct {
+	Raw json.RawMessage // Complete raw JSON response from provider
+
+	// Extracted fields for logging/processing
+	Usage Usage `json:"-"`
+
+	Provider string `json:"-"` // provider that served the response
+}
+
+// UnmarshalJSON stores the raw JSON response and extracts token usage
+func (r *EmbeddingsResponse) UnmarshalJSON(data []byte) error {
+	if !json.Valid(data) {
+		return fmt.Errorf("invalid JSON in embeddings response")
+	}
+	r.Raw = make(json.RawMessage, len(data))
+	copy(r.Raw, data)
+
+	var temp struct {
+		Usage Usage `json:"usage"`
+	}
+	if err := json.Unmarshal(data, &temp); err != nil {
+		return err
+	}
+	r.Usage = temp.Usage
+	return nil
+}
+
+// MarshalJSON returns the raw JSON unchanged
+func (r EmbeddingsResponse) MarshalJSON() ([]byte, error) {
+	if r.Raw == nil {
+		return nil, fmt.Errorf("no raw JSON to marshal")
+	}
+	return r.Raw, nil
+}
@@ -3,6 +3,7 @@ package types
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 
 	"ai-gateway/config"
 )
@@ -20,18 +21,32 @@ type ErrorDetails struct {
 	Details interface{} `json:"details,omitempty"`
 }
 
-// RouteError represents a detailed error when all route steps fail
+// RouteError represents a detailed error when all route steps fail, or when
+// the route's fallback_on stopped it at a step error that does not fall back
 type RouteError struct {
-	Route  config.Route      `json:"route"`
-	Errors []RouteStepError  `json:"errors"`
+	Route           config.Route     `json:"route"`
+	Errors          []RouteStepError `json:"errors"`
+	FallbackStopped bool             `json:"fallback_stopped,omitempty"`
 }
 
 // RouteStepError represents an error from a specific route step
 type RouteStepError struct {
-	StepIndex  int    `json:"step_index"`
-	Provider   string `json:"provider"`
-	Model      string `json:"model"`
-	Error      string `json:"error"`
+	StepIndex  int            `json:"step_index"`
+	Provider   string         `json:"provider"`
+	Model      string         `json:"model"`
+	Error      string         `json:"error"`
+	StatusCode int            `json:"status_code,omitempty"`    // upstream HTTP status, 0 if no response
+	DurationMs int64          `json:"duration_ms"`              // time spent on the step including retries, 0 if skipped
+	Upstream   *UpstreamError `json:"upstream_error,omitempty"` // parsed upstream error body
+	NoFallback bool           `json:"-"`                        // the route's fallback_on does not cover this error
+}
+
+// UpstreamError holds the fields of an OpenAI-style error returned by a provider
+type UpstreamError struct {
+	Message string `json:"message"`
+	Type    string `json:"type,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Param   string `json:"param,omitempty"`
 }
 
 // Error implements the error interface for RouteError
@@ -40,10 +55,46 @@ func (e RouteError) Error() string {
 		return fmt.Sprintf("all route steps failed for model '%s'", e.Route.Name)
 	}
 	lastErr := e.Errors[len(e.Errors)-1]
+	if e.FallbackStopped {
+		return fmt.Sprintf("route '%s' stopped without fallback, error from %s/%s: %s",
+			e.Route.Name, lastErr.Provider, lastErr.Model, lastErr.Error)
+	}
 	return fmt.Sprintf("all route steps failed for model '%s', last error from %s/%s: %s",
 		e.Route.Name, lastErr.Provider, lastErr.Model, lastErr.Error)
 }
 
+// routeSummary is the route as shown in error details. It keeps the same keys
+// whatever tags the config types carry, so clients parsing errors don't break.
+type routeSummary struct {
+	Name  string
+	Steps []routeStepSummary
+}
+
+type routeStepSummary struct {
+	Provider           string
+	Model              string
+	Timeout            string
+	ConflictResolution string
+}
+
+// MarshalJSON replaces the configured route with its summary
+func (e RouteError) MarshalJSON() ([]byte, error) {
+	route := routeSummary{Name: e.Route.Name, Steps: make([]routeStepSummary, len(e.Route.Steps))}
+	for i, step := range e.Route.Steps {
+		route.Steps[i] = routeStepSummary{
+			Provider:           step.Provider,
+			Model:              step.Model,
+			Timeout:            step.Timeout,
+			ConflictResolution: step.ConflictResolution,
+		}
+	}
+	return json.Marshal(struct {
+		Route           routeSummary     `json:"route"`
+		Errors          []RouteStepError `json:"errors"`
+		FallbackStopped bool             `json:"fallback_stopped,omitempty"`
+	}{route, e.Errors, e.FallbackStopped})
+}
+
 // truncateContent truncates content to first 100 characters
 func truncateContent(content string) string {
 	const maxLength = 100
@@ -222,23 +273,31 @@ func (r *ChatResponse) TruncateResponseForLogging() *ChatResponse {
 // ChatRequest represents an OpenAI-compatible chat completion request
 // Stores raw JSON and allows model replacement only
 type ChatRequest struct {
-	Raw   json.RawMessage // Complete raw JSON from client
-	Model string          // Extracted model for logging/validation
+	Raw     json.RawMessage // Complete raw JSON from client
+	Model   string          // Extracted model for logging/validation
+	User    string          // End-user identifier from the optional "user" field, for logging
+	Headers http.Header     // Incoming client headers, used for forward_headers
 }
 
-// UnmarshalJSON stores the raw JSON and extracts the model
+// UnmarshalJSON stores the raw JSON and extracts the model and user
 func (r *ChatRequest) UnmarshalJSON(data []byte) error {
 	r.Raw = make(json.RawMessage, len(data))
 	copy(r.Raw, data)
 
 	// Extract model for logging/validation
 	var temp struct {
-		Model string `json:"model"`
+		Model string          `json:"model"`
+		User  json.RawMessage `json:"user"`
 	}
 	if err := json.Unmarshal(data, &temp); err != nil {
 		return err
 	}
 	r.Model = temp.Model
+	// The user is only logged; a non-string value is left for the provider to reject
+	var user string
+	if len(temp.User) > 0 && json.Unmarshal(temp.User, &user) == nil {
+		r.User = user
+	}
 	return nil
 }
 
@@ -257,6 +316,17 @@ func (r ChatRequest) MarshalJSON() ([]byte, error) {
 	return json.Marshal(temp)
 }
 
+// IsStream reports whether the client asked for a server-sent events stream
+func (r *ChatRequest) IsStream() bool {
+	var temp struct {
+		Stream bool `json:"stream"`
+	}
+	if err := json.Unmarshal(r.Raw, &temp); err != nil {
+		return false
+	}
+	return temp.Stream
+}
+
 // Message represents a chat message
 type Message struct {
 	Role    string          `json:"role"`
@@ -303,6 +373,12 @@ type ChatResponse struct {
 	Model   string   `json:"-"`
 	Choices []Choice `json:"-"`
 	Usage   Usage    `json:"-"`
+
+	// Upstream response headers selected by the provider's response_headers
+	Headers http.Header `json:"-"`
+	// Provider is the name of the provider that served the response, empty
+	// for a route's fallback_response
+	Provider string `json:"-"`
 }
 
 // UnmarshalJSON stores raw JSON and extracts key fields for logging
@@ -361,8 +437,9 @@ type ModelsResponse struct {
 
 // Model represents a model in the models list
 type Model struct {
-	ID      string `json:"id"`
-	Object  string `json:"object"`
-	Created int64  `json:"created"`
-	OwnedBy string `json:"owned_by"`
+	ID       string                 `json:"id"`
+	Object   string                 `json:"object"`
+	Created  int64                  `json:"created"`
+	OwnedBy  string                 `json:"owned_by"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"` // capabilities configured on the route
 }
\ No newline at end of file
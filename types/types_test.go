@@ -3,6 +3,8 @@ package types
 import (
 	"encoding/json"
 	"testing"
+
+	"ai-gateway/config"
 )
 
 func TestChatRequest_ReplacesOnlyModel(t *testing.T) {
@@ -98,6 +100,30 @@ func TestChatRequest_ReplacesOnlyModel(t *testing.T) {
 	}
 }
 
+func TestChatRequest_User(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "present", body: `{"model":"m","user":"user-123"}`, want: "user-123"},
+		{name: "absent", body: `{"model":"m"}`, want: ""},
+		{name: "not a string", body: `{"model":"m","user":{"id":1}}`, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request ChatRequest
+			if err := json.Unmarshal([]byte(tt.body), &request); err != nil {
+				t.Fatalf("Failed to unmarshal: %v", err)
+			}
+			if request.User != tt.want {
+				t.Errorf("Expected user '%s', got '%s'", tt.want, request.User)
+			}
+		})
+	}
+}
+
 func TestChatRequest_TruncateRequestForLogging(t *testing.T) {
 	originalJSON := `{
 		"model": "gpt-4",
@@ -153,4 +179,22 @@ func TestChatRequest_TruncateRequestForLogging(t *testing.T) {
 	if model, ok := truncatedMap["model"].(string); !ok || model != "gpt-4" {
 		t.Errorf("Model not preserved: %v", truncatedMap["model"])
 	}
-}
\ No newline at end of file
+}
+func TestRouteError_MarshalJSON(t *testing.T) {
+	routeErr := RouteError{
+		Route: config.Route{Name: "chat", Strategy: "weighted", Steps: []config.RouteStep{
+			{Provider: "openai", Model: "gpt-4", Timeout: "10s", Retries: 2},
+		}},
+		Errors: []RouteStepError{{Provider: "openai", Model: "gpt-4", Error: "boom"}},
+	}
+	data, err := json.Marshal(routeErr)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	// The route keeps the keys error details have always had
+	want := `{"route":{"Name":"chat","Steps":[{"Provider":"openai","Model":"gpt-4","Timeout":"10s","ConflictResolution":""}]},`
+	if got := string(data); len(got) < len(want) || got[:len(want)] != want {
+		t.Errorf("Expected the route summary %s, got %s", want, got)
+	}
+}
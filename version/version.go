@@ -0,0 +1,44 @@
+// Package version identifies the gateway build
+package version
+
+import "runtime/debug"
+
+// Version is the gateway release, overridden at build time with
+// -ldflags "-X ai-gateway/version.Version=1.2.3". It is sent in the default
+// upstream User-Agent.
+var Version = "dev"
+
+// Commit and BuildDate describe the build, set with -X like Version. When
+// they are not, the VCS revision and commit time Go embeds in binaries built
+// from a git checkout are used.
+var (
+	Commit    = ""
+	BuildDate = ""
+)
+
+func init() {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	for _, setting := range info.Settings {
+		switch {
+		case setting.Key == "vcs.revision" && Commit == "":
+			Commit = setting.Value
+		case setting.Key == "vcs.time" && BuildDate == "":
+			BuildDate = setting.Value
+		}
+	}
+}
+
+// Info is the build description served by GET /version
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+}
+
+// Get returns the running build's Info
+func Get() Info {
+	return Info{Version: Version, Commit: Commit, BuildDate: BuildDate}
+}